@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	stdjson "encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,10 +11,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	pb "github.com/kacperborowieckb/gen-sql/shared/gen/proto"
 	"github.com/kacperborowieckb/gen-sql/utils/errors"
 	"github.com/kacperborowieckb/gen-sql/utils/json"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
@@ -33,6 +36,77 @@ func (s *apiServer) handleStartDataGeneration(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	var seed *int64
+	if seedStr := r.FormValue("seed"); seedStr != "" {
+		v, err := strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid seed: must be an integer: %w", err))
+			return
+		}
+		seed = &v
+	}
+
+	var tableRows map[string]int64
+	if v := r.FormValue("tableRows"); v != "" {
+		if err := decodeFormJSON(v, &tableRows); err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid tableRows: must be an object of table names to row counts: %w", err))
+			return
+		}
+	}
+
+	var columnLocales map[string]string
+	if v := r.FormValue("columnLocales"); v != "" {
+		if err := decodeFormJSON(v, &columnLocales); err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid columnLocales: must be an object of table.column names to locales: %w", err))
+			return
+		}
+	}
+
+	output := &pb.OutputOptions{}
+	if v := r.FormValue("batchSize"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid batchSize: must be an integer: %w", err))
+			return
+		}
+		output.BatchSize = int32(size)
+	}
+	if v := r.FormValue("transaction"); v != "" {
+		tx, err := strconv.ParseBool(v)
+		if err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid transaction: must be true or false: %w", err))
+			return
+		}
+		output.Transaction = tx
+	}
+	output.Format = r.FormValue("format")
+	if v := r.FormValue("perTableFiles"); v != "" {
+		split, err := strconv.ParseBool(v)
+		if err != nil {
+			errors.BadRequestResponse(w, r, fmt.Errorf("invalid perTableFiles: must be true or false: %w", err))
+			return
+		}
+		output.PerTableFiles = split
+	}
+	output.Archive = r.FormValue("archive")
+	if delimiter, quoting, header := r.FormValue("csvDelimiter"), r.FormValue("csvQuoting"), r.FormValue("csvHeader"); delimiter != "" || quoting != "" || header != "" {
+		output.Csv = &pb.CSVOptions{Delimiter: delimiter, Quoting: quoting}
+		if header != "" {
+			h, err := strconv.ParseBool(header)
+			if err != nil {
+				errors.BadRequestResponse(w, r, fmt.Errorf("invalid csvHeader: must be true or false: %w", err))
+				return
+			}
+			output.Csv.Header = &h
+		}
+	}
+
+	fanOut, err := parseFanOut(r.FormValue("fanOut"))
+	if err != nil {
+		errors.BadRequestResponse(w, r, fmt.Errorf("invalid fanOut: %w", err))
+		return
+	}
+
 	file, fileHeader, err := r.FormFile("ddlFile")
 	if err != nil {
 		errors.BadRequestResponse(w, r, fmt.Errorf("error retrieving 'ddlFile': %w", err))
@@ -69,6 +143,12 @@ func (s *apiServer) handleStartDataGeneration(w http.ResponseWriter, r *http.Req
 		DdlSchema:              ddlSchema,
 		GenerationInstructions: instructions,
 		MaxRows:                int32(maxRows),
+		Seed:                   seed,
+		TableRows:              tableRows,
+		FanOut:                 fanOut,
+		Locale:                 r.FormValue("locale"),
+		ColumnLocales:          columnLocales,
+		Output:                 output,
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
@@ -77,9 +157,13 @@ func (s *apiServer) handleStartDataGeneration(w http.ResponseWriter, r *http.Req
 	log.Printf("Sending StartDataGeneration gRPC request for new project %s", projectId)
 	resp, err := s.dataClient.StartDataGeneration(ctx, grpcReq)
 	if err != nil {
-		if grpcStatus, ok := status.FromError(err); ok {
+		grpcStatus, ok := status.FromError(err)
+		switch {
+		case ok && grpcStatus.Code() == codes.InvalidArgument:
+			errors.BadRequestResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok:
 			errors.InternalServerError(w, r, fmt.Errorf("gRPC error: [%s] %s", grpcStatus.Code(), grpcStatus.Message()))
-		} else {
+		default:
 			errors.InternalServerError(w, r, fmt.Errorf("failed to start data generation: %w", err))
 		}
 		return
@@ -91,6 +175,7 @@ func (s *apiServer) handleStartDataGeneration(w http.ResponseWriter, r *http.Req
 		"projectId":       projectId,
 		"generationJobId": resp.GenerationJobId,
 		"message":         resp.Message,
+		"seed":            strconv.FormatInt(resp.Seed, 10),
 	}
 
 	statusCode := http.StatusCreated
@@ -101,3 +186,175 @@ func (s *apiServer) handleStartDataGeneration(w http.ResponseWriter, r *http.Req
 
 	json.WriteJSON(w, statusCode, responsePayload)
 }
+
+// jobResponse is a generation job as GET /projects/{id}/jobs/{jobId}
+// returns it. Fields a job does not have yet are left out.
+type jobResponse struct {
+	ProjectID              string             `json:"projectId"`
+	GenerationJobID        string             `json:"generationJobId"`
+	Status                 string             `json:"status"`
+	GenerationInstructions string             `json:"generationInstructions,omitempty"`
+	Interpretation         stdjson.RawMessage `json:"interpretation,omitempty"`
+	Generators             []columnGenerator  `json:"generators,omitempty"`
+	Sandbox                *sandboxResponse   `json:"sandbox,omitempty"`
+	Error                  string             `json:"error,omitempty"`
+	Artifact               string             `json:"artifact,omitempty"`
+	RowCount               int64              `json:"rowCount,omitempty"`
+	CreatedAt              string             `json:"createdAt"`
+	StartedAt              string             `json:"startedAt,omitempty"`
+	FinishedAt             string             `json:"finishedAt,omitempty"`
+}
+
+// columnGenerator is the generator picked for a column of a job.
+type columnGenerator struct {
+	Table     string `json:"table"`
+	Column    string `json:"column"`
+	Generator string `json:"generator"`
+}
+
+// sandboxResponse is where a job loaded its dataset.
+type sandboxResponse struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
+	Schema   string `json:"schema"`
+	User     string `json:"user"`
+}
+
+func (s *apiServer) handleGetGenerationJob(w http.ResponseWriter, r *http.Request) {
+	projectId := chi.URLParam(r, "id")
+	jobId := chi.URLParam(r, "jobId")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	resp, err := s.dataClient.GetGenerationJob(ctx, &pb.GetGenerationJobRequest{
+		ProjectId:       projectId,
+		GenerationJobId: jobId,
+	})
+	if err != nil {
+		grpcStatus, ok := status.FromError(err)
+		switch {
+		case ok && grpcStatus.Code() == codes.InvalidArgument:
+			errors.BadRequestResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok && grpcStatus.Code() == codes.NotFound:
+			errors.NotFoundResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok:
+			errors.InternalServerError(w, r, fmt.Errorf("gRPC error: [%s] %s", grpcStatus.Code(), grpcStatus.Message()))
+		default:
+			errors.InternalServerError(w, r, fmt.Errorf("failed to get generation job: %w", err))
+		}
+		return
+	}
+
+	job := jobResponse{
+		ProjectID:              resp.ProjectId,
+		GenerationJobID:        resp.GenerationJobId,
+		Status:                 resp.Status,
+		GenerationInstructions: resp.GenerationInstructions,
+		Error:                  resp.Error,
+		Artifact:               resp.Artifact,
+		RowCount:               resp.RowCount,
+		CreatedAt:              resp.CreatedAt,
+		StartedAt:              resp.StartedAt,
+		FinishedAt:             resp.FinishedAt,
+	}
+	if resp.Interpretation != "" {
+		job.Interpretation = stdjson.RawMessage(resp.Interpretation)
+	}
+	for _, g := range resp.Generators {
+		job.Generators = append(job.Generators, columnGenerator{Table: g.Table, Column: g.Column, Generator: g.Generator})
+	}
+	if sb := resp.Sandbox; sb != nil {
+		job.Sandbox = &sandboxResponse{Host: sb.Host, Port: sb.Port, Database: sb.Database, Schema: sb.Schema, User: sb.User}
+	}
+
+	json.WriteJSON(w, http.StatusOK, job)
+}
+
+func (s *apiServer) handleCancelGenerationJob(w http.ResponseWriter, r *http.Request) {
+	projectId := chi.URLParam(r, "id")
+	jobId := chi.URLParam(r, "jobId")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	log.Printf("Sending CancelGenerationJob gRPC request for job %s of project %s", jobId, projectId)
+	resp, err := s.dataClient.CancelGenerationJob(ctx, &pb.CancelGenerationJobRequest{
+		ProjectId:       projectId,
+		GenerationJobId: jobId,
+	})
+	if err != nil {
+		grpcStatus, ok := status.FromError(err)
+		switch {
+		case ok && grpcStatus.Code() == codes.InvalidArgument:
+			errors.BadRequestResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok && grpcStatus.Code() == codes.NotFound:
+			errors.NotFoundResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok && grpcStatus.Code() == codes.FailedPrecondition:
+			errors.ConflictResponse(w, r, fmt.Errorf("%s", grpcStatus.Message()))
+		case ok:
+			errors.InternalServerError(w, r, fmt.Errorf("gRPC error: [%s] %s", grpcStatus.Code(), grpcStatus.Message()))
+		default:
+			errors.InternalServerError(w, r, fmt.Errorf("failed to cancel data generation: %w", err))
+		}
+		return
+	}
+
+	responsePayload := map[string]string{
+		"projectId":       projectId,
+		"generationJobId": jobId,
+		"message":         resp.Message,
+	}
+
+	statusCode := http.StatusOK
+
+	if !resp.Success {
+		statusCode = http.StatusInternalServerError
+	}
+
+	json.WriteJSON(w, statusCode, responsePayload)
+}
+
+// fanOutForm is one entry of the fanOut form field, e.g.
+// {"childTable": "orders", "parentTable": "users", "min": 0, "max": 20}
+type fanOutForm struct {
+	ChildTable   string   `json:"childTable"`
+	ParentTable  string   `json:"parentTable"`
+	Columns      []string `json:"columns"`
+	Min          int64    `json:"min"`
+	Max          int64    `json:"max"`
+	Distribution string   `json:"distribution"`
+	Mean         float64  `json:"mean"`
+}
+
+func parseFanOut(v string) ([]*pb.FanOut, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var forms []fanOutForm
+	if err := decodeFormJSON(v, &forms); err != nil {
+		return nil, fmt.Errorf("must be an array of fan-out rules: %w", err)
+	}
+
+	rules := make([]*pb.FanOut, len(forms))
+	for i, f := range forms {
+		rules[i] = &pb.FanOut{
+			ChildTable:   f.ChildTable,
+			ParentTable:  f.ParentTable,
+			Columns:      f.Columns,
+			Min:          f.Min,
+			Max:          f.Max,
+			Distribution: f.Distribution,
+			Mean:         f.Mean,
+		}
+	}
+	return rules, nil
+}
+
+func decodeFormJSON(v string, data any) error {
+	decoder := stdjson.NewDecoder(strings.NewReader(v))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(data)
+}
@@ -77,6 +77,8 @@ func main() {
 
 	r.Get("/health", health.Handler)
 	r.Post("/projects", s.handleStartDataGeneration)
+	r.Get("/projects/{id}/jobs/{jobId}", s.handleGetGenerationJob)
+	r.Delete("/projects/{id}/jobs/{jobId}", s.handleCancelGenerationJob)
 
 	srv := &http.Server{Addr: ":" + port, Handler: r}
 
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// coordinator splits generation jobs too large for one generator into
+// shards, a table and a range of its rows each. It dispatches the shards of
+// a table once the tables it references are generated, dispatches shards
+// that fail or time out again and asks for the output to be assembled once
+// every shard is generated. The plan and shards of a job are kept in the
+// store and every event of a job is handled with the job locked, so that
+// any replica of the data service can handle it, restarted or not.
+type coordinator struct {
+	store     *jobStore
+	outbox    *outboxRelay
+	tracker   *jobTracker
+	shardRows int64
+	// timeout is how long a shard may take before it is dispatched again,
+	// attempts how many times a shard or assembly is tried
+	timeout  time.Duration
+	attempts int
+}
+
+func NewCoordinator(store *jobStore, outbox *outboxRelay, tracker *jobTracker, shardRows int64, timeout time.Duration, attempts int) *coordinator {
+	return &coordinator{
+		store:     store,
+		outbox:    outbox,
+		tracker:   tracker,
+		shardRows: shardRows,
+		timeout:   timeout,
+		attempts:  attempts,
+	}
+}
+
+// shardedJob is a job split into shards, as loaded to handle one event.
+type shardedJob struct {
+	event  messaging.ProjectCreatedEvent
+	tables []*jobTable
+	// shards are in load order
+	shards []*jobShard
+	byID   map[string]*jobShard
+	// pending counts the shards not generated yet, assemblies the attempts
+	// to assemble the output
+	pending    int
+	assemblies int
+	// events are published once the changes to the job are saved; failed
+	// is why the job was given up on and assembled whether its output is
+	events    []jobEvent
+	failed    string
+	assembled bool
+}
+
+type jobEvent struct {
+	routingKey string
+	event      any
+}
+
+// jobTable is a table of a sharded job, in load order.
+type jobTable struct {
+	messaging.PlannedTable
+	shards []*jobShard
+	done   int
+}
+
+func (t *jobTable) complete() bool {
+	return t.done == len(t.shards)
+}
+
+type jobShard struct {
+	id    string
+	table *jobTable
+	first int64
+	rows  int64
+	// attempts counts the dispatches of the shard, sent is when the last
+	// one was made
+	attempts int
+	sent     time.Time
+	done     bool
+	// changed is whether the shard needs saving
+	changed bool
+}
+
+func (s *jobShard) record() shardRecord {
+	return shardRecord{
+		ID:       s.id,
+		Table:    s.table.Name,
+		First:    s.first,
+		Rows:     s.rows,
+		Attempts: s.attempts,
+		Sent:     sql.NullTime{Time: s.sent, Valid: s.attempts > 0},
+		Done:     s.done,
+	}
+}
+
+func newShardedJob(event messaging.ProjectCreatedEvent) *shardedJob {
+	return &shardedJob{event: event, byID: make(map[string]*jobShard)}
+}
+
+func (j *shardedJob) add(s *jobShard) {
+	s.table.shards = append(s.table.shards, s)
+	j.shards = append(j.shards, s)
+	j.byID[s.id] = s
+}
+
+// handleDelivery routes a message of the coordinator queue by its routing
+// key.
+func (c *coordinator) handleDelivery(d amqp.Delivery) error {
+	switch d.RoutingKey {
+	case contracts.GenerationPlannedRoutingKey:
+		var event messaging.GenerationPlannedEvent
+		if err := decodeEvent(d, "GenerationPlannedEvent", &event); err != nil {
+			return err
+		}
+		return c.handlePlanned(event)
+	case contracts.GenerationShardDoneRoutingKey:
+		var event messaging.GenerationShardDoneEvent
+		if err := decodeEvent(d, "GenerationShardDoneEvent", &event); err != nil {
+			return err
+		}
+		return c.handleShardDone(event)
+	case contracts.GenerationAssembledRoutingKey:
+		var event messaging.GenerationAssembledEvent
+		if err := decodeEvent(d, "GenerationAssembledEvent", &event); err != nil {
+			return err
+		}
+		return c.handleAssembled(event)
+	}
+	return fmt.Errorf("unexpected routing key %s", d.RoutingKey)
+}
+
+// handlePlanned splits a planned job into shards and dispatches the ones
+// that can start.
+func (c *coordinator) handlePlanned(event messaging.GenerationPlannedEvent) error {
+	id := event.Job.JobID
+	if event.ShardUnit <= 0 {
+		return fmt.Errorf("job %s has a shard unit of %d", id, event.ShardUnit)
+	}
+	// split tables are cut on multiples of the unit
+	size := max(event.ShardUnit, c.shardRows/event.ShardUnit*event.ShardUnit)
+
+	job := newShardedJob(event.Job)
+	known := make(map[string]bool)
+	for _, pt := range event.Tables {
+		for _, name := range pt.After {
+			if !known[name] {
+				return fmt.Errorf("table %s of job %s waits for %s, which is not planned before it", pt.Name, id, name)
+			}
+		}
+		known[pt.Name] = true
+
+		t := &jobTable{PlannedTable: pt}
+		add := func(first, rows int64) {
+			job.add(&jobShard{id: fmt.Sprintf("%s:%d", pt.Name, first), table: t, first: first, rows: rows})
+		}
+		if pt.Split && pt.Rows > size {
+			for first := int64(0); first < pt.Rows; first += size {
+				add(first, min(size, pt.Rows-first))
+			}
+		} else {
+			add(0, pt.Rows)
+		}
+		job.tables = append(job.tables, t)
+	}
+	job.pending = len(job.shards)
+
+	plan, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal shard plan: %w", err)
+	}
+	records := make([]shardRecord, len(job.shards))
+	for i, s := range job.shards {
+		records[i] = s.record()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	err = c.store.inTx(ctx, func(tx *sql.Tx) error {
+		status, saved, _, err := lockShardedJob(ctx, tx, id)
+		if errors.Is(err, errJobNotFound) {
+			log.Printf("Ignoring the plan of unknown job %s", id)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if status != jobQueued && status != jobRunning {
+			log.Printf("Ignoring the plan of %s job %s", status, id)
+			return nil
+		}
+		if saved.Valid {
+			log.Printf("Job %s is already planned", id)
+			return nil
+		}
+
+		if err := planShards(ctx, tx, id, plan, records); err != nil {
+			return err
+		}
+		log.Printf("Split job %s of project %s into %d shards", id, event.Job.ProjectID, len(job.shards))
+		c.dispatchReady(job)
+		return c.save(ctx, tx, job)
+	})
+	if err != nil {
+		return err
+	}
+	c.outbox.notify()
+	return nil
+}
+
+// handleShardDone records a generated shard, or dispatches a failed one
+// again. Reports of attempts that were given up on are ignored.
+func (c *coordinator) handleShardDone(event messaging.GenerationShardDoneEvent) error {
+	return c.update(event.JobID, func(job *shardedJob) {
+		s := job.byID[event.ShardID]
+		if s == nil || s.done {
+			return
+		}
+
+		if event.Error != "" {
+			if event.Attempt == s.attempts {
+				c.retry(job, s, event.Error)
+			}
+			return
+		}
+		s.done = true
+		s.changed = true
+		s.table.done++
+		job.pending--
+		if job.pending > 0 {
+			c.dispatchReady(job)
+			return
+		}
+		c.assemble(job)
+	})
+}
+
+// handleAssembled finishes a job, or asks for the output to be assembled
+// again.
+func (c *coordinator) handleAssembled(event messaging.GenerationAssembledEvent) error {
+	return c.update(event.JobID, func(job *shardedJob) {
+		if event.Error == "" {
+			// the generator that assembled it reports the job completed
+			job.assembled = true
+			return
+		}
+		if job.assemblies >= c.attempts {
+			c.fail(job, fmt.Sprintf("assembly failed %d times, last with: %s", job.assemblies, event.Error))
+			return
+		}
+		log.Printf("Assembling job %s failed, trying again: %s", event.JobID, event.Error)
+		c.assemble(job)
+	})
+}
+
+// watch dispatches again the shards that took longer than the timeout.
+func (c *coordinator) watch() {
+	ticker := time.NewTicker(max(c.timeout/4, time.Second))
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+		jobIDs, err := c.store.timedOutJobs(ctx, time.Now().Add(-c.timeout))
+		cancel()
+		if err != nil {
+			log.Printf("Failed to look for timed out shards: %v", err)
+			continue
+		}
+
+		for _, id := range jobIDs {
+			err := c.update(id, func(job *shardedJob) {
+				for _, s := range job.shards {
+					if job.failed != "" {
+						break
+					}
+					// another replica may have dispatched it since
+					if s.attempts > 0 && !s.done && time.Since(s.sent) > c.timeout {
+						c.retry(job, s, fmt.Sprintf("timed out after %v", c.timeout))
+					}
+				}
+			})
+			if err != nil {
+				log.Printf("Failed to dispatch the timed out shards of job %s: %v", id, err)
+			}
+		}
+	}
+}
+
+// update loads a sharded job under way with the job locked, runs fn on it
+// and saves what fn changed, in one transaction. Jobs that are not sharded
+// or no longer under way are left alone.
+func (c *coordinator) update(jobID string, fn func(job *shardedJob)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var job *shardedJob
+	err := c.store.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		job, err = c.load(ctx, tx, jobID)
+		if err != nil || job == nil {
+			return err
+		}
+		fn(job)
+		return c.save(ctx, tx, job)
+	})
+	if err != nil || job == nil {
+		return err
+	}
+	c.outbox.notify()
+	if job.failed != "" {
+		c.tracker.finished(jobID)
+		log.Printf("Job %s of project %s failed: %s", jobID, job.event.ProjectID, job.failed)
+	}
+	return nil
+}
+
+// load locks a job and its shards and returns the job, or nil when it is
+// not sharded, not under way or finished with its shards.
+func (c *coordinator) load(ctx context.Context, tx *sql.Tx, jobID string) (*shardedJob, error) {
+	status, plan, assemblies, err := lockShardedJob(ctx, tx, jobID)
+	if errors.Is(err, errJobNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Valid || (status != jobQueued && status != jobRunning) {
+		return nil, nil
+	}
+	var event messaging.GenerationPlannedEvent
+	if err := json.Unmarshal([]byte(plan.String), &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal shard plan of job %s: %w", jobID, err)
+	}
+	records, err := loadShards(ctx, tx, jobID)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	job := newShardedJob(event.Job)
+	job.assemblies = assemblies
+	tables := make(map[string]*jobTable)
+	for _, pt := range event.Tables {
+		t := &jobTable{PlannedTable: pt}
+		tables[pt.Name] = t
+		job.tables = append(job.tables, t)
+	}
+	for _, r := range records {
+		t := tables[r.Table]
+		if t == nil {
+			return nil, fmt.Errorf("shard %s of job %s is of table %s, which is not planned", r.ID, jobID, r.Table)
+		}
+		job.add(&jobShard{id: r.ID, table: t, first: r.First, rows: r.Rows, attempts: r.Attempts, sent: r.Sent.Time, done: r.Done})
+		if r.Done {
+			t.done++
+		} else {
+			job.pending++
+		}
+	}
+	return job, nil
+}
+
+// save records the shards of a job that changed, queues the events it
+// publishes and finishes it once it failed or was assembled.
+func (c *coordinator) save(ctx context.Context, tx *sql.Tx, job *shardedJob) error {
+	id := job.event.JobID
+	var changed []shardRecord
+	for _, s := range job.shards {
+		if s.changed {
+			changed = append(changed, s.record())
+		}
+	}
+	if err := saveShards(ctx, tx, id, job.assemblies, changed); err != nil {
+		return err
+	}
+	for _, e := range job.events {
+		if err := enqueue(ctx, tx, job.event.ProjectID, e.routingKey, e.event); err != nil {
+			return err
+		}
+	}
+	switch {
+	case job.failed != "":
+		return failShardedJob(ctx, tx, id, job.failed)
+	case job.assembled:
+		return deleteShards(ctx, tx, id)
+	}
+	return nil
+}
+
+// dispatchReady dispatches the shards of the tables whose referenced
+// tables are generated.
+func (c *coordinator) dispatchReady(job *shardedJob) {
+	complete := make(map[string]bool)
+	for _, t := range job.tables {
+		complete[t.Name] = t.complete()
+	}
+	for _, t := range job.tables {
+		ready := true
+		for _, name := range t.After {
+			ready = ready && complete[name]
+		}
+		if !ready {
+			continue
+		}
+		for _, s := range t.shards {
+			if s.attempts == 0 {
+				c.dispatch(job, s)
+			}
+		}
+	}
+}
+
+// retry dispatches a shard again, or gives up on the job once the shard
+// used up its attempts.
+func (c *coordinator) retry(job *shardedJob, s *jobShard, reason string) {
+	if s.attempts >= c.attempts {
+		c.fail(job, fmt.Sprintf("shard %s failed %d times, last with: %s", s.id, s.attempts, reason))
+		return
+	}
+	log.Printf("Shard %s of job %s failed, dispatching it again: %s", s.id, job.event.JobID, reason)
+	c.dispatch(job, s)
+}
+
+// dispatch queues a shard for a generator.
+func (c *coordinator) dispatch(job *shardedJob, s *jobShard) {
+	s.attempts++
+	s.sent = time.Now()
+	s.changed = true
+	job.events = append(job.events, jobEvent{contracts.GenerationShardRoutingKey, messaging.GenerationShardEvent{
+		Job:     job.event,
+		ShardID: s.id,
+		Attempt: s.attempts,
+		Table:   s.table.Name,
+		First:   s.first,
+		Rows:    s.rows,
+	}})
+}
+
+// assemble asks a generator for the output of a job.
+func (c *coordinator) assemble(job *shardedJob) {
+	job.assemblies++
+	log.Printf("All %d shards of job %s are generated, assembling", len(job.shards), job.event.JobID)
+	job.events = append(job.events, jobEvent{contracts.GenerationAssembleRoutingKey, messaging.GenerationAssembleEvent{Job: job.event}})
+}
+
+// fail gives up on a job.
+func (c *coordinator) fail(job *shardedJob, reason string) {
+	job.failed = reason
+}
@@ -3,11 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/google/uuid"
 	pb "github.com/kacperborowieckb/gen-sql/shared/gen/proto"
 	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -19,34 +28,280 @@ func (s *dataServer) StartDataGeneration(ctx context.Context, in *pb.StartDataGe
 		return nil, status.Error(codes.InvalidArgument, "projectId and ddlSchema are required")
 	}
 
+	for table, rows := range in.TableRows {
+		if rows <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "tableRows[%q] must be greater than 0", table)
+		}
+	}
+	fanOut := make([]messaging.FanOut, len(in.FanOut))
+	for i, f := range in.FanOut {
+		if err := validateFanOut(f); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "fanOut[%d]: %v", i, err)
+		}
+		fanOut[i] = messaging.FanOut{
+			ChildTable:   f.ChildTable,
+			ParentTable:  f.ParentTable,
+			Columns:      f.Columns,
+			Min:          f.Min,
+			Max:          f.Max,
+			Distribution: f.Distribution,
+			Mean:         f.Mean,
+		}
+	}
+
+	if in.Locale != "" && !validLocale(in.Locale) {
+		return nil, status.Errorf(codes.InvalidArgument, "locale %q must be a tag such as pl_PL", in.Locale)
+	}
+	for column, locale := range in.ColumnLocales {
+		if !strings.Contains(column, ".") {
+			return nil, status.Errorf(codes.InvalidArgument, "columnLocales[%q] must name a column as table.column", column)
+		}
+		if !validLocale(locale) {
+			return nil, status.Errorf(codes.InvalidArgument, "columnLocales[%q]: locale %q must be a tag such as pl_PL", column, locale)
+		}
+	}
+
+	output := in.GetOutput()
+	if output.GetBatchSize() < 0 || output.GetBatchSize() > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "output.batchSize must be between 0 and %d, got %d", maxBatchSize, output.GetBatchSize())
+	}
+	if err := validateOutput(output); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "output.%v", err)
+	}
+
+	if _, err := rules.Parse(in.GenerationInstructions); err != nil {
+		return nil, invalidInstructions(err)
+	}
+
+	// without a seed the job is still reproducible: the one chosen here is
+	// carried on the event and returned to the caller
+	seed := rand.Int64()
+	if in.Seed != nil {
+		seed = in.GetSeed()
+	}
+	jobID := uuid.NewString()
+
 	event := messaging.ProjectCreatedEvent{
 		ProjectID:              in.ProjectId,
 		DdlSchema:              in.DdlSchema,
 		GenerationInstructions: in.GenerationInstructions,
 		MaxRows:                in.MaxRows,
+		Seed:                   seed,
+		TableRows:              in.TableRows,
+		FanOut:                 fanOut,
+		Locale:                 in.Locale,
+		ColumnLocales:          in.ColumnLocales,
+		Output: messaging.OutputOptions{
+			BatchSize:     int(output.GetBatchSize()),
+			Transaction:   output.GetTransaction(),
+			Format:        output.GetFormat(),
+			PerTableFiles: output.GetPerTableFiles(),
+			Archive:       output.GetArchive(),
+			CSV: messaging.CSVOptions{
+				Delimiter: output.GetCsv().GetDelimiter(),
+				Quoting:   output.GetCsv().GetQuoting(),
+				NoHeader:  output.GetCsv() != nil && output.GetCsv().Header != nil && !output.GetCsv().GetHeader(),
+			},
+		},
+		JobID:     jobID,
+		ShardRows: s.shardRows,
+	}
+
+	// the job and its event are saved together, the outbox publishes the
+	// event once they are
+	if err := s.store.createJob(ctx, event); err != nil {
+		log.Printf("Failed to save job %s of project %s: %v", jobID, in.ProjectId, err)
+		return nil, status.Error(codes.Internal, "failed to save generation job")
 	}
+	s.outbox.notify()
+
+	log.Printf("Successfully queued ProjectCreatedEvent for project: %s (job %s, seed %d)", in.ProjectId, jobID, seed)
 
-	eventData, err := json.Marshal(event)
+	return &pb.StartDataGenerationResponse{
+		GenerationJobId: jobID,
+		Message:         "Data generation job successfully queued.",
+		Success:         true,
+		Seed:            seed,
+	}, nil
+}
+
+func (s *dataServer) GetGenerationJob(ctx context.Context, in *pb.GetGenerationJobRequest) (*pb.GetGenerationJobResponse, error) {
+	if in.ProjectId == "" || in.GenerationJobId == "" {
+		return nil, status.Error(codes.InvalidArgument, "projectId and generationJobId are required")
+	}
+
+	j, err := s.store.getJob(ctx, in.GenerationJobId, in.ProjectId)
+	if errors.Is(err, errJobNotFound) {
+		return nil, status.Errorf(codes.NotFound, "project %s has no job %s", in.ProjectId, in.GenerationJobId)
+	}
 	if err != nil {
-		log.Printf("Failed to marshal ProjectCreatedEvent: %v", err)
-		return nil, status.Error(codes.Internal, "failed to marshal event data")
+		log.Printf("Failed to load job %s of project %s: %v", in.GenerationJobId, in.ProjectId, err)
+		return nil, status.Error(codes.Internal, "failed to load generation job")
+	}
+
+	resp := &pb.GetGenerationJobResponse{
+		GenerationJobId:        j.ID,
+		ProjectId:              j.ProjectID,
+		Status:                 j.Status,
+		GenerationInstructions: j.Instructions,
+		Error:                  j.Error.String,
+		Artifact:               j.Artifact.String,
+		RowCount:               j.Rows.Int64,
+		CreatedAt:              j.Created.UTC().Format(time.RFC3339),
+		Interpretation:         j.Interpretation.String,
+	}
+	if j.Started.Valid {
+		resp.StartedAt = j.Started.Time.UTC().Format(time.RFC3339)
+	}
+	if j.Finished.Valid {
+		resp.FinishedAt = j.Finished.Time.UTC().Format(time.RFC3339)
+	}
+	if j.Generators.Valid {
+		var columns []messaging.ColumnGenerator
+		if err := json.Unmarshal([]byte(j.Generators.String), &columns); err != nil {
+			log.Printf("Failed to read generators of job %s: %v", j.ID, err)
+			return nil, status.Error(codes.Internal, "failed to load generation job")
+		}
+		for _, c := range columns {
+			resp.Generators = append(resp.Generators, &pb.ColumnGenerator{Table: c.Table, Column: c.Column, Generator: c.Generator})
+		}
+	}
+	if j.Sandbox.Valid {
+		var sandbox jobSandbox
+		if err := json.Unmarshal([]byte(j.Sandbox.String), &sandbox); err != nil {
+			log.Printf("Failed to read sandbox of job %s: %v", j.ID, err)
+			return nil, status.Error(codes.Internal, "failed to load generation job")
+		}
+		resp.Sandbox = &pb.Sandbox{
+			Host:     sandbox.Host,
+			Port:     sandbox.Port,
+			Database: sandbox.Database,
+			Schema:   sandbox.Schema,
+			User:     sandbox.User,
+		}
 	}
+	return resp, nil
+}
+
+func (s *dataServer) CancelGenerationJob(ctx context.Context, in *pb.CancelGenerationJobRequest) (*pb.CancelGenerationJobResponse, error) {
+	log.Printf("Received CancelGenerationJob request for job %s of project %s", in.GenerationJobId, in.ProjectId)
 
-	amqpMsg := contracts.AmqpMessage{
-		OwnerId: in.ProjectId,
-		Data:    eventData,
+	if in.ProjectId == "" || in.GenerationJobId == "" {
+		return nil, status.Error(codes.InvalidArgument, "projectId and generationJobId are required")
 	}
 
-	if err := s.mqClient.PublishMessage(ctx, messaging.ProjectsExchange, contracts.ProjectCreatedRoutingKey, amqpMsg); err != nil {
-		log.Printf("Failed to publish message to RabbitMQ: %v", err)
-		return nil, status.Error(codes.Internal, "failed to publish message to queue")
+	if err := s.store.cancelJob(ctx, in.GenerationJobId, in.ProjectId); err != nil {
+		switch {
+		case errors.Is(err, errJobNotFound):
+			return nil, status.Errorf(codes.NotFound, "project %s has no job %s", in.ProjectId, in.GenerationJobId)
+		case errors.Is(err, errJobFinished):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		log.Printf("Failed to cancel job %s of project %s: %v", in.GenerationJobId, in.ProjectId, err)
+		return nil, status.Error(codes.Internal, "failed to cancel generation job")
 	}
+	s.outbox.notify()
 
-	log.Printf("Successfully published ProjectCreatedEvent for project: %s", in.ProjectId)
+	s.jobs.cancelled(in.GenerationJobId, in.ProjectId)
 
-	return &pb.StartDataGenerationResponse{
-		GenerationJobId: "mockJobId",
-		Message:         "Data generation job successfully queued.",
-		Success:         true,
+	return &pb.CancelGenerationJobResponse{
+		Message: "Data generation job cancelled.",
+		Success: true,
 	}, nil
 }
+
+// maxBatchSize keeps INSERT statements of wide tables well below the
+// statement sizes PostgreSQL handles comfortably.
+const maxBatchSize = 10000
+
+func validateFanOut(f *pb.FanOut) error {
+	switch {
+	case f.ChildTable == "" || f.ParentTable == "":
+		return fmt.Errorf("childTable and parentTable are required")
+	case f.Min < 0 || f.Max < f.Min:
+		return fmt.Errorf("min and max must satisfy 0 <= min <= max, got %d and %d", f.Min, f.Max)
+	}
+	switch f.Distribution {
+	case "", "uniform":
+	case "poisson":
+		if f.Mean <= 0 {
+			return fmt.Errorf("poisson distribution needs a mean greater than 0")
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q, expected uniform or poisson", f.Distribution)
+	}
+	return nil
+}
+
+// validateOutput checks that the output options name known formats and
+// only set what applies to the chosen one.
+func validateOutput(o *pb.OutputOptions) error {
+	format := o.GetFormat()
+	switch format {
+	case "", messaging.FormatSQL, messaging.FormatCopy, messaging.FormatCopyCSV,
+		messaging.FormatCSV, messaging.FormatNDJSON, messaging.FormatParquet, messaging.FormatSandbox:
+	default:
+		return fmt.Errorf("format: unknown format %q, expected %s, %s, %s, %s, %s, %s or %s", format,
+			messaging.FormatSQL, messaging.FormatCopy, messaging.FormatCopyCSV,
+			messaging.FormatCSV, messaging.FormatNDJSON, messaging.FormatParquet, messaging.FormatSandbox)
+	}
+	if o.GetPerTableFiles() && format != messaging.FormatCopy && format != messaging.FormatCopyCSV {
+		return fmt.Errorf("perTableFiles: needs the %s or %s format", messaging.FormatCopy, messaging.FormatCopyCSV)
+	}
+
+	switch o.GetArchive() {
+	case "", messaging.ArchiveZip, messaging.ArchiveTarGz:
+	default:
+		return fmt.Errorf("archive: unknown archive %q, expected %s or %s", o.GetArchive(), messaging.ArchiveZip, messaging.ArchiveTarGz)
+	}
+	if o.GetArchive() != "" && !messaging.IsExport(format) {
+		return fmt.Errorf("archive: only applies to the %s, %s and %s formats", messaging.FormatCSV, messaging.FormatNDJSON, messaging.FormatParquet)
+	}
+
+	csv := o.GetCsv()
+	if csv == nil {
+		return nil
+	}
+	if format != messaging.FormatCSV {
+		return fmt.Errorf("csv: only applies to the %s format", messaging.FormatCSV)
+	}
+	if d := csv.GetDelimiter(); d != "" && (utf8.RuneCountInString(d) != 1 || strings.ContainsAny(d, "\"\r\n")) {
+		return fmt.Errorf("csv.delimiter: must be a single character other than a quote or line break, got %q", d)
+	}
+	switch csv.GetQuoting() {
+	case "", "minimal", "all":
+	default:
+		return fmt.Errorf("csv.quoting: unknown quoting %q, expected minimal or all", csv.GetQuoting())
+	}
+	return nil
+}
+
+// validLocale checks the shape of a locale tag. Which locales exist is up
+// to the packs the generator has loaded.
+func validLocale(tag string) bool {
+	return localeTag.MatchString(tag)
+}
+
+var localeTag = regexp.MustCompile(`^[A-Za-z]{2,3}([_-][A-Za-z0-9]{2,8})*$`)
+
+// invalidInstructions reports every problem of structured generation
+// instructions, with the path of each field as a BadRequest detail.
+func invalidInstructions(err error) error {
+	st := status.New(codes.InvalidArgument, "invalid generationInstructions: "+err.Error())
+
+	var errs rules.Errors
+	if !errors.As(err, &errs) {
+		return st.Err()
+	}
+	br := &errdetails.BadRequest{}
+	for _, e := range errs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "generationInstructions." + e.Path,
+			Description: e.Msg,
+		})
+	}
+	if detailed, derr := st.WithDetails(br); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Statuses of generation jobs.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+var errJobFinished = errors.New("job already finished")
+
+// progressTTL is how long the progress of a job that reports none is kept.
+const progressTTL = time.Hour
+
+// jobTracker keeps the status of generation jobs up to date in the store
+// from the events generators publish. A job only moves forward: queued,
+// running, then completed, failed or cancelled, whatever order events
+// arrive in. How far jobs under way got is tracked in memory.
+type jobTracker struct {
+	store *jobStore
+
+	mu       sync.Mutex
+	progress map[string]*jobProgress
+}
+
+func NewJobTracker(store *jobStore) *jobTracker {
+	return &jobTracker{store: store, progress: make(map[string]*jobProgress)}
+}
+
+// jobProgress holds the rows done and to do of every table of a job, by
+// the shard that reported them; jobs generated in one piece report under "".
+type jobProgress struct {
+	tables  map[string]map[string]messaging.TableProgress
+	updated time.Time
+}
+
+// rows returns the rows generated and to generate, of the tables reported
+// so far.
+func (p *jobProgress) rows() (done, total int64) {
+	for _, shards := range p.tables {
+		for _, tp := range shards {
+			done += tp.Rows
+			total += tp.Total
+		}
+	}
+	return done, total
+}
+
+// handleDelivery routes a message of the status queue by its routing key.
+func (t *jobTracker) handleDelivery(d amqp.Delivery) error {
+	switch d.RoutingKey {
+	case contracts.GenerationStartedRoutingKey:
+		var event messaging.GenerationStartedEvent
+		if err := decodeEvent(d, "GenerationStartedEvent", &event); err != nil {
+			return err
+		}
+		return t.started(event)
+	case contracts.GenerationProgressRoutingKey:
+		var event messaging.GenerationProgressEvent
+		if err := decodeEvent(d, "GenerationProgressEvent", &event); err != nil {
+			return err
+		}
+		t.progressed(event)
+		return nil
+	case contracts.GenerationCompletedRoutingKey:
+		var event messaging.GenerationCompletedEvent
+		if err := decodeEvent(d, "GenerationCompletedEvent", &event); err != nil {
+			return err
+		}
+		return t.completed(event)
+	case contracts.GenerationFailedRoutingKey:
+		var event messaging.GenerationFailedEvent
+		if err := decodeEvent(d, "GenerationFailedEvent", &event); err != nil {
+			return err
+		}
+		return t.failed(event.JobID, event.ProjectID, event.Error)
+	case contracts.ProjectInstructionsInterpretedRoutingKey:
+		var event messaging.InstructionsInterpretedEvent
+		if err := decodeEvent(d, "InstructionsInterpretedEvent", &event); err != nil {
+			return err
+		}
+		return t.interpreted(event)
+	case contracts.ProjectGeneratorsChosenRoutingKey:
+		var event messaging.ColumnGeneratorsEvent
+		if err := decodeEvent(d, "ColumnGeneratorsEvent", &event); err != nil {
+			return err
+		}
+		return t.generatorsChosen(event)
+	case contracts.ProjectSandboxReadyRoutingKey:
+		var event messaging.SandboxReadyEvent
+		if err := decodeEvent(d, "SandboxReadyEvent", &event); err != nil {
+			return err
+		}
+		return t.sandboxReady(event)
+	}
+	return fmt.Errorf("unexpected routing key %s", d.RoutingKey)
+}
+
+// decodeEvent unmarshals the event a message carries.
+func decodeEvent(d amqp.Delivery, name string, event any) error {
+	var amqpMsg contracts.AmqpMessage
+	if err := json.Unmarshal(d.Body, &amqpMsg); err != nil {
+		return fmt.Errorf("failed to unmarshal outer AmqpMessage: %w", err)
+	}
+	if err := json.Unmarshal(amqpMsg.Data, event); err != nil {
+		return fmt.Errorf("failed to unmarshal inner %s: %w", name, err)
+	}
+	return nil
+}
+
+func (t *jobTracker) started(event messaging.GenerationStartedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	moved, err := t.store.markStarted(ctx, event.JobID)
+	if err != nil {
+		return err
+	}
+	if moved {
+		log.Printf("Job %s of project %s is running", event.JobID, event.ProjectID)
+	}
+	return nil
+}
+
+// jobInterpretation is how the free-text instructions of a job were
+// understood, as kept with the job.
+type jobInterpretation struct {
+	Provider string       `json:"provider"`
+	Rules    *rules.Rules `json:"rules,omitempty"`
+	Notes    []string     `json:"notes,omitempty"`
+}
+
+func (t *jobTracker) interpreted(event messaging.InstructionsInterpretedEvent) error {
+	data, err := json.Marshal(jobInterpretation{Provider: event.Provider, Rules: event.Rules, Notes: event.Notes})
+	if err != nil {
+		return fmt.Errorf("failed to marshal interpretation: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	return t.store.saveInterpretation(ctx, event.JobID, data)
+}
+
+func (t *jobTracker) generatorsChosen(event messaging.ColumnGeneratorsEvent) error {
+	data, err := json.Marshal(event.Columns)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column generators: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	return t.store.saveGenerators(ctx, event.JobID, data)
+}
+
+// jobSandbox is where a job loaded its dataset, as kept with the job.
+type jobSandbox struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
+	Schema   string `json:"schema"`
+	User     string `json:"user"`
+}
+
+func (t *jobTracker) sandboxReady(event messaging.SandboxReadyEvent) error {
+	data, err := json.Marshal(jobSandbox{
+		Host:     event.Host,
+		Port:     event.Port,
+		Database: event.Database,
+		Schema:   event.Schema,
+		User:     event.User,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal sandbox: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := t.store.saveSandbox(ctx, event.JobID, data); err != nil {
+		return err
+	}
+	log.Printf("Job %s of project %s loaded schema %s of database %s", event.JobID, event.ProjectID, event.Schema, event.Database)
+	return nil
+}
+
+// progressed records the rows generated of the tables of a job. Progress
+// only moves forward, whatever order events of generators working side by
+// side arrive in.
+func (t *jobTracker) progressed(event messaging.GenerationProgressEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for id, p := range t.progress {
+		if now.Sub(p.updated) > progressTTL {
+			delete(t.progress, id)
+		}
+	}
+
+	p := t.progress[event.JobID]
+	if p == nil {
+		p = &jobProgress{tables: make(map[string]map[string]messaging.TableProgress)}
+		t.progress[event.JobID] = p
+	}
+	for _, tp := range event.Tables {
+		shards := p.tables[tp.Table]
+		if shards == nil {
+			shards = make(map[string]messaging.TableProgress)
+			p.tables[tp.Table] = shards
+		}
+		if tp.Rows > shards[event.ShardID].Rows {
+			shards[event.ShardID] = tp
+		}
+	}
+	p.updated = now
+	done, total := p.rows()
+	log.Printf("Job %s of project %s: %d of %d rows generated so far", event.JobID, event.ProjectID, done, total)
+}
+
+func (t *jobTracker) completed(event messaging.GenerationCompletedEvent) error {
+	t.finished(event.JobID)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	moved, err := t.store.markCompleted(ctx, event.JobID, event.Path, event.Rows)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		log.Printf("Job %s of project %s completed after it finished otherwise", event.JobID, event.ProjectID)
+		return nil
+	}
+	log.Printf("Job %s of project %s generated %d rows to %s", event.JobID, event.ProjectID, event.Rows, event.Path)
+	return nil
+}
+
+func (t *jobTracker) failed(jobID, projectID, reason string) error {
+	t.finished(jobID)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	moved, err := t.store.markFailed(ctx, jobID, reason)
+	if err != nil {
+		return err
+	}
+	if moved {
+		log.Printf("Job %s of project %s failed: %s", jobID, projectID, reason)
+	}
+	return nil
+}
+
+// cancelled forgets the progress of a cancelled job.
+func (t *jobTracker) cancelled(jobID, projectID string) {
+	t.finished(jobID)
+	log.Printf("Job %s of project %s is cancelled", jobID, projectID)
+}
+
+// finished forgets the progress of a job that finished.
+func (t *jobTracker) finished(jobID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.progress, jobID)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS generation_jobs;
+DROP TABLE IF EXISTS projects;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS projects (
+	id         text        PRIMARY KEY,
+	ddl_schema text        NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS generation_jobs (
+	id             text        PRIMARY KEY,
+	project_id     text        NOT NULL REFERENCES projects (id),
+	instructions   text        NOT NULL,
+	options        jsonb       NOT NULL,
+	status         text        NOT NULL,
+	error          text,
+	artifact       text,
+	row_count      bigint,
+	-- how free-text instructions were understood: provider, rules and notes
+	interpretation jsonb,
+	-- the generator picked for every column: table, column and generator
+	generators     jsonb,
+	-- where a sandbox job loaded its dataset: host, port, database, schema and user
+	sandbox        jsonb,
+	-- the plan of a sharded job and how many times its output was assembled
+	shard_plan     jsonb,
+	assemblies     integer     NOT NULL DEFAULT 0,
+	created_at     timestamptz NOT NULL DEFAULT now(),
+	updated_at     timestamptz NOT NULL DEFAULT now(),
+	started_at     timestamptz,
+	finished_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS generation_jobs_project_id_idx ON generation_jobs (project_id);
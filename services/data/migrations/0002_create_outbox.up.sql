@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id          bigserial   PRIMARY KEY,
+	routing_key text        NOT NULL,
+	owner_id    text        NOT NULL,
+	data        jsonb       NOT NULL,
+	created_at  timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS generation_shards (
+	job_id     text        NOT NULL REFERENCES generation_jobs (id) ON DELETE CASCADE,
+	shard_id   text        NOT NULL,
+	position   integer     NOT NULL,
+	table_name text        NOT NULL,
+	first_row  bigint      NOT NULL,
+	row_count  bigint      NOT NULL,
+	attempts   integer     NOT NULL DEFAULT 0,
+	sent_at    timestamptz,
+	done       boolean     NOT NULL DEFAULT false,
+	PRIMARY KEY (job_id, shard_id)
+);
+
+CREATE INDEX IF NOT EXISTS generation_shards_sent_at_idx ON generation_shards (sent_at) WHERE NOT done;
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	"github.com/lib/pq"
+)
+
+// outboxInterval is how often the outbox is checked for events left
+// behind, e.g. by a data service that stopped before publishing them.
+const outboxInterval = 5 * time.Second
+
+// outboxBatch is the most events published in one transaction.
+const outboxBatch = 100
+
+// outboxRelay publishes the events written to the outbox and removes them
+// once the broker confirmed them. An event is published at least once: one
+// confirmed right before the data service stops may be published again.
+type outboxRelay struct {
+	db       *sql.DB
+	mqClient *messaging.RabbitMQ
+	wake     chan struct{}
+}
+
+func NewOutboxRelay(db *sql.DB, mqClient *messaging.RabbitMQ) *outboxRelay {
+	return &outboxRelay{db: db, mqClient: mqClient, wake: make(chan struct{}, 1)}
+}
+
+// notify has the relay publish events just committed without waiting for
+// the next check.
+func (o *outboxRelay) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the outbox as events are written to it.
+func (o *outboxRelay) run() {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := o.publish()
+			if err != nil {
+				log.Printf("Failed to publish outbox: %v", err)
+			}
+			if err != nil || n < outboxBatch {
+				break
+			}
+		}
+		select {
+		case <-o.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish publishes a batch of events in the order they were written and
+// returns how many it published. Events locked by another replica of the
+// data service are left to it.
+func (o *outboxRelay) publish() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, routing_key, owner_id, data FROM outbox
+ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, outboxBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load outbox: %w", err)
+	}
+	type entry struct {
+		id         int64
+		routingKey string
+		msg        contracts.AmqpMessage
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.routingKey, &e.msg.OwnerId, &e.msg.Data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read outbox: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to load outbox: %w", err)
+	}
+
+	// an event is removed once the broker confirmed it
+	var published []int64
+	for _, e := range entries {
+		err := o.mqClient.PublishConfirmed(ctx, messaging.ProjectsExchange, e.routingKey, e.msg)
+		if errors.Is(err, messaging.ErrUnroutable) && e.routingKey == contracts.GenerationCancelRoutingKey {
+			// no generator is running to stop; those that start read the
+			// job's status first
+			log.Printf("No generator received the cancellation of a job of project %s", e.msg.OwnerId)
+			err = nil
+		}
+		if err != nil {
+			// the rest waits, so that events go out in order
+			log.Printf("Failed to publish %s event of %s: %v", e.routingKey, e.msg.OwnerId, err)
+			break
+		}
+		published = append(published, e.id)
+	}
+	if len(published) == 0 {
+		return 0, nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, pq.Array(published)); err != nil {
+		return 0, fmt.Errorf("failed to remove published events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(published), nil
+}
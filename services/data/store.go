@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+)
+
+// dbTimeout bounds every query made while handling an event.
+const dbTimeout = 5 * time.Second
+
+// errJobNotFound is returned for jobs the store does not know.
+var errJobNotFound = errors.New("job not found")
+
+// jobStore keeps projects and their generation jobs in PostgreSQL. Events
+// that must reach the generators are written to an outbox in the same
+// transaction as the job they concern, and published from there, so that a
+// job is never recorded without being queued or queued without being
+// recorded.
+type jobStore struct {
+	db *sql.DB
+}
+
+func NewJobStore(db *sql.DB) *jobStore {
+	return &jobStore{db: db}
+}
+
+// migrations create and upgrade the tables of the store, see db.Migrator.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// jobOptions are the options of a job kept with it, everything of its
+// event but the DDL and instructions.
+type jobOptions struct {
+	MaxRows       int32                   `json:"maxRows"`
+	Seed          int64                   `json:"seed"`
+	TableRows     map[string]int64        `json:"tableRows,omitempty"`
+	FanOut        []messaging.FanOut      `json:"fanOut,omitempty"`
+	Locale        string                  `json:"locale,omitempty"`
+	ColumnLocales map[string]string       `json:"columnLocales,omitempty"`
+	Output        messaging.OutputOptions `json:"output"`
+	ShardRows     int64                   `json:"shardRows,omitempty"`
+}
+
+// createJob records a job of a project, creating the project or replacing
+// its DDL, and queues the job's event.
+func (s *jobStore) createJob(ctx context.Context, event messaging.ProjectCreatedEvent) error {
+	options, err := json.Marshal(jobOptions{
+		MaxRows:       event.MaxRows,
+		Seed:          event.Seed,
+		TableRows:     event.TableRows,
+		FanOut:        event.FanOut,
+		Locale:        event.Locale,
+		ColumnLocales: event.ColumnLocales,
+		Output:        event.Output,
+		ShardRows:     event.ShardRows,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal job options: %w", err)
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO projects (id, ddl_schema) VALUES ($1, $2)
+ON CONFLICT (id) DO UPDATE SET ddl_schema = EXCLUDED.ddl_schema, updated_at = now()`,
+			event.ProjectID, event.DdlSchema); err != nil {
+			return fmt.Errorf("failed to save project: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO generation_jobs (id, project_id, instructions, options, status)
+VALUES ($1, $2, $3, $4, $5)`,
+			event.JobID, event.ProjectID, event.GenerationInstructions, string(options), jobQueued); err != nil {
+			return fmt.Errorf("failed to save job: %w", err)
+		}
+		return enqueue(ctx, tx, event.ProjectID, contracts.ProjectCreatedRoutingKey, event)
+	})
+}
+
+// cancelJob records a job of a project as cancelled and queues the event
+// that stops it. It fails with errJobNotFound when the project has no such
+// job and errJobFinished when the job completed or failed.
+func (s *jobStore) cancelJob(ctx context.Context, jobID, projectID string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRowContext(ctx, `SELECT status FROM generation_jobs WHERE id = $1 AND project_id = $2 FOR UPDATE`,
+			jobID, projectID).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errJobNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load job: %w", err)
+		}
+		switch status {
+		case jobCancelled:
+			return nil
+		case jobCompleted, jobFailed:
+			return fmt.Errorf("%w: it is %s", errJobFinished, status)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE generation_jobs
+SET status = $2, updated_at = now(), finished_at = now() WHERE id = $1`, jobID, jobCancelled); err != nil {
+			return fmt.Errorf("failed to cancel job: %w", err)
+		}
+		if err := deleteShards(ctx, tx, jobID); err != nil {
+			return err
+		}
+		event := messaging.GenerationCancelEvent{JobID: jobID, ProjectID: projectID}
+		return enqueue(ctx, tx, projectID, contracts.GenerationCancelRoutingKey, event)
+	})
+}
+
+// markStarted moves a queued job to running and reports whether it did.
+func (s *jobStore) markStarted(ctx context.Context, jobID string) (bool, error) {
+	return s.update(ctx, `UPDATE generation_jobs
+SET status = $2, updated_at = now(), started_at = now()
+WHERE id = $1 AND status = $3`, jobID, jobRunning, jobQueued)
+}
+
+// markCompleted records the output of a job that did not finish otherwise
+// and reports whether it did.
+func (s *jobStore) markCompleted(ctx context.Context, jobID, artifact string, rows int64) (bool, error) {
+	return s.update(ctx, `UPDATE generation_jobs
+SET status = $2, artifact = $3, row_count = $4, updated_at = now(), finished_at = now()
+WHERE id = $1 AND status IN ($5, $6)`, jobID, jobCompleted, artifact, rows, jobQueued, jobRunning)
+}
+
+// markFailed records why a job that did not finish otherwise failed and
+// reports whether it did.
+func (s *jobStore) markFailed(ctx context.Context, jobID, reason string) (bool, error) {
+	return s.update(ctx, `UPDATE generation_jobs
+SET status = $2, error = $3, updated_at = now(), finished_at = now()
+WHERE id = $1 AND status IN ($4, $5)`, jobID, jobFailed, reason, jobQueued, jobRunning)
+}
+
+// saveInterpretation records how the free-text instructions of a job were
+// understood, as JSON.
+func (s *jobStore) saveInterpretation(ctx context.Context, jobID string, interpretation []byte) error {
+	if _, err := s.update(ctx, `UPDATE generation_jobs SET interpretation = $2, updated_at = now() WHERE id = $1`,
+		jobID, string(interpretation)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// saveGenerators records the generators picked for the columns of a job,
+// as JSON.
+func (s *jobStore) saveGenerators(ctx context.Context, jobID string, generators []byte) error {
+	if _, err := s.update(ctx, `UPDATE generation_jobs SET generators = $2, updated_at = now() WHERE id = $1`,
+		jobID, string(generators)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// saveSandbox records where a job loaded its dataset, as JSON.
+func (s *jobStore) saveSandbox(ctx context.Context, jobID string, sandbox []byte) error {
+	if _, err := s.update(ctx, `UPDATE generation_jobs SET sandbox = $2, updated_at = now() WHERE id = $1`,
+		jobID, string(sandbox)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// jobRecord is a job as the store keeps it.
+type jobRecord struct {
+	ID, ProjectID   string
+	Status          string
+	Instructions    string
+	Error, Artifact sql.NullString
+	Rows            sql.NullInt64
+	Created         time.Time
+	Started         sql.NullTime
+	Finished        sql.NullTime
+	Interpretation  sql.NullString
+	Generators      sql.NullString
+	Sandbox         sql.NullString
+}
+
+// getJob loads a job of a project. It fails with errJobNotFound when the
+// project has no such job.
+func (s *jobStore) getJob(ctx context.Context, jobID, projectID string) (*jobRecord, error) {
+	j := jobRecord{ID: jobID, ProjectID: projectID}
+	err := s.db.QueryRowContext(ctx, `SELECT status, instructions, error, artifact, row_count,
+	created_at, started_at, finished_at, interpretation, generators, sandbox
+FROM generation_jobs WHERE id = $1 AND project_id = $2`, jobID, projectID).Scan(
+		&j.Status, &j.Instructions, &j.Error, &j.Artifact, &j.Rows,
+		&j.Created, &j.Started, &j.Finished, &j.Interpretation, &j.Generators, &j.Sandbox)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job: %w", err)
+	}
+	return &j, nil
+}
+
+// shardRecord is a shard of a sharded job as the store keeps it.
+type shardRecord struct {
+	ID       string
+	Table    string
+	First    int64
+	Rows     int64
+	Attempts int
+	Sent     sql.NullTime
+	Done     bool
+}
+
+// lockShardedJob locks a job until the transaction ends and returns its
+// status, its shard plan unless it is not sharded and how many times its
+// output was assembled. It fails with errJobNotFound when there is no such
+// job.
+func lockShardedJob(ctx context.Context, tx *sql.Tx, jobID string) (string, sql.NullString, int, error) {
+	var (
+		status     string
+		plan       sql.NullString
+		assemblies int
+	)
+	err := tx.QueryRowContext(ctx, `SELECT status, shard_plan, assemblies FROM generation_jobs WHERE id = $1 FOR UPDATE`,
+		jobID).Scan(&status, &plan, &assemblies)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", plan, 0, errJobNotFound
+	}
+	if err != nil {
+		return "", plan, 0, fmt.Errorf("failed to lock job: %w", err)
+	}
+	return status, plan, assemblies, nil
+}
+
+// planShards records the plan of a job and its shards, in load order.
+func planShards(ctx context.Context, tx *sql.Tx, jobID string, plan []byte, shards []shardRecord) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE generation_jobs SET shard_plan = $2, updated_at = now() WHERE id = $1`,
+		jobID, string(plan)); err != nil {
+		return fmt.Errorf("failed to save shard plan: %w", err)
+	}
+	for i, shard := range shards {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO generation_shards (job_id, shard_id, position, table_name, first_row, row_count)
+VALUES ($1, $2, $3, $4, $5, $6)`, jobID, shard.ID, i, shard.Table, shard.First, shard.Rows); err != nil {
+			return fmt.Errorf("failed to save shard %s: %w", shard.ID, err)
+		}
+	}
+	return nil
+}
+
+// loadShards locks the shards of a job until the transaction ends and
+// returns them in load order.
+func loadShards(ctx context.Context, tx *sql.Tx, jobID string) ([]shardRecord, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT shard_id, table_name, first_row, row_count, attempts, sent_at, done
+FROM generation_shards WHERE job_id = $1 ORDER BY position FOR UPDATE`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shards: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []shardRecord
+	for rows.Next() {
+		var shard shardRecord
+		if err := rows.Scan(&shard.ID, &shard.Table, &shard.First, &shard.Rows, &shard.Attempts, &shard.Sent, &shard.Done); err != nil {
+			return nil, fmt.Errorf("failed to read shard: %w", err)
+		}
+		shards = append(shards, shard)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load shards: %w", err)
+	}
+	return shards, nil
+}
+
+// saveShards records the dispatches and completion of shards of a job, and
+// how many times its output was assembled.
+func saveShards(ctx context.Context, tx *sql.Tx, jobID string, assemblies int, shards []shardRecord) error {
+	for _, shard := range shards {
+		if _, err := tx.ExecContext(ctx, `UPDATE generation_shards SET attempts = $3, sent_at = $4, done = $5
+WHERE job_id = $1 AND shard_id = $2`, jobID, shard.ID, shard.Attempts, shard.Sent, shard.Done); err != nil {
+			return fmt.Errorf("failed to save shard %s: %w", shard.ID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE generation_jobs SET assemblies = $2 WHERE id = $1`, jobID, assemblies); err != nil {
+		return fmt.Errorf("failed to save job assemblies: %w", err)
+	}
+	return nil
+}
+
+// deleteShards removes the shards of a job that no longer needs them. A
+// job with a shard plan but no shards is finished with its shards.
+func deleteShards(ctx context.Context, tx *sql.Tx, jobID string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM generation_shards WHERE job_id = $1`, jobID); err != nil {
+		return fmt.Errorf("failed to delete shards: %w", err)
+	}
+	return nil
+}
+
+// failShardedJob records why a sharded job failed and removes its shards.
+func failShardedJob(ctx context.Context, tx *sql.Tx, jobID, reason string) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE generation_jobs
+SET status = $2, error = $3, updated_at = now(), finished_at = now()
+WHERE id = $1 AND status IN ($4, $5)`, jobID, jobFailed, reason, jobQueued, jobRunning); err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	return deleteShards(ctx, tx, jobID)
+}
+
+// timedOutJobs returns the jobs under way with a shard dispatched before
+// sent and not generated yet.
+func (s *jobStore) timedOutJobs(ctx context.Context, sent time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT s.job_id FROM generation_shards s
+JOIN generation_jobs j ON j.id = s.job_id
+WHERE NOT s.done AND s.sent_at < $1 AND j.status IN ($2, $3)`, sent, jobQueued, jobRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timed out shards: %w", err)
+	}
+	defer rows.Close()
+
+	var jobIDs []string
+	for rows.Next() {
+		var jobID string
+		if err := rows.Scan(&jobID); err != nil {
+			return nil, fmt.Errorf("failed to read timed out shard: %w", err)
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load timed out shards: %w", err)
+	}
+	return jobIDs, nil
+}
+
+func (s *jobStore) update(ctx context.Context, query string, args ...any) (bool, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update job: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update job: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *jobStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// enqueue writes an event to the outbox, to be published once the
+// transaction commits.
+func enqueue(ctx context.Context, tx *sql.Tx, ownerID, routingKey string, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", routingKey, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO outbox (routing_key, owner_id, data) VALUES ($1, $2, $3)`,
+		routingKey, ownerID, string(data)); err != nil {
+		return fmt.Errorf("failed to queue %s event: %w", routingKey, err)
+	}
+	return nil
+}
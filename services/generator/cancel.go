@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/kacperborowieckb/gen-sql/shared/gen/proto"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// cancelledTTL is how long a cancelled job is remembered, to skip its
+// messages still queued.
+const cancelledTTL = 24 * time.Hour
+
+var (
+	errCancelled = errors.New("job cancelled")
+	errShutdown  = errors.New("generator stopping")
+)
+
+// jobRegistry keeps the jobs a generator is working on, to stop them when
+// they are cancelled or the generator stops, and the jobs cancelled lately.
+// Cancellations received before the generator started are read from the
+// data service, see startJob.
+type jobRegistry struct {
+	mu        sync.Mutex
+	running   map[*runningJob]bool
+	cancelled map[string]time.Time
+	stopping  bool
+	wg        sync.WaitGroup
+}
+
+type runningJob struct {
+	jobID  string
+	cancel context.CancelCauseFunc
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		running:   make(map[*runningJob]bool),
+		cancelled: make(map[string]time.Time),
+	}
+}
+
+// start registers work on a job and returns the context that is cancelled
+// with it and the func that ends the work. It fails with errCancelled when
+// the job is cancelled already and errShutdown when the generator is
+// stopping. Jobs without an ID cannot be cancelled.
+func (r *jobRegistry) start(jobID string) (context.Context, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopping {
+		return nil, nil, errShutdown
+	}
+	if _, ok := r.cancelled[jobID]; ok && jobID != "" {
+		return nil, nil, errCancelled
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	j := &runningJob{jobID: jobID, cancel: cancel}
+	r.running[j] = true
+	r.wg.Add(1)
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.running, j)
+		r.mu.Unlock()
+		cancel(nil)
+		r.wg.Done()
+	}, nil
+}
+
+// statusCancelled is the status the data service reports for cancelled
+// jobs.
+const statusCancelled = "cancelled"
+
+// startJob registers work on a job like jobRegistry.start, once the data
+// service confirms the job was not cancelled. A job whose status cannot be
+// read is started; its cancellation still stops it when it is received.
+func (s *generatorServer) startJob(jobID, projectID string) (context.Context, func(), error) {
+	if jobID != "" && s.cancelledInStore(jobID, projectID) {
+		s.jobs.cancel(jobID)
+	}
+	return s.jobs.start(jobID)
+}
+
+// cancelledInStore reports whether the data service has a job as cancelled.
+func (s *generatorServer) cancelledInStore(jobID, projectID string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := s.dataClient.GetGenerationJob(ctx, &pb.GetGenerationJobRequest{
+		ProjectId:       projectID,
+		GenerationJobId: jobID,
+	})
+	if err != nil {
+		log.Printf("Failed to read the status of job %s: %v", jobID, err)
+		return false
+	}
+	return resp.Status == statusCancelled
+}
+
+// cancel stops the work on a job, if any, and remembers it is cancelled.
+func (r *jobRegistry) cancel(jobID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for id, at := range r.cancelled {
+		if now.Sub(at) > cancelledTTL {
+			delete(r.cancelled, id)
+		}
+	}
+	r.cancelled[jobID] = now
+
+	stopped := false
+	for j := range r.running {
+		if j.jobID == jobID {
+			j.cancel(errCancelled)
+			stopped = true
+		}
+	}
+	return stopped
+}
+
+// stop stops the work under way, for its messages to be delivered again,
+// and waits at most timeout for it to end.
+func (r *jobRegistry) stop(timeout time.Duration) {
+	r.mu.Lock()
+	r.stopping = true
+	for j := range r.running {
+		j.cancel(errShutdown)
+	}
+	r.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		log.Printf("Jobs still running after %v", timeout)
+	}
+}
+
+// interrupted handles work on a job that did not start or did not finish
+// since cause stopped it: work of a cancelled job is dropped, work the
+// generator stopped is requeued, to resume from its last checkpoint.
+func interrupted(cause error, what string) error {
+	if errors.Is(cause, errShutdown) {
+		log.Printf("Requeueing %s, the generator is stopping", what)
+		return messaging.Requeue(cause)
+	}
+	log.Printf("Cancelled %s", what)
+	return nil
+}
+
+// handleCancel stops a cancelled job and removes its shards and
+// checkpoints. The generator working on it cleans up the rest of its
+// output once it stops.
+func (s *generatorServer) handleCancel(d amqp.Delivery) error {
+	var event messaging.GenerationCancelEvent
+	if err := decodeEvent(d, "GenerationCancelEvent", &event); err != nil {
+		return err
+	}
+	if event.JobID == "" {
+		return nil
+	}
+
+	if s.jobs.cancel(event.JobID) {
+		log.Printf("Stopping cancelled job %s of project %s", event.JobID, event.ProjectID)
+	}
+	s.removeShards(messaging.ProjectCreatedEvent{ProjectID: event.ProjectID, JobID: event.JobID})
+	s.clearCheckpoints(event.JobID)
+	return nil
+}
+
+// discard removes the partial output at path of a job that failed since
+// its context stopped it.
+func discard(ctx context.Context, err error, path string) {
+	if err == nil || ctx.Err() == nil || path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove partial output %s: %v", path, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package checkpoint records in PostgreSQL how far generation jobs got, so
+// that a job delivered again after its generator stopped resumes where it
+// left off.
+package checkpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Checkpoint is a range of rows of a table generated for a job, whose parts
+// are kept until the job's output is written. Generation draws every range
+// of rows from a random source of its own, derived from the seed, the table
+// and the range, so Seed and First are the random state to resume from.
+type Checkpoint struct {
+	JobID string
+	Table string
+	First int64
+	Rows  int64
+	Seed  int64
+	// Fingerprint identifies what the rows are generated from, see
+	// Fingerprint
+	Fingerprint string
+}
+
+// Key identifies the checkpoint of a range of rows within its job.
+func Key(table string, first int64) string {
+	return fmt.Sprintf("%s:%d", table, first)
+}
+
+// Fingerprint hashes the event a job is generated from, with its
+// instructions resolved to rules. Checkpoints of a job whose fingerprint
+// changed, e.g. since free-text instructions were read differently, are
+// not resumed from.
+func Fingerprint(event any) (string, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal job: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Migrations create and upgrade the checkpoints table, see db.Migrator.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+// Store keeps checkpoints in the generation_checkpoints table.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Has reports whether a checkpoint of the same range, seed and fingerprint
+// is recorded.
+func (s *Store) Has(ctx context.Context, c Checkpoint) (bool, error) {
+	var found bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (
+	SELECT 1 FROM generation_checkpoints
+	WHERE job_id = $1 AND table_name = $2 AND first_row = $3
+		AND row_count = $4 AND seed = $5 AND fingerprint = $6
+)`, c.JobID, c.Table, c.First, c.Rows, c.Seed, c.Fingerprint).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up checkpoint of job %s: %w", c.JobID, err)
+	}
+	return found, nil
+}
+
+// Save records a checkpoint, replacing an earlier one of the same range.
+func (s *Store) Save(ctx context.Context, c Checkpoint) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO generation_checkpoints
+	(job_id, table_name, first_row, row_count, seed, fingerprint)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (job_id, table_name, first_row) DO UPDATE
+SET row_count = EXCLUDED.row_count, seed = EXCLUDED.seed,
+	fingerprint = EXCLUDED.fingerprint, created_at = now()`,
+		c.JobID, c.Table, c.First, c.Rows, c.Seed, c.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %s of job %s: %w", Key(c.Table, c.First), c.JobID, err)
+	}
+	return nil
+}
+
+// Clear removes the checkpoints of a job once its output is written or it
+// is cancelled.
+func (s *Store) Clear(ctx context.Context, jobID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM generation_checkpoints WHERE job_id = $1`, jobID); err != nil {
+		return fmt.Errorf("failed to clear checkpoints of job %s: %w", jobID, err)
+	}
+	return nil
+}
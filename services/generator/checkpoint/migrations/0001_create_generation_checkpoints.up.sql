@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS generation_checkpoints (
+	job_id      text        NOT NULL,
+	table_name  text        NOT NULL,
+	first_row   bigint      NOT NULL,
+	row_count   bigint      NOT NULL,
+	seed        bigint      NOT NULL,
+	fingerprint text        NOT NULL,
+	created_at  timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (job_id, table_name, first_row)
+);
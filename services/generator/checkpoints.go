@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/checkpoint"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+)
+
+// runCheckpointed generates a job of more rows than checkpointRows in
+// shards of about that many rows, one after the other, recording a
+// checkpoint as each is written, then assembles its output. A job
+// delivered again resumes after its last checkpoint; shards cut on the
+// ranges Stream generates, so the output is the same either way. It
+// reports whether the job was large enough.
+func (s *generatorServer) runCheckpointed(ctx context.Context, event messaging.ProjectCreatedEvent, j *job) (bool, error) {
+	layout, err := engine.Layout(j.schema, j.plan, j.opts)
+	if err != nil {
+		return false, err
+	}
+	var total int64
+	for _, tl := range layout {
+		total += tl.Rows
+	}
+	if total <= s.checkpointRows {
+		return false, nil
+	}
+
+	if err := s.resume(ctx, event, j, layout); err != nil {
+		// a job the generator stopped keeps its shards for the next attempt
+		if !errors.Is(context.Cause(ctx), errShutdown) {
+			s.removeShards(event)
+			s.clearCheckpoints(event.JobID)
+		}
+		return true, err
+	}
+	return true, nil
+}
+
+// resume generates the shards of a job not checkpointed yet and assembles
+// them.
+func (s *generatorServer) resume(ctx context.Context, event messaging.ProjectCreatedEvent, j *job, layout []engine.TableLayout) error {
+	resolved, err := resolvedEvent(event, j)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := checkpoint.Fingerprint(resolved)
+	if err != nil {
+		return err
+	}
+	dir := s.shardsDir(event)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// split tables are cut on multiples of the shard unit
+	size := max(engine.ShardRows, s.checkpointRows/engine.ShardRows*engine.ShardRows)
+	var shards []engine.Shard
+	for _, tl := range layout {
+		if !tl.Split || tl.Rows <= size {
+			shards = append(shards, engine.Shard{Table: tl.Table, Rows: tl.Rows})
+			continue
+		}
+		for first := int64(0); first < tl.Rows; first += size {
+			shards = append(shards, engine.Shard{Table: tl.Table, First: first, Rows: min(size, tl.Rows-first)})
+		}
+	}
+
+	start := time.Now()
+	resumed := 0
+	for _, shard := range shards {
+		name := shard.Table.QualifiedName()
+		c := checkpoint.Checkpoint{
+			JobID:       event.JobID,
+			Table:       name,
+			First:       shard.First,
+			Rows:        shard.Rows,
+			Seed:        event.Seed,
+			Fingerprint: fingerprint,
+		}
+		progress := s.newProgress(event, checkpoint.Key(name, shard.First))
+		if s.resumable(ctx, j, c, shard, dir) {
+			progress.update(shard.Table, shard.Rows, shard.Rows)
+			progress.flush()
+			resumed++
+			continue
+		}
+
+		j.opts.Progress = progress.update
+		err := engine.GenerateShard(j.schema, j.plan, j.opts, shard, dir)
+		progress.flush()
+		if err != nil {
+			return err
+		}
+		s.saveCheckpoint(c)
+	}
+	if resumed > 0 {
+		log.Printf("Resumed job %s of project %s after %d of its %d checkpoints", event.JobID, event.ProjectID, resumed, len(shards))
+	}
+	log.Printf("Generated %d checkpoints of job %s in %v", len(shards)-resumed, event.JobID, time.Since(start).Round(time.Millisecond))
+
+	j.opts.Progress = nil
+	result, path, err := s.generate(ctx, event, j.plan, func(sink engine.Sink) (*engine.Result, error) {
+		return engine.Assemble(j.schema, j.plan, j.opts, dir, sink)
+	})
+	if err != nil {
+		return err
+	}
+	s.report(event, result, path)
+	s.removeShards(event)
+	s.clearCheckpoints(event.JobID)
+	return nil
+}
+
+// resumable reports whether a shard is checkpointed and its parts are in
+// dir. Without the checkpoints at hand the shard is generated again.
+func (s *generatorServer) resumable(ctx context.Context, j *job, c checkpoint.Checkpoint, shard engine.Shard, dir string) bool {
+	done, err := s.checkpoints.Has(ctx, c)
+	if err != nil {
+		log.Printf("Failed to resume from checkpoint: %v", err)
+		return false
+	}
+	return done && engine.ShardGenerated(j.plan, shard, dir)
+}
+
+// saveCheckpoint records a generated shard. A checkpoint that could not be
+// saved only costs generating the shard again if the job is resumed.
+func (s *generatorServer) saveCheckpoint(c checkpoint.Checkpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.checkpoints.Save(ctx, c); err != nil {
+		log.Printf("Failed to save checkpoint: %v", err)
+	}
+}
+
+// clearCheckpoints removes the checkpoints of a job that is done with.
+func (s *generatorServer) clearCheckpoints(jobID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.checkpoints.Clear(ctx, jobID); err != nil {
+		log.Printf("Failed to clear checkpoints: %v", err)
+	}
+}
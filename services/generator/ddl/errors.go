@@ -0,0 +1,11 @@
+package ddl
+
+// Error is a DDL parse error that points at the offending source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
@@ -0,0 +1,617 @@
+package ddl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node is a parsed SQL expression.
+type Node interface {
+	String() string
+}
+
+// ColumnRef is a reference to a column of the row being checked.
+type ColumnRef struct {
+	Name string
+}
+
+// Literal is a constant: int64, float64, string, bool or nil for NULL.
+// Numeric literals with a fractional part are kept as float64.
+type Literal struct {
+	Value any
+}
+
+type Unary struct {
+	Op string // "not", "-" or "+"
+	X  Node
+}
+
+// Binary is an infix operator. Keyword operators (and, or, like, ilike)
+// are lower case.
+type Binary struct {
+	Op   string
+	L, R Node
+}
+
+type IsNull struct {
+	X   Node
+	Not bool
+}
+
+// In is x [NOT] IN (list), which also represents x = ANY (ARRAY[...]).
+type In struct {
+	X    Node
+	List []Node
+	Not  bool
+}
+
+type Between struct {
+	X, Lo, Hi Node
+	Not       bool
+}
+
+// Call is a function call; Name is lower case and unqualified.
+type Call struct {
+	Name string
+	Args []Node
+}
+
+type Cast struct {
+	X    Node
+	Type Type
+}
+
+func (n *ColumnRef) String() string { return n.Name }
+
+func (n *Literal) String() string {
+	switch v := n.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (n *Unary) String() string {
+	if n.Op == "not" {
+		return "NOT " + n.X.String()
+	}
+	return n.Op + n.X.String()
+}
+
+func (n *Binary) String() string {
+	return "(" + n.L.String() + " " + strings.ToUpper(n.Op) + " " + n.R.String() + ")"
+}
+
+func (n *IsNull) String() string {
+	if n.Not {
+		return n.X.String() + " IS NOT NULL"
+	}
+	return n.X.String() + " IS NULL"
+}
+
+func (n *In) String() string {
+	items := make([]string, len(n.List))
+	for i, item := range n.List {
+		items[i] = item.String()
+	}
+	op := " IN "
+	if n.Not {
+		op = " NOT IN "
+	}
+	return n.X.String() + op + "(" + strings.Join(items, ", ") + ")"
+}
+
+func (n *Between) String() string {
+	op := " BETWEEN "
+	if n.Not {
+		op = " NOT BETWEEN "
+	}
+	return n.X.String() + op + n.Lo.String() + " AND " + n.Hi.String()
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *Cast) String() string {
+	return n.X.String() + "::" + n.Type.String()
+}
+
+// ParseExpr parses the text of a CHECK, DEFAULT or index predicate
+// expression. Error positions refer to the original DDL source.
+func ParseExpr(e *Expr) (Node, error) {
+	tokens, err := lex(e.Text)
+	if err != nil {
+		return nil, shiftError(err, e.Pos)
+	}
+	for i := range tokens {
+		tokens[i].pos = shift(tokens[i].pos, e.Pos)
+	}
+
+	p := &parser{src: e.Text, tokens: tokens}
+	n, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEOF() {
+		return nil, p.unexpected(p.peek(), "in expression")
+	}
+	return n, nil
+}
+
+func shift(pos, base Pos) Pos {
+	if pos.Line == 1 {
+		return Pos{Line: base.Line, Column: base.Column + pos.Column - 1}
+	}
+	return Pos{Line: base.Line + pos.Line - 1, Column: pos.Column}
+}
+
+func shiftError(err error, base Pos) error {
+	if pe, ok := err.(*Error); ok {
+		return &Error{Pos: shift(pe.Pos, base), Msg: pe.Msg}
+	}
+	return err
+}
+
+// binding powers, loosely following PostgreSQL operator precedence
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precIs
+	precCompare
+	precLike
+	precOther
+	precAdd
+	precMul
+	precUnary
+	precCast
+)
+
+func binaryPrec(t token) int {
+	switch {
+	case t.is("or"):
+		return precOr
+	case t.is("and"):
+		return precAnd
+	case t.is("is") || t.is("isnull") || t.is("notnull"):
+		return precIs
+	case t.kind == tokOp && (t.text == "=" || t.text == "<>" || t.text == "!=" ||
+		t.text == "<" || t.text == ">" || t.text == "<=" || t.text == ">="):
+		return precCompare
+	case t.is("like") || t.is("ilike") || t.is("in") || t.is("between") || t.is("similar") || t.is("not"):
+		return precLike
+	case t.kind == tokOp && (t.text == "+" || t.text == "-"):
+		return precAdd
+	case t.kind == tokOp && (t.text == "*" || t.text == "/" || t.text == "%"):
+		return precMul
+	case t.is("::"):
+		return precCast
+	case t.kind == tokOp && t.text != "(" && t.text != ")" && t.text != "," && t.text != "[" && t.text != "]" && t.text != ";" && t.text != ".":
+		return precOther
+	}
+	return 0
+}
+
+func (p *parser) parseExpr(minPrec int) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec := binaryPrec(t)
+		if prec == 0 || prec <= minPrec {
+			return left, nil
+		}
+
+		switch {
+		case t.is("::"):
+			p.advance()
+			typ, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			left = &Cast{X: left, Type: typ}
+
+		case t.is("is"):
+			p.advance()
+			not := p.acceptKeyword("not")
+			switch {
+			case p.acceptKeyword("null"):
+				left = &IsNull{X: left, Not: not}
+			case p.peek().is("true") || p.peek().is("false"):
+				val := p.advance().text == "true"
+				var n Node = &Binary{Op: "=", L: left, R: &Literal{Value: val}}
+				if not {
+					n = &Unary{Op: "not", X: n}
+				}
+				left = n
+			case p.peek().is("distinct"):
+				p.advance()
+				if err := p.expectKeyword("from"); err != nil {
+					return nil, err
+				}
+				right, err := p.parseExpr(precIs)
+				if err != nil {
+					return nil, err
+				}
+				op := "is distinct from"
+				if not {
+					op = "is not distinct from"
+				}
+				left = &Binary{Op: op, L: left, R: right}
+			default:
+				return nil, p.unexpected(p.peek(), "after IS")
+			}
+
+		case t.is("isnull") || t.is("notnull"):
+			p.advance()
+			left = &IsNull{X: left, Not: t.text == "notnull"}
+
+		case t.is("not"):
+			// NOT IN, NOT LIKE, NOT BETWEEN
+			next := p.peekAt(1)
+			if !next.is("in") && !next.is("like") && !next.is("ilike") && !next.is("between") {
+				return left, nil
+			}
+			p.advance()
+			n, err := p.parseInfixKeyword(left, precLike)
+			if err != nil {
+				return nil, err
+			}
+			switch n := n.(type) {
+			case *In:
+				n.Not = true
+				left = n
+			case *Between:
+				n.Not = true
+				left = n
+			default:
+				left = &Unary{Op: "not", X: n}
+			}
+
+		case t.is("in") || t.is("like") || t.is("ilike") || t.is("between") || t.is("similar"):
+			n, err := p.parseInfixKeyword(left, precLike)
+			if err != nil {
+				return nil, err
+			}
+			left = n
+
+		default:
+			p.advance()
+			op := t.text
+			if op == "!=" {
+				op = "<>"
+			}
+			if precCompare == prec && (p.peek().is("any") || p.peek().is("some") || p.peek().is("all")) {
+				n, err := p.parseQuantified(left, op)
+				if err != nil {
+					return nil, err
+				}
+				left = n
+				continue
+			}
+			right, err := p.parseExpr(prec)
+			if err != nil {
+				return nil, err
+			}
+			left = &Binary{Op: op, L: left, R: right}
+		}
+	}
+}
+
+func (p *parser) parseInfixKeyword(left Node, prec int) (Node, error) {
+	t := p.advance()
+	switch t.text {
+	case "in":
+		list, err := p.parseExprList("(", ")")
+		if err != nil {
+			return nil, err
+		}
+		return &In{X: left, List: list}, nil
+	case "between":
+		p.acceptKeyword("symmetric")
+		lo, err := p.parseExpr(precLike)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		hi, err := p.parseExpr(precLike)
+		if err != nil {
+			return nil, err
+		}
+		return &Between{X: left, Lo: lo, Hi: hi}, nil
+	case "similar":
+		if err := p.expectKeyword("to"); err != nil {
+			return nil, err
+		}
+		right, err := p.parseExpr(prec)
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: "similar to", L: left, R: right}, nil
+	default:
+		right, err := p.parseExpr(prec)
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: t.text, L: left, R: right}, nil
+	}
+}
+
+// parseQuantified handles x op ANY (ARRAY[...]) / ALL (...), the form in
+// which PostgreSQL stores IN lists.
+func (p *parser) parseQuantified(left Node, op string) (Node, error) {
+	quant := p.advance().text
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	var list []Node
+	if p.peek().is("array") {
+		p.advance()
+		items, err := p.parseExprList("[", "]")
+		if err != nil {
+			return nil, err
+		}
+		list = items
+	} else {
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		list = []Node{inner}
+		// ANY ((ARRAY[...])::text[]) as written by pg_dump
+		if cast, ok := inner.(*Cast); ok {
+			inner = cast.X
+		}
+		if call, ok := inner.(*Call); ok && call.Name == "array" {
+			list = call.Args
+		}
+	}
+	// a trailing cast such as ARRAY[...]::text[] does not change the list
+	for p.peek().is("::") {
+		p.advance()
+		if _, err := p.parseType(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case op == "=" && quant != "all":
+		return &In{X: left, List: list}, nil
+	case op == "<>" && quant == "all":
+		return &In{X: left, List: list, Not: true}, nil
+	}
+	return &Call{Name: op + " " + quant, Args: append([]Node{left}, list...)}, nil
+}
+
+func (p *parser) parseExprList(open, close string) ([]Node, error) {
+	if err := p.expectOp(open); err != nil {
+		return nil, err
+	}
+	var list []Node
+	if p.peek().is(close) {
+		p.advance()
+		return list, nil
+	}
+	for {
+		n, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+		if p.peek().is(close) {
+			p.advance()
+			return list, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parsePrefix() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.advance()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &Literal{Value: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return &Literal{Value: f}, nil
+
+	case tokString:
+		p.advance()
+		return &Literal{Value: t.text}, nil
+
+	case tokQuotedIdent:
+		p.advance()
+		return p.parseNameTail(t.text)
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			p.advance()
+			n, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "-", "+":
+			p.advance()
+			x, err := p.parseExpr(precUnary)
+			if err != nil {
+				return nil, err
+			}
+			if lit, ok := x.(*Literal); ok && t.text == "-" {
+				switch v := lit.Value.(type) {
+				case int64:
+					return &Literal{Value: -v}, nil
+				case float64:
+					return &Literal{Value: -v}, nil
+				}
+			}
+			return &Unary{Op: t.text, X: x}, nil
+		}
+
+	case tokIdent:
+		switch t.text {
+		case "null":
+			p.advance()
+			return &Literal{Value: nil}, nil
+		case "true", "false":
+			p.advance()
+			return &Literal{Value: t.text == "true"}, nil
+		case "not":
+			p.advance()
+			x, err := p.parseExpr(precNot)
+			if err != nil {
+				return nil, err
+			}
+			return &Unary{Op: "not", X: x}, nil
+		case "array":
+			p.advance()
+			items, err := p.parseExprList("[", "]")
+			if err != nil {
+				return nil, err
+			}
+			return &Call{Name: "array", Args: items}, nil
+		case "cast":
+			p.advance()
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			x, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("as"); err != nil {
+				return nil, err
+			}
+			typ, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return &Cast{X: x, Type: typ}, nil
+		case "current_date", "current_timestamp", "localtimestamp", "current_time", "localtime", "current_user", "session_user":
+			p.advance()
+			return &Call{Name: t.text}, nil
+		case "case":
+			return nil, p.errorf(t, "CASE expressions are not supported")
+		}
+		// typed literals such as DATE '2020-01-01'
+		if canonical, ok := typeAliases[t.text]; ok && p.peekAt(1).kind == tokString {
+			p.advance()
+			lit := p.advance()
+			return &Cast{X: &Literal{Value: lit.text}, Type: Type{Name: canonical}}, nil
+		}
+		p.advance()
+		return p.parseNameTail(t.text)
+	}
+
+	return nil, p.unexpected(t, "in expression")
+}
+
+// parseNameTail finishes a column reference or function call whose first
+// name part has been consumed.
+func (p *parser) parseNameTail(name string) (Node, error) {
+	for p.peek().is(".") {
+		p.advance()
+		part, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		name = part // drop table and schema qualifiers
+	}
+
+	if !p.peek().is("(") {
+		return &ColumnRef{Name: name}, nil
+	}
+
+	p.advance()
+	call := &Call{Name: name}
+	if p.peek().is(")") {
+		p.advance()
+		return call, nil
+	}
+	p.acceptKeyword("distinct")
+	for {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if p.peek().is(")") {
+			p.advance()
+			return call, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Columns returns the names of the columns an expression refers to.
+func Columns(n Node) []string {
+	var cols []string
+	seen := make(map[string]bool)
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *ColumnRef:
+			if !seen[n.Name] {
+				seen[n.Name] = true
+				cols = append(cols, n.Name)
+			}
+		case *Unary:
+			walk(n.X)
+		case *Binary:
+			walk(n.L)
+			walk(n.R)
+		case *IsNull:
+			walk(n.X)
+		case *In:
+			walk(n.X)
+			for _, item := range n.List {
+				walk(item)
+			}
+		case *Between:
+			walk(n.X)
+			walk(n.Lo)
+			walk(n.Hi)
+		case *Call:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *Cast:
+			walk(n.X)
+		}
+	}
+	walk(n)
+	return cols
+}
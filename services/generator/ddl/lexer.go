@@ -0,0 +1,346 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+// Pos is a 1-based line/column position in the DDL source.
+type Pos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+type token struct {
+	kind  tokenKind
+	text  string // identifiers are lower-cased unless quoted, strings are unescaped
+	pos   Pos
+	start int // byte offsets into the source, used to recover expression text
+	end   int
+}
+
+// is reports whether the token is the given keyword or operator.
+func (t token) is(s string) bool {
+	return (t.kind == tokIdent || t.kind == tokOp) && t.text == s
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return fmt.Sprintf("string '%s'", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+type lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1, col: 1}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) peekRune(ahead int) rune {
+	off := l.off
+	for i := 0; i < ahead; i++ {
+		if off >= len(l.src) {
+			return 0
+		}
+		_, size := utf8.DecodeRuneInString(l.src[off:])
+		off += size
+	}
+	if off >= len(l.src) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[off:])
+	return r
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.off:])
+	l.off += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{Line: l.line, Column: l.col}
+}
+
+func (l *lexer) errorf(pos Pos, format string, args ...any) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.off < len(l.src) {
+		r := l.peekRune(0)
+		switch {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '-' && l.peekRune(1) == '-':
+			for l.off < len(l.src) && l.peekRune(0) != '\n' {
+				l.advance()
+			}
+		case r == '/' && l.peekRune(1) == '*':
+			start := l.pos()
+			l.advance()
+			l.advance()
+			depth := 1
+			for depth > 0 {
+				if l.off >= len(l.src) {
+					return l.errorf(start, "unterminated block comment")
+				}
+				switch {
+				case l.peekRune(0) == '/' && l.peekRune(1) == '*':
+					l.advance()
+					l.advance()
+					depth++
+				case l.peekRune(0) == '*' && l.peekRune(1) == '/':
+					l.advance()
+					l.advance()
+					depth--
+				default:
+					l.advance()
+				}
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+const opChars = "+-*/<>=~!@#%^&|`?"
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+
+	start := l.off
+	pos := l.pos()
+	tok := func(kind tokenKind, text string) (token, error) {
+		return token{kind: kind, text: text, pos: pos, start: start, end: l.off}, nil
+	}
+
+	if l.off >= len(l.src) {
+		return tok(tokEOF, "")
+	}
+
+	r := l.peekRune(0)
+	switch {
+	case (r == 'e' || r == 'E') && l.peekRune(1) == '\'':
+		l.advance()
+		s, err := l.quoted('\'', true)
+		if err != nil {
+			return token{}, err
+		}
+		return tok(tokString, s)
+
+	case isIdentStart(r):
+		for l.off < len(l.src) && isIdentPart(l.peekRune(0)) {
+			l.advance()
+		}
+		return tok(tokIdent, strings.ToLower(l.src[start:l.off]))
+
+	case r == '"':
+		s, err := l.quoted('"', false)
+		if err != nil {
+			return token{}, err
+		}
+		if s == "" {
+			return token{}, l.errorf(pos, "zero-length quoted identifier")
+		}
+		return tok(tokQuotedIdent, s)
+
+	case r == '\'':
+		s, err := l.quoted('\'', false)
+		if err != nil {
+			return token{}, err
+		}
+		return tok(tokString, s)
+
+	case r == '$' && (l.peekRune(1) == '$' || isIdentStart(l.peekRune(1))):
+		s, err := l.dollarQuoted()
+		if err != nil {
+			return token{}, err
+		}
+		return tok(tokString, s)
+
+	case unicode.IsDigit(r) || (r == '.' && unicode.IsDigit(l.peekRune(1))):
+		l.number()
+		return tok(tokNumber, l.src[start:l.off])
+
+	case r == ':' && l.peekRune(1) == ':':
+		l.advance()
+		l.advance()
+		return tok(tokOp, "::")
+
+	case strings.ContainsRune("(),;.[]:", r):
+		l.advance()
+		return tok(tokOp, string(r))
+
+	case strings.ContainsRune(opChars, r):
+		end := start
+		for end < len(l.src) && strings.ContainsRune(opChars, rune(l.src[end])) {
+			// stop before a comment start so "a>=-- x" still lexes sanely
+			if end > start && (strings.HasPrefix(l.src[end:], "--") || strings.HasPrefix(l.src[end:], "/*")) {
+				break
+			}
+			end++
+		}
+		// as in PostgreSQL, an operator only ends in + or - when it has one
+		// of ~!@#%^&|`? in it, so x>-1 is x > -1
+		if !strings.ContainsAny(l.src[start:end], "~!@#%^&|`?") {
+			for end-start > 1 && strings.ContainsRune("+-", rune(l.src[end-1])) {
+				end--
+			}
+		}
+		for l.off < end {
+			l.advance()
+		}
+		return tok(tokOp, l.src[start:l.off])
+	}
+
+	return token{}, l.errorf(pos, "unexpected character %q", r)
+}
+
+func (l *lexer) number() {
+	for unicode.IsDigit(l.peekRune(0)) {
+		l.advance()
+	}
+	if l.peekRune(0) == '.' && l.peekRune(1) != '.' {
+		l.advance()
+		for unicode.IsDigit(l.peekRune(0)) {
+			l.advance()
+		}
+	}
+	if r := l.peekRune(0); r == 'e' || r == 'E' {
+		next := l.peekRune(1)
+		if unicode.IsDigit(next) || ((next == '+' || next == '-') && unicode.IsDigit(l.peekRune(2))) {
+			l.advance()
+			l.advance()
+			for unicode.IsDigit(l.peekRune(0)) {
+				l.advance()
+			}
+		}
+	}
+}
+
+// quoted reads a string delimited by q, where a doubled q is an escaped q.
+// With backslashEscapes it also understands PostgreSQL E'...' escape sequences.
+func (l *lexer) quoted(q rune, backslashEscapes bool) (string, error) {
+	start := l.pos()
+	l.advance()
+
+	var sb strings.Builder
+	for {
+		if l.off >= len(l.src) {
+			if q == '"' {
+				return "", l.errorf(start, "unterminated quoted identifier")
+			}
+			return "", l.errorf(start, "unterminated string literal")
+		}
+		r := l.advance()
+		switch {
+		case r == q && l.peekRune(0) == q:
+			l.advance()
+			sb.WriteRune(q)
+		case r == q:
+			return sb.String(), nil
+		case backslashEscapes && r == '\\' && l.off < len(l.src):
+			e := l.advance()
+			switch e {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case 'b':
+				sb.WriteRune('\b')
+			case 'f':
+				sb.WriteRune('\f')
+			default:
+				sb.WriteRune(e)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+}
+
+func (l *lexer) dollarQuoted() (string, error) {
+	start := l.pos()
+	tagStart := l.off
+	l.advance()
+	for l.off < len(l.src) && l.peekRune(0) != '$' {
+		if !isIdentPart(l.peekRune(0)) {
+			return "", l.errorf(start, "invalid dollar-quote tag")
+		}
+		l.advance()
+	}
+	if l.off >= len(l.src) {
+		return "", l.errorf(start, "unterminated dollar-quoted string")
+	}
+	l.advance()
+	tag := l.src[tagStart:l.off]
+
+	end := strings.Index(l.src[l.off:], tag)
+	if end < 0 {
+		return "", l.errorf(start, "unterminated dollar-quoted string")
+	}
+	body := l.src[l.off : l.off+end]
+	for l.off < len(l.src) && l.off < tagStart+len(tag)+end+len(tag) {
+		l.advance()
+	}
+	return body, nil
+}
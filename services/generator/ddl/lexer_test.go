@@ -0,0 +1,70 @@
+package ddl
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLexOperators(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"x>-1", []string{"x", ">", "-", "1"}},
+		{"x<=-5", []string{"x", "<=", "-", "5"}},
+		{"x*-2", []string{"x", "*", "-", "2"}},
+		{"x=+3", []string{"x", "=", "+", "3"}},
+		{"x<>-1", []string{"x", "<>", "-", "1"}},
+		{"x>=-- comment\n1", []string{"x", ">=", "1"}},
+		{"a @- b", []string{"a", "@-", "b"}},
+		{"a !=- b", []string{"a", "!=-", "b"}},
+		{"a - b", []string{"a", "-", "b"}},
+		{"x::int", []string{"x", "::", "int"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			toks, err := lex(tt.src)
+			if err != nil {
+				t.Fatalf("lex: %v", err)
+			}
+			var got []string
+			for _, tok := range toks {
+				if tok.kind != tokEOF {
+					got = append(got, tok.text)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexTokens(t *testing.T) {
+	tests := []struct {
+		src  string
+		kind tokenKind
+		text string
+	}{
+		{"Users", tokIdent, "users"},
+		{`"Users"`, tokQuotedIdent, "Users"},
+		{`"a""b"`, tokQuotedIdent, `a"b`},
+		{"'it''s'", tokString, "it's"},
+		{"E'a\\nb'", tokString, "a\nb"},
+		{"$$x$$", tokString, "x"},
+		{"$tag$a $$ b$tag$", tokString, "a $$ b"},
+		{"1.5e-3", tokNumber, "1.5e-3"},
+		{".5", tokNumber, ".5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			toks, err := lex(tt.src)
+			if err != nil {
+				t.Fatalf("lex: %v", err)
+			}
+			if len(toks) == 0 || toks[0].kind != tt.kind || toks[0].text != tt.text {
+				t.Errorf("got %+v, want %q of kind %d", toks[0], tt.text, tt.kind)
+			}
+		})
+	}
+}
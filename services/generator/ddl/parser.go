@@ -0,0 +1,1191 @@
+package ddl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a PostgreSQL DDL script into a Schema. CREATE TABLE and
+// ALTER TABLE ... ADD statements are modelled, everything else (extensions,
+// functions, grants, ...) is skipped. Errors are reported as *Error values.
+func Parse(src string) (*Schema, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: src, tokens: tokens}
+	s := &Schema{}
+
+	for !p.atEOF() {
+		if p.peek().is(";") {
+			p.advance()
+			continue
+		}
+
+		var err error
+		switch {
+		case p.peek().is("create"):
+			err = p.parseCreate(s)
+		case p.peek().is("alter"):
+			err = p.parseAlter(s)
+		default:
+			p.skipStatement()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.Tables) == 0 {
+		return nil, &Error{Pos: Pos{Line: 1, Column: 1}, Msg: "no CREATE TABLE statements found"}
+	}
+
+	if err := s.resolve(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.i+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.i+n]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) atEOF() bool {
+	return p.peek().kind == tokEOF
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &Error{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) unexpected(t token, context string) error {
+	return p.errorf(t, "unexpected %s %s", t.describe(), context)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.peek().kind == tokIdent && p.peek().text == kw {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf(p.peek(), "expected %s, got %s", strings.ToUpper(kw), p.peek().describe())
+	}
+	return nil
+}
+
+func (p *parser) expectOp(op string) error {
+	if p.peek().kind != tokOp || p.peek().text != op {
+		return p.errorf(p.peek(), "expected %q, got %s", op, p.peek().describe())
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) parseIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent && t.kind != tokQuotedIdent {
+		return "", p.errorf(t, "expected identifier, got %s", t.describe())
+	}
+	p.advance()
+	return t.text, nil
+}
+
+func (p *parser) parseQualifiedName() (string, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", err
+	}
+	for p.peek().is(".") {
+		p.advance()
+		part, err := p.parseIdent()
+		if err != nil {
+			return "", err
+		}
+		name += "." + part
+	}
+	return name, nil
+}
+
+func (p *parser) parseInt() (int, error) {
+	t := p.peek()
+	neg := false
+	if t.is("-") {
+		neg = true
+		p.advance()
+		t = p.peek()
+	}
+	if t.kind != tokNumber {
+		return 0, p.errorf(t, "expected integer, got %s", t.describe())
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return 0, p.errorf(t, "invalid integer %q", t.text)
+	}
+	p.advance()
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+func (p *parser) parseIdentList() ([]string, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if p.peek().is(")") {
+			p.advance()
+			return names, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipStatement skips tokens up to and including the next top-level ';'.
+func (p *parser) skipStatement() {
+	depth := 0
+	for !p.atEOF() {
+		t := p.advance()
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")") && depth > 0:
+			depth--
+		case t.is(";") && depth == 0:
+			return
+		}
+	}
+}
+
+// skipGroup skips a balanced parenthesised group starting at the current token.
+func (p *parser) skipGroup() error {
+	open := p.peek()
+	if err := p.expectOp("("); err != nil {
+		return err
+	}
+	depth := 1
+	for depth > 0 {
+		t := p.advance()
+		switch {
+		case t.kind == tokEOF:
+			return p.errorf(open, "unbalanced parentheses")
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		}
+	}
+	return nil
+}
+
+// skipElement skips to the next ',' or ')' that closes the current list.
+func (p *parser) skipElement() error {
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokEOF:
+			return p.errorf(t, "unexpected end of input")
+		case t.is(",") || t.is(")"):
+			return nil
+		case t.is("("):
+			if err := p.skipGroup(); err != nil {
+				return err
+			}
+		default:
+			p.advance()
+		}
+	}
+}
+
+func (p *parser) exprFrom(first, last token) *Expr {
+	return &Expr{Text: strings.TrimSpace(p.src[first.start:last.end]), Pos: first.pos}
+}
+
+// parseParenExpr returns the text inside a balanced parenthesised expression.
+func (p *parser) parseParenExpr() (*Expr, error) {
+	open := p.peek()
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	if p.peek().is(")") {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+	first := p.peek()
+	last := first
+	depth := 1
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokEOF:
+			return nil, p.errorf(open, "unbalanced parentheses")
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				p.advance()
+				return p.exprFrom(first, last), nil
+			}
+		}
+		last = p.advance()
+	}
+}
+
+var columnConstraintStarts = map[string]bool{
+	"constraint": true, "not": true, "null": true, "primary": true, "unique": true,
+	"check": true, "references": true, "default": true, "generated": true, "collate": true,
+	"deferrable": true, "initially": true,
+}
+
+// parseDefaultExpr reads an unparenthesised DEFAULT expression, which ends at
+// the next column constraint keyword or list separator.
+func (p *parser) parseDefaultExpr() (*Expr, error) {
+	first := p.peek()
+	if first.kind == tokEOF || first.is(",") || first.is(")") {
+		return nil, p.errorf(first, "expected DEFAULT expression, got %s", first.describe())
+	}
+	last := p.advance()
+	depth := 0
+	if first.is("(") {
+		depth++
+	}
+	for {
+		t := p.peek()
+		if t.kind == tokEOF {
+			break
+		}
+		if depth == 0 {
+			if t.is(",") || t.is(")") || t.is(";") || (t.kind == tokIdent && columnConstraintStarts[t.text]) {
+				break
+			}
+		}
+		switch {
+		case t.is("("), t.is("["):
+			depth++
+		case t.is(")"), t.is("]"):
+			depth--
+		}
+		last = p.advance()
+	}
+	return p.exprFrom(first, last), nil
+}
+
+func (p *parser) parseCreate(s *Schema) error {
+	p.advance() // CREATE
+
+	if p.peek().is("or") && p.peekAt(1).is("replace") {
+		p.skipStatement()
+		return nil
+	}
+	p.acceptKeyword("global")
+	p.acceptKeyword("local")
+	if !p.acceptKeyword("temporary") && !p.acceptKeyword("temp") {
+		p.acceptKeyword("unlogged")
+	}
+
+	switch {
+	case p.acceptKeyword("table"):
+		return p.parseCreateTable(s)
+	case p.acceptKeyword("type"):
+		return p.parseCreateType(s)
+	case p.acceptKeyword("domain"):
+		return p.parseCreateDomain(s)
+	case p.peek().is("unique") && p.peekAt(1).is("index"):
+		p.advance()
+		p.advance()
+		return p.parseCreateUniqueIndex(s)
+	}
+	p.skipStatement()
+	return nil
+}
+
+// parseCreateUniqueIndex records unique indexes over plain columns as
+// table keys. Indexes on expressions such as lower(email) are skipped.
+func (p *parser) parseCreateUniqueIndex(s *Schema) error {
+	p.acceptKeyword("concurrently")
+	if p.peek().is("if") {
+		p.advance()
+		if err := p.expectKeyword("not"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("exists"); err != nil {
+			return err
+		}
+	}
+
+	key := &Key{Pos: p.peek().pos}
+	if !p.peek().is("on") {
+		name, err := p.parseIdent()
+		if err != nil {
+			return err
+		}
+		key.Name = name
+	}
+	if err := p.expectKeyword("on"); err != nil {
+		return err
+	}
+	p.acceptKeyword("only")
+
+	nameTok := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+	t := s.Table(name)
+	if t == nil {
+		return p.errorf(nameTok, "CREATE INDEX references unknown table %q", name)
+	}
+
+	if p.acceptKeyword("using") {
+		if _, err := p.parseIdent(); err != nil {
+			return err
+		}
+	}
+
+	if err := p.expectOp("("); err != nil {
+		return err
+	}
+	plain := true
+	for {
+		if p.peek().kind == tokIdent || p.peek().kind == tokQuotedIdent {
+			col := p.advance().text
+			if p.peek().is("(") {
+				// function call, e.g. lower(email)
+				plain = false
+				if err := p.skipGroup(); err != nil {
+					return err
+				}
+			} else {
+				key.Columns = append(key.Columns, col)
+			}
+		} else {
+			plain = false
+		}
+		// collation, operator class, ordering and anything unsupported
+		if err := p.skipElement(); err != nil {
+			return err
+		}
+		if p.peek().is(")") {
+			p.advance()
+			break
+		}
+		p.advance() // ,
+	}
+
+	for !p.atEOF() && !p.peek().is(";") {
+		switch {
+		case p.peek().is("include") || p.peek().is("with"):
+			p.advance()
+			if err := p.skipGroup(); err != nil {
+				return err
+			}
+		case p.peek().is("nulls"):
+			nnd, err := p.parseNullsDistinct()
+			if err != nil {
+				return err
+			}
+			key.NullsNotDistinct = nnd
+		case p.peek().is("tablespace"):
+			p.advance()
+			if _, err := p.parseIdent(); err != nil {
+				return err
+			}
+		case p.peek().is("where"):
+			p.advance()
+			first := p.peek()
+			last := first
+			for !p.atEOF() && !p.peek().is(";") {
+				last = p.advance()
+			}
+			key.Where = p.exprFrom(first, last)
+		default:
+			return p.unexpected(p.peek(), "in CREATE INDEX")
+		}
+	}
+
+	if plain {
+		t.Uniques = append(t.Uniques, key)
+	}
+	return nil
+}
+
+// parseCreateType records enum types. Composite, range and base types are skipped.
+func (p *parser) parseCreateType(s *Schema) error {
+	nameTok := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+	if !p.peek().is("as") || !p.peekAt(1).is("enum") {
+		p.skipStatement()
+		return nil
+	}
+	p.advance()
+	p.advance()
+
+	e := &Enum{Pos: nameTok.pos}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		e.Namespace, e.Name = name[:dot], name[dot+1:]
+	} else {
+		e.Name = name
+	}
+
+	if err := p.expectOp("("); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for !p.peek().is(")") {
+		tok := p.peek()
+		if tok.kind != tokString {
+			return p.errorf(tok, "expected enum label, got %s", tok.describe())
+		}
+		if seen[tok.text] {
+			return p.errorf(tok, "enum label %q is specified more than once", tok.text)
+		}
+		seen[tok.text] = true
+		e.Values = append(e.Values, tok.text)
+		p.advance()
+		if !p.peek().is(")") {
+			if err := p.expectOp(","); err != nil {
+				return err
+			}
+		}
+	}
+	p.advance()
+
+	for _, existing := range s.Enums {
+		if existing.QualifiedName() == e.QualifiedName() {
+			return p.errorf(nameTok, "type %q already exists", e.QualifiedName())
+		}
+	}
+	s.Enums = append(s.Enums, e)
+	p.skipStatement()
+	return nil
+}
+
+// parseCreateDomain records a domain with its base type and constraints.
+func (p *parser) parseCreateDomain(s *Schema) error {
+	nameTok := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+	p.acceptKeyword("as")
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+
+	d := &Domain{Type: typ, Pos: nameTok.pos}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		d.Namespace, d.Name = name[:dot], name[dot+1:]
+	} else {
+		d.Name = name
+	}
+
+	for {
+		tok := p.peek()
+		if tok.is(";") || tok.kind == tokEOF {
+			break
+		}
+
+		conName := ""
+		if tok.is("constraint") {
+			p.advance()
+			n, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			conName = n
+			tok = p.peek()
+		}
+
+		switch {
+		case tok.is("not") && p.peekAt(1).is("null"):
+			p.advance()
+			p.advance()
+			d.NotNull = true
+
+		case tok.is("null"):
+			p.advance()
+
+		case tok.is("default"):
+			p.advance()
+			expr, err := p.parseDefaultExpr()
+			if err != nil {
+				return err
+			}
+			d.Default = expr
+
+		case tok.is("check"):
+			p.advance()
+			expr, err := p.parseParenExpr()
+			if err != nil {
+				return err
+			}
+			d.Checks = append(d.Checks, &Check{Name: conName, Expr: expr, Pos: tok.pos})
+			if p.peek().is("not") && p.peekAt(1).is("valid") {
+				p.advance()
+				p.advance()
+			}
+
+		case tok.is("collate"):
+			p.advance()
+			if _, err := p.parseQualifiedName(); err != nil {
+				return err
+			}
+
+		default:
+			return p.unexpected(tok, fmt.Sprintf("in definition of domain %q", d.QualifiedName()))
+		}
+	}
+
+	for _, existing := range s.Domains {
+		if existing.QualifiedName() == d.QualifiedName() {
+			return p.errorf(nameTok, "type %q already exists", d.QualifiedName())
+		}
+	}
+	s.Domains = append(s.Domains, d)
+	return nil
+}
+
+func (p *parser) parseCreateTable(s *Schema) error {
+	if p.peek().is("if") {
+		p.advance()
+		if err := p.expectKeyword("not"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("exists"); err != nil {
+			return err
+		}
+	}
+
+	nameTok := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+
+	// CREATE TABLE ... AS / OF / PARTITION OF carry no column list of their own
+	if !p.peek().is("(") {
+		p.skipStatement()
+		return nil
+	}
+
+	t := &Table{Pos: nameTok.pos}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		t.Namespace, t.Name = name[:dot], name[dot+1:]
+	} else {
+		t.Name = name
+	}
+
+	p.advance() // (
+	if !p.peek().is(")") {
+		for {
+			if err := p.parseTableElement(t); err != nil {
+				return err
+			}
+			if p.peek().is(")") {
+				break
+			}
+			if err := p.expectOp(","); err != nil {
+				return err
+			}
+		}
+	}
+	p.advance() // )
+
+	if len(t.Columns) == 0 {
+		return p.errorf(nameTok, "table %q has no columns", t.QualifiedName())
+	}
+
+	// storage parameters, INHERITS, PARTITION BY, TABLESPACE, ...
+	p.skipStatement()
+
+	return s.addTable(t)
+}
+
+var tableConstraintStarts = map[string]bool{
+	"constraint": true, "primary": true, "unique": true, "check": true, "foreign": true, "exclude": true,
+}
+
+func (p *parser) parseTableElement(t *Table) error {
+	tok := p.peek()
+	if tok.kind == tokIdent {
+		if tok.text == "like" {
+			return p.skipElement()
+		}
+		if tableConstraintStarts[tok.text] {
+			return p.parseTableConstraint(t)
+		}
+	}
+	return p.parseColumn(t)
+}
+
+func (p *parser) parseColumn(t *Table) error {
+	nameTok := p.peek()
+	name, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	if t.Column(name) != nil {
+		return p.errorf(nameTok, "column %q specified more than once", name)
+	}
+
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+
+	c := &Column{Name: name, Type: typ, Pos: nameTok.pos}
+	switch typ.Name {
+	case "serial", "bigserial", "smallserial":
+		c.NotNull = true
+	}
+	t.Columns = append(t.Columns, c)
+
+	return p.parseColumnConstraints(t, c)
+}
+
+// parseColumnConstraints parses the constraints that follow the type of a
+// column, up to the ',' or ')' ending it in CREATE TABLE or the ',' or ';'
+// ending an ALTER TABLE action.
+func (p *parser) parseColumnConstraints(t *Table, c *Column) error {
+	// constraint attributes apply to the most recent constraint
+	var lastFK *ForeignKey
+
+	for {
+		tok := p.peek()
+		if tok.is(",") || tok.is(")") || tok.is(";") || tok.kind == tokEOF {
+			return nil
+		}
+
+		conName := ""
+		if tok.is("constraint") {
+			p.advance()
+			n, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			conName = n
+			tok = p.peek()
+		}
+
+		switch {
+		case tok.is("not") && p.peekAt(1).is("null"):
+			p.advance()
+			p.advance()
+			c.NotNull = true
+
+		case tok.is("not") && p.peekAt(1).is("deferrable"):
+			p.advance()
+			p.advance()
+
+		case tok.is("null"):
+			p.advance()
+
+		case tok.is("default"):
+			p.advance()
+			expr, err := p.parseDefaultExpr()
+			if err != nil {
+				return err
+			}
+			c.Default = expr
+
+		case tok.is("primary"):
+			p.advance()
+			if err := p.expectKeyword("key"); err != nil {
+				return err
+			}
+			if t.PrimaryKey != nil {
+				return p.errorf(tok, "multiple primary keys for table %q are not allowed", t.QualifiedName())
+			}
+			t.PrimaryKey = &Key{Name: conName, Columns: []string{c.Name}, Pos: tok.pos}
+			if err := p.skipIndexParameters(); err != nil {
+				return err
+			}
+
+		case tok.is("unique"):
+			p.advance()
+			key := &Key{Name: conName, Columns: []string{c.Name}, Pos: tok.pos}
+			nnd, err := p.parseNullsDistinct()
+			if err != nil {
+				return err
+			}
+			key.NullsNotDistinct = nnd
+			t.Uniques = append(t.Uniques, key)
+			if err := p.skipIndexParameters(); err != nil {
+				return err
+			}
+
+		case tok.is("check"):
+			p.advance()
+			expr, err := p.parseParenExpr()
+			if err != nil {
+				return err
+			}
+			t.Checks = append(t.Checks, &Check{Name: conName, Expr: expr, Column: c.Name, Pos: tok.pos})
+			p.acceptNoInherit()
+
+		case tok.is("references"):
+			fk := &ForeignKey{Name: conName, Columns: []string{c.Name}, Pos: tok.pos}
+			if err := p.parseReferences(fk); err != nil {
+				return err
+			}
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+			lastFK = fk
+
+		case tok.is("deferrable") || tok.is("initially"):
+			if err := p.parseConstraintAttributes(lastFK); err != nil {
+				return err
+			}
+
+		case tok.is("generated"):
+			if err := p.parseGenerated(c); err != nil {
+				return err
+			}
+
+		case tok.is("collate"):
+			p.advance()
+			coll, err := p.parseQualifiedName()
+			if err != nil {
+				return err
+			}
+			c.Collation = coll
+
+		default:
+			return p.unexpected(tok, fmt.Sprintf("in definition of column %q", c.Name))
+		}
+	}
+}
+
+func (p *parser) parseGenerated(c *Column) error {
+	p.advance() // GENERATED
+
+	switch {
+	case p.acceptKeyword("always"):
+		if err := p.expectKeyword("as"); err != nil {
+			return err
+		}
+		if p.acceptKeyword("identity") {
+			c.Identity = "always"
+			c.NotNull = true
+			return p.skipOptionalGroup()
+		}
+		expr, err := p.parseParenExpr()
+		if err != nil {
+			return err
+		}
+		c.Generated = expr
+		if !p.acceptKeyword("stored") {
+			p.acceptKeyword("virtual")
+		}
+		return nil
+
+	case p.acceptKeyword("by"):
+		if err := p.expectKeyword("default"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("as"); err != nil {
+			return err
+		}
+		if err := p.expectKeyword("identity"); err != nil {
+			return err
+		}
+		c.Identity = "by default"
+		c.NotNull = true
+		return p.skipOptionalGroup()
+	}
+
+	return p.errorf(p.peek(), "expected ALWAYS or BY DEFAULT after GENERATED, got %s", p.peek().describe())
+}
+
+func (p *parser) skipOptionalGroup() error {
+	if p.peek().is("(") {
+		return p.skipGroup()
+	}
+	return nil
+}
+
+func (p *parser) acceptNoInherit() {
+	if p.peek().is("no") && p.peekAt(1).is("inherit") {
+		p.advance()
+		p.advance()
+	}
+}
+
+// parseNullsDistinct handles the optional NULLS [NOT] DISTINCT clause of UNIQUE.
+func (p *parser) parseNullsDistinct() (bool, error) {
+	if !p.acceptKeyword("nulls") {
+		return false, nil
+	}
+	notDistinct := p.acceptKeyword("not")
+	if err := p.expectKeyword("distinct"); err != nil {
+		return false, err
+	}
+	return notDistinct, nil
+}
+
+// skipIndexParameters skips INCLUDE (...), WITH (...) and USING INDEX TABLESPACE.
+func (p *parser) skipIndexParameters() error {
+	for {
+		switch {
+		case p.peek().is("include") || p.peek().is("with"):
+			p.advance()
+			if err := p.skipGroup(); err != nil {
+				return err
+			}
+		case p.peek().is("using"):
+			p.advance()
+			if err := p.expectKeyword("index"); err != nil {
+				return err
+			}
+			if err := p.expectKeyword("tablespace"); err != nil {
+				return err
+			}
+			if _, err := p.parseIdent(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseReferences(fk *ForeignKey) error {
+	if err := p.expectKeyword("references"); err != nil {
+		return err
+	}
+	ref, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+	fk.RefTable = ref
+
+	if p.peek().is("(") {
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		fk.RefColumns = cols
+	}
+
+	for {
+		switch {
+		case p.peek().is("match"):
+			p.advance()
+			if !p.acceptKeyword("full") && !p.acceptKeyword("partial") && !p.acceptKeyword("simple") {
+				return p.errorf(p.peek(), "expected FULL, PARTIAL or SIMPLE after MATCH, got %s", p.peek().describe())
+			}
+		case p.peek().is("on"):
+			p.advance()
+			event := p.peek()
+			if !p.acceptKeyword("delete") && !p.acceptKeyword("update") {
+				return p.errorf(event, "expected DELETE or UPDATE after ON, got %s", event.describe())
+			}
+			action, err := p.parseReferentialAction()
+			if err != nil {
+				return err
+			}
+			if event.text == "delete" {
+				fk.OnDelete = action
+			} else {
+				fk.OnUpdate = action
+			}
+		case p.peek().is("deferrable") || p.peek().is("initially") ||
+			(p.peek().is("not") && p.peekAt(1).is("deferrable")):
+			if err := p.parseConstraintAttributes(fk); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseReferentialAction() (string, error) {
+	switch {
+	case p.acceptKeyword("cascade"):
+		return "cascade", nil
+	case p.acceptKeyword("restrict"):
+		return "restrict", nil
+	case p.acceptKeyword("no"):
+		if err := p.expectKeyword("action"); err != nil {
+			return "", err
+		}
+		return "no action", nil
+	case p.acceptKeyword("set"):
+		action := "set " + p.peek().text
+		if !p.acceptKeyword("null") && !p.acceptKeyword("default") {
+			return "", p.errorf(p.peek(), "expected NULL or DEFAULT after SET, got %s", p.peek().describe())
+		}
+		if p.peek().is("(") {
+			if _, err := p.parseIdentList(); err != nil {
+				return "", err
+			}
+		}
+		return action, nil
+	}
+	return "", p.errorf(p.peek(), "expected referential action, got %s", p.peek().describe())
+}
+
+// parseConstraintAttributes handles [NOT] DEFERRABLE and INITIALLY
+// {DEFERRED | IMMEDIATE}. fk may be nil for constraints that are not
+// foreign keys, in which case the attributes are accepted and ignored.
+func (p *parser) parseConstraintAttributes(fk *ForeignKey) error {
+	for {
+		switch {
+		case p.peek().is("not") && p.peekAt(1).is("deferrable"):
+			p.advance()
+			p.advance()
+			if fk != nil {
+				fk.Deferrable = false
+			}
+		case p.acceptKeyword("deferrable"):
+			if fk != nil {
+				fk.Deferrable = true
+			}
+		case p.peek().is("initially"):
+			p.advance()
+			switch {
+			case p.acceptKeyword("deferred"):
+				if fk != nil {
+					fk.Deferrable = true
+					fk.InitiallyDeferred = true
+				}
+			case p.acceptKeyword("immediate"):
+				if fk != nil {
+					fk.InitiallyDeferred = false
+				}
+			default:
+				return p.errorf(p.peek(), "expected DEFERRED or IMMEDIATE after INITIALLY, got %s", p.peek().describe())
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseTableConstraint(t *Table) error {
+	conName := ""
+	if p.acceptKeyword("constraint") {
+		n, err := p.parseIdent()
+		if err != nil {
+			return err
+		}
+		conName = n
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.is("primary"):
+		p.advance()
+		if err := p.expectKeyword("key"); err != nil {
+			return err
+		}
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		if t.PrimaryKey != nil {
+			return p.errorf(tok, "multiple primary keys for table %q are not allowed", t.QualifiedName())
+		}
+		t.PrimaryKey = &Key{Name: conName, Columns: cols, Pos: tok.pos}
+		if err := p.skipIndexParameters(); err != nil {
+			return err
+		}
+
+	case tok.is("unique"):
+		p.advance()
+		nnd, err := p.parseNullsDistinct()
+		if err != nil {
+			return err
+		}
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		t.Uniques = append(t.Uniques, &Key{Name: conName, Columns: cols, NullsNotDistinct: nnd, Pos: tok.pos})
+		if err := p.skipIndexParameters(); err != nil {
+			return err
+		}
+
+	case tok.is("check"):
+		p.advance()
+		expr, err := p.parseParenExpr()
+		if err != nil {
+			return err
+		}
+		t.Checks = append(t.Checks, &Check{Name: conName, Expr: expr, Pos: tok.pos})
+		p.acceptNoInherit()
+
+	case tok.is("foreign"):
+		p.advance()
+		if err := p.expectKeyword("key"); err != nil {
+			return err
+		}
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		fk := &ForeignKey{Name: conName, Columns: cols, Pos: tok.pos}
+		if err := p.parseReferences(fk); err != nil {
+			return err
+		}
+		t.ForeignKeys = append(t.ForeignKeys, fk)
+		return p.parseConstraintAttributes(fk)
+
+	case tok.is("exclude"):
+		// exclusion constraints cannot be honoured by the generator, skip them
+		return p.skipElement()
+
+	default:
+		return p.unexpected(tok, "in table constraint")
+	}
+
+	return p.parseConstraintAttributes(nil)
+}
+
+// parseAlter handles ALTER TABLE ... ADD [COLUMN | CONSTRAINT] and
+// ALTER [COLUMN] ... SET NOT NULL / SET DEFAULT, as emitted by pg_dump.
+// Other ALTER statements are skipped.
+func (p *parser) parseAlter(s *Schema) error {
+	p.advance() // ALTER
+	if !p.acceptKeyword("table") {
+		p.skipStatement()
+		return nil
+	}
+	if p.peek().is("if") && p.peekAt(1).is("exists") {
+		p.advance()
+		p.advance()
+	}
+	p.acceptKeyword("only")
+
+	nameTok := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+	t := s.tables[name]
+	if t == nil {
+		t = s.Table(name)
+	}
+	if t == nil {
+		return p.errorf(nameTok, "ALTER TABLE references unknown table %q", name)
+	}
+
+	for {
+		switch {
+		case p.peek().is("add"):
+			p.advance()
+			if p.acceptKeyword("column") {
+				if err := p.parseColumn(t); err != nil {
+					return err
+				}
+			} else if p.peek().kind == tokIdent && tableConstraintStarts[p.peek().text] {
+				if err := p.parseTableConstraint(t); err != nil {
+					return err
+				}
+			} else if err := p.parseColumn(t); err != nil {
+				return err
+			}
+			// NOT VALID constraints still describe the intended data
+			if p.peek().is("not") && p.peekAt(1).is("valid") {
+				p.advance()
+				p.advance()
+			}
+
+		case p.peek().is("alter"):
+			p.advance()
+			p.acceptKeyword("column")
+			colTok := p.peek()
+			colName, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			c := t.Column(colName)
+			if c == nil {
+				return p.errorf(colTok, "column %q of table %q does not exist", colName, t.QualifiedName())
+			}
+			switch {
+			case p.peek().is("set") && p.peekAt(1).is("not") && p.peekAt(2).is("null"):
+				p.advance()
+				p.advance()
+				p.advance()
+				c.NotNull = true
+			case p.peek().is("set") && p.peekAt(1).is("default"):
+				p.advance()
+				p.advance()
+				expr, err := p.parseDefaultExpr()
+				if err != nil {
+					return err
+				}
+				c.Default = expr
+			default:
+				p.skipAlterAction()
+			}
+
+		default:
+			p.skipAlterAction()
+		}
+
+		if !p.peek().is(",") {
+			p.skipStatement()
+			return nil
+		}
+		p.advance()
+	}
+}
+
+// skipAlterAction skips one ALTER TABLE action up to the next top-level ',' or ';'.
+func (p *parser) skipAlterAction() {
+	depth := 0
+	for !p.atEOF() {
+		t := p.peek()
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")") && depth > 0:
+			depth--
+		case (t.is(",") || t.is(";")) && depth == 0:
+			return
+		}
+		p.advance()
+	}
+}
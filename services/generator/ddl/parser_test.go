@@ -0,0 +1,224 @@
+package ddl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x > 0", "(x > 0)"},
+		{"x>-1", "(x > -1)"},
+		{"a + b * c", "(a + (b * c))"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"a > 0 AND b > 0 OR c", "(((a > 0) AND (b > 0)) OR c)"},
+		{"NOT a AND b", "(NOT a AND b)"},
+		{"x BETWEEN 1 AND 10", "x BETWEEN 1 AND 10"},
+		{"x NOT IN ('a', 'b')", "x NOT IN ('a', 'b')"},
+		{"x IS NOT NULL", "x IS NOT NULL"},
+		{"char_length(name) <= 20", "(char_length(name) <= 20)"},
+		{"price::numeric(10,2) > 0", "(price::numeric(10,2) > 0)"},
+		{"status = 'it''s'", "(status = 'it''s')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			n, err := ParseExpr(&Expr{Text: tt.src})
+			if err != nil {
+				t.Fatalf("ParseExpr: %v", err)
+			}
+			if got := n.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, src := range []string{"x >", "(x > 1", "x > 1)", "x BETWEEN 1"} {
+		t.Run(src, func(t *testing.T) {
+			if _, err := ParseExpr(&Expr{Text: src}); err == nil {
+				t.Errorf("ParseExpr succeeded")
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	schema, err := Parse(`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE TABLE app.users (
+	id bigserial PRIMARY KEY,
+	"Email" varchar(255) NOT NULL UNIQUE,
+	feeling mood,
+	tags text[],
+	score numeric(8, 2) DEFAULT 0 CHECK (score >= 0),
+	team_id int REFERENCES teams (id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+);
+CREATE TABLE teams (id int PRIMARY KEY, name text);
+CREATE UNIQUE INDEX users_team_idx ON app.users (team_id) WHERE team_id IS NOT NULL;
+`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(schema.Enums) != 1 || !slices.Equal(schema.Enums[0].Values, []string{"sad", "happy"}) {
+		t.Errorf("enums are %+v", schema.Enums)
+	}
+	users := schema.Table("app.users")
+	if users == nil {
+		t.Fatal("table app.users is missing")
+	}
+
+	columns := []struct {
+		name, typ string
+		notNull   bool
+	}{
+		{"id", "bigserial", true},
+		{"Email", "varchar(255)", true},
+		{"feeling", "mood", false},
+		{"tags", "text[]", false},
+		{"score", "numeric(8,2)", false},
+		{"team_id", "integer", false},
+	}
+	if len(users.Columns) != len(columns) {
+		t.Fatalf("got %d columns, want %d", len(users.Columns), len(columns))
+	}
+	for i, want := range columns {
+		c := users.Columns[i]
+		if c.Name != want.name || c.Type.String() != want.typ || c.NotNull != want.notNull {
+			t.Errorf("column %d is %s %s not null %v, want %s %s not null %v",
+				i, c.Name, c.Type, c.NotNull, want.name, want.typ, want.notNull)
+		}
+	}
+
+	if users.PrimaryKey == nil || !slices.Equal(users.PrimaryKey.Columns, []string{"id"}) {
+		t.Errorf("primary key is %+v", users.PrimaryKey)
+	}
+	if len(users.Uniques) != 2 || !slices.Equal(users.Uniques[0].Columns, []string{"Email"}) || users.Uniques[1].Where == nil {
+		t.Errorf("uniques are %+v", users.Uniques)
+	}
+	if len(users.Checks) != 1 || users.Checks[0].Column != "score" {
+		t.Errorf("checks are %+v", users.Checks)
+	}
+	if len(users.ForeignKeys) != 1 {
+		t.Fatalf("got %d foreign keys, want 1", len(users.ForeignKeys))
+	}
+	fk := users.ForeignKeys[0]
+	if fk.RefTable != "teams" || !slices.Equal(fk.RefColumns, []string{"id"}) || !fk.Deferrable || !fk.InitiallyDeferred {
+		t.Errorf("foreign key is %+v", fk)
+	}
+}
+
+func TestParseDomain(t *testing.T) {
+	schema, err := Parse(`
+CREATE DOMAIN posint AS integer CHECK (VALUE > 0);
+CREATE DOMAIN app.code varchar(8) NOT NULL DEFAULT 'x' CONSTRAINT upper CHECK (upper(VALUE) = VALUE);
+CREATE DOMAIN small_code AS app.code CHECK (char_length(value) < 4);
+CREATE TABLE t (
+	qty posint,
+	"Code" small_code,
+	codes app.code[]
+);
+`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	table := schema.Table("t")
+	columns := []struct {
+		name, typ, domain string
+		notNull           bool
+	}{
+		{"qty", "integer", "posint", false},
+		{"Code", "varchar(8)", "small_code", true},
+		{"codes", "varchar(8)[]", "app.code", false},
+	}
+	for i, want := range columns {
+		c := table.Columns[i]
+		if c.Name != want.name || c.Type.String() != want.typ || c.Domain != want.domain || c.NotNull != want.notNull {
+			t.Errorf("column %d is %s %s domain %q not null %v, want %s %s domain %q not null %v",
+				i, c.Name, c.Type, c.Domain, c.NotNull, want.name, want.typ, want.domain, want.notNull)
+		}
+	}
+	if d := table.Column("Code").Default; d == nil || d.Text != "'x'" {
+		t.Errorf("default of Code is %+v", d)
+	}
+
+	var checks []string
+	for _, c := range table.Checks {
+		checks = append(checks, c.Column+": "+c.Expr.Text)
+	}
+	want := []string{
+		"qty: qty > 0",
+		`Code: upper("Code") = "Code"`,
+		`Code: char_length("Code") < 4`,
+	}
+	if !slices.Equal(checks, want) {
+		t.Errorf("checks are %q, want %q", checks, want)
+	}
+}
+
+func TestParseAlter(t *testing.T) {
+	tests := []struct {
+		name  string
+		alter string
+		// want lists the columns of t after the ALTER, with their types and
+		// whether they are NOT NULL
+		want []string
+	}{
+		{"add column", "ALTER TABLE t ADD COLUMN c int;", []string{"id integer true", "c integer false"}},
+		{"add without column", "ALTER TABLE t ADD c text NOT NULL;", []string{"id integer true", "c text true"}},
+		{"last statement", "ALTER TABLE t ADD COLUMN c int", []string{"id integer true", "c integer false"}},
+		{
+			"several actions",
+			"ALTER TABLE ONLY t ADD COLUMN c int DEFAULT 1, ADD COLUMN d text UNIQUE, ALTER COLUMN c SET NOT NULL;",
+			[]string{"id integer true", "c integer true", "d text false"},
+		},
+		{
+			"skipped action",
+			"ALTER TABLE t OWNER TO admin, ADD COLUMN c int REFERENCES t (id);",
+			[]string{"id integer true", "c integer false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := Parse("CREATE TABLE t (id int PRIMARY KEY);\n" + tt.alter)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var got []string
+			for _, c := range schema.Table("t").Columns {
+				got = append(got, fmt.Sprintf("%s %s %v", c.Name, c.Type, c.NotNull))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"CREATE TABLE t (id int PRIMARY KEY, id text);", "specified more than once"},
+		{"CREATE TABLE t (a int REFERENCES missing (id));", "unknown table"},
+		{"CREATE TABLE t (a int,);", ""},
+		{"CREATE TABLE t (a int", ""},
+		{"ALTER TABLE missing ADD COLUMN c int;", "unknown table"},
+		{"CREATE TABLE t (a int); ALTER TABLE t ADD COLUMN c int foo;", `unexpected`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package ddl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// resolve validates the column references of every constraint once all
+// statements have been read, and fills in implied details such as the
+// referenced primary key of a foreign key without a column list.
+func (s *Schema) resolve() error {
+	s.resolveDomains()
+
+	for _, t := range s.Tables {
+		if t.PrimaryKey != nil {
+			if err := t.checkColumns(t.PrimaryKey.Columns, t.PrimaryKey.Pos, "PRIMARY KEY"); err != nil {
+				return err
+			}
+			for _, name := range t.PrimaryKey.Columns {
+				t.Column(name).NotNull = true
+			}
+		}
+
+		for _, u := range t.Uniques {
+			if err := t.checkColumns(u.Columns, u.Pos, "UNIQUE"); err != nil {
+				return err
+			}
+		}
+
+		for _, fk := range t.ForeignKeys {
+			if err := t.checkColumns(fk.Columns, fk.Pos, "FOREIGN KEY"); err != nil {
+				return err
+			}
+
+			ref := s.Table(fk.RefTable)
+			if ref == nil {
+				return &Error{Pos: fk.Pos, Msg: fmt.Sprintf("foreign key on %q references unknown table %q", t.QualifiedName(), fk.RefTable)}
+			}
+			fk.RefTable = ref.QualifiedName()
+
+			if len(fk.RefColumns) == 0 {
+				if ref.PrimaryKey == nil {
+					return &Error{Pos: fk.Pos, Msg: fmt.Sprintf("referenced table %q has no primary key", ref.QualifiedName())}
+				}
+				fk.RefColumns = ref.PrimaryKey.Columns
+			}
+			if err := ref.checkColumns(fk.RefColumns, fk.Pos, "REFERENCES"); err != nil {
+				return err
+			}
+			if len(fk.Columns) != len(fk.RefColumns) {
+				return &Error{Pos: fk.Pos, Msg: fmt.Sprintf("number of referencing and referenced columns for foreign key on %q disagree", t.QualifiedName())}
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Table) checkColumns(cols []string, pos Pos, what string) error {
+	for _, name := range cols {
+		if t.Column(name) == nil {
+			return &Error{Pos: pos, Msg: fmt.Sprintf("column %q named in %s does not exist in table %q", name, what, t.QualifiedName())}
+		}
+	}
+	return nil
+}
+
+// resolveDomains replaces domain types with their base types. A domain must
+// be created before it is used, so a domain over another domain can be
+// flattened from the already resolved one.
+func (s *Schema) resolveDomains() {
+	for _, d := range s.Domains {
+		base := s.Domain(d.Type.Name)
+		if base == nil || base == d {
+			continue
+		}
+		dims := d.Type.ArrayDims
+		d.Type = base.Type
+		d.Type.ArrayDims += dims
+		if dims == 0 {
+			d.NotNull = d.NotNull || base.NotNull
+			if d.Default == nil {
+				d.Default = base.Default
+			}
+			d.Checks = append(slices.Clip(base.Checks), d.Checks...)
+		}
+	}
+
+	for _, t := range s.Tables {
+		for _, c := range t.Columns {
+			d := s.Domain(c.Type.Name)
+			if d == nil {
+				continue
+			}
+			dims := c.Type.ArrayDims
+			c.Domain = d.QualifiedName()
+			c.Type = d.Type
+			c.Type.ArrayDims += dims
+			// the constraints of a domain hold for its values, not for
+			// arrays of them
+			if dims > 0 {
+				continue
+			}
+			c.NotNull = c.NotNull || d.NotNull
+			if c.Default == nil {
+				c.Default = d.Default
+			}
+			for _, check := range d.Checks {
+				t.Checks = append(t.Checks, &Check{
+					Name:   check.Name,
+					Expr:   check.Expr.withValue(c.Name),
+					Column: c.Name,
+					Pos:    check.Pos,
+				})
+			}
+		}
+	}
+}
+
+// withValue returns the domain check expression with VALUE replaced by a
+// reference to the named column.
+func (e *Expr) withValue(column string) *Expr {
+	tokens, err := lex(e.Text)
+	if err != nil {
+		return e
+	}
+	ref := column
+	if !isPlainIdent(column) {
+		ref = `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, tok := range tokens {
+		if tok.kind == tokIdent && tok.text == "value" {
+			sb.WriteString(e.Text[last:tok.start])
+			sb.WriteString(ref)
+			last = tok.end
+		}
+	}
+	sb.WriteString(e.Text[last:])
+	return &Expr{Text: sb.String(), Pos: e.Pos}
+}
+
+// isPlainIdent reports whether name can be written without quotes.
+func isPlainIdent(name string) bool {
+	for i, r := range name {
+		if !(r >= 'a' && r <= 'z' || r == '_' || i > 0 && (r >= '0' && r <= '9' || r == '$')) {
+			return false
+		}
+	}
+	return name != ""
+}
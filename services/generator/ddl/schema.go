@@ -0,0 +1,255 @@
+package ddl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Schema is the in-memory model of an uploaded DDL script.
+type Schema struct {
+	Tables  []*Table
+	Enums   []*Enum
+	Domains []*Domain
+
+	tables map[string]*Table
+}
+
+// Enum is a type created with CREATE TYPE ... AS ENUM.
+type Enum struct {
+	Namespace string
+	Name      string
+	Values    []string
+
+	Pos Pos
+}
+
+func (e *Enum) QualifiedName() string {
+	if e.Namespace == "" {
+		return e.Name
+	}
+	return e.Namespace + "." + e.Name
+}
+
+// Enum returns the enum type with the given, possibly qualified, name.
+func (s *Schema) Enum(name string) *Enum {
+	var found *Enum
+	for _, e := range s.Enums {
+		if e.QualifiedName() == name {
+			return e
+		}
+		if e.Name == name || (e.Namespace == "" && name[strings.LastIndex(name, ".")+1:] == e.Name) {
+			found = e
+		}
+	}
+	return found
+}
+
+// Domain is a type created with CREATE DOMAIN. Columns declared with a domain
+// have its base type, NOT NULL, default and checks folded in by resolve.
+type Domain struct {
+	Namespace string
+	Name      string
+	Type      Type
+	NotNull   bool
+	Default   *Expr
+	// Checks refer to the checked value as VALUE.
+	Checks []*Check
+
+	Pos Pos
+}
+
+func (d *Domain) QualifiedName() string {
+	if d.Namespace == "" {
+		return d.Name
+	}
+	return d.Namespace + "." + d.Name
+}
+
+// Domain returns the domain with the given, possibly qualified, name.
+func (s *Schema) Domain(name string) *Domain {
+	var found *Domain
+	for _, d := range s.Domains {
+		if d.QualifiedName() == name {
+			return d
+		}
+		if d.Name == name || (d.Namespace == "" && name[strings.LastIndex(name, ".")+1:] == d.Name) {
+			found = d
+		}
+	}
+	return found
+}
+
+// Table returns the table with the given name. Unqualified names match
+// tables in any namespace as long as the match is unambiguous.
+func (s *Schema) Table(name string) *Table {
+	if t, ok := s.tables[name]; ok {
+		return t
+	}
+
+	var found *Table
+	for _, t := range s.Tables {
+		if t.Name == name {
+			if found != nil {
+				return nil
+			}
+			found = t
+		}
+	}
+	return found
+}
+
+func (s *Schema) addTable(t *Table) error {
+	if s.tables == nil {
+		s.tables = make(map[string]*Table)
+	}
+	key := t.QualifiedName()
+	if _, ok := s.tables[key]; ok {
+		return &Error{Pos: t.Pos, Msg: fmt.Sprintf("table %q is defined more than once", key)}
+	}
+	s.tables[key] = t
+	s.Tables = append(s.Tables, t)
+	return nil
+}
+
+type Table struct {
+	Namespace string // empty when the name was not schema-qualified
+	Name      string
+	Columns   []*Column
+
+	PrimaryKey  *Key
+	Uniques     []*Key
+	Checks      []*Check
+	ForeignKeys []*ForeignKey
+
+	Pos Pos
+}
+
+// QualifiedName returns the table name prefixed with its namespace, if any.
+func (t *Table) QualifiedName() string {
+	if t.Namespace == "" {
+		return t.Name
+	}
+	return t.Namespace + "." + t.Name
+}
+
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Nullable reports whether column c of t can hold NULL, which takes more
+// than a missing NOT NULL: primary key columns never can.
+func (t *Table) Nullable(c *Column) bool {
+	if c.NotNull {
+		return false
+	}
+	return t.PrimaryKey == nil || !slices.Contains(t.PrimaryKey.Columns, c.Name)
+}
+
+// ColumnIndex returns the position of the named column, or -1.
+func (t *Table) ColumnIndex(name string) int {
+	for i, c := range t.Columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+type Column struct {
+	Name    string
+	Type    Type
+	NotNull bool
+
+	// Default is the DEFAULT expression, nil when the column has none.
+	Default *Expr
+	// Generated is the expression of a GENERATED ALWAYS AS (...) STORED column.
+	Generated *Expr
+	// Identity is "always" or "by default" for identity columns.
+	Identity  string
+	Collation string
+	// Domain is the qualified name of the domain the column was declared
+	// with, in which case Type is the domain's base type.
+	Domain string
+
+	Pos Pos
+}
+
+// Type is a column type with its modifiers, e.g. numeric(10,2) or varchar(64)[].
+type Type struct {
+	// Name is the canonical PostgreSQL type name, e.g. "integer", "varchar",
+	// "timestamptz". User-defined types keep their (possibly qualified) name.
+	Name      string
+	Modifiers []int
+	// ArrayDims is the number of array dimensions, 0 for scalars.
+	ArrayDims int
+}
+
+func (t Type) String() string {
+	var sb strings.Builder
+	sb.WriteString(t.Name)
+	if len(t.Modifiers) > 0 {
+		mods := make([]string, len(t.Modifiers))
+		for i, m := range t.Modifiers {
+			mods[i] = fmt.Sprint(m)
+		}
+		sb.WriteString("(" + strings.Join(mods, ",") + ")")
+	}
+	for i := 0; i < t.ArrayDims; i++ {
+		sb.WriteString("[]")
+	}
+	return sb.String()
+}
+
+// Elem returns the element type of an array type.
+func (t Type) Elem() Type {
+	t.ArrayDims = 0
+	return t
+}
+
+// Key is a PRIMARY KEY or UNIQUE constraint over one or more columns,
+// or a unique index.
+type Key struct {
+	Name    string
+	Columns []string
+	// NullsNotDistinct is set for UNIQUE NULLS NOT DISTINCT.
+	NullsNotDistinct bool
+	// Where is the predicate of a partial unique index.
+	Where *Expr
+
+	Pos Pos
+}
+
+type Check struct {
+	Name string
+	Expr *Expr
+	// Column is set when the check was declared inline on a column.
+	Column string
+
+	Pos Pos
+}
+
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string // resolved to the referenced primary key when omitted
+
+	OnDelete          string
+	OnUpdate          string
+	Deferrable        bool
+	InitiallyDeferred bool
+
+	Pos Pos
+}
+
+// Expr is the source text of a DEFAULT, CHECK or generated column expression.
+type Expr struct {
+	Text string
+	Pos  Pos
+}
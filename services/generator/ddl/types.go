@@ -0,0 +1,187 @@
+package ddl
+
+import "strings"
+
+// typeAliases maps PostgreSQL type spellings to the canonical names used in Type.
+var typeAliases = map[string]string{
+	"int":         "integer",
+	"int4":        "integer",
+	"integer":     "integer",
+	"int2":        "smallint",
+	"smallint":    "smallint",
+	"int8":        "bigint",
+	"bigint":      "bigint",
+	"serial":      "serial",
+	"serial4":     "serial",
+	"bigserial":   "bigserial",
+	"serial8":     "bigserial",
+	"smallserial": "smallserial",
+	"serial2":     "smallserial",
+	"decimal":     "numeric",
+	"numeric":     "numeric",
+	"real":        "real",
+	"float4":      "real",
+	"float8":      "double precision",
+	"varchar":     "varchar",
+	"char":        "char",
+	"character":   "char",
+	"bpchar":      "char",
+	"text":        "text",
+	"bool":        "boolean",
+	"boolean":     "boolean",
+	"timestamp":   "timestamp",
+	"timestamptz": "timestamptz",
+	"time":        "time",
+	"timetz":      "timetz",
+	"date":        "date",
+	"interval":    "interval",
+	"uuid":        "uuid",
+	"inet":        "inet",
+	"cidr":        "cidr",
+	"macaddr":     "macaddr",
+	"macaddr8":    "macaddr8",
+	"bytea":       "bytea",
+	"json":        "json",
+	"jsonb":       "jsonb",
+	"money":       "money",
+	"bit":         "bit",
+	"varbit":      "varbit",
+	"xml":         "xml",
+}
+
+var intervalFields = map[string]bool{
+	"year": true, "month": true, "day": true, "hour": true, "minute": true, "second": true, "to": true,
+}
+
+// parseType parses a column type: a (possibly multi-word or qualified) name,
+// optional modifiers and optional array bounds.
+func (p *parser) parseType() (Type, error) {
+	first := p.peek()
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return Type{}, err
+	}
+	if strings.Contains(name, ".") && strings.HasPrefix(name, "pg_catalog.") {
+		name = strings.TrimPrefix(name, "pg_catalog.")
+	}
+
+	var t Type
+	switch name {
+	case "double":
+		if err := p.expectKeyword("precision"); err != nil {
+			return Type{}, err
+		}
+		t.Name = "double precision"
+	case "character", "char", "bit":
+		if p.acceptKeyword("varying") {
+			if name == "bit" {
+				t.Name = "varbit"
+			} else {
+				t.Name = "varchar"
+			}
+		} else {
+			t.Name = typeAliases[name]
+		}
+	case "float":
+		t.Name = "double precision"
+	default:
+		if canonical, ok := typeAliases[name]; ok && first.kind == tokIdent {
+			t.Name = canonical
+		} else {
+			t.Name = name
+		}
+	}
+
+	if t.Name == "interval" {
+		for p.peek().kind == tokIdent && intervalFields[p.peek().text] {
+			p.advance()
+		}
+	}
+
+	if p.peek().is("(") {
+		mods, err := p.parseTypeModifiers()
+		if err != nil {
+			return Type{}, err
+		}
+		t.Modifiers = mods
+	}
+
+	switch t.Name {
+	case "double precision":
+		// float(p) with p <= 24 is a real, anything else is a double
+		if name == "float" && len(t.Modifiers) == 1 && t.Modifiers[0] <= 24 {
+			t.Name = "real"
+		}
+		if name == "float" {
+			t.Modifiers = nil
+		}
+	case "timestamp", "time":
+		if p.peek().is("with") || p.peek().is("without") {
+			with := p.advance().text == "with"
+			if err := p.expectKeyword("time"); err != nil {
+				return Type{}, err
+			}
+			if err := p.expectKeyword("zone"); err != nil {
+				return Type{}, err
+			}
+			if with {
+				t.Name += "tz"
+			}
+		}
+	case "char":
+		if len(t.Modifiers) == 0 {
+			t.Modifiers = []int{1}
+		}
+	}
+
+	for {
+		switch {
+		case p.peek().is("["):
+			p.advance()
+			if p.peek().kind == tokNumber {
+				p.advance()
+			}
+			if err := p.expectOp("]"); err != nil {
+				return Type{}, err
+			}
+			t.ArrayDims++
+		case p.peek().is("array"):
+			p.advance()
+			if p.peek().is("[") {
+				p.advance()
+				if p.peek().kind == tokNumber {
+					p.advance()
+				}
+				if err := p.expectOp("]"); err != nil {
+					return Type{}, err
+				}
+			}
+			t.ArrayDims++
+		default:
+			return t, nil
+		}
+	}
+}
+
+func (p *parser) parseTypeModifiers() ([]int, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	var mods []int
+	for {
+		n, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, n)
+		if p.peek().is(")") {
+			p.advance()
+			return mods, nil
+		}
+		if !p.peek().is(",") {
+			return nil, p.errorf(p.peek(), "expected \",\" or \")\" in type modifiers, got %s", p.peek().describe())
+		}
+		p.advance()
+	}
+}
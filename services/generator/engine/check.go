@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// errCheckUnsatisfied is returned when rejection sampling gives up on a CHECK.
+var errCheckUnsatisfied = errors.New("check constraint unsatisfied")
+
+// tableCheck is a parsed CHECK constraint of a table.
+type tableCheck struct {
+	def  *ddl.Check
+	expr ddl.Node
+	cols []int
+	// flawed is set once a row could not be evaluated against it
+	flawed bool
+}
+
+func (c *tableCheck) String() string {
+	if c.def.Name != "" {
+		return fmt.Sprintf("CHECK %s (%s)", c.def.Name, c.def.Expr.Text)
+	}
+	return fmt.Sprintf("CHECK (%s)", c.def.Expr.Text)
+}
+
+// dependentBound narrows column target by the value of column source in
+// the same row, e.g. end_at > start_at.
+type dependentBound struct {
+	target, source int
+	op             string // comparison with target on the left
+}
+
+// prepareChecks parses the CHECK constraints of a table and narrows column
+// generators to the ranges, value lists and lengths they allow. Whatever
+// cannot be narrowed is enforced by rejection sampling in settleRow.
+func (g *generator) prepareChecks(st *tableState) error {
+	t := st.def
+	for _, def := range slices.Concat(t.Checks, g.opts.Checks[t]) {
+		expr, err := ddl.ParseExpr(def.Expr)
+		if err != nil {
+			st.warnf("table %q: %s: %v; rows are not validated against it", t.QualifiedName(), (&tableCheck{def: def}).String(), err)
+			continue
+		}
+
+		ck := &tableCheck{def: def, expr: expr}
+		for _, name := range ddl.Columns(expr) {
+			if i := t.ColumnIndex(name); i >= 0 {
+				ck.cols = append(ck.cols, i)
+			}
+		}
+		st.checks = append(st.checks, ck)
+
+		for _, conj := range conjuncts(expr) {
+			if err := g.narrow(st, conj); err != nil {
+				if errors.Is(err, errUnsupported) {
+					continue
+				}
+				return fmt.Errorf("%s: %w", ck, err)
+			}
+		}
+	}
+	return nil
+}
+
+func conjuncts(n ddl.Node) []ddl.Node {
+	if b, ok := n.(*ddl.Binary); ok && b.Op == "and" {
+		return append(conjuncts(b.L), conjuncts(b.R)...)
+	}
+	return []ddl.Node{n}
+}
+
+// constant evaluates an expression that does not reference any column.
+func constant(n ddl.Node) (any, bool) {
+	v, err := evalRow(n, func(string) (any, bool) { return nil, false })
+	if err != nil || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// column returns the index of a plain column reference with a generator.
+func column(st *tableState, n ddl.Node) (int, bool) {
+	if cast, ok := n.(*ddl.Cast); ok {
+		n = cast.X
+	}
+	ref, ok := n.(*ddl.ColumnRef)
+	if !ok {
+		return 0, false
+	}
+	i := st.def.ColumnIndex(ref.Name)
+	if i < 0 || st.gens[i] == nil {
+		return 0, false
+	}
+	return i, true
+}
+
+var flipped = map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<=", "=": "=", "<>": "<>"}
+
+// narrow applies one conjunct of a CHECK constraint to the generators.
+func (g *generator) narrow(st *tableState, n ddl.Node) error {
+	switch n := n.(type) {
+	case *ddl.Binary:
+		if _, ok := flipped[n.Op]; !ok {
+			return errUnsupported
+		}
+		l, r, op := n.L, n.R, n.Op
+		if _, ok := constant(l); ok {
+			l, r, op = r, l, flipped[op]
+		}
+
+		if call, ok := l.(*ddl.Call); ok && isLengthCall(call) {
+			return narrowLength(st, call.Args[0], op, r)
+		}
+
+		c, ok := column(st, l)
+		if !ok {
+			return errUnsupported
+		}
+		if other, ok := column(st, r); ok {
+			return narrowDependent(st, c, other, op)
+		}
+		v, ok := constant(r)
+		if !ok {
+			return errUnsupported
+		}
+		return narrowRange(st, c, op, v)
+
+	case *ddl.Between:
+		c, ok := column(st, n.X)
+		if !ok || n.Not {
+			return errUnsupported
+		}
+		lo, ok1 := constant(n.Lo)
+		hi, ok2 := constant(n.Hi)
+		if !ok1 || !ok2 {
+			return errUnsupported
+		}
+		if err := narrowRange(st, c, ">=", lo); err != nil {
+			return err
+		}
+		return narrowRange(st, c, "<=", hi)
+
+	case *ddl.In:
+		c, ok := column(st, n.X)
+		if !ok || n.Not {
+			return errUnsupported
+		}
+		col := st.def.Columns[c]
+		choices := make([]any, 0, len(n.List))
+		for _, item := range n.List {
+			v, ok := constant(item)
+			if !ok {
+				return errUnsupported
+			}
+			cv, err := values.Coerce(col.Type, v)
+			if err != nil {
+				return fmt.Errorf("column %q: %w", col.Name, err)
+			}
+			choices = append(choices, cv)
+		}
+		if len(choices) == 0 {
+			return errUnsupported
+		}
+		st.gens[c] = &values.Choice{Values: choices}
+		return nil
+	}
+	return errUnsupported
+}
+
+func isLengthCall(c *ddl.Call) bool {
+	switch c.Name {
+	case "char_length", "character_length", "length":
+		return len(c.Args) == 1
+	}
+	return false
+}
+
+func narrowLength(st *tableState, arg ddl.Node, op string, r ddl.Node) error {
+	c, ok := column(st, arg)
+	if !ok {
+		return errUnsupported
+	}
+	gen, ok := st.gens[c].(*values.String)
+	if !ok {
+		return errUnsupported
+	}
+	v, ok := constant(r)
+	if !ok {
+		return errUnsupported
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return errUnsupported
+	}
+
+	lo, hi := 0, math.MaxInt32
+	switch op {
+	case "=":
+		lo, hi = int(n), int(n)
+	case ">":
+		lo = int(n) + 1
+	case ">=":
+		lo = int(n)
+	case "<":
+		hi = int(n) - 1
+	case "<=":
+		hi = int(n)
+	default:
+		return errUnsupported
+	}
+	if err := gen.RestrictLength(lo, hi); err != nil {
+		return fmt.Errorf("column %q: %w", st.def.Columns[c].Name, err)
+	}
+	return nil
+}
+
+func narrowRange(st *tableState, c int, op string, v any) error {
+	col := st.def.Columns[c]
+
+	if op == "<>" {
+		// col <> '' is the usual way of saying "not empty"
+		if s, ok := v.(string); ok && s == "" {
+			if gen, ok := st.gens[c].(*values.String); ok {
+				return gen.RestrictLength(1, math.MaxInt32)
+			}
+		}
+		return errUnsupported
+	}
+
+	if op == "=" {
+		cv, err := values.Coerce(col.Type, v)
+		if err != nil {
+			return fmt.Errorf("column %q: %w", col.Name, err)
+		}
+		st.gens[c] = &values.Choice{Values: []any{cv}}
+		return nil
+	}
+
+	gen, ok := st.gens[c].(values.Ranged)
+	if !ok {
+		return errUnsupported
+	}
+	var lo, hi *values.Bound
+	switch op {
+	case ">":
+		lo = &values.Bound{Value: v}
+	case ">=":
+		lo = &values.Bound{Value: v, Inclusive: true}
+	case "<":
+		hi = &values.Bound{Value: v}
+	case "<=":
+		hi = &values.Bound{Value: v, Inclusive: true}
+	}
+	if err := restrict(st, c, gen, lo, hi); err != nil {
+		return fmt.Errorf("column %q: %w", col.Name, err)
+	}
+	return nil
+}
+
+// restrict narrows a column to a range. A range outside the default one of
+// its generator replaces it, within what the type holds, and the ranges the
+// column was narrowed to before are applied again.
+func restrict(st *tableState, c int, gen values.Ranged, lo, hi *values.Bound) error {
+	if st.ranges == nil {
+		st.ranges = make(map[int][][2]*values.Bound)
+	}
+	earlier := st.ranges[c]
+	st.ranges[c] = append(earlier, [2]*values.Bound{lo, hi})
+	if err := gen.Restrict(lo, hi); err == nil {
+		return nil
+	}
+
+	if err := values.Override(gen, st.def.Columns[c].Type, lo, hi); err != nil {
+		return err
+	}
+	for _, r := range earlier {
+		if err := gen.Restrict(r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// narrowDependent records a comparison between two columns. The column
+// declared later is drawn relative to the earlier one.
+func narrowDependent(st *tableState, l, r int, op string) error {
+	if op == "=" || op == "<>" {
+		return errUnsupported
+	}
+	target, source := l, r
+	if l < r {
+		target, source, op = r, l, flipped[op]
+	}
+	if _, ok := st.gens[target].(values.Ranged); !ok {
+		return errUnsupported
+	}
+	st.deps = append(st.deps, dependentBound{target: target, source: source, op: op})
+	return nil
+}
+
+// applyDeps redraws columns whose range depends on other columns of the row.
+func applyDeps(st *tableState, r *rand.Rand, row []any, i int64) {
+	for _, d := range st.deps {
+		gen, ok := st.gens[d.target].(values.Ranged)
+		if !ok || row[d.source] == nil || row[d.target] == nil {
+			continue
+		}
+		var lo, hi *values.Bound
+		for _, other := range st.deps {
+			if other.target != d.target || row[other.source] == nil {
+				continue
+			}
+			b := &values.Bound{Value: row[other.source], Inclusive: other.op == ">=" || other.op == "<="}
+			switch other.op {
+			case ">", ">=":
+				lo = b
+			case "<", "<=":
+				hi = b
+			}
+		}
+		if v, ok := gen.GenerateWithin(r, i, lo, hi); ok {
+			row[d.target] = v
+		}
+	}
+}
+
+// failingCheck returns the first CHECK constraint the row violates, or nil.
+// A NULL result satisfies a CHECK, as in PostgreSQL. A check that cannot be
+// evaluated is skipped for the rest of the range.
+func failingCheck(st *tableState, rr *rowRange, row []any) *tableCheck {
+	for k, ck := range st.checks {
+		if rr.checkErrs[k] != nil {
+			continue
+		}
+		v, err := evalRow(ck.expr, rowLookup(st.def, row))
+		if err != nil {
+			rr.checkErrs[k] = err
+			continue
+		}
+		if v == false {
+			return ck
+		}
+	}
+	return nil
+}
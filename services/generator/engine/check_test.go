@@ -0,0 +1,142 @@
+package engine_test
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+)
+
+// generate generates rows of every table of a schema.
+func generate(t *testing.T, src string, rows int64) *engine.Result {
+	t.Helper()
+	schema, err := ddl.Parse(src)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	res, err := engine.Generate(schema, plan, engine.Options{Rows: rows, Seed: 1})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	return res
+}
+
+func TestCheckLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+		lo, hi int
+	}{
+		{"text equal", "code text CHECK (char_length(code) = 6)", 6, 6},
+		{"text less", "code text CHECK (char_length(code) < 3)", 0, 2},
+		{"text at least", "code text CHECK (char_length(code) >= 40)", 40, 1 << 20},
+		{"varchar equal", "code varchar(10) CHECK (char_length(code) = 6)", 6, 6},
+		{"varchar less", "code varchar(10) CHECK (length(code) < 3)", 0, 2},
+		{"varchar at least", "code varchar(50) CHECK (char_length(code) >= 40)", 40, 50},
+		{"not empty", "code varchar(2) CHECK (code <> '')", 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := generate(t, "CREATE TABLE t ("+tt.column+");", 200)
+			if len(res.Warnings) > 0 {
+				t.Errorf("warnings: %v", res.Warnings)
+			}
+			for _, row := range res.Tables[0].Rows {
+				s, ok := row[0].(string)
+				if !ok {
+					t.Fatalf("value %v is not a string", row[0])
+				}
+				if n := utf8.RuneCountInString(s); n < tt.lo || n > tt.hi {
+					t.Fatalf("length of %q is %d, want %d to %d", s, n, tt.lo, tt.hi)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckLengthOutOfType(t *testing.T) {
+	schema, err := ddl.Parse("CREATE TABLE t (code varchar(5) CHECK (char_length(code) >= 6));")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if _, err := engine.Generate(schema, plan, engine.Options{Rows: 10, Seed: 1}); err == nil {
+		t.Fatal("Generate succeeded for a length the type cannot hold")
+	}
+}
+
+func TestCheckNegativeOperand(t *testing.T) {
+	tests := []struct {
+		check string
+		ok    func(int64) bool
+	}{
+		{"x>-1", func(x int64) bool { return x > -1 }},
+		{"x*-2<=0", func(x int64) bool { return x*-2 <= 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.check, func(t *testing.T) {
+			res := generate(t, "CREATE TABLE t (x integer CHECK ("+tt.check+"));", 200)
+			if len(res.Warnings) > 0 {
+				t.Errorf("warnings: %v", res.Warnings)
+			}
+			for _, row := range res.Tables[0].Rows {
+				if x := row[0].(int64); !tt.ok(x) {
+					t.Fatalf("%d does not satisfy %s", x, tt.check)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRange(t *testing.T) {
+	tests := []struct {
+		column string
+		lo, hi int64
+	}{
+		{"x integer CHECK (x > 10)", 11, 1<<31 - 1},
+		{"x integer CHECK (x <= -5)", -1 << 31, -5},
+		{"x smallint CHECK (x >= -10 AND x <= -5)", -10, -5},
+		{"x bigint CHECK (x >= -10) CHECK (x < -5)", -10, -6},
+		{"x integer CHECK (x BETWEEN -3 AND 3)", -3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			res := generate(t, "CREATE TABLE t ("+tt.column+");", 200)
+			if len(res.Warnings) > 0 {
+				t.Errorf("warnings: %v", res.Warnings)
+			}
+			for _, row := range res.Tables[0].Rows {
+				if x := row[0].(int64); x < tt.lo || x > tt.hi {
+					t.Fatalf("%d is not in %d to %d", x, tt.lo, tt.hi)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	res := generate(t, `CREATE DOMAIN posint AS smallint CHECK (VALUE > 0);
+CREATE DOMAIN code AS varchar(8) NOT NULL CHECK (char_length(VALUE) = 3);
+CREATE TABLE t (qty posint, "Code" code);`, 200)
+	if len(res.Warnings) > 0 {
+		t.Errorf("warnings: %v", res.Warnings)
+	}
+	for _, row := range res.Tables[0].Rows {
+		if x, ok := row[0].(int64); ok && x <= 0 {
+			t.Fatalf("qty %d is not positive", x)
+		}
+		s, ok := row[1].(string)
+		if !ok || utf8.RuneCountInString(s) != 3 {
+			t.Fatalf("Code %v does not have 3 characters", row[1])
+		}
+	}
+}
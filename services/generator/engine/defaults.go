@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// Sequence is the last value the generated rows took from a sequence.
+// Outputs end with setval calls for them, so that later inserts do not
+// collide with generated keys.
+type Sequence struct {
+	// Name is the sequence of a nextval DEFAULT. It is empty for serial
+	// and identity columns, whose sequence belongs to Table.Column.
+	Name   string
+	Table  *ddl.Table
+	Column string
+	Last   int64
+}
+
+// prepareDefault sets up column i when the database fills it in. Generated
+// columns are computed from the rest of the row, identity columns and
+// nextval defaults count up like serial ones, and other defaults are
+// emulated unless Options.GenerateDefaults is set or a rule sets the
+// column. Key columns keep their emulated values in INSERTs, since foreign
+// keys and updates refer to them and the database would draw other UUIDs.
+// It reports false for
+// columns that get a generator like any other.
+func (g *generator) prepareDefault(st *tableState, i int) bool {
+	t, c := st.def, st.def.Columns[i]
+
+	if c.Generated != nil {
+		st.names[i], st.nulls[i], st.filled[i] = DatabaseGenerator, 0, true
+		expr, err := ddl.ParseExpr(c.Generated)
+		if err != nil {
+			st.warnf("table %q: generated column %q: %v; it is left NULL in outputs that skip the database", t.QualifiedName(), c.Name, err)
+			return true
+		}
+		st.computed[i] = expr
+		return true
+	}
+
+	if _, ok := sequenceOf(c); ok {
+		st.gens[i], st.names[i], st.nulls[i] = &values.Sequence{Start: 1}, "sequence", 0
+		return true
+	}
+	if _, ruled := g.opts.NullRatio[c]; ruled || c.Default == nil || g.opts.GenerateDefaults {
+		return false
+	}
+
+	var gen values.Generator
+	if expr, err := ddl.ParseExpr(c.Default); err == nil {
+		if call, ok := expr.(*ddl.Call); ok && isUUIDFunc(call.Name) {
+			gen, _ = g.registryFor(c).Named("uuid", c.Type)
+		} else if lit, ok := expr.(*ddl.Literal); ok && lit.Value == nil {
+			gen = &values.Choice{Values: []any{nil}}
+		} else if v, ok := constant(expr); ok {
+			gen = &values.Choice{Values: []any{emulate(c.Type, v)}}
+		}
+	}
+	if gen == nil {
+		st.warnf("table %q: DEFAULT %s of column %q cannot be emulated; values are generated instead", t.QualifiedName(), c.Default.Text, c.Name)
+		return false
+	}
+	st.gens[i], st.names[i], st.nulls[i] = gen, DatabaseGenerator, 0
+	st.filled[i] = !g.isKey(t, c)
+	return true
+}
+
+// isKey reports whether rows of table t are identified by column c, or a
+// foreign key of the schema points at it.
+func (g *generator) isKey(t *ddl.Table, c *ddl.Column) bool {
+	if slices.Contains(graph.RowKey(t), c.Name) {
+		return true
+	}
+	for _, other := range g.schema.Tables {
+		for _, fk := range other.ForeignKeys {
+			if g.schema.Table(fk.RefTable) == t && slices.Contains(fk.RefColumns, c.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compute fills the generated columns of a row from its other columns.
+func (g *generator) compute(st *tableState, rr *rowRange, row []any) {
+	lookup := func(name string) (any, bool) {
+		i := st.def.ColumnIndex(name)
+		if i < 0 {
+			return nil, false
+		}
+		return row[i], true
+	}
+	for i, expr := range st.computed {
+		if expr == nil {
+			continue
+		}
+		v, err := evalRow(expr, lookup)
+		if err != nil {
+			if rr.columnErrs[i] == nil {
+				rr.columnErrs[i] = err
+			}
+			v = nil
+		}
+		row[i] = emulate(st.def.Columns[i].Type, v)
+	}
+}
+
+// sequenceTracker follows the largest value the rows of a table take from
+// each of its sequence columns.
+type sequenceTracker struct {
+	def   *ddl.Table
+	cols  []int
+	names []string
+	last  []int64
+	seen  []bool
+}
+
+func newSequenceTracker(t *ddl.Table) *sequenceTracker {
+	s := &sequenceTracker{def: t}
+	for i, c := range t.Columns {
+		if name, ok := sequenceOf(c); ok {
+			s.cols = append(s.cols, i)
+			s.names = append(s.names, name)
+		}
+	}
+	s.last = make([]int64, len(s.cols))
+	s.seen = make([]bool, len(s.cols))
+	return s
+}
+
+func (s *sequenceTracker) observe(row []any) {
+	for k, c := range s.cols {
+		if v, ok := row[c].(int64); ok && (!s.seen[k] || v > s.last[k]) {
+			s.last[k], s.seen[k] = v, true
+		}
+	}
+}
+
+// merge adds the last value of every sequence the table used to the ones
+// found so far.
+func (s *sequenceTracker) merge(found []Sequence) []Sequence {
+	for k, c := range s.cols {
+		if !s.seen[k] {
+			continue
+		}
+		name, last := s.names[k], s.last[k]
+		merged := false
+		for j := range found {
+			if name != "" && found[j].Name == name {
+				found[j].Last = max(found[j].Last, last)
+				merged = true
+			}
+		}
+		if !merged {
+			found = append(found, Sequence{Name: name, Table: s.def, Column: s.def.Columns[c].Name, Last: last})
+		}
+	}
+	return found
+}
+
+// sequenceOf reports whether a column takes its values from a sequence,
+// and the name of the sequence when it is not owned by the column.
+func sequenceOf(c *ddl.Column) (string, bool) {
+	switch {
+	case c.Identity != "":
+		return "", true
+	case c.Type.ArrayDims > 0:
+		return "", false
+	}
+	switch c.Type.Name {
+	case "serial", "bigserial", "smallserial":
+		return "", true
+	}
+	if c.Default == nil {
+		return "", false
+	}
+	expr, err := ddl.ParseExpr(c.Default)
+	if err != nil {
+		return "", false
+	}
+	call, ok := expr.(*ddl.Call)
+	if !ok || call.Name != "nextval" || len(call.Args) != 1 {
+		return "", false
+	}
+	arg := call.Args[0]
+	if cast, ok := arg.(*ddl.Cast); ok {
+		arg = cast.X
+	}
+	lit, ok := arg.(*ddl.Literal)
+	if !ok {
+		return "", false
+	}
+	name, ok := lit.Value.(string)
+	return name, ok && name != ""
+}
+
+func isUUIDFunc(name string) bool {
+	switch name[strings.LastIndex(name, ".")+1:] {
+	case "gen_random_uuid", "uuid_generate_v4":
+		return true
+	}
+	return false
+}
+
+// emulate converts the result of an expression to the value the database
+// would store in a column of type t.
+func emulate(t ddl.Type, v any) any {
+	if v == nil {
+		return nil
+	}
+	v, err := castValue(v, t)
+	if err != nil {
+		return nil
+	}
+	switch t.Name {
+	case "date":
+		if ts, ok := v.(time.Time); ok {
+			return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+		}
+	case "numeric":
+		if f, ok := v.(float64); ok && len(t.Modifiers) == 2 {
+			scale := t.Modifiers[1]
+			return values.FormatScaled(int64(math.Round(f*math.Pow10(scale))), scale)
+		}
+	}
+	cv, err := values.Coerce(t, v)
+	if err != nil {
+		return v
+	}
+	return cv
+}
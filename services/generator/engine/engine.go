@@ -0,0 +1,1000 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+type Options struct {
+	// Rows is the number of rows generated for tables without a count of
+	// their own in TableRows or FanOut.
+	Rows      int64
+	TableRows map[*ddl.Table]int64
+	FanOut    []FanOut
+	// Columns replaces the generators picked from column types.
+	Columns map[*ddl.Column]values.Generator
+	// NullRatio is the share of NULLs drawn for nullable columns, including
+	// foreign keys. DefaultNullRatio applies to columns without an entry.
+	NullRatio        map[*ddl.Column]float64
+	DefaultNullRatio float64
+	// GenerateDefaults draws values for columns with a DEFAULT like for any
+	// other column. Otherwise they are left to the database and emulated,
+	// unless Columns or NullRatio set them.
+	GenerateDefaults bool
+	// Checks are row conditions on top of each table's CHECK constraints.
+	Checks map[*ddl.Table][]*ddl.Check
+	// ParentDistributions skews how often each parent row of a foreign key
+	// is referenced, over the positions of the parent rows. Keys with a
+	// fan-out or a unique reference ignore it.
+	ParentDistributions map[*ddl.ForeignKey]*values.Distribution
+	// Locale shapes inferred text such as names, addresses and phone
+	// numbers, values.DefaultLocale when nil. ColumnLocales overrides it.
+	Locale        *values.Locale
+	ColumnLocales map[*ddl.Column]*values.Locale
+	// Seed drives every random choice; the same schema and seed always
+	// produce the same rows.
+	Seed uint64
+	// MemoryLimit bounds, in bytes, the memory kept for what grows with the
+	// row count: unique key tracking, the parent rows foreign keys copy
+	// from and the rows of tables closed by deferred foreign keys. Past it
+	// they spill to files in SpillDir. Zero keeps all of them in memory.
+	MemoryLimit int64
+	// SpillDir holds spill files, os.TempDir() when empty.
+	SpillDir string
+	// Workers is the number of row ranges generated at once, and of tables
+	// generated side by side, runtime.GOMAXPROCS(0) when 0. It does not
+	// change the rows.
+	Workers int
+	// Progress, when set, is called as rows of a table are generated, with
+	// the rows done so far and the rows to generate: of the table, or of
+	// the shard given to GenerateShard. Tables generated side by side call
+	// it from their own goroutines.
+	Progress func(t *ddl.Table, done, total int64)
+	// Context, when set, stops generation with its error once it is done,
+	// before the next range of rows is generated or handed to the sink.
+	Context context.Context
+}
+
+// Table is one generated table, with values in column order.
+type Table struct {
+	Def   *ddl.Table
+	Count int64
+	// Rows holds the rows of datasets kept in memory by Generate. Stream
+	// hands them to its sink instead.
+	Rows [][]any
+	// Generators names the generator picked for each column: a named
+	// generator inferred from the column, values.TypeGenerator, or
+	// RulesGenerator when Options.Columns set it. Foreign key columns have
+	// an empty name.
+	Generators []string
+	// Defaulted marks the columns the database fills in: generated columns
+	// and columns left to their DEFAULT. Their values are emulated for
+	// outputs loaded without the database's help; INSERT outputs leave them
+	// out.
+	Defaulted []bool
+}
+
+const (
+	// RulesGenerator is the generator name of columns set by Options.Columns.
+	RulesGenerator = "rules"
+	// DatabaseGenerator is the generator name of columns whose values
+	// emulate the database: generated columns and DEFAULT expressions.
+	DatabaseGenerator = "database"
+)
+
+// Update sets foreign key columns that were loaded as NULL because they
+// are part of a cycle.
+type Update struct {
+	Table     *ddl.Table
+	Key       []string
+	KeyValues []any
+	Columns   []string
+	Values    []any
+}
+
+// Result is a generated dataset in load order.
+type Result struct {
+	Tables []*Table
+	// Updates is kept by Generate; Stream hands updates to its sink.
+	Updates          []Update
+	DeferConstraints bool
+	// Sequences are the sequences the rows took values from, with the last
+	// value taken.
+	Sequences []Sequence
+	// Warnings lists constraints the generator could not take into account.
+	Warnings []string
+	// Spilled is the number of bytes spilled to disk to stay within
+	// Options.MemoryLimit.
+	Spilled int64
+}
+
+func (r *Result) Table(t *ddl.Table) *Table {
+	for _, td := range r.Tables {
+		if td.Def == t {
+			return td
+		}
+	}
+	return nil
+}
+
+// spooledTable is a table with deferred foreign keys, or one that
+// references such a table and must be loaded after it. Its rows wait in a
+// store, each followed by whether its deferred keys are still to be
+// chosen, until every table they can point at is generated.
+type spooledTable struct {
+	td    *Table
+	edges []*graph.Edge
+	rows  *rowStore
+}
+
+type generator struct {
+	schema   *ddl.Schema
+	plan     *graph.Plan
+	opts     Options
+	registry *values.Registry
+	// registries of the locales in Options.ColumnLocales, under mu
+	mu        sync.Mutex
+	localized map[*values.Locale]*values.Registry
+
+	sink    Sink
+	res     *Result
+	budget  *budget
+	workers int
+	// counts are the row counts of every table, known up front
+	counts map[*ddl.Table]int64
+	// refs hold the columns foreign keys reference of every row of their
+	// parent tables, at the positions in refCols
+	refs    map[*ddl.Table]*rowStore
+	refCols map[*ddl.Table][]int
+	fanOut  map[*ddl.Table]*fanOutRule
+	// updates hold the position and row key of the rows that wait for the
+	// follow-up update of a foreign key
+	updates map[*graph.Edge]*rowStore
+	runs    map[*ddl.Table]*tableRun
+	// spooled are the tables held back until every table is generated
+	spooled []*spooledTable
+	held    map[*ddl.Table]bool
+	// outputs are the other tables in load order; the one at head is
+	// handed to the sink, later ones wait in their early stores
+	outMu    sync.Mutex
+	outputs  []*tableOutput
+	head     int
+	jobs     chan *rowRange
+	slots    chan struct{}
+	failed   atomic.Bool
+	warnings []string
+}
+
+// Generate produces rows for every table of the plan and keeps the
+// dataset in memory, in Table.Rows and Result.Updates.
+func Generate(schema *ddl.Schema, plan *graph.Plan, opts Options) (*Result, error) {
+	return Stream(schema, plan, opts, &collector{})
+}
+
+// Stream produces rows for every table of the plan and hands them to sink
+// in chunks as they are generated, so that memory stays within
+// Options.MemoryLimit whatever the row counts. Tables with deferred
+// foreign keys are handed over last, once every table they can point at
+// is generated, followed by the tables that reference them.
+func Stream(schema *ddl.Schema, plan *graph.Plan, opts Options, sink Sink) (*Result, error) {
+	g, err := newGenerator(schema, plan, opts, sink)
+	if err != nil {
+		return nil, err
+	}
+	defer g.budget.cleanup()
+
+	g.res = &Result{DeferConstraints: plan.DeferConstraints()}
+	if err := sink.Start(g.res); err != nil {
+		return nil, err
+	}
+	if err := g.run(); err != nil {
+		return nil, err
+	}
+	for _, sp := range g.spooled {
+		err := g.emitSpooled(sp, sp.rows.each)
+		sp.rows.close()
+		if err != nil {
+			return nil, fmt.Errorf("table %q: %w", sp.td.Def.QualifiedName(), err)
+		}
+	}
+	if err := g.resolveUpdates(); err != nil {
+		return nil, err
+	}
+
+	g.res.Warnings = g.warnings
+	g.res.Spilled = g.budget.spilled
+	if err := sink.Finish(g.res); err != nil {
+		return nil, err
+	}
+	return g.res, nil
+}
+
+// newGenerator checks the options and counts the rows of every table. The
+// caller cleans up its budget.
+func newGenerator(schema *ddl.Schema, plan *graph.Plan, opts Options, sink Sink) (*generator, error) {
+	g := &generator{
+		schema:    schema,
+		plan:      plan,
+		opts:      opts,
+		registry:  values.NewRegistry(schema, opts.Locale),
+		localized: make(map[*values.Locale]*values.Registry),
+		sink:      sink,
+		workers:   opts.Workers,
+		counts:    make(map[*ddl.Table]int64),
+		refs:      make(map[*ddl.Table]*rowStore),
+		refCols:   make(map[*ddl.Table][]int),
+		updates:   make(map[*graph.Edge]*rowStore),
+		runs:      make(map[*ddl.Table]*tableRun),
+		held:      make(map[*ddl.Table]bool),
+	}
+	if err := g.checkOptions(); err != nil {
+		return nil, err
+	}
+	if g.workers == 0 {
+		g.workers = runtime.GOMAXPROCS(0)
+	}
+	g.budget = newBudget(opts.MemoryLimit, opts.SpillDir)
+	g.prepareRefs()
+	g.prepareTables()
+	return g, nil
+}
+
+// prepareTables counts the rows of every table and sets up where they go:
+// to the sink in plan order, or to a spool for the tables held back until
+// every table is generated.
+func (g *generator) prepareTables() {
+	for _, t := range g.plan.Order {
+		g.counts[t] = g.rowCount(t)
+		run := &tableRun{def: t}
+		edges := g.plan.EdgesFrom(t)
+		if deferred := deferredEdges(edges); len(deferred) > 0 || g.referencesHeld(edges) {
+			run.spool = &spooledTable{edges: deferred, rows: newRowStore(g.budget, len(t.Columns)+len(deferred))}
+			g.spooled = append(g.spooled, run.spool)
+			g.held[t] = true
+		} else {
+			run.out = &tableOutput{}
+			g.outputs = append(g.outputs, run.out)
+		}
+		for _, e := range edges {
+			if e.Resolution == graph.NullThenUpdate {
+				g.updates[e] = newRowStore(g.budget, 1+len(graph.RowKey(t)))
+			}
+		}
+		g.runs[t] = run
+	}
+}
+
+// prepareRefs sets up a store for the referenced columns of every table a
+// foreign key points at.
+func (g *generator) prepareRefs() {
+	for _, e := range g.plan.Edges {
+		cols := g.refCols[e.Parent]
+		for _, name := range e.FK.RefColumns {
+			if c := e.Parent.ColumnIndex(name); c >= 0 && !slices.Contains(cols, c) {
+				cols = append(cols, c)
+			}
+		}
+		g.refCols[e.Parent] = cols
+	}
+	for t, cols := range g.refCols {
+		g.refs[t] = newRowStore(g.budget, len(cols))
+	}
+}
+
+// refRow returns row j of parent table t with the columns foreign keys
+// reference filled in.
+func (g *generator) refRow(t *ddl.Table, j int64) ([]any, error) {
+	rec, err := g.refs[t].get(j)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]any, len(t.Columns))
+	for k, c := range g.refCols[t] {
+		row[c] = rec[k]
+	}
+	return row, nil
+}
+
+// registryFor returns the registry of the column's locale.
+func (g *generator) registryFor(c *ddl.Column) *values.Registry {
+	loc, ok := g.opts.ColumnLocales[c]
+	if !ok {
+		return g.registry
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.localized[loc]
+	if !ok {
+		r = values.NewRegistry(g.schema, loc)
+		g.localized[loc] = r
+	}
+	return r
+}
+
+// tableRand returns the random source for one table, derived from the job
+// seed and the table name so tables do not share a stream.
+func (g *generator) tableRand(t *ddl.Table) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(t.QualifiedName()))
+	return rand.New(rand.NewPCG(g.opts.Seed, h.Sum64()))
+}
+
+// rangeRand returns the random source of range k of a table's rows, so
+// that rows come out the same however ranges are spread over workers.
+func (g *generator) rangeRand(t *ddl.Table, k int64) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(t.QualifiedName()))
+	return rand.New(rand.NewPCG(g.opts.Seed, h.Sum64()^mix64(uint64(k)+1)))
+}
+
+// fanOutRand returns the random source of the child counts of a fan-out.
+func (g *generator) fanOutRand(e *graph.Edge) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte("fan-out\x00" + e.Child.QualifiedName()))
+	for _, name := range e.FK.Columns {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+	}
+	return rand.New(rand.NewPCG(g.opts.Seed, h.Sum64()))
+}
+
+// edgeRand returns the random source used to close a cyclic foreign key,
+// independent of the order in which tables or edges are processed.
+func (g *generator) edgeRand(e *graph.Edge) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(e.Child.QualifiedName()))
+	for _, name := range e.FK.Columns {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+	}
+	return rand.New(rand.NewPCG(g.opts.Seed, h.Sum64()))
+}
+
+// tableState is the per-table generation context. Workers share it while
+// they generate ranges of rows, and only read it.
+type tableState struct {
+	def   *ddl.Table
+	rows  int64
+	gens  []values.Generator
+	names []string
+	nulls []float64
+	// filled marks defaulted columns, computed holds the expressions of
+	// generated ones
+	filled       []bool
+	computed     []ddl.Node
+	uncomputable []bool
+	edges        []*graph.Edge
+	fkNulls      map[*graph.Edge]float64
+	keys         []*uniqueKey
+	// checks are evaluated on every row, deps narrow columns by other columns
+	checks []*tableCheck
+	deps   []dependentBound
+	// ranges are the bounds CHECKs narrowed each column to, by column
+	ranges map[int][][2]*values.Bound
+	// pickers draw parent rows without replacement for foreign keys that
+	// are unique on the child, e.g. one-to-one relationships
+	pickers map[*graph.Edge]*permutation
+	// parents assigns the parent row of every row for a fan-out foreign key
+	fanOut  *graph.Edge
+	parents *parentStream
+	// earlier is set when rows reference earlier rows of the table, waits
+	// when keys are left for after every table is generated
+	earlier  bool
+	waits    bool
+	refRec   []any
+	warnings []string
+}
+
+func (st *tableState) warnf(format string, args ...any) {
+	st.warnings = append(st.warnings, fmt.Sprintf(format, args...))
+}
+
+// prepareTable picks the generators of a table's columns and narrows them
+// to its constraints.
+func (g *generator) prepareTable(t *ddl.Table) (*tableState, error) {
+	st := &tableState{
+		def:          t,
+		rows:         g.counts[t],
+		gens:         make([]values.Generator, len(t.Columns)),
+		names:        make([]string, len(t.Columns)),
+		nulls:        make([]float64, len(t.Columns)),
+		filled:       make([]bool, len(t.Columns)),
+		computed:     make([]ddl.Node, len(t.Columns)),
+		uncomputable: make([]bool, len(t.Columns)),
+		edges:        g.plan.EdgesFrom(t),
+		fkNulls:      make(map[*graph.Edge]float64),
+		pickers:      make(map[*graph.Edge]*permutation),
+		refRec:       make([]any, len(g.refCols[t])),
+	}
+
+	fkColumn := make(map[string]bool)
+	for _, e := range st.edges {
+		for _, name := range e.FK.Columns {
+			fkColumn[name] = true
+		}
+		st.fkNulls[e] = g.fkNullRatio(t, e)
+		switch e.Resolution {
+		case graph.EarlierRow:
+			st.earlier = true
+		case graph.NullThenUpdate, graph.Deferred:
+			st.waits = true
+		}
+	}
+
+	r := g.tableRand(t)
+	if rule := g.fanOut[t]; rule != nil {
+		st.fanOut = rule.edge
+		st.parents = g.newParentStream(rule, r)
+	}
+
+	for i, c := range t.Columns {
+		if fkColumn[c.Name] {
+			continue
+		}
+		if t.Nullable(c) {
+			st.nulls[i] = g.nullRatio(c)
+		}
+		if gen, ok := g.opts.Columns[c]; ok {
+			st.gens[i], st.names[i] = gen, RulesGenerator
+			continue
+		}
+		if g.prepareDefault(st, i) {
+			continue
+		}
+		gen, name, err := g.registryFor(c).Infer(t, c)
+		if err != nil {
+			return st, err
+		}
+		st.gens[i], st.names[i] = gen, name
+	}
+
+	if err := g.prepareChecks(st); err != nil {
+		return st, err
+	}
+
+	keys, err := newUniqueKeys(t, g.budget)
+	if err != nil {
+		return st, err
+	}
+	st.keys = keys
+	return st, g.prepareKeys(st, r)
+}
+
+// noteFlaws warns once about every CHECK constraint and generated column
+// that a committed range of rows could not evaluate.
+func (st *tableState) noteFlaws(rr *rowRange) {
+	for k, err := range rr.checkErrs {
+		if ck := st.checks[k]; err != nil && !ck.flawed {
+			ck.flawed = true
+			st.warnf("table %q: %s cannot be evaluated (%v); rows are not validated against it", st.def.QualifiedName(), ck, err)
+		}
+	}
+	for i, err := range rr.columnErrs {
+		if err != nil && !st.uncomputable[i] {
+			st.uncomputable[i] = true
+			st.warnf("table %q: generated column %q cannot be emulated (%v); it is left NULL in outputs that skip the database",
+				st.def.QualifiedName(), st.def.Columns[i].Name, err)
+		}
+	}
+}
+
+// deferredEdges returns the foreign keys of a table that are chosen after
+// every table is generated and loaded with deferred constraints.
+func deferredEdges(edges []*graph.Edge) []*graph.Edge {
+	var deferred []*graph.Edge
+	for _, e := range edges {
+		if e.Resolution == graph.Deferred {
+			deferred = append(deferred, e)
+		}
+	}
+	return deferred
+}
+
+// referencesHeld reports whether a foreign key that is checked right away
+// points at a table held back until the end.
+func (g *generator) referencesHeld(edges []*graph.Edge) bool {
+	for _, e := range edges {
+		if e.Resolution == graph.Ordered && g.held[e.Parent] {
+			return true
+		}
+	}
+	return false
+}
+
+// record keeps what later rows and tables need of row i: the columns
+// foreign keys reference and, for keys closed by follow-up updates, the
+// row key to update. waiting marks the keys of the row, by edge, that are
+// chosen once every table is generated.
+func (g *generator) record(st *tableState, row []any, i int64, waiting []bool) error {
+	if refs := g.refs[st.def]; refs != nil {
+		for k, c := range g.refCols[st.def] {
+			st.refRec[k] = row[c]
+		}
+		if err := refs.add(st.refRec); err != nil {
+			return err
+		}
+	}
+	for k, e := range st.edges {
+		if e.Resolution != graph.NullThenUpdate || !waiting[k] {
+			continue
+		}
+		key := graph.RowKey(e.Child)
+		rec := make([]any, 0, 1+len(key))
+		rec = append(rec, i)
+		for _, name := range key {
+			rec = append(rec, row[st.def.ColumnIndex(name)])
+		}
+		if err := g.updates[e].add(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// draw generates the value of column c for row i; again marks a redraw
+// of a value that broke a constraint.
+func (st *tableState) draw(r *rand.Rand, c int, i int64, again bool) any {
+	if st.nulls[c] > 0 && r.Float64() < st.nulls[c] {
+		return nil
+	}
+	if w, ok := st.gens[c].(*withoutReplacement); ok && again {
+		return w.any(r)
+	}
+	return st.gens[c].Generate(r, i)
+}
+
+// nullRatio returns the share of NULLs of a nullable column.
+func (g *generator) nullRatio(c *ddl.Column) float64 {
+	if ratio, ok := g.opts.NullRatio[c]; ok {
+		return ratio
+	}
+	return g.opts.DefaultNullRatio
+}
+
+// fkNullRatio returns the share of rows that reference no parent through a
+// foreign key, which needs all of its columns to be nullable.
+func (g *generator) fkNullRatio(t *ddl.Table, e *graph.Edge) float64 {
+	ratio := g.opts.DefaultNullRatio
+	for _, name := range e.FK.Columns {
+		c := t.Column(name)
+		if c == nil || !t.Nullable(c) {
+			return 0
+		}
+		if r, ok := g.opts.NullRatio[c]; ok {
+			ratio = r
+		}
+	}
+	return ratio
+}
+
+// pickParent fills the columns of one foreign key of row i, and reports
+// whether the key is left NULL until every table is generated. again marks
+// a redraw of a parent that broke a constraint. Keys to earlier rows of
+// the table are picked once the range of the row is committed.
+func (g *generator) pickParent(st *tableState, rr *rowRange, row []any, i int64, e *graph.Edge, again bool) (bool, error) {
+	r := rr.r
+	if e.Resolution == graph.EarlierRow && !rr.committing {
+		return false, nil
+	}
+	if ratio := st.fkNulls[e]; ratio > 0 && e != st.fanOut && r.Float64() < ratio {
+		for _, name := range e.FK.Columns {
+			row[st.def.ColumnIndex(name)] = nil
+		}
+		return false, nil
+	}
+	switch e.Resolution {
+	case graph.Ordered:
+		n := g.counts[e.Parent]
+		if n == 0 {
+			return false, fmt.Errorf("cannot reference %q: it has no rows", e.Parent.QualifiedName())
+		}
+		j := r.Int64N(n)
+		if e == st.fanOut {
+			j = rr.parents[i-rr.first]
+		} else if perm := st.pickers[e]; perm != nil {
+			if !again && uint64(i) < perm.n {
+				j = int64(perm.at(uint64(i)))
+			}
+		} else if d := g.opts.ParentDistributions[e.FK]; d != nil {
+			j = int64(skewedParent(d, r, int(n)))
+		}
+		parent, err := g.refRow(e.Parent, j)
+		if err != nil {
+			return false, err
+		}
+		copyRef(row, st.def, parent, e)
+	case graph.EarlierRow:
+		j := r.Int64N(i + 1)
+		if d := g.opts.ParentDistributions[e.FK]; d != nil {
+			j = int64(skewedParent(d, r, int(i+1)))
+		}
+		src := row
+		if j < i {
+			var err error
+			if src, err = g.refRow(st.def, j); err != nil {
+				return false, err
+			}
+		}
+		copyRef(row, st.def, src, e)
+	case graph.NullThenUpdate, graph.Deferred:
+		for _, name := range e.FK.Columns {
+			row[st.def.ColumnIndex(name)] = nil
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// prepareKeys checks up front that every unique key can hold the requested
+// number of rows, and switches small domains to drawing without
+// replacement so that they fill up without endless redraws.
+func (g *generator) prepareKeys(st *tableState, r *rand.Rand) error {
+	t := st.def
+	for _, k := range st.keys {
+		if len(k.cols) == 1 {
+			c := k.cols[0]
+			// dictionary values such as city names run out for unique columns
+			if gen, ok := st.gens[c].(*values.Fake); ok && st.names[c] != RulesGenerator && gen.Cardinality() < 4*float64(st.rows) {
+				typed, err := g.registryFor(t.Columns[c]).ForColumn(t.Columns[c])
+				if err != nil {
+					return err
+				}
+				st.gens[c], st.names[c] = typed, values.TypeGenerator
+			}
+			// pronounceable words run out quickly for short unique columns
+			if gen, ok := st.gens[c].(*values.String); ok && gen.Charset == "" && gen.Cardinality() < 4*float64(st.rows) {
+				st.gens[c] = &values.String{MinLen: gen.MinLen, MaxLen: gen.MaxLen, Charset: values.Alphanumeric, Limit: gen.Limit}
+			}
+			if gen, ok := st.gens[c].(values.Enumerable); ok && gen.Cardinality() < 1<<62 {
+				st.gens[c] = newWithoutReplacement(gen, r)
+			}
+		}
+
+		domain := 1.0
+		checkable := true
+		counted := make(map[*graph.Edge]bool)
+
+		for _, c := range k.cols {
+			if gen := st.gens[c]; gen != nil {
+				if u, ok := gen.(values.Unique); ok && u.Unique() {
+					domain = math.Inf(1)
+				} else if f, ok := gen.(values.Finite); ok {
+					domain *= f.Cardinality()
+				} else {
+					domain = math.Inf(1)
+				}
+				continue
+			}
+
+			e := edgeFor(st.edges, t.Columns[c].Name)
+			switch {
+			case e == nil || counted[e]:
+			case e.Resolution == graph.Ordered:
+				counted[e] = true
+				domain *= float64(g.counts[e.Parent])
+			case e.Resolution == graph.EarlierRow:
+				counted[e] = true
+				domain = math.Inf(1)
+			default:
+				checkable = false
+			}
+		}
+
+		if checkable && k.where == nil && domain < float64(st.rows) && !k.nullable(t) {
+			return fmt.Errorf("%w: %s allows at most %.0f distinct values, but %d rows were requested",
+				errDomainExhausted, k, domain, st.rows)
+		}
+
+		if e := edgeFor(st.edges, t.Columns[k.cols[0]].Name); e != nil && e.Resolution == graph.Ordered && sameColumns(e.FK.Columns, k.def.Columns) {
+			st.pickers[e] = newPermutation(uint64(g.counts[e.Parent]), r)
+			if g.opts.ParentDistributions[e.FK] != nil {
+				st.warnf("table %q: references to %q are unique, their distribution is ignored", t.QualifiedName(), e.Parent.QualifiedName())
+			}
+		}
+	}
+	return nil
+}
+
+// settleRow redraws the columns of violated CHECK constraints and of the
+// given unique keys until row i satisfies all of them, then records its
+// keys. Keys with a nullable column fall back to NULL when their domain
+// runs out.
+func (g *generator) settleRow(st *tableState, rr *rowRange, row []any, i int64, keys []*uniqueKey) error {
+	t := st.def
+	for attempt := 0; ; attempt++ {
+		if ck := failingCheck(st, rr, row); ck != nil {
+			if attempt >= maxAttempts {
+				return fmt.Errorf("%w: could not satisfy %s after %d attempts at row %d",
+					errCheckUnsatisfied, ck, maxAttempts, i+1)
+			}
+			if err := g.redraw(st, rr, row, i, ck.cols); err != nil {
+				return err
+			}
+			continue
+		}
+
+		violated := -1
+		encoded := make([]uint64, len(keys))
+		tracked := make([]bool, len(keys))
+		for ki, k := range keys {
+			if k.alwaysUnique(st) {
+				continue
+			}
+			fp, ok := k.encode(t, row)
+			if !ok {
+				continue
+			}
+			dup, err := k.seen.has(fp)
+			if err != nil {
+				return err
+			}
+			if dup {
+				violated = ki
+				break
+			}
+			encoded[ki], tracked[ki] = fp, true
+		}
+
+		if violated < 0 {
+			for ki, k := range keys {
+				if !tracked[ki] {
+					continue
+				}
+				if err := k.seen.add(encoded[ki]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		k := keys[violated]
+		if attempt >= maxAttempts {
+			if !k.nullable(t) {
+				return fmt.Errorf("%w: could not find a free value for %s after %d attempts at row %d",
+					errDomainExhausted, k, maxAttempts, i+1)
+			}
+			for _, c := range k.cols {
+				if !t.Columns[c].NotNull {
+					row[c] = nil
+				}
+			}
+			continue
+		}
+
+		if err := g.redraw(st, rr, row, i, k.cols); err != nil {
+			return err
+		}
+	}
+}
+
+// alwaysUnique reports whether a key contains a column whose generator
+// never repeats, so it does not need to be tracked.
+func (k *uniqueKey) alwaysUnique(st *tableState) bool {
+	for _, c := range k.cols {
+		if u, ok := st.gens[c].(values.Unique); ok && u.Unique() {
+			return true
+		}
+	}
+	return false
+}
+
+// redraw regenerates the given columns of row i, re-picking parents for
+// foreign key columns.
+func (g *generator) redraw(st *tableState, rr *rowRange, row []any, i int64, cols []int) error {
+	repicked := make(map[*graph.Edge]bool)
+	for _, c := range cols {
+		if gen := st.gens[c]; gen != nil {
+			row[c] = st.draw(rr.r, c, i, true)
+			continue
+		}
+		e := edgeFor(st.edges, st.def.Columns[c].Name)
+		if e == nil || repicked[e] || (e.Resolution != graph.Ordered && e.Resolution != graph.EarlierRow) {
+			continue
+		}
+		repicked[e] = true
+		if _, err := g.pickParent(st, rr, row, i, e, true); err != nil {
+			return err
+		}
+	}
+	applyDeps(st, rr.r, row, i)
+	g.compute(st, rr, row)
+	return nil
+}
+
+func edgeFor(edges []*graph.Edge, column string) *graph.Edge {
+	for _, e := range edges {
+		for _, name := range e.FK.Columns {
+			if name == column {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, name := range a {
+		set[name] = true
+	}
+	for _, name := range b {
+		if !set[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// copyRef copies the referenced column values of parentRow into the
+// foreign key columns of row.
+func copyRef(row []any, child *ddl.Table, parentRow []any, e *graph.Edge) {
+	for k, name := range e.FK.Columns {
+		row[child.ColumnIndex(name)] = parentRow[e.Parent.ColumnIndex(e.FK.RefColumns[k])]
+	}
+}
+
+// cycleEdge chooses the parents of a foreign key on a cycle once every
+// table is generated.
+type cycleEdge struct {
+	edge    *graph.Edge
+	r       *rand.Rand
+	parents int64
+	// perm draws parents without replacement for keys unique on the child
+	perm *permutation
+}
+
+func (g *generator) newCycleEdge(e *graph.Edge) (*cycleEdge, error) {
+	n := g.counts[e.Parent]
+	if n == 0 {
+		return nil, fmt.Errorf("cannot reference %q: it has no rows", e.Parent.QualifiedName())
+	}
+	c := &cycleEdge{edge: e, r: g.edgeRand(e), parents: n}
+	if uniqueOnChild(e) {
+		c.perm = newPermutation(uint64(n), c.r)
+	}
+	return c, nil
+}
+
+// parentOf returns the parent row of child row i, and false once a unique
+// reference has taken every parent.
+func (g *generator) parentOf(c *cycleEdge, i int64) (int64, bool) {
+	j := c.r.Int64N(c.parents)
+	if c.perm != nil {
+		k, ok := c.perm.draw()
+		return int64(k), ok
+	}
+	if d := g.opts.ParentDistributions[c.edge.FK]; d != nil {
+		j = int64(skewedParent(d, c.r, int(c.parents)))
+	}
+	if c.edge.Parent == c.edge.Child && c.parents > 1 && j == i {
+		j = (j + 1) % c.parents
+	}
+	return j, true
+}
+
+// emitSpooled fills in the deferred foreign keys of a spooled table and
+// hands its rows to the sink. each reads the rows, each followed by
+// whether its deferred keys are still to be chosen.
+func (g *generator) emitSpooled(sp *spooledTable, each func(fn func(i int64, rec []any) error) error) error {
+	w, err := g.beginTable(sp.td)
+	if err != nil {
+		return err
+	}
+	n := len(sp.td.Def.Columns)
+	cycles := make([]*cycleEdge, len(sp.edges))
+	err = each(func(i int64, rec []any) error {
+		if err := g.cancelled(i); err != nil {
+			return err
+		}
+		row := rec[:n:n]
+		for k, e := range sp.edges {
+			if rec[n+k] != true {
+				continue
+			}
+			if cycles[k] == nil {
+				c, err := g.newCycleEdge(e)
+				if err != nil {
+					return err
+				}
+				cycles[k] = c
+			}
+			j, ok := g.parentOf(cycles[k], i)
+			if !ok {
+				return fmt.Errorf("%w: %s has more rows than %q can be referenced uniquely",
+					errDomainExhausted, e.Child.QualifiedName(), e.Parent.QualifiedName())
+			}
+			parent, err := g.refRow(e.Parent, j)
+			if err != nil {
+				return err
+			}
+			copyRef(row, e.Child, parent, e)
+		}
+		return w.add(row)
+	})
+	if err != nil {
+		return err
+	}
+	return g.endTable(w)
+}
+
+// resolveUpdates chooses parents for the foreign keys closed by follow-up
+// updates and hands the updates to the sink.
+func (g *generator) resolveUpdates() error {
+	for _, e := range g.plan.Edges {
+		spool := g.updates[e]
+		if spool == nil {
+			continue
+		}
+		if spool.len() == 0 {
+			spool.close()
+			continue
+		}
+		c, err := g.newCycleEdge(e)
+		if err != nil {
+			return err
+		}
+		key := graph.RowKey(e.Child)
+		err = spool.each(func(i int64, rec []any) error {
+			if err := g.cancelled(i); err != nil {
+				return err
+			}
+			j, ok := g.parentOf(c, rec[0].(int64))
+			if !ok {
+				// every parent is taken, leave the one-to-one reference unset
+				return nil
+			}
+			parent, err := g.refRow(e.Parent, j)
+			if err != nil {
+				return err
+			}
+			u := Update{Table: e.Child, Key: key, KeyValues: rec[1:], Columns: e.FK.Columns}
+			for _, name := range e.FK.RefColumns {
+				u.Values = append(u.Values, parent[e.Parent.ColumnIndex(name)])
+			}
+			return g.sink.WriteUpdate(u)
+		})
+		spool.close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelled returns the error of Options.Context once it is done, checked
+// at the first row i of every range.
+func (g *generator) cancelled(i int64) error {
+	if g.opts.Context == nil || i%rangeRows != 0 {
+		return nil
+	}
+	return g.opts.Context.Err()
+}
+
+// uniqueOnChild reports whether the foreign key columns are themselves a
+// unique key of the child table.
+func uniqueOnChild(e *graph.Edge) bool {
+	t := e.Child
+	if t.PrimaryKey != nil && sameColumns(t.PrimaryKey.Columns, e.FK.Columns) {
+		return true
+	}
+	for _, u := range t.Uniques {
+		if u.Where == nil && sameColumns(u.Columns, e.FK.Columns) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package engine_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/output"
+)
+
+// keyOf joins the values of columns of a row, or reports false when one is
+// NULL.
+func keyOf(t *ddl.Table, row []any, columns []string) (string, bool) {
+	parts := make([]string, len(columns))
+	for i, name := range columns {
+		v := row[t.ColumnIndex(name)]
+		if v == nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, "|"), true
+}
+
+func TestForeignKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		fanOut string
+	}{
+		{
+			name: "chain",
+			src: `CREATE TABLE teams (id serial PRIMARY KEY);
+CREATE TABLE users (id bigserial PRIMARY KEY, team_id int NOT NULL REFERENCES teams (id));
+CREATE TABLE orders (id uuid PRIMARY KEY, user_id bigint REFERENCES users (id));`,
+		},
+		{
+			name: "composite key",
+			src: `CREATE TABLE a (x int, y text, PRIMARY KEY (x, y));
+CREATE TABLE b (id int PRIMARY KEY, x int NOT NULL, y text NOT NULL, FOREIGN KEY (x, y) REFERENCES a (x, y));`,
+		},
+		{
+			name: "self-reference",
+			src:  `CREATE TABLE emp (id int PRIMARY KEY, boss_id int REFERENCES emp (id), mentor_id int NOT NULL REFERENCES emp (id));`,
+		},
+		{
+			name: "cycle",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int REFERENCES a (id));`,
+		},
+		{
+			name: "deferred cycle",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL UNIQUE REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int NOT NULL UNIQUE REFERENCES a (id) DEFERRABLE);`,
+		},
+		{
+			name: "one to one",
+			src: `CREATE TABLE users (id int PRIMARY KEY);
+CREATE TABLE profiles (user_id int PRIMARY KEY REFERENCES users (id));`,
+		},
+		{
+			name: "fan-out",
+			src: `CREATE TABLE users (id int PRIMARY KEY);
+CREATE TABLE orders (id int PRIMARY KEY, user_id int NOT NULL REFERENCES users (id));`,
+			fanOut: "orders",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ddl.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			plan, err := graph.Build(schema)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			opts := engine.Options{Rows: 300, Seed: 1, DefaultNullRatio: 0.2}
+			if tt.fanOut != "" {
+				opts.FanOut = []engine.FanOut{{FK: schema.Table(tt.fanOut).ForeignKeys[0], Min: 0, Max: 5}}
+			}
+			res, err := engine.Generate(schema, plan, opts)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+
+			byTable := make(map[*ddl.Table]*engine.Table)
+			for _, td := range res.Tables {
+				byTable[td.Def] = td
+			}
+			for _, e := range plan.Edges {
+				parent := byTable[e.Parent]
+				keys := make(map[string]bool)
+				for _, row := range parent.Rows {
+					if key, ok := keyOf(e.Parent, row, e.FK.RefColumns); ok {
+						keys[key] = true
+					}
+				}
+
+				child := byTable[e.Child]
+				for _, row := range child.Rows {
+					key, ok := keyOf(e.Child, row, e.FK.Columns)
+					if ok && !keys[key] {
+						t.Fatalf("%s references %s, which %s does not have", e.Child.Name, key, e.Parent.Name)
+					}
+				}
+				for _, u := range res.Updates {
+					if u.Table != e.Child || !slices.Equal(u.Columns, e.FK.Columns) {
+						continue
+					}
+					parts := make([]string, len(u.Values))
+					for i, v := range u.Values {
+						parts[i] = fmt.Sprint(v)
+					}
+					if key := strings.Join(parts, "|"); !keys[key] {
+						t.Fatalf("%s is updated to reference %s, which %s does not have", e.Child.Name, key, e.Parent.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUniqueKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		rows int64
+		err  string
+	}{
+		{name: "smallint", src: `CREATE TABLE t (s smallint NOT NULL UNIQUE);`, rows: 40000},
+		{name: "smallint exhausted", src: `CREATE TABLE t (s smallint PRIMARY KEY);`, rows: 70000, err: "at most 65536"},
+		{name: "boolean and smallint", src: `CREATE TABLE t (b boolean, s smallint, UNIQUE (b, s));`, rows: 131072},
+		{
+			name: "boolean and smallint exhausted",
+			src:  `CREATE TABLE t (b boolean NOT NULL, s smallint NOT NULL, UNIQUE (b, s));`,
+			rows: 131073,
+			err:  "at most 131072",
+		},
+		{
+			name: "partial index",
+			src: `CREATE TABLE t (id serial PRIMARY KEY, code smallint NOT NULL, active boolean NOT NULL);
+CREATE UNIQUE INDEX ON t (code) WHERE active;`,
+			rows: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ddl.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			plan, err := graph.Build(schema)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			res, err := engine.Generate(schema, plan, engine.Options{Rows: tt.rows, Seed: 1})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+
+			table := res.Tables[0]
+			if int64(len(table.Rows)) != tt.rows {
+				t.Fatalf("got %d rows, want %d", len(table.Rows), tt.rows)
+			}
+			keys := table.Def.Uniques
+			if table.Def.PrimaryKey != nil {
+				keys = append(keys, table.Def.PrimaryKey)
+			}
+			for _, k := range keys {
+				seen := make(map[string]bool)
+				for _, row := range table.Rows {
+					if k.Where != nil && row[table.Def.ColumnIndex("active")] != true {
+						continue
+					}
+					key, ok := keyOf(table.Def, row, k.Columns)
+					if !ok {
+						continue
+					}
+					if seen[key] {
+						t.Fatalf("%v is repeated in (%s)", key, strings.Join(k.Columns, ", "))
+					}
+					seen[key] = true
+				}
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	schema, err := ddl.Parse(`CREATE TABLE users (
+	id bigserial PRIMARY KEY,
+	email varchar(64) NOT NULL UNIQUE,
+	born date,
+	score numeric(5, 2) CHECK (score >= 0)
+);
+CREATE TABLE orders (id uuid PRIMARY KEY, user_id bigint NOT NULL REFERENCES users (id), total real);
+CREATE TABLE emp (id int PRIMARY KEY, boss_id int REFERENCES emp (id));`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	dump := func(seed uint64) string {
+		res, err := engine.Generate(schema, plan, engine.Options{Rows: 200, Seed: seed})
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		var sb strings.Builder
+		for _, td := range res.Tables {
+			fmt.Fprintf(&sb, "%s %v\n", td.Def.Name, td.Rows)
+		}
+		for _, u := range res.Updates {
+			fmt.Fprintf(&sb, "%s %v %v\n", u.Table.Name, u.KeyValues, u.Values)
+		}
+		return sb.String()
+	}
+
+	first := dump(42)
+	if again := dump(42); again != first {
+		t.Error("the same seed generated different rows")
+	}
+	if other := dump(43); other == first {
+		t.Error("a different seed generated the same rows")
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	schema, err := ddl.Parse(`CREATE TABLE teams (id serial PRIMARY KEY, name text NOT NULL UNIQUE, lead_id int);
+CREATE TABLE users (
+	id bigserial PRIMARY KEY,
+	team_id int NOT NULL REFERENCES teams (id),
+	email varchar(64) NOT NULL UNIQUE,
+	age int CHECK (age BETWEEN 18 AND 99),
+	created_at timestamptz DEFAULT now()
+);
+ALTER TABLE teams ADD FOREIGN KEY (lead_id) REFERENCES users (id);
+CREATE TABLE emp (id int PRIMARY KEY, boss_id int REFERENCES emp (id));`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	script := func(opts engine.Options) string {
+		var sb strings.Builder
+		if _, err := engine.Stream(schema, plan, opts, output.NewSQLWriter(&sb, output.SQLOptions{})); err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name string
+		opts engine.Options
+	}{
+		{name: "in memory", opts: engine.Options{Rows: 5000, Seed: 7}},
+		{name: "spilled", opts: engine.Options{Rows: 5000, Seed: 7, MemoryLimit: 64 << 10, SpillDir: t.TempDir()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Workers = 1
+			want := script(opts)
+			for _, workers := range []int{2, 8} {
+				opts.Workers = workers
+				if got := script(opts); got != want {
+					t.Errorf("%d workers wrote a different script than 1", workers)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// errUnsupported is returned for expressions the evaluator cannot decide.
+// Callers treat such expressions conservatively.
+var errUnsupported = errors.New("unsupported expression")
+
+func unsupported(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errUnsupported, fmt.Sprintf(format, args...))
+}
+
+// evalRow evaluates an expression against one row. lookup returns the value
+// of a column and whether the column exists. A nil result is SQL NULL.
+func evalRow(n ddl.Node, lookup func(string) (any, bool)) (any, error) {
+	switch n := n.(type) {
+	case *ddl.Literal:
+		return n.Value, nil
+
+	case *ddl.ColumnRef:
+		v, ok := lookup(n.Name)
+		if !ok {
+			return nil, unsupported("unknown column %q", n.Name)
+		}
+		return v, nil
+
+	case *ddl.Unary:
+		x, err := evalRow(n.X, lookup)
+		if err != nil || x == nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "not":
+			b, ok := x.(bool)
+			if !ok {
+				return nil, unsupported("NOT of non-boolean")
+			}
+			return !b, nil
+		case "-":
+			return arith("-", int64(0), x)
+		}
+		return x, nil
+
+	case *ddl.IsNull:
+		x, err := evalRow(n.X, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return (x == nil) != n.Not, nil
+
+	case *ddl.Binary:
+		return evalBinary(n, lookup)
+
+	case *ddl.In:
+		x, err := evalRow(n.X, lookup)
+		if err != nil || x == nil {
+			return nil, err
+		}
+		sawNull := false
+		for _, item := range n.List {
+			v, err := evalRow(item, lookup)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				sawNull = true
+				continue
+			}
+			c, err := compare(x, v)
+			if err != nil {
+				return nil, err
+			}
+			if c == 0 {
+				return !n.Not, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return n.Not, nil
+
+	case *ddl.Between:
+		x, err := evalRow(n.X, lookup)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := evalRow(n.Lo, lookup)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := evalRow(n.Hi, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if x == nil || lo == nil || hi == nil {
+			return nil, nil
+		}
+		c1, err := compare(x, lo)
+		if err != nil {
+			return nil, err
+		}
+		c2, err := compare(x, hi)
+		if err != nil {
+			return nil, err
+		}
+		return (c1 >= 0 && c2 <= 0) != n.Not, nil
+
+	case *ddl.Cast:
+		x, err := evalRow(n.X, lookup)
+		if err != nil || x == nil {
+			return nil, err
+		}
+		return castValue(x, n.Type)
+
+	case *ddl.Call:
+		return evalCall(n, lookup)
+	}
+
+	return nil, unsupported("%s", n)
+}
+
+func evalBinary(n *ddl.Binary, lookup func(string) (any, bool)) (any, error) {
+	l, err := evalRow(n.L, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	// AND and OR short-circuit with three-valued logic
+	if n.Op == "and" || n.Op == "or" {
+		r, err := evalRow(n.R, lookup)
+		if err != nil {
+			return nil, err
+		}
+		lb, lok := l.(bool)
+		rb, rok := r.(bool)
+		if (l != nil && !lok) || (r != nil && !rok) {
+			return nil, unsupported("%s of non-boolean", strings.ToUpper(n.Op))
+		}
+		if n.Op == "and" {
+			if (lok && !lb) || (rok && !rb) {
+				return false, nil
+			}
+			if lok && rok {
+				return true, nil
+			}
+			return nil, nil
+		}
+		if (lok && lb) || (rok && rb) {
+			return true, nil
+		}
+		if lok && rok {
+			return false, nil
+		}
+		return nil, nil
+	}
+
+	r, err := evalRow(n.R, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "is distinct from", "is not distinct from":
+		same := l == nil && r == nil
+		if l != nil && r != nil {
+			c, err := compare(l, r)
+			if err != nil {
+				return nil, err
+			}
+			same = c == 0
+		}
+		return same == (n.Op == "is not distinct from"), nil
+	}
+
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	switch n.Op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "=":
+			return c == 0, nil
+		case "<>":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+
+	case "+", "-", "*", "/", "%":
+		return arith(n.Op, l, r)
+
+	case "||":
+		return asString(l) + asString(r), nil
+
+	case "like", "ilike", "~", "~*", "!~", "!~*":
+		s, ok1 := l.(string)
+		pat, ok2 := r.(string)
+		if !ok1 || !ok2 {
+			return nil, unsupported("pattern match on non-text")
+		}
+		var re *regexp.Regexp
+		var err error
+		switch n.Op {
+		case "like":
+			re, err = regexp.Compile(likeToRegexp(pat, false))
+		case "ilike":
+			re, err = regexp.Compile(likeToRegexp(pat, true))
+		case "~", "!~":
+			re, err = regexp.Compile(pat)
+		default:
+			re, err = regexp.Compile("(?i)" + pat)
+		}
+		if err != nil {
+			return nil, unsupported("pattern %q: %v", pat, err)
+		}
+		return re.MatchString(s) != strings.HasPrefix(n.Op, "!"), nil
+	}
+
+	return nil, unsupported("operator %s", n.Op)
+}
+
+func likeToRegexp(pat string, fold bool) string {
+	var sb strings.Builder
+	if fold {
+		sb.WriteString("(?i)")
+	}
+	sb.WriteString("^")
+	for i := 0; i < len(pat); i++ {
+		switch c := pat[i]; c {
+		case '%':
+			sb.WriteString("(?s:.*)")
+		case '_':
+			sb.WriteString("(?s:.)")
+		case '\\':
+			if i+1 < len(pat) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pat[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func evalCall(n *ddl.Call, lookup func(string) (any, bool)) (any, error) {
+	args := make([]any, len(n.Args))
+	for i, a := range n.Args {
+		v, err := evalRow(a, lookup)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.Name {
+	case "now", "current_timestamp", "localtimestamp", "transaction_timestamp", "statement_timestamp", "clock_timestamp":
+		return values.RangeEnd, nil
+	case "current_date":
+		return values.RangeEnd.Truncate(24 * time.Hour), nil
+	case "coalesce":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "array":
+		return args, nil
+	}
+
+	if len(args) != 1 {
+		return nil, unsupported("function %s", n.Name)
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	switch n.Name {
+	case "char_length", "character_length", "length":
+		switch v := args[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case []byte:
+			return int64(len(v)), nil
+		}
+	case "octet_length":
+		return int64(len(asString(args[0]))), nil
+	case "lower":
+		return strings.ToLower(asString(args[0])), nil
+	case "upper":
+		return strings.ToUpper(asString(args[0])), nil
+	case "btrim", "trim":
+		return strings.TrimSpace(asString(args[0])), nil
+	case "abs":
+		if c, err := compare(args[0], int64(0)); err == nil && c < 0 {
+			return arith("-", int64(0), args[0])
+		}
+		return args[0], nil
+	case "cardinality", "array_length":
+		if arr, ok := args[0].([]any); ok {
+			return int64(len(arr)), nil
+		}
+	}
+	return nil, unsupported("function %s", n.Name)
+}
+
+func asString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case values.Decimal:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case values.Decimal:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func arith(op string, l, r any) (any, error) {
+	li, lInt := l.(int64)
+	ri, rInt := r.(int64)
+	if lInt && rInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, unsupported("division by zero")
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	if lt, ok := l.(time.Time); ok {
+		if days, ok := r.(int64); ok && (op == "+" || op == "-") {
+			if op == "-" {
+				days = -days
+			}
+			return lt.AddDate(0, 0, int(days)), nil
+		}
+		if iv, ok := r.(values.Interval); ok && (op == "+" || op == "-") {
+			sign := 1
+			if op == "-" {
+				sign = -1
+			}
+			return lt.AddDate(0, sign*int(iv.Months), sign*int(iv.Days)).Add(time.Duration(sign) * time.Duration(iv.Micros) * time.Microsecond), nil
+		}
+	}
+
+	lf, ok1 := toFloat(l)
+	rf, ok2 := toFloat(r)
+	if !ok1 || !ok2 {
+		return nil, unsupported("arithmetic on %T and %T", l, r)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, unsupported("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, unsupported("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, unsupported("operator %s", op)
+}
+
+// compare orders two non-NULL values of compatible types.
+func compare(a, b any) (int, error) {
+	if ai, ok := a.(int64); ok {
+		if bi, ok := b.(int64); ok {
+			return cmpOrdered(ai, bi), nil
+		}
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return cmpOrdered(af, bf), nil
+		}
+		if bs, ok := b.(string); ok {
+			if bf, err := strconv.ParseFloat(bs, 64); err == nil {
+				return cmpOrdered(af, bf), nil
+			}
+		}
+	}
+
+	switch av := a.(type) {
+	case string:
+		switch bv := b.(type) {
+		case string:
+			return strings.Compare(av, bv), nil
+		case time.Time, time.Duration, values.Interval:
+			c, err := compare(b, a)
+			return -c, err
+		}
+		if _, ok := toFloat(b); ok {
+			c, err := compare(b, a)
+			return -c, err
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, nil
+			case !av:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	case time.Time:
+		switch bv := b.(type) {
+		case time.Time:
+			return av.Compare(bv), nil
+		case string:
+			bt, err := parseTime(bv)
+			if err != nil {
+				return 0, err
+			}
+			return av.Compare(bt), nil
+		}
+	case time.Duration:
+		switch bv := b.(type) {
+		case time.Duration:
+			return cmpOrdered(av, bv), nil
+		case string:
+			bt, err := time.Parse("15:04:05", bv)
+			if err != nil {
+				return 0, unsupported("time literal %q", bv)
+			}
+			return cmpOrdered(av, bt.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), nil
+		}
+	case values.Interval:
+		if bv, ok := b.(values.Interval); ok {
+			return cmpOrdered(intervalMicros(av), intervalMicros(bv)), nil
+		}
+	}
+	return 0, unsupported("comparison of %T and %T", a, b)
+}
+
+func intervalMicros(iv values.Interval) int64 {
+	return (int64(iv.Months)*30+int64(iv.Days))*int64(24*time.Hour/time.Microsecond) + iv.Micros
+}
+
+func cmpOrdered[T int64 | float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := values.ParseTime(s)
+	if err != nil {
+		return time.Time{}, unsupported("%v", err)
+	}
+	return t, nil
+}
+
+func castValue(v any, t ddl.Type) (any, error) {
+	if t.ArrayDims > 0 {
+		return v, nil
+	}
+	switch t.Name {
+	case "text", "varchar", "char", "citext":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return asString(v), nil
+	case "date", "timestamp", "timestamptz":
+		if s, ok := v.(string); ok {
+			return parseTime(s)
+		}
+	case "integer", "bigint", "smallint":
+		switch x := v.(type) {
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+			if err != nil {
+				return nil, unsupported("cast of %q to %s", x, t.Name)
+			}
+			return i, nil
+		case float64:
+			return int64(math.Round(x)), nil
+		}
+	case "numeric", "real", "double precision":
+		if s, ok := v.(string); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, unsupported("cast of %q to %s", s, t.Name)
+			}
+			return f, nil
+		}
+	case "interval":
+		if s, ok := v.(string); ok {
+			return parseInterval(s)
+		}
+	}
+	return v, nil
+}
+
+// parseInterval understands the simple "<n> <unit> ..." interval syntax.
+func parseInterval(s string) (values.Interval, error) {
+	var iv values.Interval
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(s), "@"))
+	if len(fields)%2 != 0 {
+		return iv, unsupported("interval literal %q", s)
+	}
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return iv, unsupported("interval literal %q", s)
+		}
+		unit := strings.TrimSuffix(strings.ToLower(fields[i+1]), "s")
+		switch unit {
+		case "year":
+			iv.Months += int32(n * 12)
+		case "mon", "month":
+			iv.Months += int32(n)
+		case "week":
+			iv.Days += int32(n * 7)
+		case "day":
+			iv.Days += int32(n)
+		case "hour":
+			iv.Micros += n * int64(time.Hour/time.Microsecond)
+		case "min", "minute":
+			iv.Micros += n * int64(time.Minute/time.Microsecond)
+		case "sec", "second":
+			iv.Micros += n * int64(time.Second/time.Microsecond)
+		default:
+			return iv, unsupported("interval unit %q", fields[i+1])
+		}
+	}
+	return iv, nil
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// CountDistribution is how the number of children per parent is drawn.
+type CountDistribution int
+
+const (
+	// Uniform draws every count in [Min, Max] with equal probability.
+	Uniform CountDistribution = iota
+	// Poisson draws counts around Mean, clamped to [Min, Max].
+	Poisson
+)
+
+func (d CountDistribution) String() string {
+	switch d {
+	case Uniform:
+		return "uniform"
+	case Poisson:
+		return "poisson"
+	}
+	return fmt.Sprintf("CountDistribution(%d)", int(d))
+}
+
+// FanOut sets how many rows of the child table reference each parent row
+// through one foreign key. The child table's row count follows from it.
+type FanOut struct {
+	FK           *ddl.ForeignKey
+	Min, Max     int64
+	Distribution CountDistribution
+	Mean         float64
+}
+
+func (f FanOut) draw(r *rand.Rand) int64 {
+	var n int64
+	switch f.Distribution {
+	case Poisson:
+		n = poisson(r, f.Mean)
+	default:
+		n = f.Min + r.Int64N(f.Max-f.Min+1)
+	}
+	return min(max(n, f.Min), f.Max)
+}
+
+// poisson uses Knuth's method for small means and a normal approximation
+// above that.
+func poisson(r *rand.Rand, mean float64) int64 {
+	if mean > 30 {
+		return int64(math.Round(mean + r.NormFloat64()*math.Sqrt(mean)))
+	}
+	limit := math.Exp(-mean)
+	var n int64
+	for p := r.Float64(); p > limit; p *= r.Float64() {
+		n++
+	}
+	return n
+}
+
+// checkOptions validates row counts and fan-out rules against the plan
+// and indexes the rules by child table.
+func (g *generator) checkOptions() error {
+	if g.opts.Rows <= 0 {
+		return fmt.Errorf("row count must be greater than 0, got %d", g.opts.Rows)
+	}
+	if g.opts.MemoryLimit < 0 {
+		return fmt.Errorf("memory limit must not be negative, got %d", g.opts.MemoryLimit)
+	}
+	if g.opts.Workers < 0 {
+		return fmt.Errorf("worker count must not be negative, got %d", g.opts.Workers)
+	}
+	for t, n := range g.opts.TableRows {
+		if n <= 0 {
+			return fmt.Errorf("row count for %q must be greater than 0, got %d", t.QualifiedName(), n)
+		}
+	}
+
+	g.fanOut = make(map[*ddl.Table]*fanOutRule)
+	for i := range g.opts.FanOut {
+		f := &g.opts.FanOut[i]
+		e := g.plan.Edge(f.FK)
+		if e == nil {
+			return fmt.Errorf("fan-out names a foreign key that is not part of the schema")
+		}
+		child := e.Child.QualifiedName()
+		switch {
+		case f.Min < 0 || f.Max < f.Min:
+			return fmt.Errorf("fan-out %s: invalid range %d..%d", e, f.Min, f.Max)
+		case f.Distribution == Poisson && f.Mean <= 0:
+			return fmt.Errorf("fan-out %s: poisson needs a mean greater than 0", e)
+		case e.Resolution != graph.Ordered:
+			return fmt.Errorf("fan-out %s: the foreign key is part of a cycle (%s), so %q is not generated before %q",
+				e, e.Resolution, e.Parent.QualifiedName(), child)
+		case uniqueOnChild(e) && f.Max > 1:
+			return fmt.Errorf("fan-out %s: the foreign key is unique on %q, so at most 1 child per parent is possible", e, child)
+		case g.fanOut[e.Child] != nil:
+			return fmt.Errorf("table %q has more than one fan-out rule", child)
+		}
+		if _, ok := g.opts.TableRows[e.Child]; ok {
+			return fmt.Errorf("row count for %q is set both directly and by fan-out", child)
+		}
+		g.fanOut[e.Child] = &fanOutRule{FanOut: f, edge: e}
+	}
+	return nil
+}
+
+type fanOutRule struct {
+	*FanOut
+	edge *graph.Edge
+}
+
+// rowCount returns how many rows table t gets; fan-out children need the
+// count of their parent table.
+func (g *generator) rowCount(t *ddl.Table) int64 {
+	if rule := g.fanOut[t]; rule != nil {
+		return g.fanOutTotal(rule)
+	}
+	if n, ok := g.opts.TableRows[t]; ok {
+		return n
+	}
+	return g.opts.Rows
+}
+
+// fanOutWindow is how many child rows of a fan-out are shuffled together.
+const fanOutWindow = 1 << 16
+
+// parentStream assigns the rows of a fan-out's child table to parent rows
+// without holding the whole assignment. Parents are visited in a random
+// order and the children of a window of them are shuffled together, so
+// that siblings are not adjacent.
+type parentStream struct {
+	rule *fanOutRule
+	// counts draws the child count of every parent, the same draws
+	// fanOutTotal makes; r shuffles the windows
+	counts  *rand.Rand
+	r       *rand.Rand
+	order   *permutation
+	parents int64
+	visited int64
+	window  []int64
+	buf     []int64
+}
+
+func (g *generator) newParentStream(rule *fanOutRule, r *rand.Rand) *parentStream {
+	parents := g.counts[rule.edge.Parent]
+	return &parentStream{
+		rule:    rule,
+		counts:  g.fanOutRand(rule.edge),
+		r:       r,
+		order:   newPermutation(uint64(parents), r),
+		parents: parents,
+	}
+}
+
+// fanOutTotal returns the number of child rows of a fan-out, drawing every
+// parent's count from a fresh source.
+func (g *generator) fanOutTotal(rule *fanOutRule) int64 {
+	counts := g.fanOutRand(rule.edge)
+	var total int64
+	for j := g.counts[rule.edge.Parent]; j > 0; j-- {
+		total += rule.draw(counts)
+	}
+	return total
+}
+
+// next returns the parent row of the next child row.
+func (s *parentStream) next() int64 {
+	if len(s.window) == 0 {
+		s.fill()
+	}
+	j := s.window[0]
+	s.window = s.window[1:]
+	return j
+}
+
+// skip passes over the parents of the first n child rows.
+func (s *parentStream) skip(n int64) {
+	for n > 0 {
+		if len(s.window) == 0 {
+			s.fill()
+		}
+		k := min(n, int64(len(s.window)))
+		s.window = s.window[k:]
+		n -= k
+	}
+}
+
+func (s *parentStream) fill() {
+	buf := s.buf[:0]
+	for len(buf) < fanOutWindow && s.visited < s.parents {
+		j := int64(s.order.at(uint64(s.visited)))
+		s.visited++
+		for n := s.rule.draw(s.counts); n > 0; n-- {
+			buf = append(buf, j)
+		}
+	}
+	s.r.Shuffle(len(buf), func(a, b int) {
+		buf[a], buf[b] = buf[b], buf[a]
+	})
+	s.buf, s.window = buf, buf
+}
+
+// skewedParent draws one of n parent rows from a distribution over their
+// positions. Positions are spread over the rows by a fixed permutation, so
+// that the hot parents of a skewed distribution are not simply the first
+// rows loaded.
+func skewedParent(d *values.Distribution, r *rand.Rand, n int) int {
+	k := int(d.Sample(r, 0, math.Nextafter(float64(n), 0), 0))
+	k = min(max(k, 0), n-1)
+
+	// any step coprime to n visits every row once
+	step := 2654435761 % n
+	for gcd(step, n) != 1 {
+		step++
+	}
+	return int((uint64(k)*uint64(step) + uint64(n/3)) % uint64(n))
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
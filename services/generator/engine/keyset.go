@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+)
+
+// minKeySlots is the smallest hash table of a keySet, taken even when the
+// budget is spent.
+const minKeySlots = 1024
+
+// runPage is the number of fingerprints per page of a sorted run; the
+// first fingerprint of every page is kept in memory.
+const runPage = 512
+
+// keySet holds the 64-bit fingerprints of the values a unique key took.
+// Fingerprints live in an open-addressing hash table until the budget
+// refuses to grow it; the table is then written out as a sorted run and
+// emptied. Runs of similar size are merged, so a lookup reads at most a
+// page of a logarithmic number of them. Two values sharing a fingerprint
+// only cost a needless redraw.
+type keySet struct {
+	budget *budget
+	// slots holds fingerprints, 0 marks an empty slot
+	slots []uint64
+	n     int
+	runs  []*keyRun
+}
+
+// keyRun is a sorted file of fingerprints.
+type keyRun struct {
+	file  *os.File
+	n     int64
+	index []uint64
+}
+
+func newKeySet(b *budget) *keySet {
+	return &keySet{budget: b}
+}
+
+// fingerprint mixes a 64-bit hash once more, since FNV leaves similar
+// values close, and keeps 0 free for empty slots.
+func fingerprint(h uint64) uint64 {
+	h = mix64(h)
+	if h == 0 {
+		return 1
+	}
+	return h
+}
+
+// mix64 is the finalizer of SplitMix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (s *keySet) has(fp uint64) (bool, error) {
+	if len(s.slots) > 0 {
+		mask := uint64(len(s.slots) - 1)
+		for i := fp & mask; s.slots[i] != 0; i = (i + 1) & mask {
+			if s.slots[i] == fp {
+				return true, nil
+			}
+		}
+	}
+	for _, run := range s.runs {
+		found, err := run.has(fp)
+		if found || err != nil {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// add records a fingerprint that has is false for.
+func (s *keySet) add(fp uint64) error {
+	if 2*(s.n+1) > len(s.slots) {
+		size := max(2*len(s.slots), minKeySlots)
+		switch {
+		case s.budget.reserve(8 * int64(size-len(s.slots))):
+			s.rehash(size)
+		case len(s.slots) == 0:
+			s.budget.force(8 * minKeySlots)
+			s.rehash(minKeySlots)
+		default:
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	mask := uint64(len(s.slots) - 1)
+	i := fp & mask
+	for s.slots[i] != 0 {
+		i = (i + 1) & mask
+	}
+	s.slots[i] = fp
+	s.n++
+	return nil
+}
+
+func (s *keySet) rehash(size int) {
+	old := s.slots
+	s.slots = make([]uint64, size)
+	mask := uint64(size - 1)
+	for _, fp := range old {
+		if fp == 0 {
+			continue
+		}
+		i := fp & mask
+		for s.slots[i] != 0 {
+			i = (i + 1) & mask
+		}
+		s.slots[i] = fp
+	}
+}
+
+// flush writes the hash table out as a sorted run, empties it and merges
+// runs that have grown to a similar size.
+func (s *keySet) flush() error {
+	// sorted in place, so flushing takes no memory of its own
+	fps := s.slots[:0]
+	for _, fp := range s.slots {
+		if fp != 0 {
+			fps = append(fps, fp)
+		}
+	}
+	slices.Sort(fps)
+
+	run, err := s.writeRun(func(emit func(uint64) error) error {
+		for _, fp := range fps {
+			if err := emit(fp); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	clear(s.slots)
+	s.n = 0
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+
+	for len(s.runs) > 1 {
+		a, b := s.runs[len(s.runs)-2], s.runs[len(s.runs)-1]
+		if a.n > 2*b.n {
+			break
+		}
+		merged, err := s.writeRun(func(emit func(uint64) error) error { return mergeRuns(a, b, emit) })
+		if err != nil {
+			return err
+		}
+		s.budget.drop(a.file)
+		s.budget.drop(b.file)
+		s.runs = append(s.runs[:len(s.runs)-2], merged)
+	}
+	return nil
+}
+
+// close lets go of the set's memory and runs.
+func (s *keySet) close() {
+	s.budget.release(8 * int64(len(s.slots)))
+	for _, run := range s.runs {
+		s.budget.drop(run.file)
+	}
+	s.slots, s.n, s.runs = nil, 0, nil
+}
+
+// writeRun writes the sorted fingerprints fill emits to a new run.
+func (s *keySet) writeRun(fill func(emit func(uint64) error) error) (*keyRun, error) {
+	f, err := s.budget.spillFile()
+	if err != nil {
+		return nil, err
+	}
+	run := &keyRun{file: f}
+	w := bufio.NewWriter(f)
+	var buf [8]byte
+	err = fill(func(fp uint64) error {
+		if run.n%runPage == 0 {
+			run.index = append(run.index, fp)
+		}
+		run.n++
+		binary.LittleEndian.PutUint64(buf[:], fp)
+		_, err := w.Write(buf[:])
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to spill unique keys: %w", err)
+	}
+	s.budget.wrote(8 * run.n)
+	return run, nil
+}
+
+// mergeRuns emits the fingerprints of two runs in order.
+func mergeRuns(a, b *keyRun, emit func(uint64) error) error {
+	ra, rb := a.reader(), b.reader()
+	va, oka, err := ra()
+	if err != nil {
+		return err
+	}
+	vb, okb, err := rb()
+	if err != nil {
+		return err
+	}
+	for oka || okb {
+		if !okb || oka && va <= vb {
+			if err := emit(va); err != nil {
+				return err
+			}
+			if okb && va == vb {
+				if vb, okb, err = rb(); err != nil {
+					return err
+				}
+			}
+			if va, oka, err = ra(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := emit(vb); err != nil {
+			return err
+		}
+		if vb, okb, err = rb(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reader returns a function that reads the fingerprints of a run in order.
+func (r *keyRun) reader() func() (uint64, bool, error) {
+	br := bufio.NewReader(io.NewSectionReader(r.file, 0, 8*r.n))
+	var buf [8]byte
+	return func() (uint64, bool, error) {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			if err == io.EOF {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+		return binary.LittleEndian.Uint64(buf[:]), true, nil
+	}
+}
+
+// has looks for a fingerprint in the one page of the run that can hold it.
+func (r *keyRun) has(fp uint64) (bool, error) {
+	p := sort.Search(len(r.index), func(i int) bool { return r.index[i] > fp }) - 1
+	if p < 0 {
+		return false, nil
+	}
+	n := min(int64(runPage), r.n-int64(p)*runPage)
+	page := make([]byte, 8*n)
+	if _, err := r.file.ReadAt(page, 8*int64(p)*runPage); err != nil {
+		return false, fmt.Errorf("failed to read spilled unique keys: %w", err)
+	}
+	i := sort.Search(int(n), func(i int) bool { return binary.LittleEndian.Uint64(page[8*i:]) >= fp })
+	return i < int(n) && binary.LittleEndian.Uint64(page[8*i:]) == fp, nil
+}
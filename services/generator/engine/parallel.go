@@ -0,0 +1,439 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+)
+
+// rangeRows is the number of rows of a range. Every range has a random
+// source of its own, so the size is part of what a seed produces and does
+// not follow the number of workers.
+const rangeRows = 1024
+
+// errAborted stops tables still being generated once another one failed.
+var errAborted = errors.New("generation aborted")
+
+// tableRun is the generation of one table. Its runner hands the ranges of
+// the table to the workers and commits them in order.
+type tableRun struct {
+	def *ddl.Table
+	// deps counts the referenced tables still to be generated
+	deps    int
+	started bool
+	st      *tableState
+	// spool holds the rows of a held table, out passes the rows of the
+	// others on to the sink
+	spool *spooledTable
+	out   *tableOutput
+	// part receives the rows of a shard instead
+	part *shardParts
+	// done counts the committed rows
+	done int64
+	err  error
+}
+
+// tableOutput is a table handed to the sink in load order. Rows committed
+// before every table ahead of it is written wait in early.
+type tableOutput struct {
+	td    *Table
+	w     *tableWriter
+	early *rowStore
+	done  bool
+}
+
+// rowRange is a range of rows of one table. A worker generates the rows
+// and settles their CHECK constraints; the runner of the table then
+// commits them in order: it picks references to earlier rows, settles
+// unique keys and records what later rows and tables need.
+type rowRange struct {
+	st    *tableState
+	first int64
+	r     *rand.Rand
+	rows  [][]any
+	// parents are the fan-out parents of the rows
+	parents []int64
+	// waiting marks, for every row and edge, the keys left for after every
+	// table is generated
+	waiting    []bool
+	committing bool
+	// checkErrs and columnErrs keep the first error of the CHECK
+	// constraints and generated columns the range could not evaluate
+	checkErrs  []error
+	columnErrs []error
+	err        error
+	done       chan struct{}
+}
+
+// run generates every table. Workers generate ranges of rows; a table
+// starts as soon as the tables it references are generated, with at most
+// as many tables under way as there are workers, and at most two ranges
+// per worker generated and not yet committed.
+func (g *generator) run() error {
+	defer g.startWorkers()()
+
+	children := make(map[*ddl.Table][]*tableRun)
+	for _, t := range g.plan.Order {
+		for _, p := range referenced(g.plan.EdgesFrom(t)) {
+			g.runs[t].deps++
+			children[p] = append(children[p], g.runs[t])
+		}
+	}
+
+	finished := make(chan *tableRun)
+	running := 0
+	for {
+		for _, t := range g.plan.Order {
+			run := g.runs[t]
+			if running == g.workers || g.failed.Load() {
+				break
+			}
+			if run.started || run.deps > 0 {
+				continue
+			}
+			run.started = true
+			running++
+			go func() {
+				run.err = g.generateTable(run)
+				finished <- run
+			}()
+		}
+		if running == 0 {
+			break
+		}
+		run := <-finished
+		running--
+		if run.err != nil {
+			g.failed.Store(true)
+			continue
+		}
+		for _, c := range children[run.def] {
+			c.deps--
+		}
+	}
+
+	for _, t := range g.plan.Order {
+		if err := g.runs[t].err; err != nil && !errors.Is(err, errAborted) {
+			return fmt.Errorf("table %q: %w", t.QualifiedName(), err)
+		}
+	}
+	for _, t := range g.plan.Order {
+		g.warnings = append(g.warnings, g.runs[t].st.warnings...)
+	}
+	return nil
+}
+
+// startWorkers starts the workers and returns the func that stops them.
+func (g *generator) startWorkers() func() {
+	g.jobs = make(chan *rowRange, 2*g.workers)
+	g.slots = make(chan struct{}, 2*g.workers)
+	var workers sync.WaitGroup
+	for range g.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for rr := range g.jobs {
+				if g.failed.Load() {
+					rr.err = errAborted
+				} else {
+					rr.err = g.generateRange(rr)
+				}
+				close(rr.done)
+			}
+		}()
+	}
+	return func() {
+		close(g.jobs)
+		workers.Wait()
+	}
+}
+
+// referenced returns the other tables that rows must find generated.
+func referenced(edges []*graph.Edge) []*ddl.Table {
+	var parents []*ddl.Table
+	for _, e := range edges {
+		if e.Resolution == graph.Ordered && e.Parent != e.Child && !slices.Contains(parents, e.Parent) {
+			parents = append(parents, e.Parent)
+		}
+	}
+	return parents
+}
+
+// generateTable prepares a table, then keeps the workers supplied with its
+// ranges while it commits the ones they finish, in order. Of a shard, only
+// the ranges of its rows are generated.
+func (g *generator) generateTable(run *tableRun) error {
+	st, err := g.prepareTable(run.def)
+	run.st = st
+	defer func() {
+		for _, k := range st.keys {
+			k.seen.close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	if p := run.part; p != nil && (p.first > 0 || p.last < st.rows) && !st.splittable() {
+		return errors.New("its rows cannot be generated in shards")
+	}
+
+	td := &Table{Def: run.def, Count: st.rows, Generators: st.names, Defaulted: st.filled}
+	if run.spool != nil {
+		run.spool.td = td
+	} else if run.out != nil {
+		g.outMu.Lock()
+		run.out.td = td
+		g.outMu.Unlock()
+	}
+
+	first, n := int64(0), (st.rows+rangeRows-1)/rangeRows
+	if run.part != nil {
+		first, n = run.part.first/rangeRows, (run.part.last+rangeRows-1)/rangeRows
+		if st.parents != nil {
+			st.parents.skip(run.part.first)
+		}
+	}
+	var pending []*rowRange
+	defer func() {
+		for range pending {
+			<-g.slots
+		}
+	}()
+	for next, committed := first, first; committed < n; {
+		if g.failed.Load() {
+			return errAborted
+		}
+		if err := g.cancelled(next * rangeRows); err != nil {
+			return err
+		}
+		// a nil channel leaves its case out of the select
+		var slots chan struct{}
+		if next < n {
+			slots = g.slots
+		}
+		var head chan struct{}
+		if len(pending) > 0 {
+			head = pending[0].done
+		}
+		select {
+		case slots <- struct{}{}:
+			rr := g.newRange(st, next)
+			next++
+			pending = append(pending, rr)
+			g.jobs <- rr
+		case <-head:
+			rr := pending[0]
+			pending = pending[1:]
+			<-g.slots
+			if err := g.commit(run, rr); err != nil {
+				return err
+			}
+			committed++
+		}
+	}
+
+	if run.out == nil {
+		return nil
+	}
+	g.outMu.Lock()
+	defer g.outMu.Unlock()
+	run.out.done = true
+	return g.advance()
+}
+
+// newRange sets up range k of a table. Fan-out parents are assigned here,
+// since the runner creates ranges in order.
+func (g *generator) newRange(st *tableState, k int64) *rowRange {
+	first := k * rangeRows
+	n := min(rangeRows, st.rows-first)
+	rr := &rowRange{
+		st:         st,
+		first:      first,
+		r:          g.rangeRand(st.def, k),
+		rows:       make([][]any, n),
+		checkErrs:  make([]error, len(st.checks)),
+		columnErrs: make([]error, len(st.def.Columns)),
+		done:       make(chan struct{}),
+	}
+	if st.parents != nil {
+		rr.parents = make([]int64, n)
+		for i := range rr.parents {
+			rr.parents[i] = st.parents.next()
+		}
+	}
+	if st.waits {
+		rr.waiting = make([]bool, n*int64(len(st.edges)))
+	}
+	return rr
+}
+
+// generateRange draws the rows of a range, on a worker.
+func (g *generator) generateRange(rr *rowRange) error {
+	st := rr.st
+	for k := range rr.rows {
+		i := rr.first + int64(k)
+		row := make([]any, len(st.def.Columns))
+		for c, gen := range st.gens {
+			if gen != nil {
+				row[c] = st.draw(rr.r, c, i, false)
+			}
+		}
+		applyDeps(st, rr.r, row, i)
+		for ei, e := range st.edges {
+			wait, err := g.pickParent(st, rr, row, i, e, false)
+			if err != nil {
+				return err
+			}
+			if wait {
+				rr.waiting[k*len(st.edges)+ei] = true
+			}
+		}
+		g.compute(st, rr, row)
+		if err := g.settleRow(st, rr, row, i, nil); err != nil {
+			return err
+		}
+		rr.rows[k] = row
+	}
+	return nil
+}
+
+// commit settles a generated range against the rows before it and passes
+// its rows on.
+func (g *generator) commit(run *tableRun, rr *rowRange) error {
+	if rr.err != nil {
+		return rr.err
+	}
+	st := run.st
+	rr.committing = true
+	for k, row := range rr.rows {
+		i := rr.first + int64(k)
+		if st.earlier {
+			for _, e := range st.edges {
+				if e.Resolution != graph.EarlierRow {
+					continue
+				}
+				if _, err := g.pickParent(st, rr, row, i, e, false); err != nil {
+					return err
+				}
+			}
+			g.compute(st, rr, row)
+		}
+		if err := g.settleRow(st, rr, row, i, st.keys); err != nil {
+			return err
+		}
+		var waiting []bool
+		if rr.waiting != nil {
+			waiting = rr.waiting[k*len(st.edges) : (k+1)*len(st.edges)]
+		}
+		if err := g.record(st, row, i, waiting); err != nil {
+			return err
+		}
+
+		if run.spool != nil || run.part != nil {
+			rec := row
+			if run.spool != nil {
+				rec = append(make([]any, 0, len(row)+len(run.spool.edges)), row...)
+				for ei, e := range st.edges {
+					if e.Resolution == graph.Deferred {
+						rec = append(rec, waiting[ei])
+					}
+				}
+			}
+			if err := run.store(rec); err != nil {
+				return err
+			}
+		}
+	}
+	st.noteFlaws(rr)
+	if run.out != nil {
+		if err := g.emit(run.out, rr.rows); err != nil {
+			return err
+		}
+	}
+	run.done += int64(len(rr.rows))
+	if g.opts.Progress != nil {
+		total := st.rows
+		if run.part != nil {
+			total = run.part.last - run.part.first
+		}
+		g.opts.Progress(st.def, run.done, total)
+	}
+	return nil
+}
+
+// store keeps a committed row: in the part of a shard, or in the spool of a
+// held table.
+func (run *tableRun) store(rec []any) error {
+	if run.part != nil {
+		return run.part.rows.add(rec)
+	}
+	return run.spool.rows.add(rec)
+}
+
+// emit passes committed rows of a table to the sink once every table ahead
+// of it is written, and keeps them in its early store until then.
+func (g *generator) emit(o *tableOutput, rows [][]any) error {
+	g.outMu.Lock()
+	defer g.outMu.Unlock()
+	if o.w == nil {
+		if err := g.advance(); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		var err error
+		switch {
+		case o.w != nil:
+			err = o.w.add(row)
+		case o.early == nil:
+			o.early = newRowStore(g.budget, len(row))
+			fallthrough
+		default:
+			err = o.early.add(row)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance writes out the tables at the head of the load order as far as
+// they are generated, and starts the next one. It is called with outMu
+// held.
+func (g *generator) advance() error {
+	for g.head < len(g.outputs) {
+		o := g.outputs[g.head]
+		if o.td == nil {
+			return nil
+		}
+		if o.w == nil {
+			w, err := g.beginTable(o.td)
+			if err != nil {
+				return err
+			}
+			if o.early != nil {
+				err = o.early.each(func(_ int64, row []any) error { return w.add(row) })
+				o.early.close()
+				o.early = nil
+				if err != nil {
+					return err
+				}
+			}
+			o.w = w
+		}
+		if !o.done {
+			return nil
+		}
+		if err := g.endTable(o.w); err != nil {
+			return err
+		}
+		g.head++
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+)
+
+// ShardRows is the granularity of shards: every shard of a split table but
+// the last has a multiple of it rows. Shards cut on ranges of rows, so the
+// rows they generate are the rows Stream generates.
+const ShardRows = rangeRows
+
+// TableLayout describes how the rows of a table are generated in shards.
+type TableLayout struct {
+	Table *ddl.Table
+	Rows  int64
+	// Split is set when ranges of the table's rows can be generated apart:
+	// no row depends on another and its unique keys hold across ranges by
+	// construction. Other tables are generated in a single shard.
+	Split bool
+	// After are the tables whose shards must all be generated before any
+	// of the table's shards.
+	After []*ddl.Table
+}
+
+// Shard is a range of rows of one table.
+type Shard struct {
+	Table *ddl.Table
+	First int64
+	Rows  int64
+}
+
+// Layout returns how the tables of a job are generated in shards, in load
+// order.
+func Layout(schema *ddl.Schema, plan *graph.Plan, opts Options) ([]TableLayout, error) {
+	g, err := newGenerator(schema, plan, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer g.budget.cleanup()
+
+	var layout []TableLayout
+	for _, t := range plan.Order {
+		st, err := g.prepareTable(t)
+		for _, k := range st.keys {
+			k.seen.close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("table %q: %w", t.QualifiedName(), err)
+		}
+		layout = append(layout, TableLayout{Table: t, Rows: st.rows, Split: st.splittable(), After: referenced(st.edges)})
+	}
+	return layout, nil
+}
+
+// GenerateShard generates the rows of a shard into part files in dir, which
+// must hold the parts of every table in the shard's TableLayout.After.
+// Parts are written under temporary names and renamed once complete, so a
+// shard generated twice leaves the same parts behind.
+func GenerateShard(schema *ddl.Schema, plan *graph.Plan, opts Options, shard Shard, dir string) error {
+	g, err := newGenerator(schema, plan, opts, nil)
+	if err != nil {
+		return err
+	}
+	defer g.budget.cleanup()
+
+	t := shard.Table
+	run := g.runs[t]
+	if run == nil {
+		return fmt.Errorf("table %q is not part of the plan", t.QualifiedName())
+	}
+	last := shard.First + shard.Rows
+	if shard.First < 0 || shard.Rows < 0 || last > g.counts[t] {
+		return fmt.Errorf("table %q has no rows %d to %d", t.QualifiedName(), shard.First, last)
+	}
+	if shard.First%ShardRows != 0 || (last < g.counts[t] && last%ShardRows != 0) {
+		return fmt.Errorf("shard of table %q does not start and end on multiples of %d rows", t.QualifiedName(), ShardRows)
+	}
+	for _, p := range referenced(plan.EdgesFrom(t)) {
+		if err := g.loadRefs(p, dir); err != nil {
+			return err
+		}
+	}
+
+	ti := slices.Index(plan.Order, t)
+	var parts []*partWriter
+	defer func() {
+		for _, p := range parts {
+			p.discard()
+		}
+	}()
+	create := func(kind string) (*partWriter, error) {
+		p, err := createPart(dir, partName(ti, kind, shard.First))
+		if err == nil {
+			parts = append(parts, p)
+		}
+		return p, err
+	}
+
+	rows, err := create("rows")
+	if err != nil {
+		return err
+	}
+	run.out = nil
+	run.part = &shardParts{first: shard.First, last: last, rows: rows}
+	stop := g.startWorkers()
+	err = g.generateTable(run)
+	stop()
+	if err != nil {
+		return fmt.Errorf("table %q: %w", t.QualifiedName(), err)
+	}
+
+	dump := func(kind string, s *rowStore) error {
+		p, err := create(kind)
+		if err != nil {
+			return err
+		}
+		return s.each(func(_ int64, rec []any) error { return p.add(rec) })
+	}
+	if refs := g.refs[t]; refs != nil {
+		if err := dump("refs", refs); err != nil {
+			return err
+		}
+	}
+	for ei, e := range run.st.edges {
+		if s := g.updates[e]; s != nil {
+			if err := dump(updatesKind(ei), s); err != nil {
+				return err
+			}
+		}
+	}
+	notes, err := create("notes")
+	if err != nil {
+		return err
+	}
+	for _, w := range run.st.warnings {
+		if err := notes.add([]any{w}); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range parts {
+		if err := p.finish(); err != nil {
+			return err
+		}
+	}
+	// the rows go last: a table is complete once its rows are
+	for _, p := range slices.Backward(parts) {
+		if err := p.rename(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShardGenerated reports whether the parts of a shard are complete in dir.
+func ShardGenerated(plan *graph.Plan, shard Shard, dir string) bool {
+	ti := slices.Index(plan.Order, shard.Table)
+	if ti < 0 {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, partName(ti, "rows", shard.First)))
+	return err == nil
+}
+
+// Assemble hands the rows of every shard of a job in dir to the sink. The
+// output is the one Stream writes for the job.
+func Assemble(schema *ddl.Schema, plan *graph.Plan, opts Options, dir string, sink Sink) (*Result, error) {
+	g, err := newGenerator(schema, plan, opts, sink)
+	if err != nil {
+		return nil, err
+	}
+	defer g.budget.cleanup()
+
+	for t := range g.refs {
+		if err := g.loadRefs(t, dir); err != nil {
+			return nil, err
+		}
+	}
+	for ti, t := range plan.Order {
+		st, err := g.prepareTable(t)
+		for _, k := range st.keys {
+			k.seen.close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("table %q: %w", t.QualifiedName(), err)
+		}
+		g.warnings = append(g.warnings, st.warnings...)
+		_, err = readParts(dir, partPrefix(ti, "notes"), 1, false, func(_ int64, rec []any) error {
+			if w, ok := rec[0].(string); ok && !slices.Contains(g.warnings, w) {
+				g.warnings = append(g.warnings, w)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for ei, e := range st.edges {
+			s := g.updates[e]
+			if s == nil {
+				continue
+			}
+			if _, err := readParts(dir, partPrefix(ti, updatesKind(ei)), s.width, false, func(_ int64, rec []any) error {
+				return s.add(rec)
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		td := &Table{Def: t, Count: st.rows, Generators: st.names, Defaulted: st.filled}
+		if run := g.runs[t]; run.spool != nil {
+			run.spool.td = td
+		} else {
+			run.out.td = td
+		}
+	}
+
+	g.res = &Result{DeferConstraints: plan.DeferConstraints()}
+	if err := sink.Start(g.res); err != nil {
+		return nil, err
+	}
+	for _, t := range plan.Order {
+		run := g.runs[t]
+		if run.out == nil {
+			continue
+		}
+		w, err := g.beginTable(run.out.td)
+		if err != nil {
+			return nil, err
+		}
+		err = g.readRows(t, dir, len(t.Columns), func(i int64, row []any) error {
+			if err := g.cancelled(i); err != nil {
+				return err
+			}
+			return w.add(row)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := g.endTable(w); err != nil {
+			return nil, err
+		}
+	}
+	for _, sp := range g.spooled {
+		t := sp.td.Def
+		err := g.emitSpooled(sp, func(fn func(i int64, rec []any) error) error {
+			return g.readRows(t, dir, len(t.Columns)+len(sp.edges), fn)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("table %q: %w", t.QualifiedName(), err)
+		}
+	}
+	if err := g.resolveUpdates(); err != nil {
+		return nil, err
+	}
+
+	g.res.Warnings = g.warnings
+	g.res.Spilled = g.budget.spilled
+	if err := sink.Finish(g.res); err != nil {
+		return nil, err
+	}
+	return g.res, nil
+}
+
+// splittable reports whether ranges of the table's rows can be generated
+// apart from each other.
+func (st *tableState) splittable() bool {
+	if st.earlier || st.waits {
+		return false
+	}
+	for _, k := range st.keys {
+		if !k.alwaysUnique(st) && !st.drawnApart(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// drawnApart reports whether the values of a unique key follow from the
+// row position alone: a column drawn without replacement, or a foreign key
+// picking parents without replacement, with no CHECK constraint that could
+// make a row draw it again.
+func (st *tableState) drawnApart(k *uniqueKey) bool {
+	for _, ck := range st.checks {
+		for _, c := range ck.cols {
+			if slices.Contains(k.cols, c) {
+				return false
+			}
+		}
+	}
+	if len(k.cols) == 1 {
+		if w, ok := st.gens[k.cols[0]].(*withoutReplacement); ok {
+			return uint64(st.rows) <= w.perm.n
+		}
+	}
+	e := edgeFor(st.edges, st.def.Columns[k.cols[0]].Name)
+	if e == nil || !sameColumns(e.FK.Columns, k.def.Columns) {
+		return false
+	}
+	perm := st.pickers[e]
+	return perm != nil && uint64(st.rows) <= perm.n
+}
+
+// loadRefs reads the referenced columns of every row of table t from its
+// parts.
+func (g *generator) loadRefs(t *ddl.Table, dir string) error {
+	refs := g.refs[t]
+	ti := slices.Index(g.plan.Order, t)
+	n, err := readParts(dir, partPrefix(ti, "refs"), refs.width, true, func(_ int64, rec []any) error {
+		return refs.add(rec)
+	})
+	if err != nil {
+		return err
+	}
+	if n != g.counts[t] {
+		return fmt.Errorf("table %q has %d of its %d rows generated", t.QualifiedName(), n, g.counts[t])
+	}
+	return nil
+}
+
+// readRows reads the rows of table t from the parts in dir.
+func (g *generator) readRows(t *ddl.Table, dir string, width int, fn func(i int64, rec []any) error) error {
+	ti := slices.Index(g.plan.Order, t)
+	n, err := readParts(dir, partPrefix(ti, "rows"), width, true, fn)
+	if err != nil {
+		return err
+	}
+	if n != g.counts[t] {
+		return fmt.Errorf("table %q has %d of its %d rows generated", t.QualifiedName(), n, g.counts[t])
+	}
+	return nil
+}
+
+// shardParts receives the rows of a shard, from first up to last.
+type shardParts struct {
+	first, last int64
+	rows        *partWriter
+}
+
+// partPrefix names the parts of one kind of a table, by its position in
+// the load order.
+func partPrefix(ti int, kind string) string {
+	return fmt.Sprintf("%04d-%s", ti, kind)
+}
+
+// partName names the part of a shard starting at row first.
+func partName(ti int, kind string, first int64) string {
+	return fmt.Sprintf("%s-%012d.part", partPrefix(ti, kind), first)
+}
+
+// updatesKind names the parts of the rows waiting for follow-up updates of
+// the table's foreign key ei.
+func updatesKind(ei int) string {
+	return fmt.Sprintf("updates%d", ei)
+}
+
+// partWriter writes a part file. Every record is its length followed by
+// its values, encoded as spilled rows are.
+type partWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	path string
+	buf  []byte
+}
+
+func createPart(dir, name string) (*partWriter, error) {
+	f, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shard part: %w", err)
+	}
+	return &partWriter{f: f, w: bufio.NewWriter(f), path: filepath.Join(dir, name)}, nil
+}
+
+func (p *partWriter) add(rec []any) error {
+	buf := p.buf[:0]
+	for _, v := range rec {
+		buf = appendValue(buf, v)
+	}
+	p.buf = buf
+	var n [binary.MaxVarintLen64]byte
+	if _, err := p.w.Write(n[:binary.PutUvarint(n[:], uint64(len(buf)))]); err != nil {
+		return fmt.Errorf("failed to write shard part: %w", err)
+	}
+	if _, err := p.w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write shard part: %w", err)
+	}
+	return nil
+}
+
+// finish flushes the part to its temporary file.
+func (p *partWriter) finish() error {
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write shard part: %w", err)
+	}
+	if err := p.f.Close(); err != nil {
+		return fmt.Errorf("failed to write shard part: %w", err)
+	}
+	return nil
+}
+
+// rename gives a finished part its name.
+func (p *partWriter) rename() error {
+	if err := os.Rename(p.f.Name(), p.path); err != nil {
+		return fmt.Errorf("failed to write shard part: %w", err)
+	}
+	return nil
+}
+
+// discard removes the temporary file of a part not renamed.
+func (p *partWriter) discard() {
+	p.f.Close()
+	os.Remove(p.f.Name())
+}
+
+// readParts calls fn with every record of the parts named by prefix, in
+// order of the rows they start at, and returns the number of records. With
+// dense set every part must start where the ones before it end, as parts
+// of rows do.
+func readParts(dir, prefix string, width int, dense bool, fn func(i int64, rec []any) error) (int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, prefix+"-*.part"))
+	if err != nil {
+		return 0, err
+	}
+	slices.Sort(names)
+	var i int64
+	for _, name := range names {
+		var first int64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(filepath.Base(name), prefix+"-"), "%d.part", &first); err != nil {
+			return 0, fmt.Errorf("unexpected shard part %s", filepath.Base(name))
+		}
+		if dense && first != i {
+			return 0, fmt.Errorf("shard parts %s are missing rows %d to %d", prefix, i, first)
+		}
+		n, err := readPart(name, width, i, fn)
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	return i, nil
+}
+
+func readPart(name string, width int, i int64, fn func(i int64, rec []any) error) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read shard part: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var n int64
+	var buf []byte
+	for {
+		size, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read shard part: %w", err)
+		}
+		buf = slices.Grow(buf[:0], int(size))[:size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, fmt.Errorf("failed to read shard part: %w", err)
+		}
+		rec := make([]any, width)
+		data := buf
+		for c := range rec {
+			if rec[c], data, err = readValue(data); err != nil {
+				return 0, fmt.Errorf("shard part %s: %w", filepath.Base(name), err)
+			}
+		}
+		if err := fn(i+n, rec); err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
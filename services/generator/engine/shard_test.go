@@ -0,0 +1,181 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/output"
+)
+
+const shardSchema = `
+CREATE TABLE users (id bigserial PRIMARY KEY, email text NOT NULL UNIQUE, manager_id bigint REFERENCES users (id), born date);
+CREATE TABLE orders (id uuid PRIMARY KEY, user_id bigint NOT NULL REFERENCES users (id), amount numeric(8,2) CHECK (amount > 10), at timestamptz);
+CREATE TABLE events (id bigserial PRIMARY KEY, name text, at timestamptz);
+`
+
+// shards cuts the tables of a job into shards of at most size rows.
+func shards(t *testing.T, schema *ddl.Schema, plan *graph.Plan, opts engine.Options, size int64) []engine.Shard {
+	t.Helper()
+	layout, err := engine.Layout(schema, plan, opts)
+	if err != nil {
+		t.Fatalf("Layout: %v", err)
+	}
+	var out []engine.Shard
+	for _, tl := range layout {
+		if !tl.Split || tl.Rows <= size {
+			out = append(out, engine.Shard{Table: tl.Table, Rows: tl.Rows})
+			continue
+		}
+		for first := int64(0); first < tl.Rows; first += size {
+			out = append(out, engine.Shard{Table: tl.Table, First: first, Rows: min(size, tl.Rows-first)})
+		}
+	}
+	return out
+}
+
+func TestShards(t *testing.T) {
+	schema, err := ddl.Parse(shardSchema)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	opts := engine.Options{Rows: 10000, Seed: 9, DefaultNullRatio: 0.1}
+	opts.FanOut = []engine.FanOut{{FK: schema.Table("orders").ForeignKeys[0], Min: 0, Max: 4}}
+
+	var whole bytes.Buffer
+	if _, err := engine.Stream(schema, plan, opts, output.NewSQLWriter(&whole, output.SQLOptions{})); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	all := shards(t, schema, plan, opts, 2048)
+	if len(all) < 4 {
+		t.Fatalf("the job has %d shards, too few to split", len(all))
+	}
+	// shards of a table may be generated in any order, once the tables it
+	// waits for are
+	reversed := slices.Clone(all)
+	for i := 0; i < len(reversed); {
+		j := i
+		for j < len(reversed) && reversed[j].Table == reversed[i].Table {
+			j++
+		}
+		slices.Reverse(reversed[i:j])
+		i = j
+	}
+	tests := []struct {
+		name   string
+		shards []engine.Shard
+	}{
+		{"in order", all},
+		{"reversed within tables", reversed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, shard := range tt.shards {
+				if err := engine.GenerateShard(schema, plan, opts, shard, dir); err != nil {
+					t.Fatalf("GenerateShard: %v", err)
+				}
+			}
+			var sharded bytes.Buffer
+			if _, err := engine.Assemble(schema, plan, opts, dir, output.NewSQLWriter(&sharded, output.SQLOptions{})); err != nil {
+				t.Fatalf("Assemble: %v", err)
+			}
+			if !bytes.Equal(whole.Bytes(), sharded.Bytes()) {
+				t.Error("the sharded output differs from the output generated in one piece")
+			}
+		})
+	}
+}
+
+func TestResumeShards(t *testing.T) {
+	schema, err := ddl.Parse(shardSchema)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	plan, err := graph.Build(schema)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	opts := engine.Options{Rows: 10000, Seed: 9, DefaultNullRatio: 0.1}
+	opts.FanOut = []engine.FanOut{{FK: schema.Table("orders").ForeignKeys[0], Min: 0, Max: 4}}
+
+	var whole bytes.Buffer
+	if _, err := engine.Stream(schema, plan, opts, output.NewSQLWriter(&whole, output.SQLOptions{})); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	all := shards(t, schema, plan, opts, 2048)
+	if len(all) < 4 {
+		t.Fatalf("the job has %d shards, too few to interrupt", len(all))
+	}
+	tests := []struct {
+		name string
+		// stop is the shard the first run is interrupted in
+		stop int
+	}{
+		{"uninterrupted", -1},
+		{"first shard", 0},
+		{"midway", len(all) / 2},
+		{"last shard", len(all) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			interrupted := opts
+			interrupted.Context = ctx
+
+			for i, shard := range all {
+				if i == tt.stop {
+					interrupted.Progress = func(*ddl.Table, int64, int64) { cancel() }
+				}
+				err := engine.GenerateShard(schema, plan, interrupted, shard, dir)
+				if i == tt.stop {
+					if !errors.Is(err, context.Canceled) {
+						t.Fatalf("GenerateShard of the interrupted shard: got %v, want it cancelled", err)
+					}
+					if engine.ShardGenerated(plan, shard, dir) {
+						t.Fatal("the interrupted shard looks generated")
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("GenerateShard: %v", err)
+				}
+			}
+
+			skipped := 0
+			for _, shard := range all {
+				if engine.ShardGenerated(plan, shard, dir) {
+					skipped++
+					continue
+				}
+				if err := engine.GenerateShard(schema, plan, opts, shard, dir); err != nil {
+					t.Fatalf("GenerateShard: %v", err)
+				}
+			}
+			if want := tt.stop; want >= 0 && skipped != want {
+				t.Errorf("skipped %d shards, want %d", skipped, want)
+			}
+
+			var resumed bytes.Buffer
+			if _, err := engine.Assemble(schema, plan, opts, dir, output.NewSQLWriter(&resumed, output.SQLOptions{})); err != nil {
+				t.Fatalf("Assemble: %v", err)
+			}
+			if !bytes.Equal(whole.Bytes(), resumed.Bytes()) {
+				t.Error("the resumed output differs from the output generated in one piece")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package engine
+
+// chunkRows is the number of rows handed to a sink at once.
+const chunkRows = 1024
+
+// Sink receives a dataset while it is generated: each table in chunks of
+// rows, in load order, then the updates that close foreign key cycles.
+// The slice of a chunk is reused for the next one, the rows in it are not.
+// Calls never overlap, but they may come from different goroutines.
+type Sink interface {
+	// Start is called before any table. Only DeferConstraints of res is
+	// set at this point.
+	Start(res *Result) error
+	// BeginTable is called before the rows of a table, with its Count set.
+	BeginTable(t *Table) error
+	WriteRows(t *Table, rows [][]any) error
+	EndTable(t *Table) error
+	WriteUpdate(u Update) error
+	// Finish is called once everything else is written, with the tables,
+	// sequences and warnings of res set.
+	Finish(res *Result) error
+}
+
+// collector is the sink of Generate, which keeps the dataset in memory.
+type collector struct {
+	updates []Update
+}
+
+func (c *collector) Start(*Result) error {
+	return nil
+}
+
+func (c *collector) BeginTable(t *Table) error {
+	t.Rows = make([][]any, 0, t.Count)
+	return nil
+}
+
+func (c *collector) WriteRows(t *Table, rows [][]any) error {
+	t.Rows = append(t.Rows, rows...)
+	return nil
+}
+
+func (c *collector) EndTable(*Table) error {
+	return nil
+}
+
+func (c *collector) WriteUpdate(u Update) error {
+	c.updates = append(c.updates, u)
+	return nil
+}
+
+func (c *collector) Finish(res *Result) error {
+	res.Updates = c.updates
+	return nil
+}
+
+// tableWriter hands the rows of one table to the sink in chunks and
+// follows the sequences they take values from.
+type tableWriter struct {
+	sink  Sink
+	td    *Table
+	chunk [][]any
+	seqs  *sequenceTracker
+}
+
+func (g *generator) beginTable(td *Table) (*tableWriter, error) {
+	g.res.Tables = append(g.res.Tables, td)
+	if err := g.sink.BeginTable(td); err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		sink:  g.sink,
+		td:    td,
+		chunk: make([][]any, 0, min(td.Count, chunkRows)),
+		seqs:  newSequenceTracker(td.Def),
+	}, nil
+}
+
+func (w *tableWriter) add(row []any) error {
+	w.seqs.observe(row)
+	w.chunk = append(w.chunk, row)
+	if len(w.chunk) < chunkRows {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *tableWriter) flush() error {
+	if len(w.chunk) == 0 {
+		return nil
+	}
+	err := w.sink.WriteRows(w.td, w.chunk)
+	clear(w.chunk)
+	w.chunk = w.chunk[:0]
+	return err
+}
+
+func (g *generator) endTable(w *tableWriter) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	g.res.Sequences = w.seqs.merge(g.res.Sequences)
+	return g.sink.EndTable(w.td)
+}
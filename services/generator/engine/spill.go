@@ -0,0 +1,433 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// budget accounts for the memory of what grows with the row count: parent
+// references, unique key fingerprints and the rows of tables closed by
+// deferred foreign keys. A structure whose reservation is refused keeps
+// its data in a spill file instead. Tables generated at once share it.
+type budget struct {
+	mu sync.Mutex
+	// limit is 0 when memory is not bounded
+	limit int64
+	used  int64
+	dir   string
+	files []*os.File
+	// spilled counts the bytes written to spill files
+	spilled int64
+}
+
+func newBudget(limit int64, dir string) *budget {
+	return &budget{limit: limit, dir: dir}
+}
+
+// reserve reports whether n more bytes fit in the budget and takes them.
+func (b *budget) reserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// force takes n bytes whether they fit or not, for the least a structure
+// needs to work at all.
+func (b *budget) force(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+func (b *budget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+}
+
+// wrote counts n bytes written to a spill file.
+func (b *budget) wrote(n int64) {
+	b.mu.Lock()
+	b.spilled += n
+	b.mu.Unlock()
+}
+
+// spillFile creates a temporary file that cleanup removes.
+func (b *budget) spillFile() (*os.File, error) {
+	f, err := os.CreateTemp(b.dir, "gen-sql-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	b.mu.Lock()
+	b.files = append(b.files, f)
+	b.mu.Unlock()
+	return f, nil
+}
+
+// drop removes a spill file before cleanup, once it has been merged away.
+func (b *budget) drop(f *os.File) {
+	b.mu.Lock()
+	for i, g := range b.files {
+		if g == f {
+			b.files = append(b.files[:i], b.files[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func (b *budget) cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range b.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	b.files = nil
+}
+
+// Tags of encoded values.
+const (
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagFalse
+	tagTrue
+	tagString
+	tagDecimal
+	tagJSON
+	tagBytes
+	tagTime
+	tagDuration
+	tagInterval
+	tagArray
+)
+
+var errCorruptRecord = errors.New("corrupt spilled record")
+
+// appendValue encodes a generated value. Values of other types than the
+// generators produce are kept as their text.
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, tagNull)
+	case int64:
+		return binary.AppendVarint(append(b, tagInt), v)
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(b, tagFloat), math.Float64bits(v))
+	case bool:
+		if v {
+			return append(b, tagTrue)
+		}
+		return append(b, tagFalse)
+	case string:
+		return appendBytes(append(b, tagString), []byte(v))
+	case values.Decimal:
+		return appendBytes(append(b, tagDecimal), []byte(v))
+	case values.JSON:
+		return appendBytes(append(b, tagJSON), []byte(v))
+	case []byte:
+		return appendBytes(append(b, tagBytes), v)
+	case time.Time:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			// zones with fractional minute offsets, not generated
+			data, _ = v.UTC().MarshalBinary()
+		}
+		return appendBytes(append(b, tagTime), data)
+	case time.Duration:
+		return binary.AppendVarint(append(b, tagDuration), int64(v))
+	case values.Interval:
+		b = binary.AppendVarint(append(b, tagInterval), int64(v.Months))
+		b = binary.AppendVarint(b, int64(v.Days))
+		return binary.AppendVarint(b, v.Micros)
+	case []any:
+		b = binary.AppendUvarint(append(b, tagArray), uint64(len(v)))
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	}
+	return appendBytes(append(b, tagString), []byte(fmt.Sprint(v)))
+}
+
+func appendBytes(b, data []byte) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(data))), data...)
+}
+
+// readValue decodes the value at the start of b and returns the rest.
+func readValue(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errCorruptRecord
+	}
+	tag, b := b[0], b[1:]
+	switch tag {
+	case tagNull:
+		return nil, b, nil
+	case tagInt, tagDuration:
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, nil, errCorruptRecord
+		}
+		if tag == tagDuration {
+			return time.Duration(v), b[n:], nil
+		}
+		return v, b[n:], nil
+	case tagFloat:
+		if len(b) < 8 {
+			return nil, nil, errCorruptRecord
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:], nil
+	case tagFalse, tagTrue:
+		return tag == tagTrue, b, nil
+	case tagString, tagDecimal, tagJSON, tagBytes, tagTime:
+		data, rest, err := readBytes(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tag {
+		case tagString:
+			return string(data), rest, nil
+		case tagDecimal:
+			return values.Decimal(data), rest, nil
+		case tagJSON:
+			return values.JSON(data), rest, nil
+		case tagBytes:
+			return append([]byte(nil), data...), rest, nil
+		}
+		var t time.Time
+		if err := t.UnmarshalBinary(data); err != nil {
+			return nil, nil, err
+		}
+		return t, rest, nil
+	case tagInterval:
+		var parts [3]int64
+		for i := range parts {
+			v, n := binary.Varint(b)
+			if n <= 0 {
+				return nil, nil, errCorruptRecord
+			}
+			parts[i], b = v, b[n:]
+		}
+		return values.Interval{Months: int32(parts[0]), Days: int32(parts[1]), Micros: parts[2]}, b, nil
+	case tagArray:
+		n, k := binary.Uvarint(b)
+		if k <= 0 || n > uint64(len(b)) {
+			return nil, nil, errCorruptRecord
+		}
+		b = b[k:]
+		arr := make([]any, n)
+		for i := range arr {
+			v, rest, err := readValue(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			arr[i], b = v, rest
+		}
+		return arr, b, nil
+	}
+	return nil, nil, errCorruptRecord
+}
+
+func readBytes(b []byte) ([]byte, []byte, error) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b)-k) {
+		return nil, nil, errCorruptRecord
+	}
+	return b[k : k+int(n)], b[k+int(n):], nil
+}
+
+// blockRecords is the number of records a rowStore block holds.
+const blockRecords = 1024
+
+// storeBlock is a block of encoded records, in memory or in the spill
+// file. Spilled blocks start with the offsets of their records, as
+// little-endian uint32s, followed by the records.
+type storeBlock struct {
+	data []byte
+	offs []uint32
+	pos  int64
+	n    int
+}
+
+func (b *storeBlock) size() int64 {
+	return int64(len(b.data) + 4*len(b.offs))
+}
+
+// rowStore appends fixed-width records of values and reads them back by
+// position. Full blocks stay in memory while the budget allows and go to a
+// spill file once it does not.
+type rowStore struct {
+	budget *budget
+	width  int
+	blocks []*storeBlock
+	cur    *storeBlock
+	count  int64
+	file   *os.File
+	end    int64
+	held   int64
+	buf    []byte
+}
+
+func newRowStore(b *budget, width int) *rowStore {
+	return &rowStore{budget: b, width: width, cur: &storeBlock{}}
+}
+
+func (s *rowStore) len() int64 {
+	return s.count
+}
+
+func (s *rowStore) add(rec []any) error {
+	b := s.cur
+	b.offs = append(b.offs, uint32(len(b.data)))
+	for _, v := range rec {
+		b.data = appendValue(b.data, v)
+	}
+	b.n++
+	s.count++
+	if b.n < blockRecords {
+		return nil
+	}
+	b.offs = append(b.offs, uint32(len(b.data)))
+	s.blocks = append(s.blocks, b)
+	s.cur = &storeBlock{data: make([]byte, 0, len(b.data)), offs: make([]uint32, 0, blockRecords+1)}
+	if s.budget.reserve(b.size()) {
+		s.held += b.size()
+		return nil
+	}
+	return s.spill(b)
+}
+
+// spill writes a full block to the spill file and lets go of its memory.
+func (s *rowStore) spill(b *storeBlock) error {
+	if s.file == nil {
+		f, err := s.budget.spillFile()
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	buf := s.buf[:0]
+	for _, off := range b.offs {
+		buf = binary.LittleEndian.AppendUint32(buf, off)
+	}
+	buf = append(buf, b.data...)
+	if _, err := s.file.WriteAt(buf, s.end); err != nil {
+		return fmt.Errorf("failed to spill rows: %w", err)
+	}
+	b.pos, b.data, b.offs = s.end, nil, nil
+	s.end += int64(len(buf))
+	s.budget.wrote(int64(len(buf)))
+	s.buf = buf
+	return nil
+}
+
+// get returns record i.
+func (s *rowStore) get(i int64) ([]any, error) {
+	if i < 0 || i >= s.count {
+		return nil, fmt.Errorf("record %d out of range", i)
+	}
+	k, j := int(i/blockRecords), int(i%blockRecords)
+	var rec []byte
+	switch {
+	case k == len(s.blocks):
+		b := s.cur
+		end := len(b.data)
+		if j+1 < len(b.offs) {
+			end = int(b.offs[j+1])
+		}
+		rec = b.data[b.offs[j]:end]
+	case s.blocks[k].data != nil:
+		b := s.blocks[k]
+		rec = b.data[b.offs[j]:b.offs[j+1]]
+	default:
+		b := s.blocks[k]
+		var offs [8]byte
+		if _, err := s.file.ReadAt(offs[:], b.pos+4*int64(j)); err != nil {
+			return nil, fmt.Errorf("failed to read spilled rows: %w", err)
+		}
+		start, end := binary.LittleEndian.Uint32(offs[:4]), binary.LittleEndian.Uint32(offs[4:])
+		rec = make([]byte, end-start)
+		header := 4 * int64(blockRecords+1)
+		if _, err := s.file.ReadAt(rec, b.pos+header+int64(start)); err != nil {
+			return nil, fmt.Errorf("failed to read spilled rows: %w", err)
+		}
+	}
+	return s.decode(rec)
+}
+
+func (s *rowStore) decode(b []byte) ([]any, error) {
+	out := make([]any, s.width)
+	for i := range out {
+		v, rest, err := readValue(b)
+		if err != nil {
+			return nil, err
+		}
+		out[i], b = v, rest
+	}
+	return out, nil
+}
+
+// each calls fn with every record in order, reading spilled blocks whole.
+func (s *rowStore) each(fn func(i int64, rec []any) error) error {
+	var i int64
+	visit := func(data []byte, n int) error {
+		for ; n > 0; n-- {
+			rec := make([]any, s.width)
+			for c := range rec {
+				v, rest, err := readValue(data)
+				if err != nil {
+					return err
+				}
+				rec[c], data = v, rest
+			}
+			if err := fn(i, rec); err != nil {
+				return err
+			}
+			i++
+		}
+		return nil
+	}
+	header := 4 * (blockRecords + 1)
+	for _, b := range s.blocks {
+		data := b.data
+		if data == nil {
+			var offs [4]byte
+			if _, err := s.file.ReadAt(offs[:], b.pos+int64(header-4)); err != nil {
+				return fmt.Errorf("failed to read spilled rows: %w", err)
+			}
+			data = make([]byte, binary.LittleEndian.Uint32(offs[:]))
+			if _, err := s.file.ReadAt(data, b.pos+int64(header)); err != nil && err != io.EOF {
+				return fmt.Errorf("failed to read spilled rows: %w", err)
+			}
+		}
+		if err := visit(data, b.n); err != nil {
+			return err
+		}
+	}
+	return visit(s.cur.data, s.cur.n)
+}
+
+// close lets go of the store's memory and spill file.
+func (s *rowStore) close() {
+	s.budget.release(s.held)
+	s.held, s.blocks, s.cur = 0, nil, &storeBlock{}
+	if s.file != nil {
+		s.budget.drop(s.file)
+		s.file = nil
+	}
+}
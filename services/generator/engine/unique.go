@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// maxAttempts bounds how often a row is redrawn to satisfy its unique keys.
+const maxAttempts = 100
+
+// uniqueKey tracks the values already emitted for a PRIMARY KEY, UNIQUE
+// constraint or unique index of a table.
+type uniqueKey struct {
+	def     *ddl.Key
+	primary bool
+	cols    []int
+	where   ddl.Node
+	seen    *keySet
+}
+
+func newUniqueKeys(t *ddl.Table, b *budget) ([]*uniqueKey, error) {
+	var keys []*uniqueKey
+	add := func(def *ddl.Key, primary bool) error {
+		k := &uniqueKey{def: def, primary: primary, seen: newKeySet(b)}
+		for _, name := range def.Columns {
+			k.cols = append(k.cols, t.ColumnIndex(name))
+		}
+		if def.Where != nil {
+			where, err := ddl.ParseExpr(def.Where)
+			if err != nil {
+				return fmt.Errorf("predicate of unique index %s: %w", def.Name, err)
+			}
+			k.where = where
+		}
+		keys = append(keys, k)
+		return nil
+	}
+
+	if t.PrimaryKey != nil {
+		if err := add(t.PrimaryKey, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range t.Uniques {
+		if err := add(u, false); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (k *uniqueKey) String() string {
+	kind := "UNIQUE"
+	switch {
+	case k.primary:
+		kind = "PRIMARY KEY"
+	case k.where != nil:
+		kind = "unique index"
+	}
+	s := kind + " (" + strings.Join(k.def.Columns, ", ") + ")"
+	if k.def.Name != "" {
+		s = k.def.Name + " " + s
+	}
+	return s
+}
+
+// nullable reports whether rows can escape the key by holding a NULL.
+func (k *uniqueKey) nullable(t *ddl.Table) bool {
+	if k.primary || k.def.NullsNotDistinct {
+		return false
+	}
+	for _, c := range k.cols {
+		if !t.Columns[c].NotNull {
+			return true
+		}
+	}
+	return false
+}
+
+// encode returns the fingerprint of a row's values of the key, or false
+// when the row is exempt: it holds a NULL in a nulls-distinct key or falls
+// outside the predicate of a partial index.
+func (k *uniqueKey) encode(t *ddl.Table, row []any) (uint64, bool) {
+	if k.where != nil {
+		v, err := evalRow(k.where, rowLookup(t, row))
+		// predicates we cannot evaluate are assumed to apply
+		if err == nil && v != true {
+			return 0, false
+		}
+	}
+
+	h := fnv.New64a()
+	for i, c := range k.cols {
+		if i > 0 {
+			h.Write([]byte{0})
+		}
+		v := row[c]
+		if v == nil {
+			if !k.def.NullsNotDistinct {
+				return 0, false
+			}
+			h.Write([]byte("\x01NULL"))
+			continue
+		}
+		h.Write([]byte(values.Text(t.Columns[c].Type, v)))
+	}
+	return fingerprint(h.Sum64()), true
+}
+
+func rowLookup(t *ddl.Table, row []any) func(string) (any, bool) {
+	return func(name string) (any, bool) {
+		i := t.ColumnIndex(name)
+		if i < 0 {
+			return nil, false
+		}
+		return row[i], true
+	}
+}
+
+// errDomainExhausted is returned when a unique key cannot be satisfied.
+var errDomainExhausted = errors.New("value domain exhausted")
+
+// permutation draws the integers [0, n) in random order without
+// replacement and without memory: a Feistel network shuffles the smallest
+// power of four that covers n, and values past n are walked on through it
+// until they land in range.
+type permutation struct {
+	n    uint64
+	next uint64
+	half uint
+	mask uint64
+	keys [4]uint64
+}
+
+func newPermutation(n uint64, r *rand.Rand) *permutation {
+	p := &permutation{n: n, half: 1}
+	for p.half < 32 && uint64(1)<<(2*p.half) < n {
+		p.half++
+	}
+	p.mask = 1<<p.half - 1
+	for i := range p.keys {
+		p.keys[i] = r.Uint64()
+	}
+	return p
+}
+
+// at returns the i-th value of the permutation.
+func (p *permutation) at(i uint64) uint64 {
+	for {
+		l, r := i>>p.half, i&p.mask
+		for _, k := range p.keys {
+			l, r = r, l^(mix64(r^k)&p.mask)
+		}
+		i = l<<p.half | r
+		if i < p.n {
+			return i
+		}
+	}
+}
+
+// draw returns the next value and false once every value has been drawn.
+func (p *permutation) draw() (uint64, bool) {
+	if p.next >= p.n {
+		return 0, false
+	}
+	p.next++
+	return p.at(p.next - 1), true
+}
+
+// withoutReplacement wraps an enumerable generator so that it never repeats
+// a value until its domain is exhausted: row i takes the i-th value of a
+// permutation of the domain, whichever range of rows it is generated in.
+type withoutReplacement struct {
+	gen  values.Enumerable
+	perm *permutation
+}
+
+func newWithoutReplacement(gen values.Enumerable, r *rand.Rand) *withoutReplacement {
+	return &withoutReplacement{gen: gen, perm: newPermutation(uint64(gen.Cardinality()), r)}
+}
+
+func (w *withoutReplacement) Generate(r *rand.Rand, row int64) any {
+	if uint64(row) >= w.perm.n {
+		// exhausted, any value collides and triggers the NULL fallback or an error
+		return w.any(r)
+	}
+	return w.gen.Nth(w.perm.at(uint64(row)))
+}
+
+// any draws a value of the domain at random, for rows whose own value
+// broke a constraint.
+func (w *withoutReplacement) any(r *rand.Rand) any {
+	return w.gen.Nth(r.Uint64N(w.perm.n))
+}
+
+func (w *withoutReplacement) Cardinality() float64 {
+	return w.gen.Cardinality()
+}
@@ -0,0 +1,366 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Resolution describes how a foreign key is satisfied when rows are loaded.
+type Resolution int
+
+const (
+	// Ordered foreign keys are satisfied by loading the parent table first.
+	Ordered Resolution = iota
+	// NullThenUpdate foreign keys are inserted as NULL and filled in by
+	// follow-up UPDATE statements once every table has been loaded.
+	NullThenUpdate
+	// Deferred foreign keys are DEFERRABLE and checked at commit time, so
+	// the output has to run inside a transaction with constraints deferred.
+	Deferred
+	// EarlierRow self-references point at a row of the same table that has
+	// already been inserted (or at the row itself).
+	EarlierRow
+)
+
+func (r Resolution) String() string {
+	switch r {
+	case Ordered:
+		return "ordered"
+	case NullThenUpdate:
+		return "null then update"
+	case Deferred:
+		return "deferred"
+	case EarlierRow:
+		return "earlier row"
+	}
+	return fmt.Sprintf("Resolution(%d)", int(r))
+}
+
+// Edge is a foreign key from Child to Parent.
+type Edge struct {
+	Child      *ddl.Table
+	Parent     *ddl.Table
+	FK         *ddl.ForeignKey
+	Resolution Resolution
+}
+
+func (e *Edge) String() string {
+	return fmt.Sprintf("%s(%s) -> %s(%s) [%s]",
+		e.Child.QualifiedName(), strings.Join(e.FK.Columns, ", "),
+		e.Parent.QualifiedName(), strings.Join(e.FK.RefColumns, ", "), e.Resolution)
+}
+
+// Plan is the parent-first load order of a schema together with the way
+// each foreign key, including those on cycles, is going to be satisfied.
+type Plan struct {
+	Order []*ddl.Table
+	Edges []*Edge
+
+	edgesFrom map[*ddl.Table][]*Edge
+}
+
+// EdgesFrom returns the foreign keys declared on t.
+func (p *Plan) EdgesFrom(t *ddl.Table) []*Edge {
+	return p.edgesFrom[t]
+}
+
+// Edge returns the edge of the given foreign key.
+func (p *Plan) Edge(fk *ddl.ForeignKey) *Edge {
+	for _, e := range p.Edges {
+		if e.FK == fk {
+			return e
+		}
+	}
+	return nil
+}
+
+// Updates returns the foreign keys that are loaded as NULL and set afterwards.
+func (p *Plan) Updates() []*Edge {
+	var edges []*Edge
+	for _, e := range p.Edges {
+		if e.Resolution == NullThenUpdate {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// DeferConstraints reports whether loading requires SET CONSTRAINTS ALL DEFERRED.
+func (p *Plan) DeferConstraints() bool {
+	for _, e := range p.Edges {
+		if e.Resolution == Deferred {
+			return true
+		}
+	}
+	return false
+}
+
+// Build computes the load plan for a parsed schema. Cycles, including
+// self-references, are broken by loading a nullable foreign key as NULL and
+// updating it later, or by deferring a DEFERRABLE constraint. A cycle that
+// offers neither cannot be loaded and is reported as an error.
+func Build(schema *ddl.Schema) (*Plan, error) {
+	p := &Plan{edgesFrom: make(map[*ddl.Table][]*Edge)}
+
+	for _, t := range schema.Tables {
+		for _, fk := range t.ForeignKeys {
+			parent := schema.Table(fk.RefTable)
+			if parent == nil {
+				return nil, fmt.Errorf("foreign key on %q references unknown table %q", t.QualifiedName(), fk.RefTable)
+			}
+			e := &Edge{Child: t, Parent: parent, FK: fk}
+			if parent == t {
+				e.Resolution = resolveSelfReference(t, fk)
+			}
+			p.Edges = append(p.Edges, e)
+			p.edgesFrom[t] = append(p.edgesFrom[t], e)
+		}
+	}
+
+	for _, scc := range stronglyConnected(schema.Tables, p.edgesFrom) {
+		if len(scc) > 1 {
+			if err := breakCycles(scc, p.edgesFrom); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	order, err := topoSort(schema.Tables, p.edgesFrom)
+	if err != nil {
+		return nil, err
+	}
+	p.Order = order
+
+	return p, nil
+}
+
+func nullable(t *ddl.Table, fk *ddl.ForeignKey) bool {
+	for _, name := range fk.Columns {
+		if t.Column(name).NotNull {
+			return false
+		}
+	}
+	return true
+}
+
+// RowKey returns the columns that identify a row of t for a follow-up
+// UPDATE: the primary key, or else the first UNIQUE key made of NOT NULL
+// columns. It returns nil when the table has neither.
+func RowKey(t *ddl.Table) []string {
+	if t.PrimaryKey != nil {
+		return t.PrimaryKey.Columns
+	}
+	for _, u := range t.Uniques {
+		notNull := true
+		for _, name := range u.Columns {
+			notNull = notNull && t.Column(name).NotNull
+		}
+		if notNull {
+			return u.Columns
+		}
+	}
+	return nil
+}
+
+// updatable reports whether the foreign key can be loaded as NULL and set later.
+func updatable(t *ddl.Table, fk *ddl.ForeignKey) bool {
+	return nullable(t, fk) && RowKey(t) != nil
+}
+
+func resolveSelfReference(t *ddl.Table, fk *ddl.ForeignKey) Resolution {
+	switch {
+	case updatable(t, fk):
+		return NullThenUpdate
+	case fk.Deferrable:
+		return Deferred
+	default:
+		return EarlierRow
+	}
+}
+
+// ordering reports whether the edge still constrains the load order.
+func ordering(e *Edge) bool {
+	return e.Resolution == Ordered && e.Child != e.Parent
+}
+
+// stronglyConnected returns the strongly connected components of the
+// ordering edges using Tarjan's algorithm.
+func stronglyConnected(tables []*ddl.Table, edgesFrom map[*ddl.Table][]*Edge) [][]*ddl.Table {
+	index := make(map[*ddl.Table]int)
+	low := make(map[*ddl.Table]int)
+	onStack := make(map[*ddl.Table]bool)
+	var stack []*ddl.Table
+	var sccs [][]*ddl.Table
+	next := 0
+
+	var visit func(t *ddl.Table)
+	visit = func(t *ddl.Table) {
+		index[t] = next
+		low[t] = next
+		next++
+		stack = append(stack, t)
+		onStack[t] = true
+
+		for _, e := range edgesFrom[t] {
+			if !ordering(e) {
+				continue
+			}
+			if _, seen := index[e.Parent]; !seen {
+				visit(e.Parent)
+				low[t] = min(low[t], low[e.Parent])
+			} else if onStack[e.Parent] {
+				low[t] = min(low[t], index[e.Parent])
+			}
+		}
+
+		if low[t] == index[t] {
+			var scc []*ddl.Table
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == t {
+					break
+				}
+			}
+			sccs = append(sccs, scc)
+		}
+	}
+
+	for _, t := range tables {
+		if _, seen := index[t]; !seen {
+			visit(t)
+		}
+	}
+	return sccs
+}
+
+// breakCycles re-resolves edges inside one strongly connected component
+// until no ordering cycle remains. On every cycle found it picks a nullable
+// foreign key if there is one, otherwise a deferrable one.
+func breakCycles(scc []*ddl.Table, edgesFrom map[*ddl.Table][]*Edge) error {
+	inSCC := make(map[*ddl.Table]bool, len(scc))
+	for _, t := range scc {
+		inSCC[t] = true
+	}
+
+	for {
+		cycle := findCycle(scc, inSCC, edgesFrom)
+		if cycle == nil {
+			return nil
+		}
+
+		var best *Edge
+		for _, e := range cycle {
+			if updatable(e.Child, e.FK) {
+				best = e
+				break
+			}
+			if best == nil && e.FK.Deferrable {
+				best = e
+			}
+		}
+		if best == nil {
+			names := make([]string, len(cycle))
+			for i, e := range cycle {
+				names[i] = e.Child.QualifiedName()
+			}
+			return fmt.Errorf("foreign key cycle %s -> %s cannot be loaded: it needs a nullable foreign key on a table with a primary key, or a DEFERRABLE one",
+				strings.Join(names, " -> "), names[0])
+		}
+
+		if updatable(best.Child, best.FK) {
+			best.Resolution = NullThenUpdate
+		} else {
+			best.Resolution = Deferred
+		}
+	}
+}
+
+// findCycle returns the edges of one ordering cycle within the component, or nil.
+func findCycle(scc []*ddl.Table, inSCC map[*ddl.Table]bool, edgesFrom map[*ddl.Table][]*Edge) []*Edge {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[*ddl.Table]int, len(scc))
+	var path []*Edge
+
+	var visit func(t *ddl.Table) []*Edge
+	visit = func(t *ddl.Table) []*Edge {
+		state[t] = active
+		for _, e := range edgesFrom[t] {
+			if !ordering(e) || !inSCC[e.Parent] {
+				continue
+			}
+			switch state[e.Parent] {
+			case active:
+				// the cycle is the suffix of the path starting at e.Parent
+				for i, pe := range path {
+					if pe.Child == e.Parent {
+						return append(append([]*Edge{}, path[i:]...), e)
+					}
+				}
+				return []*Edge{e}
+			case unvisited:
+				path = append(path, e)
+				if cycle := visit(e.Parent); cycle != nil {
+					return cycle
+				}
+				path = path[:len(path)-1]
+			}
+		}
+		state[t] = done
+		return nil
+	}
+
+	for _, t := range scc {
+		if state[t] == unvisited {
+			if cycle := visit(t); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// topoSort orders tables parent-first, keeping declaration order among
+// tables that do not depend on each other.
+func topoSort(tables []*ddl.Table, edgesFrom map[*ddl.Table][]*Edge) ([]*ddl.Table, error) {
+	pending := make(map[*ddl.Table]int, len(tables))
+	children := make(map[*ddl.Table][]*ddl.Table)
+	for _, t := range tables {
+		for _, e := range edgesFrom[t] {
+			if ordering(e) {
+				pending[t]++
+				children[e.Parent] = append(children[e.Parent], t)
+			}
+		}
+	}
+
+	order := make([]*ddl.Table, 0, len(tables))
+	placed := make(map[*ddl.Table]bool, len(tables))
+	for len(order) < len(tables) {
+		progressed := false
+		for _, t := range tables {
+			if placed[t] || pending[t] > 0 {
+				continue
+			}
+			placed[t] = true
+			order = append(order, t)
+			for _, c := range children[t] {
+				pending[c]--
+			}
+			progressed = true
+			break
+		}
+		if !progressed {
+			return nil, fmt.Errorf("foreign key graph still contains a cycle after cycle breaking")
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,117 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// want maps the first column of every foreign key to its resolution
+		want map[string]graph.Resolution
+		err  string
+	}{
+		{
+			name: "chain",
+			src: `CREATE TABLE c (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int NOT NULL REFERENCES a (id));
+CREATE TABLE a (id int PRIMARY KEY);`,
+			want: map[string]graph.Resolution{"c.b_id": graph.Ordered, "b.a_id": graph.Ordered},
+		},
+		{
+			name: "nullable self-reference",
+			src:  `CREATE TABLE emp (id int PRIMARY KEY, boss_id int REFERENCES emp (id));`,
+			want: map[string]graph.Resolution{"emp.boss_id": graph.NullThenUpdate},
+		},
+		{
+			name: "deferrable self-reference",
+			src:  `CREATE TABLE emp (id int PRIMARY KEY, boss_id int NOT NULL REFERENCES emp (id) DEFERRABLE);`,
+			want: map[string]graph.Resolution{"emp.boss_id": graph.Deferred},
+		},
+		{
+			name: "required self-reference",
+			src:  `CREATE TABLE emp (id int PRIMARY KEY, boss_id int NOT NULL REFERENCES emp (id));`,
+			want: map[string]graph.Resolution{"emp.boss_id": graph.EarlierRow},
+		},
+		{
+			name: "cycle broken on the nullable key",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int REFERENCES a (id));`,
+			want: map[string]graph.Resolution{"a.b_id": graph.Ordered, "b.a_id": graph.NullThenUpdate},
+		},
+		{
+			name: "cycle broken on the deferrable key",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int NOT NULL REFERENCES a (id) DEFERRABLE INITIALLY DEFERRED);`,
+			want: map[string]graph.Resolution{"a.b_id": graph.Ordered, "b.a_id": graph.Deferred},
+		},
+		{
+			name: "nullable key without a row key",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int UNIQUE, a_id int REFERENCES a (id));`,
+			err: "cannot be loaded",
+		},
+		{
+			name: "three tables",
+			src: `CREATE TABLE a (id int PRIMARY KEY, c_id int NOT NULL REFERENCES c (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int NOT NULL REFERENCES a (id));
+CREATE TABLE c (id int PRIMARY KEY, b_id int REFERENCES b (id));
+CREATE TABLE d (id int PRIMARY KEY, c_id int NOT NULL REFERENCES c (id));`,
+			want: map[string]graph.Resolution{
+				"a.c_id": graph.Ordered, "b.a_id": graph.Ordered, "c.b_id": graph.NullThenUpdate, "d.c_id": graph.Ordered,
+			},
+		},
+		{
+			name: "unbreakable cycle",
+			src: `CREATE TABLE a (id int PRIMARY KEY, b_id int NOT NULL REFERENCES b (id));
+CREATE TABLE b (id int PRIMARY KEY, a_id int NOT NULL REFERENCES a (id));`,
+			err: "cannot be loaded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ddl.Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			plan, err := graph.Build(schema)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			if len(plan.Edges) != len(tt.want) {
+				t.Fatalf("got %d edges, want %d", len(plan.Edges), len(tt.want))
+			}
+			for _, e := range plan.Edges {
+				key := e.Child.Name + "." + e.FK.Columns[0]
+				if want, ok := tt.want[key]; !ok || e.Resolution != want {
+					t.Errorf("%s is %s, want %s", key, e.Resolution, want)
+				}
+			}
+
+			position := make(map[*ddl.Table]int)
+			for i, table := range plan.Order {
+				position[table] = i
+			}
+			if len(position) != len(schema.Tables) {
+				t.Fatalf("order has %d tables, want %d", len(position), len(schema.Tables))
+			}
+			for _, e := range plan.Edges {
+				if e.Resolution == graph.Ordered && position[e.Parent] > position[e.Child] {
+					t.Errorf("%s is loaded before %s", e.Child.Name, e.Parent.Name)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,45 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/graph"
+	"github.com/kacperborowieckb/gen-sql/services/generator/output"
+	"github.com/kacperborowieckb/gen-sql/services/generator/sandbox"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
 	"github.com/kacperborowieckb/gen-sql/shared/contracts"
 	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func (s *generatorServer) handleProjectCreated(d amqp.Delivery) error {
+// handleDelivery routes a message of the data generation queue by its
+// routing key.
+func (s *generatorServer) handleDelivery(d amqp.Delivery) error {
 	log.Printf("Received a message with routing key: %s", d.RoutingKey)
 
+	switch d.RoutingKey {
+	case contracts.GenerationShardRoutingKey:
+		return s.handleShard(d)
+	case contracts.GenerationAssembleRoutingKey:
+		return s.handleAssemble(d)
+	default:
+		return s.handleProjectCreated(d)
+	}
+}
+
+// decodeEvent unmarshals the event a message carries.
+func decodeEvent(d amqp.Delivery, name string, event any) error {
 	var amqpMsg contracts.AmqpMessage
 
 	if err := json.Unmarshal(d.Body, &amqpMsg); err != nil {
@@ -20,12 +47,389 @@ func (s *generatorServer) handleProjectCreated(d amqp.Delivery) error {
 		return fmt.Errorf("failed to unmarshal outer AmqpMessage: %w", err)
 	}
 
+	if err := json.Unmarshal(amqpMsg.Data, event); err != nil {
+		log.Printf("Failed to unmarshal %s: %v. Data: %s", name, err, string(amqpMsg.Data))
+		return fmt.Errorf("failed to unmarshal inner %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *generatorServer) handleProjectCreated(d amqp.Delivery) error {
 	var event messaging.ProjectCreatedEvent
+	if err := decodeEvent(d, "ProjectCreatedEvent", &event); err != nil {
+		return err
+	}
 
-	if err := json.Unmarshal(amqpMsg.Data, &event); err != nil {
-		log.Printf("Failed to unmarshal ProjectCreatedEvent: %v. Data: %s", err, string(amqpMsg.Data))
-		return fmt.Errorf("failed to unmarshal inner ProjectCreatedEvent: %w", err)
+	what := fmt.Sprintf("job %s of project %s", event.JobID, event.ProjectID)
+	ctx, done, err := s.startJob(event.JobID, event.ProjectID)
+	if err != nil {
+		return interrupted(err, what)
 	}
+	defer done()
 
+	started := messaging.GenerationStartedEvent{JobID: event.JobID, ProjectID: event.ProjectID}
+	s.publishStatus(event.ProjectID, contracts.GenerationStartedRoutingKey, started)
+	if err := s.runJob(ctx, event); err != nil {
+		if ctx.Err() != nil {
+			return interrupted(context.Cause(ctx), what)
+		}
+		failed := messaging.GenerationFailedEvent{JobID: event.JobID, ProjectID: event.ProjectID, Error: err.Error()}
+		s.publishStatus(event.ProjectID, contracts.GenerationFailedRoutingKey, failed)
+		return err
+	}
 	return nil
 }
+
+// runJob generates the dataset of a job, checkpointing large ones, or plans
+// the shards of a job too large for one generator. Generation stops once
+// ctx is cancelled.
+func (s *generatorServer) runJob(ctx context.Context, event messaging.ProjectCreatedEvent) error {
+	j, err := s.prepareJob(event)
+	if err != nil {
+		return err
+	}
+	j.opts.Context = ctx
+
+	if event.ShardRows > 0 && event.JobID != "" {
+		planned, err := s.planShards(event, j)
+		if err != nil {
+			log.Printf("Failed to plan shards for project %s: %v", event.ProjectID, err)
+			return fmt.Errorf("failed to plan shards: %w", err)
+		}
+		if planned {
+			return nil
+		}
+	}
+
+	if s.checkpointRows > 0 && event.JobID != "" {
+		checkpointed, err := s.runCheckpointed(ctx, event, j)
+		if err != nil {
+			log.Printf("Failed to generate data for project %s: %v", event.ProjectID, err)
+			return fmt.Errorf("failed to generate data: %w", err)
+		}
+		if checkpointed {
+			return nil
+		}
+	}
+
+	progress := s.newProgress(event, "")
+	j.opts.Progress = progress.update
+	result, path, err := s.generate(ctx, event, j.plan, func(sink engine.Sink) (*engine.Result, error) {
+		return engine.Stream(j.schema, j.plan, j.opts, sink)
+	})
+	progress.flush()
+	if err != nil {
+		log.Printf("Failed to generate data for project %s: %v", event.ProjectID, err)
+		return fmt.Errorf("failed to generate data: %w", err)
+	}
+	s.report(event, result, path)
+
+	return nil
+}
+
+// job is a generation job resolved from its event.
+type job struct {
+	schema *ddl.Schema
+	plan   *graph.Plan
+	// rules are the rules the instructions resolved to, nil when none
+	rules *rules.Rules
+	opts  engine.Options
+}
+
+// prepareJob parses the schema of a job, plans its insert order and
+// resolves its instructions and options.
+func (s *generatorServer) prepareJob(event messaging.ProjectCreatedEvent) (*job, error) {
+	schema, err := ddl.Parse(event.DdlSchema)
+	if err != nil {
+		log.Printf("Failed to parse DDL for project %s: %v", event.ProjectID, err)
+		return nil, fmt.Errorf("failed to parse DDL schema: %w", err)
+	}
+
+	log.Printf("Parsed DDL for project %s: %d tables, seed %d", event.ProjectID, len(schema.Tables), event.Seed)
+
+	plan, err := graph.Build(schema)
+	if err != nil {
+		log.Printf("Failed to plan insert order for project %s: %v", event.ProjectID, err)
+		return nil, fmt.Errorf("failed to build dependency graph: %w", err)
+	}
+
+	order := make([]string, len(plan.Order))
+	for i, t := range plan.Order {
+		order[i] = t.QualifiedName()
+	}
+	log.Printf("Insert order for project %s: %s", event.ProjectID, strings.Join(order, ", "))
+	for _, e := range plan.Edges {
+		if e.Resolution != graph.Ordered {
+			log.Printf("Foreign key %s", e)
+		}
+	}
+
+	rs, err := s.instructionRules(event, schema)
+	if err != nil {
+		log.Printf("Failed to read instructions for project %s: %v", event.ProjectID, err)
+		return nil, fmt.Errorf("failed to read generation instructions: %w", err)
+	}
+
+	opts, notes, err := engineOptions(schema, event, rs)
+	if err != nil {
+		log.Printf("Invalid generation options for project %s: %v", event.ProjectID, err)
+		return nil, fmt.Errorf("failed to resolve generation options: %w", err)
+	}
+	for _, n := range notes {
+		log.Printf("Instructions for project %s: %s", event.ProjectID, n)
+	}
+
+	opts.MemoryLimit = s.memory.engine()
+	opts.SpillDir = s.memory.spillDir
+	opts.Workers = s.workers
+
+	return &job{schema: schema, plan: plan, rules: rs, opts: opts}, nil
+}
+
+// report logs what was generated for a project and publishes the
+// generators picked for its columns and that the job completed.
+func (s *generatorServer) report(event messaging.ProjectCreatedEvent, result *engine.Result, path string) {
+	var rows int64
+	for _, t := range result.Tables {
+		log.Printf("Generated %d rows for table %s", t.Count, t.Def.QualifiedName())
+		rows += t.Count
+	}
+	for _, seq := range result.Sequences {
+		name := seq.Name
+		if name == "" {
+			name = seq.Table.QualifiedName() + "." + seq.Column
+		}
+		log.Printf("Sequence %s of project %s ends at %d", name, event.ProjectID, seq.Last)
+	}
+	if result.Spilled > 0 {
+		log.Printf("Spilled %d MiB to disk for project %s", result.Spilled>>20, event.ProjectID)
+	}
+	s.publishGenerators(event, result)
+	for _, w := range result.Warnings {
+		log.Printf("Warning for project %s: %s", event.ProjectID, w)
+	}
+	log.Printf("Wrote %s output for project %s to %s", outputFormat(event.Output), event.ProjectID, path)
+
+	completed := messaging.GenerationCompletedEvent{JobID: event.JobID, ProjectID: event.ProjectID, Path: path, Rows: rows}
+	s.publishStatus(event.ProjectID, contracts.GenerationCompletedRoutingKey, completed)
+}
+
+// producer hands a dataset to a sink: engine.Stream generating it, or
+// engine.Assemble putting its shards together.
+type producer func(sink engine.Sink) (*engine.Result, error)
+
+// generate streams a dataset into the output the event asks for and
+// returns the path of the script, archive or directory of per-table files
+// written to the project's output directory, or the sandbox schema it was
+// loaded into. The files of a job cancelled through ctx are removed.
+func (s *generatorServer) generate(ctx context.Context, event messaging.ProjectCreatedEvent, plan *graph.Plan, produce producer) (*engine.Result, string, error) {
+	format := outputFormat(event.Output)
+	if format == messaging.FormatSandbox {
+		return s.loadSandbox(ctx, event, plan, produce)
+	}
+
+	dir := filepath.Join(s.outputDir, filepath.Base(event.ProjectID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, "", err
+	}
+
+	if messaging.IsExport(format) {
+		result, path, err := s.writeExport(dir, event.Output, produce)
+		discard(ctx, err, path)
+		return result, path, err
+	}
+	copyOpts := output.CopyOptions{Format: output.CopyText, Transaction: event.Output.Transaction}
+	if format == messaging.FormatCopyCSV {
+		copyOpts.Format = output.CopyCSV
+	}
+	if format != messaging.FormatSQL && event.Output.PerTableFiles {
+		files, err := output.NewCopyFiles(dir, copyOpts)
+		if err != nil {
+			return nil, "", err
+		}
+		defer files.Close()
+		result, err := produce(files)
+		if err != nil && ctx.Err() != nil {
+			if rerr := files.Remove(); rerr != nil {
+				log.Printf("Failed to remove partial output in %s: %v", dir, rerr)
+			}
+		}
+		return result, dir, err
+	}
+
+	path := filepath.Join(dir, "data.sql")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var sink engine.Sink
+	if format == messaging.FormatSQL {
+		sink = output.NewSQLWriter(f, output.SQLOptions{
+			BatchSize:   event.Output.BatchSize,
+			Transaction: event.Output.Transaction,
+		})
+	} else {
+		sink, err = output.NewCopyWriter(f, copyOpts)
+	}
+	var result *engine.Result
+	if err == nil {
+		result, err = produce(sink)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	discard(ctx, err, path)
+	return result, path, err
+}
+
+// loadSandbox loads a dataset into the project's sandbox schema as it is
+// generated and publishes where it can be queried. A load stopped by ctx
+// is rolled back, leaving the sandbox of an earlier job as it was.
+func (s *generatorServer) loadSandbox(ctx context.Context, event messaging.ProjectCreatedEvent, plan *graph.Plan, produce producer) (*engine.Result, string, error) {
+	name := sandbox.SchemaName(event.ProjectID)
+	loader, err := sandbox.NewLoader(ctx, s.dbPool, name, plan.Order, event.DdlSchema, sandbox.Options{Replica: event.Output.Transaction})
+	if err != nil {
+		return nil, "", err
+	}
+	defer loader.Close()
+	result, err := produce(loader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ready := messaging.SandboxReadyEvent{
+		JobID:     event.JobID,
+		ProjectID: event.ProjectID,
+		Host:      s.dbConfig.Host,
+		Port:      s.dbConfig.Port,
+		Database:  s.dbConfig.DBName,
+		Schema:    name,
+		User:      s.dbConfig.User,
+	}
+	data, err := json.Marshal(ready)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal SandboxReadyEvent: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg := contracts.AmqpMessage{OwnerId: event.ProjectID, Data: data}
+	if err := s.mqClient.PublishMessage(ctx, messaging.ProjectsExchange, contracts.ProjectSandboxReadyRoutingKey, msg); err != nil {
+		log.Printf("Failed to publish sandbox of project %s: %v", event.ProjectID, err)
+	}
+	return result, fmt.Sprintf("schema %s of database %s", name, s.dbConfig.DBName), nil
+}
+
+// writeExport packages a csv, ndjson or parquet export as an archive in dir
+// and returns its path.
+func (s *generatorServer) writeExport(dir string, o messaging.OutputOptions, produce producer) (*engine.Result, string, error) {
+	exportOpts := output.ExportOptions{
+		Format:       o.Format,
+		CSV:          output.CSVOptions{Quoting: o.CSV.Quoting, NoHeader: o.CSV.NoHeader},
+		RowGroupSize: s.memory.rowGroup(),
+	}
+	if o.CSV.Delimiter != "" {
+		exportOpts.CSV.Delimiter, _ = utf8.DecodeRuneInString(o.CSV.Delimiter)
+	}
+
+	path := filepath.Join(dir, "dataset"+output.ArchiveExt(o.Archive))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var result *engine.Result
+	a, err := output.NewArchive(f, o.Archive, s.memory.spillDir)
+	if err == nil {
+		var sink engine.Sink
+		if sink, err = output.NewExportWriter(a, exportOpts); err == nil {
+			result, err = produce(sink)
+		}
+		if cerr := a.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return result, path, err
+}
+
+func outputFormat(o messaging.OutputOptions) string {
+	if o.Format == "" {
+		return messaging.FormatSQL
+	}
+	return o.Format
+}
+
+// instructionRules returns the rules of structured instructions, or
+// interprets free text and publishes how it was understood.
+func (s *generatorServer) instructionRules(event messaging.ProjectCreatedEvent, schema *ddl.Schema) (*rules.Rules, error) {
+	rs, err := rules.Parse(event.GenerationInstructions)
+	if err != nil || rs != nil || strings.TrimSpace(event.GenerationInstructions) == "" {
+		return rs, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := s.interpreter.Interpret(ctx, event.GenerationInstructions, schema)
+	if err != nil {
+		return nil, fmt.Errorf("%s interpreter: %w", s.interpreter.Name(), err)
+	}
+	for _, n := range res.Notes {
+		log.Printf("Instructions for project %s: %s", event.ProjectID, n)
+	}
+	if res.Rules != nil {
+		if errs := res.Rules.Validate(); len(errs) > 0 {
+			return nil, fmt.Errorf("%s interpreter produced invalid rules: %w", s.interpreter.Name(), errs)
+		}
+	}
+
+	interpreted := messaging.InstructionsInterpretedEvent{
+		JobID:     event.JobID,
+		ProjectID: event.ProjectID,
+		Provider:  s.interpreter.Name(),
+		Rules:     res.Rules,
+		Notes:     res.Notes,
+	}
+	data, err := json.Marshal(interpreted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal InstructionsInterpretedEvent: %w", err)
+	}
+	msg := contracts.AmqpMessage{OwnerId: event.ProjectID, Data: data}
+	if err := s.mqClient.PublishMessage(ctx, messaging.ProjectsExchange, contracts.ProjectInstructionsInterpretedRoutingKey, msg); err != nil {
+		// generation does not depend on it, the rules are also logged above
+		log.Printf("Failed to publish interpreted instructions for project %s: %v", event.ProjectID, err)
+	}
+
+	return res.Rules, nil
+}
+
+// publishGenerators logs and publishes the generator picked for every
+// column, so that inferred ones can be reviewed and overridden by rules.
+func (s *generatorServer) publishGenerators(event messaging.ProjectCreatedEvent, result *engine.Result) {
+	chosen := messaging.ColumnGeneratorsEvent{JobID: event.JobID, ProjectID: event.ProjectID}
+	for _, t := range result.Tables {
+		for i, name := range t.Generators {
+			if name == "" {
+				continue
+			}
+			c := messaging.ColumnGenerator{Table: t.Def.QualifiedName(), Column: t.Def.Columns[i].Name, Generator: name}
+			if name != values.TypeGenerator && name != engine.RulesGenerator {
+				log.Printf("Inferred generator %s for column %s.%s", c.Generator, c.Table, c.Column)
+			}
+			chosen.Columns = append(chosen.Columns, c)
+		}
+	}
+
+	data, err := json.Marshal(chosen)
+	if err != nil {
+		log.Printf("Failed to marshal ColumnGeneratorsEvent: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg := contracts.AmqpMessage{OwnerId: event.ProjectID, Data: data}
+	if err := s.mqClient.PublishMessage(ctx, messaging.ProjectsExchange, contracts.ProjectGeneratorsChosenRoutingKey, msg); err != nil {
+		log.Printf("Failed to publish column generators for project %s: %v", event.ProjectID, err)
+	}
+}
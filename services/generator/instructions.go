@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+)
+
+// applyRules adds structured generation instructions to opts. The data
+// service already validated their shape, so what is left to check is that
+// they fit the schema. It returns the parts that are accepted but not
+// applied yet.
+func applyRules(schema *ddl.Schema, rs *rules.Rules, opts *engine.Options) ([]string, error) {
+	var skipped []string
+	if rs.NullRatio != nil {
+		opts.DefaultNullRatio = *rs.NullRatio
+	}
+	opts.GenerateDefaults = rs.Defaults == rules.GenerateDefaults
+	registries := make(map[*values.Locale]*values.Registry)
+	registryFor := func(c *ddl.Column) *values.Registry {
+		loc := opts.Locale
+		if l, ok := opts.ColumnLocales[c]; ok {
+			loc = l
+		}
+		r, ok := registries[loc]
+		if !ok {
+			r = values.NewRegistry(schema, loc)
+			registries[loc] = r
+		}
+		return r
+	}
+	fanOut := make(map[*ddl.Table]bool)
+	for _, f := range opts.FanOut {
+		for _, t := range schema.Tables {
+			if slices.Contains(t.ForeignKeys, f.FK) {
+				fanOut[t] = true
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(rs.Tables)) {
+		tr := rs.Tables[name]
+		path := "tables." + name
+		t := schema.Table(name)
+		if t == nil {
+			return nil, &rules.Error{Path: path, Msg: "table does not exist or is ambiguous"}
+		}
+
+		if _, ok := opts.TableRows[t]; tr.Rows > 0 && !ok && !fanOut[t] {
+			if opts.TableRows == nil {
+				opts.TableRows = make(map[*ddl.Table]int64)
+			}
+			opts.TableRows[t] = tr.Rows
+		}
+
+		for _, colName := range slices.Sorted(maps.Keys(tr.Columns)) {
+			cr := tr.Columns[colName]
+			cpath := path + ".columns." + colName
+			c := t.Column(colName)
+			if c == nil {
+				return nil, &rules.Error{Path: cpath, Msg: fmt.Sprintf("column does not exist in %q", t.QualifiedName())}
+			}
+			if err := applyColumnRule(registryFor(c), t, c, cr, cpath, opts); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, text := range tr.Rules {
+			rpath := fmt.Sprintf("%s.rules[%d]", path, i)
+			check := &ddl.Check{Name: rpath, Expr: &ddl.Expr{Text: text}}
+			expr, err := ddl.ParseExpr(check.Expr)
+			if err != nil {
+				return nil, &rules.Error{Path: rpath, Msg: err.Error()}
+			}
+			for _, col := range ddl.Columns(expr) {
+				if t.Column(col) == nil {
+					return nil, &rules.Error{Path: rpath, Msg: fmt.Sprintf("column %q does not exist in %q", col, t.QualifiedName())}
+				}
+			}
+			if opts.Checks == nil {
+				opts.Checks = make(map[*ddl.Table][]*ddl.Check)
+			}
+			opts.Checks[t] = append(opts.Checks[t], check)
+		}
+	}
+
+	return skipped, nil
+}
+
+func applyColumnRule(registry *values.Registry, t *ddl.Table, c *ddl.Column, cr *rules.Column, path string, opts *engine.Options) error {
+	fail := func(field, format string, args ...any) error {
+		return &rules.Error{Path: path + field, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	for _, fk := range t.ForeignKeys {
+		if slices.Contains(fk.Columns, c.Name) {
+			return applyParentRule(t, c, fk, cr, path, opts)
+		}
+	}
+	if c.Generated != nil {
+		return fail("", "generated columns are computed by the database")
+	}
+
+	if err := applyNullRatio(t, c, cr, path, opts); err != nil {
+		return err
+	}
+
+	var gen values.Generator
+	var err error
+	switch {
+	case cr.Generator != "":
+		gen, err = registry.Named(cr.Generator, c.Type)
+		if err != nil {
+			return fail(".generator", "%v", err)
+		}
+	case len(cr.Values) > 0:
+		vals := make([]any, len(cr.Values))
+		for i, v := range cr.Values {
+			if vals[i], err = values.Coerce(c.Type, v); err != nil {
+				return fail(fmt.Sprintf(".values[%d]", i), "%v", err)
+			}
+		}
+		if len(cr.Weights) > 0 {
+			gen = values.NewWeightedChoice(vals, cr.Weights)
+		} else {
+			gen = &values.Choice{Values: vals}
+		}
+	case cr.Pattern != "":
+		if gen, err = values.NewPattern(cr.Pattern); err != nil {
+			return fail(".pattern", "%v", err)
+		}
+	case cr.Min != nil || cr.Max != nil || cr.Distribution != nil:
+		if gen, err = registry.ForColumn(c); err != nil {
+			return fail("", "%v", err)
+		}
+	default:
+		return nil
+	}
+
+	if cr.Min != nil || cr.Max != nil {
+		ranged, ok := gen.(values.Ranged)
+		if !ok {
+			return fail("", "min and max only apply to numeric and date columns")
+		}
+		lo, err := bound(c, cr.Min)
+		if err != nil {
+			return fail(".min", "%v", err)
+		}
+		hi, err := bound(c, cr.Max)
+		if err != nil {
+			return fail(".max", "%v", err)
+		}
+		if err := values.Override(ranged, c.Type, lo, hi); err != nil {
+			return fail("", "%v", err)
+		}
+	}
+
+	if cr.Distribution != nil {
+		spanned, ok := gen.(values.Spanned)
+		if !ok || c.Type.ArrayDims > 0 {
+			return fail(".distribution", "distributions only apply to numeric and date columns")
+		}
+		dist, err := distribution(cr.Distribution, path+".distribution", func(v any) (float64, error) {
+			cv, err := values.Coerce(c.Type, v)
+			if err != nil {
+				return 0, err
+			}
+			return spanned.Units(cv)
+		})
+		if err != nil {
+			return err
+		}
+		gen = &values.Distributed{Spanned: spanned, Dist: dist}
+	}
+
+	if opts.Columns == nil {
+		opts.Columns = make(map[*ddl.Column]values.Generator)
+	}
+	opts.Columns[c] = gen
+	return nil
+}
+
+// applyNullRatio sets the share of NULLs of a column. A ratio of 0 keeps
+// the column from the global default.
+func applyNullRatio(t *ddl.Table, c *ddl.Column, cr *rules.Column, path string, opts *engine.Options) error {
+	if cr.NullRatio == nil {
+		return nil
+	}
+	if *cr.NullRatio > 0 && !t.Nullable(c) {
+		return &rules.Error{Path: path + ".nullRatio", Msg: "column is NOT NULL"}
+	}
+	if opts.NullRatio == nil {
+		opts.NullRatio = make(map[*ddl.Column]float64)
+	}
+	opts.NullRatio[c] = *cr.NullRatio
+	return nil
+}
+
+// applyParentRule applies the rule of a foreign key column, which can only
+// skew how often each parent row is referenced and how often none is.
+func applyParentRule(t *ddl.Table, c *ddl.Column, fk *ddl.ForeignKey, cr *rules.Column, path string, opts *engine.Options) error {
+	if cr.Generator != "" || len(cr.Values) > 0 || cr.Pattern != "" || cr.Min != nil || cr.Max != nil {
+		return &rules.Error{Path: path, Msg: fmt.Sprintf("foreign key columns take their values from %q, only distribution and nullRatio apply", fk.RefTable)}
+	}
+	if err := applyNullRatio(t, c, cr, path, opts); err != nil {
+		return err
+	}
+	if cr.Distribution == nil {
+		return nil
+	}
+	for _, f := range opts.FanOut {
+		if f.FK == fk {
+			return &rules.Error{Path: path + ".distribution", Msg: fmt.Sprintf("fanOut already decides how rows spread over %q", fk.RefTable)}
+		}
+	}
+	if _, ok := opts.ParentDistributions[fk]; ok {
+		return &rules.Error{Path: path + ".distribution", Msg: "another column of the foreign key already has a distribution"}
+	}
+
+	dist, err := distribution(cr.Distribution, path+".distribution", func(v any) (float64, error) {
+		switch v := v.(type) {
+		case int:
+			return float64(v), nil
+		case uint64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return 0, fmt.Errorf("%v is not a row position", v)
+	})
+	if err != nil {
+		return err
+	}
+	if opts.ParentDistributions == nil {
+		opts.ParentDistributions = make(map[*ddl.ForeignKey]*values.Distribution)
+	}
+	opts.ParentDistributions[fk] = dist
+	return nil
+}
+
+// distribution converts a distribution rule, with the bounds of histogram
+// buckets converted to units.
+func distribution(d *rules.Distribution, path string, units func(any) (float64, error)) (*values.Distribution, error) {
+	dist := &values.Distribution{
+		Kind:     d.Type,
+		Mean:     d.Mean,
+		StdDev:   d.StdDev,
+		Rate:     d.Rate,
+		Exponent: d.Exponent,
+		Hot:      d.Hot,
+		Share:    d.Share,
+	}
+	for i, b := range d.Buckets {
+		bpath := fmt.Sprintf("%s.buckets[%d]", path, i)
+		lo, err := units(b.Min)
+		if err != nil {
+			return nil, &rules.Error{Path: bpath + ".min", Msg: err.Error()}
+		}
+		hi, err := units(b.Max)
+		if err != nil {
+			return nil, &rules.Error{Path: bpath + ".max", Msg: err.Error()}
+		}
+		if lo > hi {
+			return nil, &rules.Error{Path: bpath, Msg: "min is greater than max"}
+		}
+		dist.Buckets = append(dist.Buckets, values.DistributionBucket{Lo: lo, Hi: hi, Weight: b.Weight})
+	}
+	return dist, nil
+}
+
+func bound(c *ddl.Column, v any) (*values.Bound, error) {
+	if v == nil {
+		return nil, nil
+	}
+	cv, err := values.Coerce(c.Type, v)
+	if err != nil {
+		return nil, err
+	}
+	return &values.Bound{Value: cv, Inclusive: true}, nil
+}
@@ -0,0 +1,51 @@
+package interpret
+
+import "strings"
+
+type country struct {
+	name, code string
+	aliases    []string
+}
+
+var countries = []country{
+	{"Poland", "PL", nil},
+	{"Germany", "DE", nil},
+	{"United States", "US", []string{"us", "usa", "america", "the us", "the usa", "united states of america"}},
+	{"United Kingdom", "GB", []string{"uk", "the uk", "britain", "great britain", "england"}},
+	{"France", "FR", nil},
+	{"Spain", "ES", nil},
+	{"Italy", "IT", nil},
+	{"Netherlands", "NL", []string{"the netherlands", "holland"}},
+	{"Czechia", "CZ", []string{"czech republic"}},
+	{"Ukraine", "UA", nil},
+	{"Austria", "AT", nil},
+	{"Switzerland", "CH", nil},
+	{"Sweden", "SE", nil},
+	{"Canada", "CA", nil},
+}
+
+// countryCode returns the ISO 3166 alpha-2 code of a country name, alias or
+// code, or "" when the place is not a known country.
+func countryCode(place string) string {
+	place = strings.ToLower(strings.TrimSpace(place))
+	for _, c := range countries {
+		if place == strings.ToLower(c.name) || place == strings.ToLower(c.code) {
+			return c.code
+		}
+		for _, a := range c.aliases {
+			if place == a {
+				return c.code
+			}
+		}
+	}
+	return ""
+}
+
+func countryName(code string) string {
+	for _, c := range countries {
+		if c.code == code {
+			return c.name
+		}
+	}
+	return code
+}
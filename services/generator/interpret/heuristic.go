@@ -0,0 +1,377 @@
+package interpret
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+)
+
+// Heuristic understands a handful of common sentence shapes by keyword
+// matching, without any network access:
+//
+//	50k users, 10 countries
+//	5% of users have no phone
+//	most users are from Poland
+//	age between 18 and 65
+//	status is one of active, banned or deleted
+type Heuristic struct{}
+
+func (Heuristic) Name() string { return "heuristic" }
+
+var (
+	clauseSep = regexp.MustCompile(`[.;\n]+|,\s+(?:and\s+)?`)
+	andSep    = regexp.MustCompile(`\s+and\s+`)
+	// an "and" after these belongs to the clause, as in "between 1 and 5"
+	openRange = regexp.MustCompile(`(?:between|from)\s+-?\d+(?:\.\d+)?$|\b(?:one of|either)\b`)
+	rowCount  = regexp.MustCompile(`^(?:about\s+|around\s+)?(\d[\d,_]*(?:\.\d+)?)\s*(k|m|thousand|million)?\s+([a-z_][a-z0-9_]*)$`)
+	nullShare = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*%\s+(?:of\s+(?:the\s+)?([a-z_][a-z0-9_]*)\s+)?(?:have|has|are)\s+(?:no|without)\s+(?:an?\s+)?([a-z_][a-z0-9_ ]*)$`)
+	origin    = regexp.MustCompile(`^(most|all|half|nearly all|almost all|(\d+(?:\.\d+)?)\s*%)\s+(?:of\s+)?(?:the\s+)?(?:([a-z_][a-z0-9_]*)\s+)?(?:are|is|come|comes|live|lives)\s+(?:from|in)\s+(?:the\s+)?([a-z][a-z .]*)$`)
+	between   = regexp.MustCompile(`^(?:the\s+)?([a-z_][a-z0-9_ ]*?)\s+(?:is\s+|are\s+|of\s+[a-z_]+\s+)?(?:between|from)\s+(-?\d+(?:\.\d+)?)\s+(?:and|to|-)\s+(-?\d+(?:\.\d+)?)$`)
+	oneOf     = regexp.MustCompile(`^(?:the\s+)?([a-z_][a-z0-9_ ]*?)\s+(?:is|are|should be|must be)\s+(?:one of|either)\s+(.+)$`)
+	listSep   = regexp.MustCompile(`\s*(?:,|\bor\b|\band\b)\s*`)
+)
+
+func (h Heuristic) Interpret(_ context.Context, text string, schema *ddl.Schema) (*Result, error) {
+	b := &builder{schema: schema, rules: &rules.Rules{Version: rules.Version, Tables: map[string]*rules.Table{}}}
+
+	for _, clause := range splitClauses(strings.ToLower(text)) {
+		note, ok := b.clause(clause)
+		if !ok {
+			note = "not understood"
+		}
+		b.notes = append(b.notes, fmt.Sprintf("%q: %s", clause, note))
+	}
+
+	res := &Result{Notes: b.notes}
+	if len(b.rules.Tables) > 0 {
+		res.Rules = b.rules
+	}
+	return res, nil
+}
+
+func splitClauses(text string) []string {
+	var clauses []string
+	for _, part := range clauseSep.Split(text, -1) {
+		var cur string
+		for _, piece := range andSep.Split(part, -1) {
+			if cur != "" && openRange.MatchString(cur) {
+				cur += " and " + piece
+				continue
+			}
+			if c := strings.Trim(cur, " \t,!?:"); c != "" {
+				clauses = append(clauses, c)
+			}
+			cur = piece
+		}
+		if c := strings.Trim(cur, " \t,!?:"); c != "" {
+			clauses = append(clauses, c)
+		}
+	}
+	return clauses
+}
+
+type builder struct {
+	schema *ddl.Schema
+	rules  *rules.Rules
+	notes  []string
+}
+
+func (b *builder) clause(s string) (string, bool) {
+	if m := rowCount.FindStringSubmatch(s); m != nil {
+		t := b.table(m[3])
+		n, ok := parseCount(m[1], m[2])
+		if t == nil || !ok {
+			return "", false
+		}
+		b.tableRules(t).Rows = n
+		return fmt.Sprintf("tables.%s.rows = %d", t.Name, n), true
+	}
+
+	if m := nullShare.FindStringSubmatch(s); m != nil {
+		t, c := b.column(m[2], m[3], nil)
+		if c == nil || c.NotNull {
+			return "", false
+		}
+		pct, _ := strconv.ParseFloat(m[1], 64)
+		ratio := min(pct/100, 1)
+		b.columnRules(t, c).NullRatio = &ratio
+		return fmt.Sprintf("tables.%s.columns.%s.nullRatio = %g", t.Name, c.Name, ratio), true
+	}
+
+	if m := origin.FindStringSubmatch(s); m != nil {
+		share := quantifier(m[1], m[2])
+		t, c := b.column(m[3], "", isPlaceColumn)
+		if c == nil {
+			return "", false
+		}
+		vals, weights, ok := b.placeChoice(c, strings.TrimSpace(m[4]), share)
+		if !ok {
+			return "", false
+		}
+		cr := b.columnRules(t, c)
+		cr.Values, cr.Weights = vals, weights
+		return fmt.Sprintf("tables.%s.columns.%s: %v with weight %g", t.Name, c.Name, vals[0], share), true
+	}
+
+	if m := between.FindStringSubmatch(s); m != nil {
+		t, c := b.column("", m[1], nil)
+		if c == nil {
+			return "", false
+		}
+		lo, hi := bound(c, m[2], false), bound(c, m[3], true)
+		if lo == nil || hi == nil {
+			return "", false
+		}
+		cr := b.columnRules(t, c)
+		cr.Min, cr.Max = lo, hi
+		return fmt.Sprintf("tables.%s.columns.%s between %v and %v", t.Name, c.Name, lo, hi), true
+	}
+
+	if m := oneOf.FindStringSubmatch(s); m != nil {
+		t, c := b.column("", m[1], nil)
+		if c == nil {
+			return "", false
+		}
+		var vals []any
+		for _, v := range listSep.Split(m[2], -1) {
+			if v = strings.Trim(v, ` "'`); v != "" {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 0 {
+			return "", false
+		}
+		b.columnRules(t, c).Values = vals
+		return fmt.Sprintf("tables.%s.columns.%s one of %v", t.Name, c.Name, vals), true
+	}
+
+	return "", false
+}
+
+func (b *builder) tableRules(t *ddl.Table) *rules.Table {
+	tr := b.rules.Tables[t.QualifiedName()]
+	if tr == nil {
+		tr = &rules.Table{Columns: map[string]*rules.Column{}}
+		b.rules.Tables[t.QualifiedName()] = tr
+	}
+	return tr
+}
+
+func (b *builder) columnRules(t *ddl.Table, c *ddl.Column) *rules.Column {
+	tr := b.tableRules(t)
+	cr := tr.Columns[c.Name]
+	if cr == nil {
+		cr = &rules.Column{}
+		tr.Columns[c.Name] = cr
+	}
+	return cr
+}
+
+// table matches a word such as "users" or "user" against the table names.
+func (b *builder) table(word string) *ddl.Table {
+	if word == "" {
+		return nil
+	}
+	for _, form := range wordForms(word) {
+		for _, t := range b.schema.Tables {
+			if t.Name == form {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// column finds a column by a phrase such as "phone" or "phone number",
+// in the named table if there is one, else in the first table that has a
+// match. Leading words that do not match are dropped, so "users signed up"
+// finds users.signed_up. With an empty phrase it takes the first column
+// accepted by like.
+func (b *builder) column(tableWord, phrase string, like func(*ddl.Column) bool) (*ddl.Table, *ddl.Column) {
+	words := strings.Fields(phrase)
+	for len(words) > 0 {
+		if t, c := b.columnIn(tableWord, strings.Join(words, "_"), nil); c != nil {
+			return t, c
+		}
+		if tableWord == "" && b.table(words[0]) != nil {
+			tableWord = words[0]
+		}
+		words = words[1:]
+	}
+	if phrase != "" {
+		return nil, nil
+	}
+	return b.columnIn(tableWord, "", like)
+}
+
+func (b *builder) columnIn(tableWord, name string, like func(*ddl.Column) bool) (*ddl.Table, *ddl.Column) {
+	tables := b.schema.Tables
+	if t := b.table(tableWord); t != nil {
+		tables = []*ddl.Table{t}
+	} else if tableWord != "" && name == "" {
+		return nil, nil
+	}
+
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if name == "" {
+				if like != nil && like(c) {
+					return t, c
+				}
+				continue
+			}
+			for _, form := range wordForms(name) {
+				if c.Name == form || strings.HasPrefix(c.Name, form+"_") || strings.HasSuffix(c.Name, "_"+form) {
+					return t, c
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func isPlaceColumn(c *ddl.Column) bool {
+	for _, part := range []string{"country", "nationality", "city", "region", "location"} {
+		if strings.Contains(c.Name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeChoice picks the value for a place with the given share and spreads
+// the rest over other values of the column's domain.
+func (b *builder) placeChoice(c *ddl.Column, place string, share float64) ([]any, []float64, bool) {
+	var domain []string
+	var value string
+
+	if e := b.schema.Enum(c.Type.Name); e != nil {
+		domain = e.Values
+		for _, v := range e.Values {
+			if strings.EqualFold(v, place) || strings.EqualFold(v, countryCode(place)) {
+				value = v
+			}
+		}
+		if value == "" {
+			return nil, nil, false
+		}
+	} else {
+		code := countryCode(place)
+		useCodes := code != "" && (len(c.Type.Modifiers) > 0 && c.Type.Modifiers[0] <= 3 || strings.Contains(c.Name, "code"))
+		for _, ct := range countries {
+			switch {
+			case code == "":
+				// not a country, there is nothing to spread the rest over
+			case useCodes:
+				domain = append(domain, ct.code)
+			default:
+				domain = append(domain, ct.name)
+			}
+		}
+		value = capitalize(place)
+		if useCodes {
+			value = code
+		} else if code != "" {
+			value = countryName(code)
+		}
+	}
+
+	vals := []any{value}
+	weights := []float64{share}
+	var others []string
+	for _, v := range domain {
+		if v != value {
+			others = append(others, v)
+		}
+	}
+	if share >= 1 || len(others) == 0 {
+		return vals, []float64{1}, true
+	}
+	others = others[:min(len(others), 5)]
+	for _, v := range others {
+		vals = append(vals, v)
+		weights = append(weights, math.Round((1-share)/float64(len(others))*1e4)/1e4)
+	}
+	return vals, weights, true
+}
+
+func quantifier(word, pct string) float64 {
+	switch word {
+	case "all":
+		return 1
+	case "nearly all", "almost all":
+		return 0.95
+	case "half":
+		return 0.5
+	case "most":
+		return 0.7
+	}
+	p, _ := strconv.ParseFloat(pct, 64)
+	return min(p/100, 1)
+}
+
+func parseCount(digits, suffix string) (int64, bool) {
+	f, err := strconv.ParseFloat(strings.NewReplacer(",", "", "_", "").Replace(digits), 64)
+	if err != nil {
+		return 0, false
+	}
+	switch suffix {
+	case "k", "thousand":
+		f *= 1e3
+	case "m", "million":
+		f *= 1e6
+	}
+	return int64(f), f >= 1
+}
+
+// bound converts a number from a range to a min or max of the column. Years
+// given for date columns become the first or last day of the year.
+func bound(c *ddl.Column, s string, upper bool) any {
+	switch c.Type.Name {
+	case "date", "timestamp", "timestamptz":
+		if len(s) != 4 {
+			return nil
+		}
+		if upper {
+			return s + "-12-31"
+		}
+		return s + "-01-01"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// wordForms returns a word with its likely singular forms.
+func wordForms(w string) []string {
+	forms := []string{w}
+	switch {
+	case strings.HasSuffix(w, "ies"):
+		forms = append(forms, strings.TrimSuffix(w, "ies")+"y")
+	case strings.HasSuffix(w, "ses"), strings.HasSuffix(w, "xes"):
+		forms = append(forms, strings.TrimSuffix(w, "es"))
+	case strings.HasSuffix(w, "s"):
+		forms = append(forms, strings.TrimSuffix(w, "s"))
+	default:
+		forms = append(forms, w+"s")
+	}
+	return forms
+}
@@ -0,0 +1,37 @@
+// Package interpret turns free-text generation instructions into
+// structured rules.
+package interpret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+)
+
+// Provider interprets instructions such as "most users are from Poland, 5%
+// have no phone" against a schema.
+type Provider interface {
+	Name() string
+	Interpret(ctx context.Context, text string, schema *ddl.Schema) (*Result, error)
+}
+
+// Result is how a provider understood the instructions.
+type Result struct {
+	// Rules is nil when nothing could be understood.
+	Rules *rules.Rules `json:"rules,omitempty"`
+	// Notes explain, sentence by sentence, what each part was taken to mean
+	// and what was ignored.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// New returns the provider with the given name. Only the offline
+// "heuristic" provider is built in.
+func New(name string) (Provider, error) {
+	switch name {
+	case "", "heuristic":
+		return Heuristic{}, nil
+	}
+	return nil, fmt.Errorf("unknown instructions provider %q", name)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	"github.com/kacperborowieckb/gen-sql/shared/rules"
+)
+
+// defaultNullRatio is the share of NULLs in nullable columns unless the
+// rules set another.
+const defaultNullRatio = 0.1
+
+// engineOptions resolves the table names of the event and the rules taken
+// from its instructions against the parsed schema. It also returns notes
+// on rules that were not applied.
+func engineOptions(schema *ddl.Schema, event messaging.ProjectCreatedEvent, rs *rules.Rules) (engine.Options, []string, error) {
+	opts := engine.Options{
+		Rows:             int64(event.MaxRows),
+		Seed:             uint64(event.Seed),
+		DefaultNullRatio: defaultNullRatio,
+	}
+
+	if event.Locale != "" {
+		loc, err := values.LookupLocale(event.Locale)
+		if err != nil {
+			return opts, nil, fmt.Errorf("locale: %w", err)
+		}
+		opts.Locale = loc
+	}
+	for key, tag := range event.ColumnLocales {
+		c, err := lookupColumn(schema, key)
+		if err != nil {
+			return opts, nil, fmt.Errorf("columnLocales: %w", err)
+		}
+		loc, err := values.LookupLocale(tag)
+		if err != nil {
+			return opts, nil, fmt.Errorf("columnLocales[%q]: %w", key, err)
+		}
+		if opts.ColumnLocales == nil {
+			opts.ColumnLocales = make(map[*ddl.Column]*values.Locale)
+		}
+		opts.ColumnLocales[c] = loc
+	}
+
+	if len(event.TableRows) > 0 {
+		opts.TableRows = make(map[*ddl.Table]int64, len(event.TableRows))
+		for name, rows := range event.TableRows {
+			t, err := lookupTable(schema, name)
+			if err != nil {
+				return opts, nil, fmt.Errorf("tableRows: %w", err)
+			}
+			opts.TableRows[t] = rows
+		}
+	}
+
+	for i, f := range event.FanOut {
+		fk, err := lookupForeignKey(schema, f)
+		if err != nil {
+			return opts, nil, fmt.Errorf("fanOut[%d]: %w", i, err)
+		}
+		rule := engine.FanOut{FK: fk, Min: f.Min, Max: f.Max, Mean: f.Mean}
+		switch f.Distribution {
+		case "", "uniform":
+			rule.Distribution = engine.Uniform
+		case "poisson":
+			rule.Distribution = engine.Poisson
+		default:
+			return opts, nil, fmt.Errorf("fanOut[%d]: unknown distribution %q", i, f.Distribution)
+		}
+		opts.FanOut = append(opts.FanOut, rule)
+	}
+
+	if rs == nil {
+		return opts, nil, nil
+	}
+	notes, err := applyRules(schema, rs, &opts)
+	if err != nil {
+		return opts, nil, fmt.Errorf("generationInstructions: %w", err)
+	}
+	return opts, notes, nil
+}
+
+func lookupTable(schema *ddl.Schema, name string) (*ddl.Table, error) {
+	t := schema.Table(name)
+	if t == nil {
+		return nil, fmt.Errorf("table %q does not exist or is ambiguous", name)
+	}
+	return t, nil
+}
+
+// lookupColumn finds a column by its table-qualified name, e.g. users.phone
+// or crm.users.phone.
+func lookupColumn(schema *ddl.Schema, name string) (*ddl.Column, error) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("%q must name a column as table.column", name)
+	}
+	t, err := lookupTable(schema, name[:i])
+	if err != nil {
+		return nil, err
+	}
+	c := t.Column(name[i+1:])
+	if c == nil {
+		return nil, fmt.Errorf("column %q does not exist in %q", name[i+1:], t.QualifiedName())
+	}
+	return c, nil
+}
+
+// lookupForeignKey finds the foreign key from the child to the parent
+// table, narrowed down by its columns when there is more than one.
+func lookupForeignKey(schema *ddl.Schema, f messaging.FanOut) (*ddl.ForeignKey, error) {
+	child, err := lookupTable(schema, f.ChildTable)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := lookupTable(schema, f.ParentTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*ddl.ForeignKey
+	for _, fk := range child.ForeignKeys {
+		if fk.RefTable != parent.QualifiedName() {
+			continue
+		}
+		if len(f.Columns) > 0 && !slices.Equal(fk.Columns, f.Columns) {
+			continue
+		}
+		found = append(found, fk)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%q has no foreign key to %q", child.QualifiedName(), parent.QualifiedName())
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%q references %q more than once, set columns to pick one", child.QualifiedName(), parent.QualifiedName())
+}
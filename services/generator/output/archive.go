@@ -0,0 +1,126 @@
+package output
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Archive formats.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Archive collects the files of a dataset into a single artifact. A file
+// written through Create is complete once the next one is created or the
+// archive is closed.
+type Archive interface {
+	Create(name string) (io.Writer, error)
+	Close() error
+}
+
+// NewArchive returns an archive of the given format that writes to w.
+// Formats that need the size of a file before it are spooled to a
+// temporary file in tempDir, os.TempDir() when empty. Close removes it.
+func NewArchive(w io.Writer, format, tempDir string) (Archive, error) {
+	switch format {
+	case "", ArchiveZip:
+		return &zipArchive{zw: zip.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarArchive{gz: gz, tw: tar.NewWriter(gz), dir: tempDir}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q, expected %s or %s", format, ArchiveZip, ArchiveTarGz)
+}
+
+// ArchiveExt is the file name extension of an archive format.
+func ArchiveExt(format string) string {
+	if format == "" {
+		format = ArchiveZip
+	}
+	return "." + format
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) Create(name string) (io.Writer, error) {
+	return a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// tarArchive spools each file to a temporary file, since tar headers
+// carry the size of the file that follows them.
+type tarArchive struct {
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	dir   string
+	name  string
+	spool *os.File
+	// pending is whether the spool holds a file not yet archived
+	pending bool
+}
+
+func (a *tarArchive) Create(name string) (io.Writer, error) {
+	if err := a.flush(); err != nil {
+		return nil, err
+	}
+	if a.spool == nil {
+		f, err := os.CreateTemp(a.dir, "gen-sql-tar-*")
+		if err != nil {
+			return nil, err
+		}
+		a.spool = f
+	}
+	a.name, a.pending = name, true
+	return a.spool, nil
+}
+
+// flush archives the spooled file and empties the spool for the next one.
+func (a *tarArchive) flush() error {
+	if !a.pending {
+		return nil
+	}
+	a.pending = false
+	size, err := a.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: a.name, Mode: 0o644, Size: size, ModTime: time.Now()}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(a.tw, io.NewSectionReader(a.spool, 0, size)); err != nil {
+		return err
+	}
+	if err := a.spool.Truncate(0); err != nil {
+		return err
+	}
+	_, err = a.spool.Seek(0, io.SeekStart)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	err := a.flush()
+	if a.spool != nil {
+		a.spool.Close()
+		os.Remove(a.spool.Name())
+		a.spool = nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
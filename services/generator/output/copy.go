@@ -0,0 +1,393 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// COPY formats.
+const (
+	CopyText = "text"
+	CopyCSV  = "csv"
+)
+
+// CopyOptions shape the COPY output of NewCopyWriter and NewCopyFiles.
+type CopyOptions struct {
+	// Format is CopyText, the default, or CopyCSV.
+	Format string
+	// Transaction loads everything in one transaction with
+	// session_replication_role set to replica, like SQLOptions.Transaction.
+	Transaction bool
+}
+
+// copyWriter writes a dataset as a psql script of COPY FROM STDIN blocks.
+type copyWriter struct {
+	w           *bufio.Writer
+	opts        CopyOptions
+	transaction bool
+	epilogue
+	// cols are the columns of the table being copied, ins writes the
+	// tables whose columns are all left to the database
+	cols []int
+	ins  *inserts
+}
+
+// NewCopyWriter returns a sink that writes a dataset to w as a psql script
+// with one COPY FROM STDIN block per table in load order, followed by the
+// same updates and setval calls as NewSQLWriter.
+func NewCopyWriter(w io.Writer, opts CopyOptions) (engine.Sink, error) {
+	if err := checkCopyFormat(opts.Format); err != nil {
+		return nil, err
+	}
+	return &copyWriter{w: bufio.NewWriter(w), opts: opts}, nil
+}
+
+func (s *copyWriter) Start(res *engine.Result) error {
+	s.transaction = writePrologue(s.w, res, s.opts.Transaction)
+	return nil
+}
+
+func (s *copyWriter) BeginTable(td *engine.Table) error {
+	s.cols, s.ins = nil, nil
+	if td.Count == 0 {
+		return nil
+	}
+	cols := LoadColumns(td)
+	if len(cols) == 0 {
+		s.ins = newInserts(s.w, td, DefaultBatchSize)
+		return nil
+	}
+	s.cols = cols
+	fmt.Fprintf(s.w, "\n-- %s: %d rows\n", td.Def.QualifiedName(), td.Count)
+	fmt.Fprintf(s.w, "%s;\n", copyStatement(td.Def, cols, s.opts.Format))
+	return nil
+}
+
+func (s *copyWriter) WriteRows(td *engine.Table, rows [][]any) error {
+	if s.ins != nil {
+		s.ins.write(rows)
+	} else {
+		writeCopyRows(s.w, td, rows, s.cols, s.opts.Format)
+	}
+	return s.w.Flush()
+}
+
+func (s *copyWriter) EndTable(*engine.Table) error {
+	switch {
+	case s.ins != nil:
+		s.ins.end()
+	case s.cols != nil:
+		fmt.Fprintln(s.w, `\.`)
+	}
+	return nil
+}
+
+func (s *copyWriter) WriteUpdate(u engine.Update) error {
+	s.writeUpdate(s.w, u)
+	return nil
+}
+
+func (s *copyWriter) Finish(res *engine.Result) error {
+	writeSequences(s.w, res.Sequences, s.transaction)
+	return s.w.Flush()
+}
+
+// CopyFiles is a sink that writes a dataset to a directory as one COPY file
+// per table, a manifest that tells the order and statements to load them
+// with, and a finish script when the dataset has updates or sequences.
+type CopyFiles struct {
+	dir    string
+	format string
+	m      Manifest
+	// tables counts the tables begun, which number the files
+	tables int
+	entry  ManifestTable
+	file   *bufferedFile
+	cols   []int
+	ins    *inserts
+	finish *bufferedFile
+	epilogue
+}
+
+// NewCopyFiles returns a sink that writes COPY files to dir. Close must be
+// called once generation ends, whether it succeeded or not.
+func NewCopyFiles(dir string, opts CopyOptions) (*CopyFiles, error) {
+	if err := checkCopyFormat(opts.Format); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	format := opts.Format
+	if format == "" {
+		format = CopyText
+	}
+	return &CopyFiles{dir: dir, format: format, m: Manifest{Format: format, Transaction: opts.Transaction}}, nil
+}
+
+func (s *CopyFiles) Start(res *engine.Result) error {
+	s.m.DeferConstraints = res.DeferConstraints
+	return nil
+}
+
+func (s *CopyFiles) BeginTable(td *engine.Table) error {
+	s.tables++
+	if td.Count == 0 {
+		return nil
+	}
+	s.cols, s.ins = LoadColumns(td), nil
+	s.entry = ManifestTable{Table: td.Def.QualifiedName(), Columns: []string{}, Rows: td.Count}
+	s.entry.File = fmt.Sprintf("%02d_%s", s.tables, fileName(s.entry.Table))
+	if len(s.cols) == 0 {
+		s.entry.File += ".sql"
+	} else {
+		s.entry.File += map[string]string{CopyText: ".tsv", CopyCSV: ".csv"}[s.format]
+		s.entry.Copy = copyStatement(td.Def, s.cols, s.format)
+		for _, c := range s.cols {
+			s.entry.Columns = append(s.entry.Columns, td.Def.Columns[c].Name)
+		}
+	}
+
+	f, err := createFile(filepath.Join(s.dir, s.entry.File))
+	if err != nil {
+		return err
+	}
+	s.file = f
+	if len(s.cols) == 0 {
+		s.ins = newInserts(f.Writer, td, DefaultBatchSize)
+	}
+	return nil
+}
+
+func (s *CopyFiles) WriteRows(td *engine.Table, rows [][]any) error {
+	if s.ins != nil {
+		s.ins.write(rows)
+	} else {
+		writeCopyRows(s.file.Writer, td, rows, s.cols, s.format)
+	}
+	return s.file.Flush()
+}
+
+func (s *CopyFiles) EndTable(td *engine.Table) error {
+	if s.file == nil {
+		return nil
+	}
+	if s.ins != nil {
+		s.ins.end()
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.m.Tables = append(s.m.Tables, s.entry)
+	return err
+}
+
+func (s *CopyFiles) WriteUpdate(u engine.Update) error {
+	if err := s.openFinish(); err != nil {
+		return err
+	}
+	s.writeUpdate(s.finish.Writer, u)
+	return nil
+}
+
+// openFinish creates the finish script when it is first needed.
+func (s *CopyFiles) openFinish() error {
+	if s.finish != nil {
+		return nil
+	}
+	f, err := createFile(filepath.Join(s.dir, FinishFile))
+	if err != nil {
+		return err
+	}
+	s.finish = f
+	s.m.Finish = FinishFile
+	return nil
+}
+
+func (s *CopyFiles) Finish(res *engine.Result) error {
+	if len(res.Sequences) > 0 {
+		if err := s.openFinish(); err != nil {
+			return err
+		}
+	}
+	if s.finish != nil {
+		writeSequences(s.finish.Writer, res.Sequences, false)
+		err := s.finish.Close()
+		s.finish = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := s.m.marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, ManifestFile), data, 0o644)
+}
+
+// Close closes the files a failed generation left open.
+func (s *CopyFiles) Close() error {
+	var err error
+	for _, f := range []*bufferedFile{s.file, s.finish} {
+		if f == nil {
+			continue
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.file, s.finish = nil, nil
+	return err
+}
+
+// Remove closes and removes the files of a generation that is given up on.
+// The manifest is only written once generation finishes.
+func (s *CopyFiles) Remove() error {
+	var names []string
+	if s.file != nil {
+		names = append(names, s.entry.File)
+	}
+	for _, t := range s.m.Tables {
+		names = append(names, t.File)
+	}
+	if s.m.Finish != "" {
+		names = append(names, s.m.Finish)
+	}
+	err := s.Close()
+	for _, name := range names {
+		if rerr := os.Remove(filepath.Join(s.dir, name)); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func checkCopyFormat(format string) error {
+	switch format {
+	case "", CopyText, CopyCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown COPY format %q, expected %s or %s", format, CopyText, CopyCSV)
+}
+
+// LoadColumns are the positions of the columns COPY lists: all but the
+// ones left to the database. Unlike INSERT, COPY writes identity columns
+// without OVERRIDING SYSTEM VALUE.
+func LoadColumns(td *engine.Table) []int {
+	cols, _ := insertColumns(td)
+	return cols
+}
+
+func copyStatement(t *ddl.Table, cols []int, format string) string {
+	stmt := fmt.Sprintf("COPY %s (%s) FROM STDIN", QualifiedName(t), columnList(t, cols))
+	if format == CopyCSV {
+		stmt += " WITH (FORMAT csv)"
+	}
+	return stmt
+}
+
+func writeCopyRows(w *bufio.Writer, td *engine.Table, rows [][]any, cols []int, format string) {
+	sep, field := byte('\t'), copyText
+	if format == CopyCSV {
+		sep, field = ',', copyCSV
+	}
+	for _, row := range rows {
+		for i, c := range cols {
+			if i > 0 {
+				w.WriteByte(sep)
+			}
+			w.WriteString(field(td.Def.Columns[c].Type, row[c]))
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// copyText renders a value in COPY's text format: \N for NULL, and
+// backslashes and control characters escaped.
+func copyText(t ddl.Type, v any) string {
+	if v == nil {
+		return `\N`
+	}
+	s := values.Text(t, v)
+	if !strings.ContainsAny(s, "\\\t\n\r\b\f\v") {
+		return s
+	}
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\v':
+			sb.WriteString(`\v`)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// copyCSV renders a value as a CSV field: NULL is an unquoted empty field,
+// so empty strings are quoted, as are fields with separators, quotes or
+// line breaks and the end-of-data marker \. that psql would stop at.
+func copyCSV(t ddl.Type, v any) string {
+	if v == nil {
+		return ""
+	}
+	s := values.Text(t, v)
+	if s != "" && s != `\.` && !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// fileName replaces the characters of a table name that do not belong in
+// file names.
+func fileName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' {
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+// bufferedFile is a file written through a buffer.
+type bufferedFile struct {
+	*bufio.Writer
+	f *os.File
+}
+
+func createFile(path string) (*bufferedFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedFile{Writer: bufio.NewWriter(f), f: f}, nil
+}
+
+// Close flushes the buffer and closes the file.
+func (f *bufferedFile) Close() error {
+	err := f.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
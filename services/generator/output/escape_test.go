@@ -0,0 +1,151 @@
+package output
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+var (
+	textType  = ddl.Type{Name: "text"}
+	intType   = ddl.Type{Name: "integer"}
+	floatType = ddl.Type{Name: "double precision"}
+	byteaType = ddl.Type{Name: "bytea"}
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"users", "users"},
+		{"user_2", "user_2"},
+		{"user", `"user"`},
+		{"Users", `"Users"`},
+		{"2fa", `"2fa"`},
+		{"a b", `"a b"`},
+		{`a"b`, `"a""b"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := QuoteIdent(tt.name); got != tt.want {
+			t.Errorf("QuoteIdent(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  ddl.Type
+		v    any
+		want string
+	}{
+		{"null", textType, nil, "NULL"},
+		{"int", intType, int64(-42), "-42"},
+		{"decimal", ddl.Type{Name: "numeric"}, values.Decimal("12.50"), "12.50"},
+		{"float", floatType, 1.5, "1.5"},
+		{"nan", floatType, math.NaN(), "'NaN'"},
+		{"infinity", floatType, math.Inf(-1), "'-Infinity'"},
+		{"bool", ddl.Type{Name: "boolean"}, true, "true"},
+		{"text", textType, "plain", "'plain'"},
+		{"quote", textType, "it's", "'it''s'"},
+		{"backslash", textType, `a\b`, `'a\b'`},
+		{"money", ddl.Type{Name: "money"}, values.Decimal("1.25"), "'1.25'"},
+		{"bytea", byteaType, []byte{0xde, 0xad}, `'\xdead'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Literal(tt.typ, tt.v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyText(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"null", nil, `\N`},
+		{"plain", "plain", "plain"},
+		{"backslash", `a\b`, `a\\b`},
+		{"null marker", `\N`, `\\N`},
+		{"tab", "a\tb", `a\tb`},
+		{"line breaks", "a\r\nb", `a\r\nb`},
+		{"control", "a\b\f\vb", `a\b\f\vb`},
+		{"quote", `"it's"`, `"it's"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := copyText(textType, tt.v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"null", nil, ""},
+		{"empty", "", `""`},
+		{"plain", "plain", "plain"},
+		{"comma", "a,b", `"a,b"`},
+		{"quote", `say "hi"`, `"say ""hi"""`},
+		{"line break", "a\nb", "\"a\nb\""},
+		{"end of data", `\.`, `"\."`},
+		{"backslash", `a\b`, `a\b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := copyCSV(textType, tt.v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CSVOptions
+		s    string
+		want string
+	}{
+		{"plain", CSVOptions{}, "plain", "plain"},
+		{"empty", CSVOptions{}, "", `""`},
+		{"delimiter", CSVOptions{}, "a,b", `"a,b"`},
+		{"quote", CSVOptions{}, `a"b`, `"a""b"`},
+		{"carriage return", CSVOptions{}, "a\rb", "\"a\rb\""},
+		{"other delimiter", CSVOptions{Delimiter: ';'}, "a,b", "a,b"},
+		{"semicolon", CSVOptions{Delimiter: ';'}, "a;b", `"a;b"`},
+		{"quote all", CSVOptions{Quoting: QuoteAll}, "plain", `"plain"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newCSVWriter(tt.opts)
+			if err != nil {
+				t.Fatalf("newCSVWriter: %v", err)
+			}
+			if got := w.quote(tt.s); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	// -1 is not a valid rune
+	for _, delim := range []rune{'"', '\n', '\r', -1} {
+		if _, err := newCSVWriter(CSVOptions{Delimiter: delim}); err == nil {
+			t.Errorf("newCSVWriter accepted delimiter %q", delim)
+		}
+	}
+}
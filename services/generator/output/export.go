@@ -0,0 +1,333 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// Export formats.
+const (
+	ExportCSV     = "csv"
+	ExportNDJSON  = "ndjson"
+	ExportParquet = "parquet"
+)
+
+// CSV quoting modes.
+const (
+	// QuoteMinimal quotes fields with delimiters, quotes or line breaks,
+	// and empty strings so they differ from NULL.
+	QuoteMinimal = "minimal"
+	// QuoteAll quotes every field but NULL ones.
+	QuoteAll = "all"
+)
+
+// ExportOptions shape the archive of NewExportWriter.
+type ExportOptions struct {
+	// Format is ExportCSV, ExportNDJSON or ExportParquet.
+	Format string
+	CSV    CSVOptions
+	// RowGroupSize is how many bytes of rows Parquet files buffer per row
+	// group, the Parquet writer's default when 0.
+	RowGroupSize int64
+}
+
+// CSVOptions shape CSV exports.
+type CSVOptions struct {
+	// Delimiter separates fields, a comma when 0.
+	Delimiter rune
+	// Quoting is QuoteMinimal, the default, or QuoteAll.
+	Quoting string
+	// NoHeader leaves out the header row of column names.
+	NoHeader bool
+}
+
+// exportTable writes the rows of one table in an export format.
+type exportTable interface {
+	write(rows [][]any) error
+	close() error
+}
+
+// exportWriter writes a dataset to an archive, one file per table.
+type exportWriter struct {
+	a     Archive
+	opts  ExportOptions
+	open  func(w *bufio.Writer, td *engine.Table) (exportTable, error)
+	m     Manifest
+	entry ManifestTable
+	sum   *checksum
+	w     *bufio.Writer
+	table exportTable
+}
+
+// NewExportWriter returns a sink that writes a dataset to an archive with
+// one file per table in load order and a manifest of their row counts and
+// checksums. Unlike the SQL outputs, exports hold every column, including
+// the values emulated for the ones the database fills in.
+func NewExportWriter(a Archive, opts ExportOptions) (engine.Sink, error) {
+	s := &exportWriter{a: a, opts: opts, m: Manifest{Format: opts.Format}}
+	switch opts.Format {
+	case ExportCSV:
+		csv, err := newCSVWriter(opts.CSV)
+		if err != nil {
+			return nil, err
+		}
+		s.open = csv.open
+	case ExportNDJSON:
+		s.open = openNDJSON
+	case ExportParquet:
+		s.open = func(w *bufio.Writer, td *engine.Table) (exportTable, error) {
+			return openParquet(w, td, opts.RowGroupSize)
+		}
+	default:
+		return nil, fmt.Errorf("unknown export format %q, expected %s, %s or %s", opts.Format, ExportCSV, ExportNDJSON, ExportParquet)
+	}
+	return s, nil
+}
+
+func (s *exportWriter) Start(res *engine.Result) error {
+	s.m.DeferConstraints = res.DeferConstraints
+	return nil
+}
+
+func (s *exportWriter) BeginTable(td *engine.Table) error {
+	s.entry = ManifestTable{
+		Table:   td.Def.QualifiedName(),
+		Columns: make([]string, len(td.Def.Columns)),
+		File:    fmt.Sprintf("%02d_%s.%s", len(s.m.Tables)+1, fileName(td.Def.QualifiedName()), s.opts.Format),
+		Rows:    td.Count,
+	}
+	for j, c := range td.Def.Columns {
+		s.entry.Columns[j] = c.Name
+	}
+	f, err := s.a.Create(s.entry.File)
+	if err != nil {
+		return err
+	}
+	s.sum = newChecksum(f)
+	s.w = bufio.NewWriter(s.sum)
+	s.table, err = s.open(s.w, td)
+	return s.tableErr(err)
+}
+
+func (s *exportWriter) WriteRows(_ *engine.Table, rows [][]any) error {
+	if err := s.table.write(rows); err != nil {
+		return s.tableErr(err)
+	}
+	return s.w.Flush()
+}
+
+func (s *exportWriter) EndTable(*engine.Table) error {
+	if err := s.table.close(); err != nil {
+		return s.tableErr(err)
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.sum.record(&s.entry)
+	s.m.Tables = append(s.m.Tables, s.entry)
+	return nil
+}
+
+func (s *exportWriter) tableErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("table %q: %w", s.entry.Table, err)
+}
+
+// WriteUpdate leaves exports as they are: they hold the rows as generated.
+func (s *exportWriter) WriteUpdate(engine.Update) error {
+	return nil
+}
+
+func (s *exportWriter) Finish(*engine.Result) error {
+	data, err := s.m.marshal()
+	if err != nil {
+		return err
+	}
+	f, err := s.a.Create(ManifestFile)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+type csvWriter struct {
+	delim    rune
+	quoteAll bool
+	header   bool
+	special  string
+}
+
+func newCSVWriter(opts CSVOptions) (*csvWriter, error) {
+	w := &csvWriter{delim: opts.Delimiter, header: !opts.NoHeader}
+	if w.delim == 0 {
+		w.delim = ','
+	}
+	if w.delim == '"' || w.delim == '\r' || w.delim == '\n' || !utf8.ValidRune(w.delim) {
+		return nil, fmt.Errorf("invalid CSV delimiter %q", w.delim)
+	}
+	switch opts.Quoting {
+	case "", QuoteMinimal:
+	case QuoteAll:
+		w.quoteAll = true
+	default:
+		return nil, fmt.Errorf("unknown CSV quoting %q, expected %s or %s", opts.Quoting, QuoteMinimal, QuoteAll)
+	}
+	w.special = string(w.delim) + "\"\r\n"
+	return w, nil
+}
+
+// csvTable writes the rows of one table as CSV.
+type csvTable struct {
+	*csvWriter
+	w    *bufio.Writer
+	cols []*ddl.Column
+}
+
+func (c *csvWriter) open(w *bufio.Writer, td *engine.Table) (exportTable, error) {
+	if c.header {
+		for i, col := range td.Def.Columns {
+			c.field(w, i, c.quote(col.Name))
+		}
+		w.WriteByte('\n')
+	}
+	return &csvTable{csvWriter: c, w: w, cols: td.Def.Columns}, nil
+}
+
+func (t *csvTable) write(rows [][]any) error {
+	for _, row := range rows {
+		for i, col := range t.cols {
+			if row[i] == nil {
+				t.field(t.w, i, "")
+				continue
+			}
+			t.field(t.w, i, t.quote(values.Text(col.Type, row[i])))
+		}
+		t.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (t *csvTable) close() error {
+	return nil
+}
+
+// quote quotes a non-NULL field when it needs it. Empty strings always
+// are, so they read back as such rather than as NULL.
+func (c *csvWriter) quote(s string) string {
+	if s != "" && !c.quoteAll && !strings.ContainsAny(s, c.special) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// field writes an already quoted field, after a delimiter unless it is the
+// first of its row.
+func (c *csvWriter) field(w *bufio.Writer, i int, s string) {
+	if i > 0 {
+		w.WriteRune(c.delim)
+	}
+	w.WriteString(s)
+}
+
+// ndjsonTable writes a table as one JSON object per row, with the keys in
+// column order.
+type ndjsonTable struct {
+	w    *bufio.Writer
+	cols []*ddl.Column
+	keys [][]byte
+}
+
+func openNDJSON(w *bufio.Writer, td *engine.Table) (exportTable, error) {
+	t := &ndjsonTable{w: w, cols: td.Def.Columns, keys: make([][]byte, len(td.Def.Columns))}
+	for i, c := range td.Def.Columns {
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return nil, err
+		}
+		t.keys[i] = key
+	}
+	return t, nil
+}
+
+func (t *ndjsonTable) write(rows [][]any) error {
+	w := t.w
+	for _, row := range rows {
+		w.WriteByte('{')
+		for i, c := range t.cols {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.Write(t.keys[i])
+			w.WriteByte(':')
+			data, err := json.Marshal(jsonValue(c.Type, row[i]))
+			if err != nil {
+				return fmt.Errorf("column %q: %w", c.Name, err)
+			}
+			w.Write(data)
+		}
+		w.WriteString("}\n")
+	}
+	return nil
+}
+
+func (t *ndjsonTable) close() error {
+	return nil
+}
+
+// jsonValue converts a generated value to what it is in NDJSON: numbers and
+// booleans as such, json columns embedded, arrays as arrays, dates and
+// timestamps in RFC 3339 and everything else as PostgreSQL's text.
+func jsonValue(t ddl.Type, v any) any {
+	if t.ArrayDims > 0 {
+		if arr, ok := v.([]any); ok {
+			out := make([]any, len(arr))
+			for i, e := range arr {
+				out[i] = jsonValue(t.Elem(), e)
+			}
+			return out
+		}
+	}
+	switch v := v.(type) {
+	case nil, int64, bool:
+		return v
+	case float64:
+		switch {
+		case math.IsNaN(v) || math.IsInf(v, 0):
+			return values.Text(t, v)
+		case t.Name == "real":
+			// shortest form of the float32, as PostgreSQL prints it
+			return json.Number(values.Text(t, v))
+		}
+		return v
+	case values.Decimal:
+		// money and numeric NaN are not JSON numbers
+		if t.Name != "money" && json.Valid([]byte(v)) {
+			return json.Number(v)
+		}
+	case values.JSON:
+		if json.Valid([]byte(v)) {
+			return json.RawMessage(v)
+		}
+	case time.Time:
+		switch t.Name {
+		case "date":
+			return v.Format(time.DateOnly)
+		case "timestamptz":
+			return v.Format(time.RFC3339Nano)
+		}
+		return v.Format("2006-01-02T15:04:05.999999999")
+	}
+	return values.Text(t, v)
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+// reserved are the PostgreSQL key words that cannot be column or table
+// names without quotes.
+var reserved = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true,
+	"asc": true, "asymmetric": true, "authorization": true, "binary": true, "both": true, "case": true,
+	"cast": true, "check": true, "collate": true, "collation": true, "column": true, "concurrently": true,
+	"constraint": true, "create": true, "cross": true, "current_catalog": true, "current_date": true,
+	"current_role": true, "current_schema": true, "current_time": true, "current_timestamp": true,
+	"current_user": true, "default": true, "deferrable": true, "desc": true, "distinct": true, "do": true,
+	"else": true, "end": true, "except": true, "false": true, "fetch": true, "for": true, "foreign": true,
+	"freeze": true, "from": true, "full": true, "grant": true, "group": true, "having": true, "ilike": true,
+	"in": true, "initially": true, "inner": true, "intersect": true, "into": true, "is": true, "isnull": true,
+	"join": true, "lateral": true, "leading": true, "left": true, "like": true, "limit": true,
+	"localtime": true, "localtimestamp": true, "natural": true, "not": true, "notnull": true, "null": true,
+	"offset": true, "on": true, "only": true, "or": true, "order": true, "outer": true, "overlaps": true,
+	"placing": true, "primary": true, "references": true, "returning": true, "right": true, "select": true,
+	"session_user": true, "similar": true, "some": true, "symmetric": true, "system_user": true,
+	"table": true, "tablesample": true, "then": true, "to": true, "trailing": true, "true": true,
+	"union": true, "unique": true, "user": true, "using": true, "variadic": true, "verbose": true,
+	"when": true, "where": true, "window": true, "with": true,
+}
+
+// QuoteIdent quotes an identifier when PostgreSQL would otherwise fold its
+// case or read it as a key word.
+func QuoteIdent(name string) string {
+	plain := name != "" && !reserved[name]
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c == '_' || i > 0 && (c >= '0' && c <= '9' || c == '$')) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QualifiedName quotes the name of a table with its namespace.
+func QualifiedName(t *ddl.Table) string {
+	if t.Namespace == "" {
+		return QuoteIdent(t.Name)
+	}
+	return QuoteIdent(t.Namespace) + "." + QuoteIdent(t.Name)
+}
+
+// QuoteLiteral quotes a string as an SQL string constant. Backslashes are
+// kept as they are, which needs standard_conforming_strings, on by default
+// since PostgreSQL 9.1.
+func QuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Literal renders a generated value of type t as an SQL constant. Numbers
+// and booleans are written bare, everything else, including bytea and
+// arrays, as a quoted string in PostgreSQL's text format, which INSERT
+// casts to the column type.
+func Literal(t ddl.Type, v any) string {
+	if v == nil {
+		return "NULL"
+	}
+	if t.ArrayDims == 0 && t.Name != "money" {
+		switch v := v.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case values.Decimal:
+			return string(v)
+		case float64:
+			switch {
+			case math.IsNaN(v):
+				return "'NaN'"
+			case math.IsInf(v, 1):
+				return "'Infinity'"
+			case math.IsInf(v, -1):
+				return "'-Infinity'"
+			}
+			return values.Text(t, v)
+		case bool:
+			return values.Text(t, v)
+		}
+	}
+	return QuoteLiteral(values.Text(t, v))
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+)
+
+// ManifestFile is the name of the manifest written next to the table
+// files of a dataset.
+const ManifestFile = "manifest.json"
+
+// FinishFile is the script of updates and setval calls that runs after the
+// table files are loaded.
+const FinishFile = "finish.sql"
+
+// Manifest describes a dataset written as one file per table.
+type Manifest struct {
+	// Format is a COPY format, or an export format for archives.
+	Format string `json:"format"`
+	// Tables are in load order.
+	Tables []ManifestTable `json:"tables"`
+	// Finish names the script to run after the tables are loaded, if any.
+	Finish string `json:"finish,omitempty"`
+	// Transaction asks for the files to be loaded in one transaction with
+	// session_replication_role set to replica.
+	Transaction bool `json:"transaction,omitempty"`
+	// DeferConstraints asks for the files to be loaded in one transaction
+	// after SET CONSTRAINTS ALL DEFERRED, because foreign keys of the
+	// dataset only hold once all of them are.
+	DeferConstraints bool `json:"deferConstraints,omitempty"`
+}
+
+// ManifestTable is the file of one table.
+type ManifestTable struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	File    string   `json:"file"`
+	Rows    int64    `json:"rows"`
+	// Bytes and SHA256 are the size and checksum of archived files.
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Copy is the statement that loads the file from standard input. Tables
+	// whose columns are all left to the database have none; their file is
+	// an SQL script of INSERTs instead.
+	Copy string `json:"copy,omitempty"`
+}
+
+func (m *Manifest) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// checksum counts and hashes what is written through it.
+type checksum struct {
+	w     io.Writer
+	hash  hash.Hash
+	bytes int64
+}
+
+func newChecksum(w io.Writer) *checksum {
+	return &checksum{w: w, hash: sha256.New()}
+}
+
+func (c *checksum) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.hash.Write(p[:n])
+	c.bytes += int64(n)
+	return n, err
+}
+
+// record stores the size and checksum of a table's file in its manifest
+// entry.
+func (c *checksum) record(entry *ManifestTable) {
+	entry.Bytes = c.bytes
+	entry.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+}
@@ -0,0 +1,205 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetKind is how the values of a column are stored in Parquet.
+type parquetKind int
+
+const (
+	parquetText parquetKind = iota
+	parquetBinary
+	parquetInt32
+	parquetInt64
+	parquetFloat
+	parquetDouble
+	parquetDecimal
+	parquetBool
+	parquetDate
+	parquetTimestamp
+	parquetTime
+)
+
+// parquetColumn is a column of a table in a Parquet file.
+type parquetColumn struct {
+	kind  parquetKind
+	scale int
+	// tag describes the column to the Parquet writer
+	tag string
+}
+
+// maxDecimalPrecision is the most digits a decimal stored as INT64 holds.
+// Wider and unconstrained numeric columns are written as text.
+const maxDecimalPrecision = 18
+
+// parquetColumnOf maps the type of a column to a Parquet type. Arrays and
+// types without a Parquet counterpart, such as intervals, are written as
+// text in PostgreSQL's format.
+func parquetColumnOf(c *ddl.Column) parquetColumn {
+	pc := parquetColumn{kind: parquetText}
+	physical, logical := "BYTE_ARRAY", "UTF8"
+	if c.Type.ArrayDims == 0 {
+		switch c.Type.Name {
+		case "smallint", "smallserial":
+			pc.kind, physical, logical = parquetInt32, "INT32", "INT_16"
+		case "integer", "serial":
+			pc.kind, physical, logical = parquetInt32, "INT32", ""
+		case "bigint", "bigserial":
+			pc.kind, physical, logical = parquetInt64, "INT64", ""
+		case "real":
+			pc.kind, physical, logical = parquetFloat, "FLOAT", ""
+		case "double precision":
+			pc.kind, physical, logical = parquetDouble, "DOUBLE", ""
+		case "numeric":
+			if mods := c.Type.Modifiers; len(mods) > 0 && mods[0] <= maxDecimalPrecision {
+				if len(mods) > 1 {
+					pc.scale = mods[1]
+				}
+				pc.kind, physical, logical = parquetDecimal, "INT64", "DECIMAL"
+				logical += fmt.Sprintf(", scale=%d, precision=%d", pc.scale, mods[0])
+			}
+		case "boolean":
+			pc.kind, physical, logical = parquetBool, "BOOLEAN", ""
+		case "date":
+			pc.kind, physical, logical = parquetDate, "INT32", "DATE"
+		case "timestamp", "timestamptz":
+			pc.kind, physical, logical = parquetTimestamp, "INT64", "TIMESTAMP_MICROS"
+		case "time":
+			pc.kind, physical, logical = parquetTime, "INT64", "TIME_MICROS"
+		case "bytea":
+			pc.kind, logical = parquetBinary, ""
+		}
+	}
+
+	// the writer reads tags as comma-separated key=value pairs
+	name := strings.NewReplacer(",", "_", "=", "_", "\t", "_").Replace(c.Name)
+	pc.tag = fmt.Sprintf("name=%s, type=%s, repetitiontype=OPTIONAL", name, physical)
+	if logical != "" {
+		pc.tag += ", convertedtype=" + logical
+	}
+	return pc
+}
+
+// value converts a generated value to the Go type the Parquet writer
+// expects for the column.
+func (pc parquetColumn) value(t ddl.Type, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch pc.kind {
+	case parquetInt32, parquetInt64:
+		i, ok := v.(int64)
+		if !ok {
+			break
+		}
+		if pc.kind == parquetInt32 {
+			return int32(i), nil
+		}
+		return i, nil
+	case parquetFloat, parquetDouble:
+		f, ok := v.(float64)
+		if !ok {
+			break
+		}
+		if pc.kind == parquetFloat {
+			return float32(f), nil
+		}
+		return f, nil
+	case parquetDecimal:
+		return unscaled(values.Text(t, v), pc.scale)
+	case parquetBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case parquetDate:
+		if ts, ok := v.(time.Time); ok {
+			return int32(math.Floor(float64(ts.Unix()) / 86400)), nil
+		}
+	case parquetTimestamp:
+		if ts, ok := v.(time.Time); ok {
+			return ts.UnixMicro(), nil
+		}
+	case parquetTime:
+		if d, ok := v.(time.Duration); ok {
+			return d.Microseconds(), nil
+		}
+	case parquetBinary:
+		if b, ok := v.([]byte); ok {
+			return string(b), nil
+		}
+	default:
+		return values.Text(t, v), nil
+	}
+	return nil, fmt.Errorf("cannot write %T as %s", v, t)
+}
+
+// unscaled returns a decimal string as an integer count of 10^-scale.
+func unscaled(s string, scale int) (int64, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	n := new(big.Int).Quo(r.Num(), r.Denom())
+	if !n.IsInt64() {
+		return 0, fmt.Errorf("decimal %q does not fit its precision", s)
+	}
+	return n.Int64(), nil
+}
+
+// parquetTable writes the rows of a table as a Parquet file.
+type parquetTable struct {
+	pw   *writer.CSVWriter
+	defs []*ddl.Column
+	cols []parquetColumn
+}
+
+func openParquet(w io.Writer, td *engine.Table, rowGroupSize int64) (exportTable, error) {
+	t := &parquetTable{defs: td.Def.Columns, cols: make([]parquetColumn, len(td.Def.Columns))}
+	tags := make([]string, len(t.cols))
+	for i, c := range td.Def.Columns {
+		t.cols[i] = parquetColumnOf(c)
+		tags[i] = t.cols[i].tag
+	}
+	pw, err := writer.NewCSVWriterFromWriter(tags, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	if rowGroupSize > 0 {
+		pw.RowGroupSize = rowGroupSize
+	}
+	t.pw = pw
+	return t, nil
+}
+
+func (t *parquetTable) write(rows [][]any) error {
+	for _, row := range rows {
+		// the writer keeps records until it flushes a row group
+		rec := make([]any, len(t.cols))
+		for i, c := range t.defs {
+			var err error
+			if rec[i], err = t.cols[i].value(c.Type, row[i]); err != nil {
+				return fmt.Errorf("column %q: %w", c.Name, err)
+			}
+		}
+		if err := t.pw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *parquetTable) close() error {
+	return t.pw.WriteStop()
+}
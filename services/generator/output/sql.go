@@ -0,0 +1,251 @@
+// Package output writes generated datasets in the formats users download
+// or load into a database.
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+)
+
+// DefaultBatchSize is the number of rows per INSERT statement unless
+// SQLOptions sets another.
+const DefaultBatchSize = 1000
+
+// SQLOptions shape the INSERT script of NewSQLWriter.
+type SQLOptions struct {
+	// BatchSize is the number of rows per INSERT statement.
+	BatchSize int
+	// Transaction wraps the script in a transaction that sets
+	// session_replication_role to replica, which turns off triggers and
+	// foreign key checks while loading and needs superuser rights.
+	Transaction bool
+}
+
+// sqlWriter writes a dataset as a script of multi-row INSERT statements.
+type sqlWriter struct {
+	w           *bufio.Writer
+	opts        SQLOptions
+	transaction bool
+	epilogue
+	ins *inserts
+}
+
+// NewSQLWriter returns a sink that writes a dataset to w as a script of
+// multi-row INSERT statements in load order, followed by the updates that
+// close foreign key cycles and setval calls for the sequences the rows
+// used. Defaulted columns are left to the database.
+func NewSQLWriter(w io.Writer, opts SQLOptions) engine.Sink {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &sqlWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+func (s *sqlWriter) Start(res *engine.Result) error {
+	s.transaction = writePrologue(s.w, res, s.opts.Transaction)
+	return nil
+}
+
+func (s *sqlWriter) BeginTable(td *engine.Table) error {
+	s.ins = newInserts(s.w, td, s.opts.BatchSize)
+	return nil
+}
+
+func (s *sqlWriter) WriteRows(_ *engine.Table, rows [][]any) error {
+	s.ins.write(rows)
+	return s.w.Flush()
+}
+
+func (s *sqlWriter) EndTable(*engine.Table) error {
+	s.ins.end()
+	return nil
+}
+
+func (s *sqlWriter) WriteUpdate(u engine.Update) error {
+	s.writeUpdate(s.w, u)
+	return nil
+}
+
+func (s *sqlWriter) Finish(res *engine.Result) error {
+	writeSequences(s.w, res.Sequences, s.transaction)
+	return s.w.Flush()
+}
+
+// writePrologue starts a script, in a transaction when replica is set or
+// the dataset relies on deferred constraints. It reports whether it began
+// one.
+func writePrologue(w *bufio.Writer, res *engine.Result, replica bool) bool {
+	fmt.Fprintln(w, "SET client_encoding = 'UTF8';")
+	fmt.Fprintln(w, "SET standard_conforming_strings = on;")
+	// deferred foreign keys only wait for the end of a transaction
+	transaction := replica || res.DeferConstraints
+	if transaction {
+		fmt.Fprintln(w, "BEGIN;")
+	}
+	if replica {
+		fmt.Fprintln(w, "SET LOCAL session_replication_role = replica;")
+	}
+	if res.DeferConstraints {
+		fmt.Fprintln(w, "SET CONSTRAINTS ALL DEFERRED;")
+	}
+	return transaction
+}
+
+// epilogue writes the updates that close foreign key cycles as they
+// arrive, after a blank line.
+type epilogue struct {
+	updates int
+}
+
+func (e *epilogue) writeUpdate(w *bufio.Writer, u engine.Update) {
+	if e.updates == 0 {
+		fmt.Fprintln(w)
+	}
+	e.updates++
+	fmt.Fprintf(w, "%s;\n", UpdateSQL(u))
+}
+
+// writeSequences ends a script with the setval calls of the sequences the
+// rows used.
+func writeSequences(w *bufio.Writer, seqs []engine.Sequence, transaction bool) {
+	if len(seqs) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, seq := range seqs {
+		fmt.Fprintf(w, "%s;\n", SetvalSQL(seq))
+	}
+
+	if transaction {
+		fmt.Fprintln(w, "COMMIT;")
+	}
+}
+
+// SetvalSQL returns the statement that moves a sequence past the values
+// the rows took from it.
+func SetvalSQL(seq engine.Sequence) string {
+	return fmt.Sprintf("SELECT setval(%s, %d)", SequenceExpr(seq), seq.Last)
+}
+
+// SequenceExpr returns an SQL expression naming the sequence of seq.
+func SequenceExpr(seq engine.Sequence) string {
+	if seq.Name != "" {
+		return QuoteLiteral(seq.Name)
+	}
+	return fmt.Sprintf("pg_get_serial_sequence(%s, %s)", QuoteLiteral(QualifiedName(seq.Table)), QuoteLiteral(seq.Column))
+}
+
+// insertColumns returns the positions of the columns an INSERT lists, and
+// whether one of them is an identity column that needs OVERRIDING SYSTEM
+// VALUE.
+func insertColumns(td *engine.Table) ([]int, bool) {
+	var cols []int
+	override := false
+	for i, c := range td.Def.Columns {
+		if td.Defaulted[i] {
+			continue
+		}
+		cols = append(cols, i)
+		if c.Identity == "always" {
+			override = true
+		}
+	}
+	return cols, override
+}
+
+// inserts writes the rows of one table as INSERT statements of up to
+// batchSize rows, however many rows each write brings.
+type inserts struct {
+	w         *bufio.Writer
+	t         *ddl.Table
+	cols      []int
+	head      string
+	batchSize int
+	// open is the number of rows of the statement being written
+	open int
+}
+
+func newInserts(w *bufio.Writer, td *engine.Table, batchSize int) *inserts {
+	t := td.Def
+	ins := &inserts{w: w, t: t, batchSize: batchSize}
+	if td.Count == 0 {
+		return ins
+	}
+	fmt.Fprintf(w, "\n-- %s: %d rows\n", t.QualifiedName(), td.Count)
+
+	cols, override := insertColumns(td)
+	ins.cols = cols
+	ins.head = fmt.Sprintf("INSERT INTO %s (%s)", QualifiedName(t), columnList(t, cols))
+	if override {
+		ins.head += " OVERRIDING SYSTEM VALUE"
+	}
+	return ins
+}
+
+func (ins *inserts) write(rows [][]any) {
+	w, t := ins.w, ins.t
+	for _, row := range rows {
+		if len(ins.cols) == 0 {
+			fmt.Fprintf(w, "INSERT INTO %s DEFAULT VALUES;\n", QualifiedName(t))
+			continue
+		}
+		if ins.open == 0 {
+			fmt.Fprintf(w, "%s VALUES\n", ins.head)
+		} else {
+			w.WriteString(",\n")
+		}
+		w.WriteByte('(')
+		for i, c := range ins.cols {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(Literal(t.Columns[c].Type, row[c]))
+		}
+		w.WriteByte(')')
+		if ins.open++; ins.open == ins.batchSize {
+			ins.end()
+		}
+	}
+}
+
+// end closes the statement being written.
+func (ins *inserts) end() {
+	if ins.open > 0 {
+		ins.w.WriteString(";\n")
+		ins.open = 0
+	}
+}
+
+// columnList quotes the names of the columns of t at the given positions.
+func columnList(t *ddl.Table, cols []int) string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = QuoteIdent(t.Columns[c].Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// UpdateSQL returns the statement that fills in the foreign keys of a row
+// after the rows they point to are loaded.
+func UpdateSQL(u engine.Update) string {
+	set := make([]string, len(u.Columns))
+	for i, name := range u.Columns {
+		set[i] = QuoteIdent(name) + " = " + Literal(columnType(u.Table, name), u.Values[i])
+	}
+	where := make([]string, len(u.Key))
+	for i, name := range u.Key {
+		where[i] = QuoteIdent(name) + " = " + Literal(columnType(u.Table, name), u.KeyValues[i])
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", QualifiedName(u.Table), strings.Join(set, ", "), strings.Join(where, " AND "))
+}
+
+func columnType(t *ddl.Table, name string) ddl.Type {
+	if c := t.Column(name); c != nil {
+		return c.Type
+	}
+	return ddl.Type{Name: "text"}
+}
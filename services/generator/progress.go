@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+)
+
+// progressInterval is the least time between two progress events of a job.
+const progressInterval = 2 * time.Second
+
+// progressReporter publishes how far the tables of a job, or of one of its
+// shards, are generated, at most every progressInterval.
+type progressReporter struct {
+	s     *generatorServer
+	event messaging.GenerationProgressEvent
+
+	mu      sync.Mutex
+	tables  map[*ddl.Table]int
+	changed []bool
+	last    time.Time
+}
+
+func (s *generatorServer) newProgress(job messaging.ProjectCreatedEvent, shardID string) *progressReporter {
+	return &progressReporter{
+		s:      s,
+		event:  messaging.GenerationProgressEvent{JobID: job.JobID, ProjectID: job.ProjectID, ShardID: shardID},
+		tables: make(map[*ddl.Table]int),
+		last:   time.Now(),
+	}
+}
+
+// update records the progress of a table, as engine.Options.Progress.
+func (p *progressReporter) update(t *ddl.Table, done, total int64) {
+	p.mu.Lock()
+	k, ok := p.tables[t]
+	if !ok {
+		k = len(p.event.Tables)
+		p.tables[t] = k
+		p.event.Tables = append(p.event.Tables, messaging.TableProgress{Table: t.QualifiedName()})
+		p.changed = append(p.changed, false)
+	}
+	p.event.Tables[k].Rows, p.event.Tables[k].Total = done, total
+	p.changed[k] = true
+	if time.Since(p.last) < progressInterval {
+		p.mu.Unlock()
+		return
+	}
+	event := p.take()
+	p.mu.Unlock()
+	p.publish(event)
+}
+
+// flush publishes the progress not published yet.
+func (p *progressReporter) flush() {
+	p.mu.Lock()
+	event := p.take()
+	p.mu.Unlock()
+	if len(event.Tables) > 0 {
+		p.publish(event)
+	}
+}
+
+// take returns the event of the tables that advanced since the last one.
+// It is called with mu held.
+func (p *progressReporter) take() messaging.GenerationProgressEvent {
+	event := p.event
+	event.Tables = nil
+	for k, changed := range p.changed {
+		if changed {
+			event.Tables = append(event.Tables, p.event.Tables[k])
+			p.changed[k] = false
+		}
+	}
+	p.last = time.Now()
+	return event
+}
+
+func (p *progressReporter) publish(event messaging.GenerationProgressEvent) {
+	if err := p.s.publish(event.ProjectID, contracts.GenerationProgressRoutingKey, event); err != nil {
+		// progress is informational, generation goes on
+		log.Printf("Failed to publish progress of job %s: %v", event.JobID, err)
+	}
+}
+
+// publishStatus publishes a started, completed or failed event of a job.
+func (s *generatorServer) publishStatus(projectID, routingKey string, event any) {
+	if err := s.publish(projectID, routingKey, event); err != nil {
+		log.Printf("Failed to publish status of project %s: %v", projectID, err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package sandbox loads generated datasets into a PostgreSQL schema of
+// their own, where they can be queried.
+package sandbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/services/generator/output"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+	"github.com/lib/pq"
+)
+
+// Prefix starts the names of sandbox schemas.
+const Prefix = "sandbox_"
+
+// maxIdentLen is the longest identifier PostgreSQL keeps whole.
+const maxIdentLen = 63
+
+// SchemaName returns the schema of a project's sandbox.
+func SchemaName(projectID string) string {
+	name := Prefix + strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			return c
+		case c >= 'A' && c <= 'Z':
+			return c + 'a' - 'A'
+		}
+		return '_'
+	}, projectID)
+	return name[:min(len(name), maxIdentLen)]
+}
+
+// Options shape a sandbox load.
+type Options struct {
+	// Replica sets session_replication_role to replica while loading, which
+	// skips triggers and foreign key checks but needs superuser rights.
+	Replica bool
+}
+
+// Loader is a sink that loads a dataset into a sandbox schema as it is
+// generated. Everything runs in one transaction, so a failure leaves the
+// database as it was.
+type Loader struct {
+	ctx       context.Context
+	tx        *sql.Tx
+	schema    string
+	committed bool
+	// stmt copies the rows of the current table, insert adds them when
+	// its columns are all left to the database
+	stmt   *sql.Stmt
+	cols   []int
+	insert string
+	args   []any
+}
+
+// NewLoader creates schema, replacing an earlier one of the same name, and
+// applies the DDL the dataset is generated from in it. Close must be
+// called once generation ends, whether it succeeded or not.
+func NewLoader(ctx context.Context, db *sql.DB, schema string, tables []*ddl.Table, ddlText string, opts Options) (*Loader, error) {
+	for _, t := range tables {
+		if t.Namespace != "" {
+			return nil, fmt.Errorf("table %q names a schema; sandboxes need unqualified table names", t.QualifiedName())
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	l := &Loader{ctx: ctx, tx: tx, schema: schema}
+
+	quoted := output.QuoteIdent(schema)
+	setup := []string{
+		"DROP SCHEMA IF EXISTS " + quoted + " CASCADE",
+		"CREATE SCHEMA " + quoted,
+		// public stays on the path for the functions of extensions
+		"SET LOCAL search_path TO " + quoted + ", public",
+	}
+	if opts.Replica {
+		setup = append(setup, "SET LOCAL session_replication_role = replica")
+	}
+	for _, stmt := range setup {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to set up schema %s: %w", schema, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, ddlText); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to apply DDL: %w", err)
+	}
+	return l, nil
+}
+
+func (l *Loader) Start(res *engine.Result) error {
+	if res.DeferConstraints {
+		_, err := l.tx.ExecContext(l.ctx, "SET CONSTRAINTS ALL DEFERRED")
+		return err
+	}
+	return nil
+}
+
+// BeginTable starts a COPY FROM STDIN of the table's rows. Values are sent
+// in PostgreSQL's text format, which the server casts to the column types.
+func (l *Loader) BeginTable(td *engine.Table) error {
+	t := td.Def
+	l.stmt, l.insert = nil, ""
+	if td.Count == 0 {
+		return nil
+	}
+	l.cols = output.LoadColumns(td)
+	if len(l.cols) == 0 {
+		// COPY needs at least one column
+		l.insert = "INSERT INTO " + output.QualifiedName(t) + " DEFAULT VALUES"
+		return nil
+	}
+
+	names := make([]string, len(l.cols))
+	for i, c := range l.cols {
+		names[i] = t.Columns[c].Name
+	}
+	stmt, err := l.tx.PrepareContext(l.ctx, pq.CopyInSchema(l.schema, t.Name, names...))
+	if err != nil {
+		return l.tableErr(td, err)
+	}
+	l.stmt = stmt
+	l.args = make([]any, len(l.cols))
+	return nil
+}
+
+func (l *Loader) WriteRows(td *engine.Table, rows [][]any) error {
+	t := td.Def
+	for _, row := range rows {
+		if l.stmt == nil {
+			if _, err := l.tx.ExecContext(l.ctx, l.insert); err != nil {
+				return l.tableErr(td, err)
+			}
+			continue
+		}
+		for i, c := range l.cols {
+			l.args[i] = text(t.Columns[c].Type, row[c])
+		}
+		if _, err := l.stmt.ExecContext(l.ctx, l.args...); err != nil {
+			return l.tableErr(td, err)
+		}
+	}
+	return nil
+}
+
+func (l *Loader) EndTable(td *engine.Table) error {
+	if l.stmt == nil {
+		return nil
+	}
+	// an Exec without arguments ends the COPY
+	_, err := l.stmt.ExecContext(l.ctx)
+	if cerr := l.stmt.Close(); err == nil {
+		err = cerr
+	}
+	l.stmt = nil
+	return l.tableErr(td, err)
+}
+
+func (l *Loader) tableErr(td *engine.Table, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("failed to load table %s: %w", td.Def.QualifiedName(), err)
+}
+
+func (l *Loader) WriteUpdate(u engine.Update) error {
+	if _, err := l.tx.ExecContext(l.ctx, output.UpdateSQL(u)); err != nil {
+		return fmt.Errorf("failed to update table %s: %w", u.Table.QualifiedName(), err)
+	}
+	return nil
+}
+
+// Finish sets the sequences the rows used and commits the load.
+func (l *Loader) Finish(res *engine.Result) error {
+	for _, seq := range res.Sequences {
+		if _, err := l.tx.ExecContext(l.ctx, output.SetvalSQL(seq)); err != nil {
+			return fmt.Errorf("failed to set sequence of %s.%s: %w", seq.Table.QualifiedName(), seq.Column, err)
+		}
+	}
+	if err := l.tx.Commit(); err != nil {
+		return err
+	}
+	l.committed = true
+	return nil
+}
+
+// Close rolls back a load that did not finish.
+func (l *Loader) Close() error {
+	if l.stmt != nil {
+		l.stmt.Close()
+		l.stmt = nil
+	}
+	if l.committed {
+		return nil
+	}
+	return l.tx.Rollback()
+}
+
+func text(t ddl.Type, v any) any {
+	if v == nil {
+		return nil
+	}
+	return values.Text(t, v)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/checkpoint"
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/engine"
+	"github.com/kacperborowieckb/gen-sql/shared/contracts"
+	"github.com/kacperborowieckb/gen-sql/shared/messaging"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// planShards publishes the layout of a job of more rows than its ShardRows
+// for the data service to split into shards, and reports whether it did.
+func (s *generatorServer) planShards(event messaging.ProjectCreatedEvent, j *job) (bool, error) {
+	layout, err := engine.Layout(j.schema, j.plan, j.opts)
+	if err != nil {
+		return false, err
+	}
+	var total int64
+	for _, tl := range layout {
+		total += tl.Rows
+	}
+	if total <= event.ShardRows {
+		return false, nil
+	}
+
+	event, err = resolvedEvent(event, j)
+	if err != nil {
+		return false, err
+	}
+
+	planned := messaging.GenerationPlannedEvent{Job: event, ShardUnit: engine.ShardRows}
+	split := 0
+	for _, tl := range layout {
+		pt := messaging.PlannedTable{Name: tl.Table.QualifiedName(), Rows: tl.Rows, Split: tl.Split}
+		for _, p := range tl.After {
+			pt.After = append(pt.After, p.QualifiedName())
+		}
+		if tl.Split {
+			split++
+		}
+		planned.Tables = append(planned.Tables, pt)
+	}
+	if err := s.publish(event.ProjectID, contracts.GenerationPlannedRoutingKey, planned); err != nil {
+		return false, err
+	}
+	log.Printf("Planned job %s of project %s: %d rows in %d tables, %d of them split into shards",
+		event.JobID, event.ProjectID, total, len(layout), split)
+	return true, nil
+}
+
+// resolvedEvent returns the event of a job with its instructions replaced
+// by the rules they resolved to, for shards of the job, or the job resumed
+// later, to follow the same rules rather than interpreting free text again.
+func resolvedEvent(event messaging.ProjectCreatedEvent, j *job) (messaging.ProjectCreatedEvent, error) {
+	event.GenerationInstructions = ""
+	if j.rules != nil {
+		data, err := json.Marshal(j.rules)
+		if err != nil {
+			return event, fmt.Errorf("failed to marshal rules: %w", err)
+		}
+		event.GenerationInstructions = string(data)
+	}
+	return event, nil
+}
+
+func (s *generatorServer) handleShard(d amqp.Delivery) error {
+	var event messaging.GenerationShardEvent
+	if err := decodeEvent(d, "GenerationShardEvent", &event); err != nil {
+		return err
+	}
+
+	what := fmt.Sprintf("shard %s of job %s", event.ShardID, event.Job.JobID)
+	ctx, stop, err := s.startJob(event.Job.JobID, event.Job.ProjectID)
+	if err != nil {
+		return interrupted(err, what)
+	}
+	defer stop()
+
+	done := messaging.GenerationShardDoneEvent{JobID: event.Job.JobID, ShardID: event.ShardID, Attempt: event.Attempt}
+	if err := s.generateShard(ctx, event); err != nil {
+		if ctx.Err() != nil {
+			if errors.Is(context.Cause(ctx), errCancelled) {
+				s.removeShards(event.Job)
+			}
+			return interrupted(context.Cause(ctx), what)
+		}
+		log.Printf("Failed to generate shard %s of job %s: %v", event.ShardID, event.Job.JobID, err)
+		done.Error = err.Error()
+	}
+	return s.publish(event.Job.ProjectID, contracts.GenerationShardDoneRoutingKey, done)
+}
+
+// generateShard writes the rows of a shard to the job's shards directory,
+// unless a checkpoint shows they are there already.
+func (s *generatorServer) generateShard(ctx context.Context, event messaging.GenerationShardEvent) error {
+	j, err := s.prepareJob(event.Job)
+	if err != nil {
+		return err
+	}
+	j.opts.Context = ctx
+	t := tableNamed(j.plan.Order, event.Table)
+	if t == nil {
+		return fmt.Errorf("table %q is not part of the schema", event.Table)
+	}
+	dir := s.shardsDir(event.Job)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	shard := engine.Shard{Table: t, First: event.First, Rows: event.Rows}
+	fingerprint, err := checkpoint.Fingerprint(event.Job)
+	if err != nil {
+		return err
+	}
+	c := checkpoint.Checkpoint{
+		JobID:       event.Job.JobID,
+		Table:       event.Table,
+		First:       event.First,
+		Rows:        event.Rows,
+		Seed:        event.Job.Seed,
+		Fingerprint: fingerprint,
+	}
+	if s.resumable(ctx, j, c, shard, dir) {
+		log.Printf("Rows %d to %d of table %s for job %s are generated already",
+			event.First, event.First+event.Rows, event.Table, event.Job.JobID)
+		return nil
+	}
+
+	start := time.Now()
+	progress := s.newProgress(event.Job, event.ShardID)
+	j.opts.Progress = progress.update
+	err = engine.GenerateShard(j.schema, j.plan, j.opts, shard, dir)
+	progress.flush()
+	if err != nil {
+		return err
+	}
+	s.saveCheckpoint(c)
+	log.Printf("Generated rows %d to %d of table %s for job %s in %v",
+		event.First, event.First+event.Rows, event.Table, event.Job.JobID, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (s *generatorServer) handleAssemble(d amqp.Delivery) error {
+	var event messaging.GenerationAssembleEvent
+	if err := decodeEvent(d, "GenerationAssembleEvent", &event); err != nil {
+		return err
+	}
+
+	what := fmt.Sprintf("assembly of job %s", event.Job.JobID)
+	ctx, done, err := s.startJob(event.Job.JobID, event.Job.ProjectID)
+	if err != nil {
+		return interrupted(err, what)
+	}
+	defer done()
+
+	assembled := messaging.GenerationAssembledEvent{JobID: event.Job.JobID, ProjectID: event.Job.ProjectID}
+	path, err := s.assemble(ctx, event.Job)
+	if err != nil {
+		if ctx.Err() != nil {
+			if errors.Is(context.Cause(ctx), errCancelled) {
+				s.removeShards(event.Job)
+			}
+			return interrupted(context.Cause(ctx), what)
+		}
+		log.Printf("Failed to assemble job %s of project %s: %v", event.Job.JobID, event.Job.ProjectID, err)
+		assembled.Error = err.Error()
+	}
+	assembled.Path = path
+	return s.publish(event.Job.ProjectID, contracts.GenerationAssembledRoutingKey, assembled)
+}
+
+// assemble writes the output of a sharded job from its shards and removes
+// them.
+func (s *generatorServer) assemble(ctx context.Context, event messaging.ProjectCreatedEvent) (string, error) {
+	j, err := s.prepareJob(event)
+	if err != nil {
+		return "", err
+	}
+	j.opts.Context = ctx
+	dir := s.shardsDir(event)
+	result, path, err := s.generate(ctx, event, j.plan, func(sink engine.Sink) (*engine.Result, error) {
+		return engine.Assemble(j.schema, j.plan, j.opts, dir, sink)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.report(event, result, path)
+	s.removeShards(event)
+	s.clearCheckpoints(event.JobID)
+	return path, nil
+}
+
+// removeShards removes the shards directory of a job.
+func (s *generatorServer) removeShards(event messaging.ProjectCreatedEvent) {
+	if err := os.RemoveAll(s.shardsDir(event)); err != nil {
+		log.Printf("Failed to remove shards of job %s: %v", event.JobID, err)
+	}
+}
+
+// shardsDir is where the shards of a job are written, under the project's
+// output directory. Generators working on the job must share it.
+func (s *generatorServer) shardsDir(event messaging.ProjectCreatedEvent) string {
+	return filepath.Join(s.outputDir, filepath.Base(event.ProjectID), "shards-"+filepath.Base(event.JobID))
+}
+
+// tableNamed returns the table of the given qualified name.
+func tableNamed(tables []*ddl.Table, name string) *ddl.Table {
+	for _, t := range tables {
+		if t.QualifiedName() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// publish sends an event of a project to the projects exchange.
+func (s *generatorServer) publish(projectID, routingKey string, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", routingKey, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg := contracts.AmqpMessage{OwnerId: projectID, Data: data}
+	if err := s.mqClient.PublishMessage(ctx, messaging.ProjectsExchange, routingKey, msg); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", routingKey, err)
+	}
+	return nil
+}
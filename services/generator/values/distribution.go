@@ -0,0 +1,198 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Distribution shapes where values fall within a range instead of spreading
+// them evenly. Its parameters are in the units of the range: the values
+// themselves for numeric columns, days for dates and timestamps, and
+// positions of parent rows for foreign keys.
+type Distribution struct {
+	// Kind is uniform, normal, lognormal, exponential, zipf, hotspot or
+	// histogram.
+	Kind string
+	// Mean and StdDev describe normal and lognormal distributions. Dates
+	// have no natural zero, so for them the mean counts from the start of
+	// the range.
+	Mean, StdDev float64
+	// Rate is the rate of exponential distributions, which fall off from
+	// the start of the range.
+	Rate float64
+	// Exponent is the s of Zipf distributions: the k-th unit from the
+	// start of the range is drawn in proportion to 1/k^s.
+	Exponent float64
+	// Hot is the share of the range, from its start, that receives Share
+	// of the values in hotspot distributions.
+	Hot, Share float64
+	Buckets    []DistributionBucket
+}
+
+// DistributionBucket is one histogram bar covering [Lo, Hi].
+type DistributionBucket struct {
+	Lo, Hi, Weight float64
+}
+
+// Sample draws a point of [lo, hi]. Draws outside the range, such as the
+// tails of a normal distribution, are repeated a number of times and then
+// clamped. origin is where the mean of normal and lognormal distributions
+// counts from.
+func (d *Distribution) Sample(r *rand.Rand, lo, hi, origin float64) float64 {
+	if hi <= lo {
+		return lo
+	}
+	var x float64
+	for attempt := 0; attempt < 64; attempt++ {
+		if x = d.draw(r, lo, hi, origin); x >= lo && x <= hi {
+			return x
+		}
+	}
+	if math.IsNaN(x) {
+		return lo
+	}
+	return min(max(x, lo), hi)
+}
+
+func (d *Distribution) draw(r *rand.Rand, lo, hi, origin float64) float64 {
+	uniform := func(a, b float64) float64 { return a + r.Float64()*(b-a) }
+	switch d.Kind {
+	case "normal":
+		return origin + d.Mean + d.StdDev*r.NormFloat64()
+	case "lognormal":
+		// Mean and StdDev are those of the values, not of their logarithm
+		sigma2 := math.Log1p(d.StdDev * d.StdDev / (d.Mean * d.Mean))
+		mu := math.Log(d.Mean) - sigma2/2
+		return origin + math.Exp(mu+math.Sqrt(sigma2)*r.NormFloat64())
+	case "exponential":
+		return lo + r.ExpFloat64()/d.Rate
+	case "zipf":
+		n := math.Floor(hi - lo)
+		if n < 1 {
+			return lo
+		}
+		return lo + float64(rand.NewZipf(r, d.Exponent, 1, uint64(min(n, 1<<53))).Uint64())
+	case "hotspot":
+		split := lo + d.Hot*(hi-lo)
+		if r.Float64() < d.Share {
+			return uniform(lo, split)
+		}
+		return uniform(split, hi)
+	case "histogram":
+		total := 0.0
+		for _, b := range d.Buckets {
+			total += b.Weight
+		}
+		w := r.Float64() * total
+		for _, b := range d.Buckets {
+			if w -= b.Weight; w < 0 {
+				return uniform(max(b.Lo, lo), min(b.Hi, hi))
+			}
+		}
+		b := d.Buckets[len(d.Buckets)-1]
+		return uniform(max(b.Lo, lo), min(b.Hi, hi))
+	}
+	return uniform(lo, hi)
+}
+
+// Spanned generators lay their range out on a line of float units, which is
+// how distributions are applied to them.
+type Spanned interface {
+	Ranged
+	// Span returns the current range in units.
+	Span() (lo, hi float64)
+	// Units converts a value of the generator's type to units.
+	Units(v any) (float64, error)
+	// At returns the value closest to x units that lies within the range.
+	At(x float64) any
+}
+
+// Distributed draws the values of a Spanned generator from Dist. Narrowing
+// it narrows the generator underneath, so CHECK constraints still hold.
+type Distributed struct {
+	Spanned
+	Dist *Distribution
+}
+
+func (g *Distributed) Generate(r *rand.Rand, _ int64) any {
+	lo, hi := g.Span()
+	origin := 0.0
+	if _, ok := g.Spanned.(*Timestamp); ok {
+		origin = lo
+	}
+	return g.At(g.Dist.Sample(r, lo, hi, origin))
+}
+
+// nearest rounds x to the closest integer in [lo, hi].
+func nearest(x float64, lo, hi int64) int64 {
+	return min(max(roundTo(math.Round(x), true), lo), hi)
+}
+
+func (g *Int) Span() (float64, float64) { return float64(g.Min), float64(g.Max) }
+
+func (g *Int) Units(v any) (float64, error) { return toFloat(v) }
+
+func (g *Int) At(x float64) any { return nearest(x, g.Min, g.Max) }
+
+func (g *Numeric) Span() (float64, float64) {
+	scale := math.Pow10(g.Scale)
+	return float64(g.Min) / scale, float64(g.Max) / scale
+}
+
+func (g *Numeric) Units(v any) (float64, error) { return toFloat(v) }
+
+func (g *Numeric) At(x float64) any {
+	return FormatScaled(nearest(x*math.Pow10(g.Scale), g.Min, g.Max), g.Scale)
+}
+
+func (g *Float) Span() (float64, float64) { return g.Min, g.Max }
+
+func (g *Float) Units(v any) (float64, error) { return toFloat(v) }
+
+func (g *Float) At(x float64) any {
+	x = min(max(x, g.Min), g.Max)
+	if rounded := math.Round(x*1e4) / 1e4; rounded >= g.Min && rounded <= g.Max {
+		x = rounded
+	}
+	if g.Bits == 32 {
+		if f := float64(float32(x)); f >= g.Min && f <= g.Max {
+			x = f
+		}
+	}
+	return x
+}
+
+const day = 24 * time.Hour
+
+// Span of dates and timestamps is in days since RangeStart.
+func (g *Timestamp) Span() (float64, float64) {
+	return float64(g.Min.Sub(RangeStart)) / float64(day), float64(g.Max.Sub(RangeStart)) / float64(day)
+}
+
+func (g *Timestamp) Units(v any) (float64, error) {
+	if s, ok := v.(string); ok {
+		t, err := ParseTime(s)
+		if err != nil {
+			return 0, err
+		}
+		v = t
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a time", v)
+	}
+	return float64(t.Sub(RangeStart)) / float64(day), nil
+}
+
+func (g *Timestamp) At(x float64) any {
+	t := RangeStart.Add(time.Duration(x * float64(day)))
+	if t.Before(g.Min) {
+		t = g.Min
+	}
+	if t.After(g.Max) {
+		t = g.Max
+	}
+	return truncate(t, g.Precision)
+}
@@ -0,0 +1,81 @@
+package values
+
+import (
+	"math"
+	"time"
+)
+
+// Finite is implemented by generators that can only produce a countable
+// number of distinct values. Generators that do not implement it are
+// treated as unbounded.
+type Finite interface {
+	Cardinality() float64
+}
+
+// Enumerable generators can also return their i-th distinct value, for i
+// in [0, Cardinality()), which lets unique columns draw without replacement.
+type Enumerable interface {
+	Finite
+	Nth(i uint64) any
+}
+
+// Unique is implemented by generators whose values never repeat within a
+// table, such as sequences.
+type Unique interface {
+	Unique() bool
+}
+
+func (g *Int) Cardinality() float64 { return float64(g.Max) - float64(g.Min) + 1 }
+func (g *Int) Nth(i uint64) any     { return g.Min + int64(i) }
+
+func (g *Numeric) Cardinality() float64 { return float64(g.Max) - float64(g.Min) + 1 }
+func (g *Numeric) Nth(i uint64) any     { return FormatScaled(g.Min+int64(i), g.Scale) }
+
+func (g *Choice) Cardinality() float64 { return float64(len(g.Values)) }
+func (g *Choice) Nth(i uint64) any     { return g.Values[i] }
+
+func (g *Bool) Cardinality() float64 { return 2 }
+func (g *Bool) Nth(i uint64) any     { return i == 1 }
+
+func (g *Sequence) Unique() bool { return true }
+
+func (g *Timestamp) Cardinality() float64 {
+	return float64(g.Max.Sub(g.Min)/g.unit()) + 1
+}
+
+func (g *Timestamp) Nth(i uint64) any {
+	return truncate(g.Min.Add(time.Duration(i)*g.unit()), g.Precision)
+}
+
+func (g *Timestamp) unit() time.Duration {
+	if g.Precision < 0 {
+		return 24 * time.Hour
+	}
+	unit := time.Second
+	for i := 0; i < min(g.Precision, 6); i++ {
+		unit /= 10
+	}
+	return unit
+}
+
+// Cardinality counts the distinct words of every allowed length, ignoring
+// the extra variety that word breaks add.
+func (g *String) Cardinality() float64 {
+	total := 0.0
+	for n := g.MinLen; n <= g.MaxLen; n++ {
+		if g.Charset != "" {
+			total += math.Pow(float64(len(g.Charset)), float64(n))
+			continue
+		}
+		total += math.Pow(float64(len(consonants)), float64((n+1)/2)) * math.Pow(float64(len(vowels)), float64(n/2))
+	}
+	return total
+}
+
+func (g *Bits) Cardinality() float64 {
+	total := 0.0
+	for n := g.MinLen; n <= g.MaxLen; n++ {
+		total += math.Pow(2, float64(n))
+	}
+	return total
+}
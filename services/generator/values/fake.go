@@ -0,0 +1,235 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fake generates realistic text of one Kind, such as names, addresses or
+// emails, in the conventions of a Locale. Values longer than MaxLen
+// characters are redrawn a few times and then cut, so they always fit
+// varchar(n).
+type Fake struct {
+	Kind   string
+	Locale *Locale
+	MaxLen int
+}
+
+// fakers build the values of every Fake kind.
+var fakers = map[string]func(r *rand.Rand, d *Locale) string{
+	"first_name": func(r *rand.Rand, d *Locale) string { return pick(r, d.FirstNames) },
+	"last_name":  func(r *rand.Rand, d *Locale) string { return pick(r, d.LastNames) },
+	"full_name":  func(r *rand.Rand, d *Locale) string { return fullName(r, d) },
+	"email": func(r *rand.Rand, d *Locale) string {
+		return userName(r, d, ".") + "@" + pick(r, d.EmailDomains)
+	},
+	"username": func(r *rand.Rand, d *Locale) string { return userName(r, d, "_") },
+	"street_address": func(r *rand.Rand, d *Locale) string {
+		number := fmt.Sprint(1 + r.IntN(250))
+		return strings.NewReplacer("{street}", pick(r, d.Streets), "{number}", number).Replace(d.AddressFormat)
+	},
+	"city":         func(r *rand.Rand, d *Locale) string { return pick(r, d.Cities) },
+	"postal_code":  func(r *rand.Rand, d *Locale) string { return d.PostalCode.Generate(r, 0).(string) },
+	"country":      func(r *rand.Rand, d *Locale) string { return country(r, d).Name },
+	"country_code": func(r *rand.Rand, d *Locale) string { return country(r, d).Code },
+	"company": func(r *rand.Rand, d *Locale) string {
+		return pick(r, d.Companies) + " " + pick(r, d.CompanySuffixes)
+	},
+	"phone": func(r *rand.Rand, d *Locale) string { return d.Phone.Generate(r, 0).(string) },
+	"iban": func(r *rand.Rand, d *Locale) string {
+		return IBAN(d.IBANCountry, d.IBANBank.Generate(r, 0).(string))
+	},
+	"national_id":   func(r *rand.Rand, d *Locale) string { return nationalID(r, d.NationalID) },
+	"currency_code": func(_ *rand.Rand, d *Locale) string { return d.Currency.Code },
+	"local_date": func(r *rand.Rand, d *Locale) string {
+		days := int(RangeEnd.Sub(RangeStart).Hours() / 24)
+		return RangeStart.AddDate(0, 0, r.IntN(days+1)).Format(d.DateLayout)
+	},
+	"domain": func(r *rand.Rand, d *Locale) string { return domain(r, d) },
+	"url": func(r *rand.Rand, d *Locale) string {
+		u := "https://www." + domain(r, d)
+		if r.IntN(2) == 0 {
+			u += "/" + pick(r, d.Words)
+		}
+		return u
+	},
+	"sentence":  func(r *rand.Rand, d *Locale) string { return sentence(r, d) },
+	"paragraph": func(r *rand.Rand, d *Locale) string { return paragraph(r, d) },
+	"slug": func(r *rand.Rand, d *Locale) string {
+		words := make([]string, 2+r.IntN(3))
+		for i := range words {
+			words[i] = pick(r, d.Words)
+		}
+		return strings.Join(words, "-")
+	},
+	"color": func(r *rand.Rand, _ *Locale) string { return fmt.Sprintf("#%06x", r.IntN(1<<24)) },
+}
+
+// IsFakeKind reports whether kind is a Fake kind.
+func IsFakeKind(kind string) bool {
+	_, ok := fakers[kind]
+	return ok
+}
+
+func (g *Fake) Generate(r *rand.Rand, _ int64) any {
+	fake := fakers[g.Kind]
+	var s string
+	for attempt := 0; attempt < 8; attempt++ {
+		s = fake(r, g.Locale)
+		if g.MaxLen <= 0 || utf8.RuneCountInString(s) <= g.MaxLen {
+			return s
+		}
+	}
+	return string([]rune(s)[:g.MaxLen])
+}
+
+// Cardinality counts the values of kinds that only combine dictionary
+// entries, which run out quickly for unique columns.
+func (g *Fake) Cardinality() float64 {
+	d := g.Locale
+	switch g.Kind {
+	case "first_name":
+		return float64(len(d.FirstNames))
+	case "last_name":
+		return float64(len(d.LastNames))
+	case "full_name":
+		return float64(len(d.FirstNames) * len(d.LastNames))
+	case "city":
+		return float64(len(d.Cities))
+	case "country", "country_code":
+		return float64(len(d.Countries) + 1)
+	case "company":
+		return float64(len(d.Companies) * len(d.CompanySuffixes))
+	case "street_address":
+		return float64(250 * len(d.Streets))
+	case "currency_code":
+		return 1
+	}
+	return math.Inf(1)
+}
+
+func pick(r *rand.Rand, list []string) string {
+	return list[r.IntN(len(list))]
+}
+
+// userName combines a first and last name in one of the usual ways, with a
+// number often appended so that large tables stay mostly unique.
+func userName(r *rand.Rand, d *Locale, sep string) string {
+	first := ASCII(strings.ToLower(pick(r, d.FirstNames)))
+	last := ASCII(strings.ToLower(pick(r, d.LastNames)))
+	var s string
+	switch r.IntN(4) {
+	case 0:
+		s = first + sep + last
+	case 1:
+		s = first + last
+	case 2:
+		s = first[:1] + last
+	default:
+		s = last + sep + first
+	}
+	if r.IntN(2) == 0 {
+		s += fmt.Sprint(1 + r.IntN(9999))
+	}
+	return s
+}
+
+var tlds = []string{"com", "net", "org", "io", "co"}
+
+// fullName pairs a first and a last name, in the feminine form when the
+// locale has one and the first name is female.
+func fullName(r *rand.Rand, d *Locale) string {
+	last := pick(r, d.LastNames)
+	if len(d.FemaleFirstNames) == 0 || len(d.MaleFirstNames) == 0 {
+		return pick(r, d.FirstNames) + " " + last
+	}
+	if r.IntN(2) == 0 {
+		return pick(r, d.MaleFirstNames) + " " + last
+	}
+	// the longest matching ending wins, so that packs can list both -ki
+	// and -ski
+	ending := ""
+	for masculine := range d.LastNameFeminine {
+		if strings.HasSuffix(last, masculine) && len(masculine) > len(ending) {
+			ending = masculine
+		}
+	}
+	if ending != "" {
+		last = strings.TrimSuffix(last, ending) + d.LastNameFeminine[ending]
+	}
+	return pick(r, d.FemaleFirstNames) + " " + last
+}
+
+// country returns the locale's own country most of the time.
+func country(r *rand.Rand, d *Locale) Country {
+	if r.IntN(5) > 0 {
+		return d.Country
+	}
+	return d.Countries[r.IntN(len(d.Countries))]
+}
+
+var asciiFolds = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n", "ó", "o", "ś", "s", "ź", "z", "ż", "z",
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "é", "e", "è", "e", "á", "a", "í", "i", "ú", "u", "ñ", "n",
+	" ", "", "-", "", "'", "",
+)
+
+// ASCII folds the letters of lower-case names to ASCII for emails, user
+// names and domains, e.g. "łukasz" to "lukasz" and "müller" to "mueller".
+// Other characters outside ASCII are dropped.
+func ASCII(s string) string {
+	s = asciiFolds.Replace(s)
+	return strings.Map(func(c rune) rune {
+		if c > unicode.MaxASCII {
+			return -1
+		}
+		return c
+	}, s)
+}
+
+func domain(r *rand.Rand, d *Locale) string {
+	name := ASCII(strings.ToLower(pick(r, d.Companies)))
+	if r.IntN(2) == 0 {
+		name += pick(r, d.Words)
+	}
+	return name + "." + pick(r, tlds)
+}
+
+func sentence(r *rand.Rand, d *Locale) string {
+	words := make([]string, 4+r.IntN(9))
+	for i := range words {
+		words[i] = pick(r, d.Words)
+	}
+	first, size := utf8.DecodeRuneInString(words[0])
+	words[0] = string(unicode.ToUpper(first)) + words[0][size:]
+	return strings.Join(words, " ") + "."
+}
+
+func paragraph(r *rand.Rand, d *Locale) string {
+	sentences := make([]string, 2+r.IntN(4))
+	for i := range sentences {
+		sentences[i] = sentence(r, d)
+	}
+	return strings.Join(sentences, " ")
+}
+
+// IBAN returns the IBAN of a country and basic bank account number, with
+// the check digits computed as in ISO 13616.
+func IBAN(country, bban string) string {
+	var num strings.Builder
+	for _, c := range bban + country + "00" {
+		if c >= 'A' && c <= 'Z' {
+			fmt.Fprint(&num, int(c-'A')+10)
+		} else {
+			num.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(num.String(), 10)
+	check := 98 - new(big.Int).Mod(n, big.NewInt(97)).Int64()
+	return fmt.Sprintf("%s%02d%s", country, check, bban)
+}
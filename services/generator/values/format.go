@@ -0,0 +1,113 @@
+package values
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Text renders a non-NULL value in the PostgreSQL text input format of
+// type t. Output writers build on it for SQL literals, COPY and CSV.
+func Text(t ddl.Type, v any) string {
+	if t.ArrayDims > 0 {
+		if arr, ok := v.([]any); ok {
+			return arrayText(t.Elem(), arr)
+		}
+	}
+
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case Decimal:
+		return string(v)
+	case float64:
+		bits := 64
+		if t.Name == "real" {
+			bits = 32
+		}
+		return strconv.FormatFloat(v, 'f', -1, bits)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case string:
+		return v
+	case JSON:
+		return string(v)
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	case time.Time:
+		switch t.Name {
+		case "date":
+			return v.Format("2006-01-02")
+		case "timestamptz":
+			return v.Format("2006-01-02 15:04:05.999999-07:00")
+		default:
+			return v.Format("2006-01-02 15:04:05.999999")
+		}
+	case time.Duration:
+		s := clockText(v)
+		if t.Name == "timetz" {
+			s += "+00"
+		}
+		return s
+	case Interval:
+		return fmt.Sprintf("%d mons %d days %s", v.Months, v.Days, clockText(time.Duration(v.Micros)*time.Microsecond))
+	}
+	return fmt.Sprint(v)
+}
+
+func clockText(d time.Duration) string {
+	neg := d < 0
+	if neg {
+		d = -d
+	}
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	d -= s * time.Second
+
+	out := fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	if d > 0 {
+		frac := fmt.Sprintf("%06d", d/time.Microsecond)
+		out += "." + strings.TrimRight(frac, "0")
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+func arrayText(elem ddl.Type, arr []any) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range arr {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		switch v := v.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case []any:
+			sb.WriteString(arrayText(elem, v))
+		default:
+			sb.WriteString(quoteArrayElem(Text(elem, v)))
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func quoteArrayElem(s string) string {
+	if s != "" && !strings.EqualFold(s, "null") && !strings.ContainsAny(s, "{}\",\\ \t\n\r") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
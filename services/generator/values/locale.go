@@ -0,0 +1,314 @@
+package values
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales
+var localeFS embed.FS
+
+// DefaultLocale is the locale of columns without one.
+const DefaultLocale = "en_US"
+
+// Locale is a data pack that makes generated text look local: the word
+// lists names, addresses and lorem text are built from, and the formats of
+// postal codes, phone numbers, national IDs, IBANs, currencies and dates.
+//
+// A pack is a directory named after the locale tag, e.g. pl_PL, holding a
+// locale.yaml with the formats and one text file per word list, one entry
+// per line. Lists and formats a pack leaves out are taken from en_US.
+type Locale struct {
+	Tag  string
+	Name string
+
+	FirstNames       []string
+	FemaleFirstNames []string
+	MaleFirstNames   []string
+	LastNames        []string
+	Streets          []string
+	Cities           []string
+	Companies        []string
+	CompanySuffixes  []string
+	Words            []string
+	EmailDomains     []string
+	Countries        []Country
+
+	// Country is the locale's own country, most country columns get it.
+	Country  Country
+	Currency Currency
+	// DateLayout formats dates stored as text, in Go's time layout.
+	DateLayout string
+	// AddressFormat builds street addresses from {street} and {number}.
+	AddressFormat string
+	PostalCode    *Pattern
+	Phone         *Pattern
+	// NationalID names the algorithm of national identification numbers:
+	// pesel, ssn or de_tax_id.
+	NationalID  string
+	IBANCountry string
+	IBANBank    *Pattern
+	// LastNameFeminine maps endings of last names to their feminine form,
+	// e.g. Kowalski to Kowalska, for locales where they differ.
+	LastNameFeminine map[string]string
+}
+
+// Country is a country name with its ISO 3166 alpha-2 code.
+type Country struct {
+	Code string `yaml:"code"`
+	Name string `yaml:"name"`
+}
+
+// Currency is an ISO 4217 currency code and its symbol.
+type Currency struct {
+	Code   string `yaml:"code"`
+	Symbol string `yaml:"symbol"`
+}
+
+// localeFile is the format of locale.yaml.
+type localeFile struct {
+	Name          string   `yaml:"name"`
+	Country       Country  `yaml:"country"`
+	Currency      Currency `yaml:"currency"`
+	DateLayout    string   `yaml:"dateLayout"`
+	AddressFormat string   `yaml:"addressFormat"`
+	PostalCode    string   `yaml:"postalCode"`
+	Phone         string   `yaml:"phone"`
+	NationalID    string   `yaml:"nationalId"`
+	IBAN          struct {
+		Country string `yaml:"country"`
+		BBAN    string `yaml:"bban"`
+	} `yaml:"iban"`
+	LastNameFeminine map[string]string `yaml:"lastNameFeminine"`
+}
+
+var nationalIDs = []string{"pesel", "ssn", "de_tax_id"}
+
+var (
+	localesMu sync.RWMutex
+	locales   = mustLoadEmbedded()
+)
+
+func mustLoadEmbedded() map[string]*Locale {
+	sub, err := fs.Sub(localeFS, "locales")
+	if err != nil {
+		panic(err)
+	}
+	base, err := loadLocale(sub, DefaultLocale, nil)
+	if err != nil {
+		panic(err)
+	}
+	loaded, err := loadLocales(sub, base)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// LoadLocales adds the packs found in the subdirectories of fsys, which
+// replace embedded packs of the same tag. It is how new locales are added
+// without recompiling.
+func LoadLocales(fsys fs.FS) error {
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	loaded, err := loadLocales(fsys, locales[DefaultLocale])
+	if err != nil {
+		return err
+	}
+	for tag, loc := range loaded {
+		locales[tag] = loc
+	}
+	return nil
+}
+
+func loadLocales(fsys fs.FS, base *Locale) (map[string]*Locale, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]*Locale)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		loc, err := loadLocale(fsys, e.Name(), base)
+		if err != nil {
+			return nil, err
+		}
+		loaded[loc.Tag] = loc
+	}
+	return loaded, nil
+}
+
+// loadLocale reads the pack in directory tag of fsys. What the pack leaves
+// out is copied from base, which is nil only for en_US itself.
+func loadLocale(fsys fs.FS, tag string, base *Locale) (*Locale, error) {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("locale %s: %s", tag, fmt.Sprintf(format, args...))
+	}
+
+	var file localeFile
+	b, err := fs.ReadFile(fsys, path.Join(tag, "locale.yaml"))
+	if err != nil {
+		return nil, fail("%v", err)
+	}
+	if err := yaml.Unmarshal(b, &file); err != nil {
+		return nil, fail("locale.yaml: %v", err)
+	}
+
+	loc := &Locale{Tag: tag}
+	if base != nil {
+		*loc = *base
+		loc.Tag = tag
+	}
+
+	var errs []error
+	read := func(name string, required bool) []string {
+		b, err := fs.ReadFile(fsys, path.Join(tag, name+".txt"))
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !required:
+			return nil
+		case err != nil:
+			errs = append(errs, fail("%v", err))
+			return nil
+		}
+		l := lines(string(b))
+		if len(l) == 0 {
+			errs = append(errs, fail("%s.txt is empty", name))
+		}
+		return l
+	}
+	list := func(dst *[]string, name string) {
+		if l := read(name, base == nil); l != nil {
+			*dst = l
+		}
+	}
+
+	// first names are either one list or split by gender, which lets
+	// full names use feminine last names
+	female, male := read("female_first_names", false), read("male_first_names", false)
+	first := read("first_names", base == nil && female == nil && male == nil)
+	if female != nil || male != nil || first != nil {
+		loc.FemaleFirstNames, loc.MaleFirstNames, loc.FirstNames = female, male, first
+		if first == nil {
+			loc.FirstNames = slices.Concat(female, male)
+		}
+	}
+	list(&loc.LastNames, "last_names")
+	list(&loc.Streets, "streets")
+	list(&loc.Cities, "cities")
+	list(&loc.Companies, "companies")
+	list(&loc.CompanySuffixes, "company_suffixes")
+	list(&loc.Words, "words")
+	list(&loc.EmailDomains, "email_domains")
+	var countries []string
+	list(&countries, "countries")
+	if countries != nil {
+		loc.Countries = parseCountries(countries)
+	}
+
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&loc.Name, file.Name)
+	set(&loc.Country.Code, file.Country.Code)
+	set(&loc.Country.Name, file.Country.Name)
+	set(&loc.Currency.Code, file.Currency.Code)
+	set(&loc.Currency.Symbol, file.Currency.Symbol)
+	set(&loc.DateLayout, file.DateLayout)
+	set(&loc.AddressFormat, file.AddressFormat)
+	set(&loc.NationalID, file.NationalID)
+	set(&loc.IBANCountry, file.IBAN.Country)
+	if file.LastNameFeminine != nil {
+		loc.LastNameFeminine = file.LastNameFeminine
+	}
+
+	pattern := func(dst **Pattern, field, expr string) {
+		if expr == "" {
+			return
+		}
+		p, err := NewPattern(expr)
+		if err != nil {
+			errs = append(errs, fail("%s: %v", field, err))
+			return
+		}
+		*dst = p
+	}
+	pattern(&loc.PostalCode, "postalCode", file.PostalCode)
+	pattern(&loc.Phone, "phone", file.Phone)
+	pattern(&loc.IBANBank, "iban.bban", file.IBAN.BBAN)
+
+	if !slices.Contains(nationalIDs, loc.NationalID) {
+		errs = append(errs, fail("unknown nationalId %q, expected one of %v", loc.NationalID, nationalIDs))
+	}
+	if !strings.Contains(loc.AddressFormat, "{street}") {
+		errs = append(errs, fail("addressFormat must contain {street}"))
+	}
+	if len(loc.Country.Code) != 2 || len(loc.IBANCountry) != 2 {
+		errs = append(errs, fail("country.code and iban.country must be two-letter codes"))
+	}
+	if loc.PostalCode == nil || loc.Phone == nil || loc.IBANBank == nil || loc.DateLayout == "" || loc.Currency.Code == "" {
+		errs = append(errs, fail("postalCode, phone, iban.bban, dateLayout and currency.code are required"))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return loc, nil
+}
+
+// LookupLocale returns the pack of a locale tag. Tags are matched without
+// regard to case or to "-" and "_", so pl-PL finds pl_PL.
+func LookupLocale(tag string) (*Locale, error) {
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+	if tag == "" {
+		return locales[DefaultLocale], nil
+	}
+	want := strings.ToLower(strings.ReplaceAll(tag, "-", "_"))
+	for t, loc := range locales {
+		if strings.ToLower(t) == want {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown locale %q, expected one of %v", tag, localeTags())
+}
+
+func localeTags() []string {
+	tags := make([]string, 0, len(locales))
+	for t := range locales {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// parseCountries reads lines of a country code followed by its name.
+func parseCountries(lines []string) []Country {
+	out := make([]Country, len(lines))
+	for i, l := range lines {
+		code, name, _ := strings.Cut(l, " ")
+		out[i] = Country{Code: code, Name: strings.TrimSpace(name)}
+	}
+	return out
+}
+
+// lines splits text into trimmed, non-empty lines.
+func lines(text string) []string {
+	var out []string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// JSON is a serialised json or jsonb document.
+type JSON string
+
+// Bool generates true with probability TrueRatio.
+type Bool struct {
+	TrueRatio float64
+}
+
+func (g *Bool) Generate(r *rand.Rand, _ int64) any {
+	return r.Float64() < g.TrueRatio
+}
+
+// Bytes generates byte strings of MinLen to MaxLen bytes.
+type Bytes struct {
+	MinLen, MaxLen int
+}
+
+func (g *Bytes) Generate(r *rand.Rand, _ int64) any {
+	n := g.MinLen
+	if g.MaxLen > g.MinLen {
+		n += r.IntN(g.MaxLen - g.MinLen + 1)
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.IntN(256))
+	}
+	return b
+}
+
+// Document generates small flat JSON objects.
+type Document struct{}
+
+func (Document) Generate(r *rand.Rand, row int64) any {
+	return JSON(fmt.Sprintf(`{"id": %d, "active": %t, "label": %q, "score": %d}`,
+		row+1, r.IntN(2) == 1, Word(r, 4+r.IntN(8)), r.IntN(100)))
+}
+
+// Array generates arrays of Dims dimensions. Multi-dimensional arrays are
+// rectangular, as PostgreSQL requires.
+type Array struct {
+	Elem   Generator
+	Dims   int
+	MaxLen int
+}
+
+func (g *Array) Generate(r *rand.Rand, row int64) any {
+	lens := make([]int, g.Dims)
+	for i := range lens {
+		if g.Dims == 1 {
+			lens[i] = r.IntN(g.MaxLen + 1)
+		} else {
+			lens[i] = 1 + r.IntN(g.MaxLen)
+		}
+	}
+	return g.build(r, row, lens)
+}
+
+func (g *Array) build(r *rand.Rand, row int64, lens []int) []any {
+	out := make([]any, lens[0])
+	for i := range out {
+		if len(lens) == 1 {
+			out[i] = g.Elem.Generate(r, row)
+		} else {
+			out[i] = g.build(r, row, lens[1:])
+		}
+	}
+	return out
+}
+
+func registerMisc(r *Registry) {
+	r.Register("boolean", func(ddl.Type) (Generator, error) { return &Bool{TrueRatio: 0.5}, nil })
+	r.Register("bytea", func(ddl.Type) (Generator, error) { return &Bytes{MinLen: 8, MaxLen: 32}, nil })
+	r.Register("json", func(ddl.Type) (Generator, error) { return Document{}, nil })
+	r.Register("jsonb", func(ddl.Type) (Generator, error) { return Document{}, nil })
+}
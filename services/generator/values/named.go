@@ -0,0 +1,67 @@
+package values
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// registerNamed adds the generators that rules can select by name for any
+// column, regardless of its type.
+func registerNamed(r *Registry) {
+	r.RegisterNamed("uuid", func(ddl.Type) (Generator, error) { return UUID{}, nil })
+	r.RegisterNamed("sequence", func(ddl.Type) (Generator, error) { return &Sequence{Start: 1}, nil })
+	r.RegisterNamed("word", func(t ddl.Type) (Generator, error) {
+		return &String{MinLen: textLimit(t, 4), MaxLen: textLimit(t, 10), Limit: typeLimit(t)}, nil
+	})
+	r.RegisterNamed("words", func(t ddl.Type) (Generator, error) {
+		return &String{MinLen: textLimit(t, 8), MaxLen: textLimit(t, 60), Limit: typeLimit(t)}, nil
+	})
+	r.RegisterNamed("alphanumeric", func(t ddl.Type) (Generator, error) {
+		return &String{MinLen: textLimit(t, 8), MaxLen: textLimit(t, 16), Charset: Alphanumeric, Limit: typeLimit(t)}, nil
+	})
+	r.RegisterNamed("json", func(ddl.Type) (Generator, error) { return Document{}, nil })
+	r.RegisterNamed(TypeGenerator, r.ForType)
+}
+
+// textLimit caps n by the length modifier of varchar(n) and char(n).
+func textLimit(t ddl.Type, n int) int {
+	if (t.Name == "varchar" || t.Name == "char") && len(t.Modifiers) > 0 {
+		return min(n, t.Modifiers[0])
+	}
+	return n
+}
+
+// typeLimit returns the length modifier of varchar(n) and char(n), 0 for
+// types without a limit.
+func typeLimit(t ddl.Type) int {
+	if (t.Name == "varchar" || t.Name == "char") && len(t.Modifiers) > 0 {
+		return t.Modifiers[0]
+	}
+	return 0
+}
+
+// RegisterNamed adds or replaces a generator that rules select by name.
+func (r *Registry) RegisterNamed(name string, f Factory) {
+	r.named[name] = f
+}
+
+// Named returns the generator registered under name for a column of type t.
+func (r *Registry) Named(name string, t ddl.Type) (Generator, error) {
+	f, ok := r.named[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q, expected one of %v", name, r.Names())
+	}
+	return f(t)
+}
+
+// Names lists the named generators in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.named))
+	for name := range r.named {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
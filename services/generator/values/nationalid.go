@@ -0,0 +1,75 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// nationalID generates an identification number of the given scheme, with
+// a valid check digit where the scheme has one.
+func nationalID(r *rand.Rand, scheme string) string {
+	switch scheme {
+	case "pesel":
+		return pesel(r)
+	case "de_tax_id":
+		return deTaxID(r)
+	}
+	return ssn(r)
+}
+
+// pesel returns a Polish PESEL: the birth date with the century encoded in
+// the month, a serial number whose last digit gives the sex, and a check
+// digit.
+func pesel(r *rand.Rand) string {
+	born := time.Date(1940, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.IntN(365*67))
+	month := int(born.Month())
+	if born.Year() >= 2000 {
+		month += 20
+	}
+	d := []byte(fmt.Sprintf("%02d%02d%02d%04d", born.Year()%100, month, born.Day(), r.IntN(10000)))
+	weights := []int{1, 3, 7, 9, 1, 3, 7, 9, 1, 3}
+	sum := 0
+	for i, w := range weights {
+		sum += int(d[i]-'0') * w
+	}
+	return string(d) + fmt.Sprint((10-sum%10)%10)
+}
+
+// ssn returns a number in the format of a US Social Security number,
+// avoiding the area numbers that are never issued.
+func ssn(r *rand.Rand) string {
+	area := 1 + r.IntN(898)
+	if area == 666 {
+		area++
+	}
+	return fmt.Sprintf("%03d-%02d-%04d", area, 1+r.IntN(99), 1+r.IntN(9999))
+}
+
+// deTaxID returns a German tax identification number: ten digits, not
+// starting with 0, in which exactly one digit occurs twice, followed by an
+// ISO 7064 MOD 11,10 check digit.
+func deTaxID(r *rand.Rand) string {
+	d := r.Perm(10)[:9]
+	if d[0] == 0 {
+		d[0], d[1] = d[1], d[0]
+	}
+	pos := 1 + r.IntN(9)
+	d = append(d[:pos], append([]int{d[1+r.IntN(8)]}, d[pos:]...)...)
+
+	product := 10
+	b := make([]byte, 0, 11)
+	for _, v := range d {
+		b = append(b, '0'+byte(v))
+		sum := (v + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (sum * 2) % 11
+	}
+	check := 11 - product
+	if check == 10 {
+		check = 0
+	}
+	return string(append(b, '0'+byte(check)))
+}
@@ -0,0 +1,69 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// UUID generates random version 4 UUIDs from the row's random source.
+type UUID struct{}
+
+func (UUID) Generate(r *rand.Rand, _ int64) any {
+	var b [16]byte
+	for i := 0; i < 16; i += 8 {
+		v := r.Uint64()
+		for j := 0; j < 8; j++ {
+			b[i+j] = byte(v >> (8 * j))
+		}
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// IPv4 generates host addresses, or network addresses with a /24 mask
+// when Network is set (cidr values must not have host bits set).
+type IPv4 struct {
+	Network bool
+}
+
+func (g *IPv4) Generate(r *rand.Rand, _ int64) any {
+	a, b, c, d := 1+r.IntN(223), r.IntN(256), r.IntN(256), 1+r.IntN(254)
+	if g.Network {
+		return fmt.Sprintf("%d.%d.%d.0/24", a, b, c)
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", a, b, c, d)
+}
+
+// MAC generates hardware addresses of Bytes (6 or 8) octets.
+type MAC struct {
+	Bytes int
+}
+
+func (g *MAC) Generate(r *rand.Rand, _ int64) any {
+	b := make([]byte, g.Bytes)
+	for i := range b {
+		b[i] = byte(r.IntN(256))
+	}
+	// locally administered, unicast
+	b[0] = (b[0] | 0x02) & 0xfe
+
+	out := make([]byte, 0, g.Bytes*3)
+	for i, v := range b {
+		if i > 0 {
+			out = append(out, ':')
+		}
+		out = fmt.Appendf(out, "%02x", v)
+	}
+	return string(out)
+}
+
+func registerNetwork(r *Registry) {
+	r.Register("uuid", func(ddl.Type) (Generator, error) { return UUID{}, nil })
+	r.Register("inet", func(ddl.Type) (Generator, error) { return &IPv4{}, nil })
+	r.Register("cidr", func(ddl.Type) (Generator, error) { return &IPv4{Network: true}, nil })
+	r.Register("macaddr", func(ddl.Type) (Generator, error) { return &MAC{Bytes: 6}, nil })
+	r.Register("macaddr8", func(ddl.Type) (Generator, error) { return &MAC{Bytes: 8}, nil })
+}
@@ -0,0 +1,151 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Decimal is an exact numeric value in its PostgreSQL text form, e.g. "-12.50".
+type Decimal string
+
+// Int generates integers in [Min, Max].
+type Int struct {
+	Min, Max int64
+}
+
+func (g *Int) Generate(r *rand.Rand, _ int64) any {
+	if g.Min >= g.Max {
+		return g.Min
+	}
+	span := uint64(g.Max - g.Min)
+	if span == math.MaxUint64 {
+		return int64(r.Uint64())
+	}
+	return g.Min + int64(r.Uint64N(span+1))
+}
+
+// Sequence generates Start, Start+1, ... by row index, like a serial column.
+type Sequence struct {
+	Start int64
+}
+
+func (g *Sequence) Generate(_ *rand.Rand, row int64) any {
+	return g.Start + row
+}
+
+// Numeric generates decimals with at most Precision significant digits and
+// exactly Scale fractional digits, within [Min, Max] in units of 10^-Scale.
+type Numeric struct {
+	Precision, Scale int
+	Min, Max         int64
+}
+
+func NewNumeric(precision, scale int) *Numeric {
+	digits := min(precision, 18)
+	return &Numeric{
+		Precision: precision,
+		Scale:     scale,
+		Min:       0,
+		Max:       int64(math.Pow10(digits)) - 1,
+	}
+}
+
+func (g *Numeric) Generate(r *rand.Rand, _ int64) any {
+	m := (&Int{Min: g.Min, Max: g.Max}).Generate(r, 0).(int64)
+	return FormatScaled(m, g.Scale)
+}
+
+// FormatScaled renders the integer m scaled by 10^-scale as a Decimal.
+func FormatScaled(m int64, scale int) Decimal {
+	neg := m < 0
+	digits := strconv.FormatUint(absUint(m), 10)
+
+	switch {
+	case scale <= 0:
+		if digits != "0" {
+			digits += strings.Repeat("0", -scale)
+		}
+	default:
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+
+	if neg {
+		return Decimal("-" + digits)
+	}
+	return Decimal(digits)
+}
+
+func absUint(m int64) uint64 {
+	if m < 0 {
+		return uint64(-(m + 1)) + 1
+	}
+	return uint64(m)
+}
+
+// Float generates floating point values in [Min, Max). With Bits == 32 the
+// values are rounded to single precision so they survive a round trip.
+type Float struct {
+	Min, Max float64
+	Bits     int
+}
+
+func (g *Float) Generate(r *rand.Rand, _ int64) any {
+	v := g.Min + r.Float64()*(g.Max-g.Min)
+	// keep a readable number of digits
+	v = math.Round(v*1e4) / 1e4
+	if g.Bits == 32 {
+		return float64(float32(v))
+	}
+	return v
+}
+
+func registerNumeric(r *Registry) {
+	intRange := func(lo, hi int64) Factory {
+		return func(ddl.Type) (Generator, error) { return &Int{Min: lo, Max: hi}, nil }
+	}
+	sequence := func(ddl.Type) (Generator, error) { return &Sequence{Start: 1}, nil }
+
+	r.Register("smallint", intRange(math.MinInt16, math.MaxInt16))
+	r.Register("integer", intRange(math.MinInt32, math.MaxInt32))
+	r.Register("bigint", intRange(math.MinInt64, math.MaxInt64))
+	r.Register("smallserial", sequence)
+	r.Register("serial", sequence)
+	r.Register("bigserial", sequence)
+
+	r.Register("numeric", func(t ddl.Type) (Generator, error) {
+		switch len(t.Modifiers) {
+		case 0:
+			// unconstrained numeric, keep values readable
+			return NewNumeric(12, 2), nil
+		case 1:
+			return numericFor(t.Modifiers[0], 0)
+		default:
+			return numericFor(t.Modifiers[0], t.Modifiers[1])
+		}
+	})
+
+	r.Register("real", func(ddl.Type) (Generator, error) { return &Float{Min: 0, Max: 1e6, Bits: 32}, nil })
+	r.Register("double precision", func(ddl.Type) (Generator, error) { return &Float{Min: 0, Max: 1e6, Bits: 64}, nil })
+
+	r.Register("money", func(ddl.Type) (Generator, error) {
+		return &Numeric{Precision: 10, Scale: 2, Min: 0, Max: 100_000_000}, nil
+	})
+}
+
+func numericFor(precision, scale int) (Generator, error) {
+	if precision < 1 || precision > 1000 {
+		return nil, fmt.Errorf("NUMERIC precision %d must be between 1 and 1000", precision)
+	}
+	if scale < -1000 || scale > 1000 {
+		return nil, fmt.Errorf("NUMERIC scale %d must be between -1000 and 1000", scale)
+	}
+	return NewNumeric(precision, scale), nil
+}
@@ -0,0 +1,102 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxRepeat caps unbounded repetitions such as \d+ or .*
+const maxRepeat = 8
+
+// Pattern generates strings that match a regular expression.
+type Pattern struct {
+	re *syntax.Regexp
+}
+
+func NewPattern(expr string) (*Pattern, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", expr, err)
+	}
+	return &Pattern{re: re.Simplify()}, nil
+}
+
+func (g *Pattern) Generate(r *rand.Rand, _ int64) any {
+	var b strings.Builder
+	generateRegexp(&b, r, g.re)
+	return b.String()
+}
+
+func generateRegexp(b *strings.Builder, r *rand.Rand, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(classRune(r, re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(Alphanumeric[r.IntN(len(Alphanumeric))])
+	case syntax.OpCapture:
+		generateRegexp(b, r, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			generateRegexp(b, r, sub)
+		}
+	case syntax.OpAlternate:
+		generateRegexp(b, r, re.Sub[r.IntN(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		lo, hi := repeatRange(re)
+		for n := lo + r.IntN(hi-lo+1); n > 0; n-- {
+			generateRegexp(b, r, re.Sub[0])
+		}
+	}
+	// anchors, word boundaries and empty matches produce no text
+}
+
+func repeatRange(re *syntax.Regexp) (int, int) {
+	switch re.Op {
+	case syntax.OpStar:
+		return 0, maxRepeat
+	case syntax.OpPlus:
+		return 1, maxRepeat
+	case syntax.OpQuest:
+		return 0, 1
+	}
+	if re.Max < 0 {
+		return re.Min, re.Min + maxRepeat
+	}
+	return re.Min, re.Max
+}
+
+// classRune picks a rune from a character class given as lo-hi pairs,
+// preferring printable ASCII so negated classes like [^,] stay readable.
+func classRune(r *rand.Rand, ranges []rune) rune {
+	if printable := clipRanges(ranges, ' ', '~'); len(printable) > 0 {
+		ranges = printable
+	}
+	total := 0
+	for i := 0; i < len(ranges); i += 2 {
+		total += int(ranges[i+1]-ranges[i]) + 1
+	}
+	n := r.IntN(total)
+	for i := 0; i < len(ranges); i += 2 {
+		size := int(ranges[i+1]-ranges[i]) + 1
+		if n < size {
+			return ranges[i] + rune(n)
+		}
+		n -= size
+	}
+	return ranges[0]
+}
+
+func clipRanges(ranges []rune, lo, hi rune) []rune {
+	var out []rune
+	for i := 0; i < len(ranges); i += 2 {
+		a, b := max(ranges[i], lo), min(ranges[i+1], hi)
+		if a <= b {
+			out = append(out, a, b)
+		}
+	}
+	return out
+}
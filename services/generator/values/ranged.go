@@ -0,0 +1,401 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Bound is one side of a value range. Value may be an int64, float64,
+// Decimal, time.Time or a string literal of the column's type.
+type Bound struct {
+	Value     any
+	Inclusive bool
+}
+
+// Ranged generators produce ordered values and can be narrowed to a range,
+// which is how CHECK constraints such as price > 0 are honoured.
+type Ranged interface {
+	Generator
+	// Restrict narrows the generator to values within lo and hi. A nil
+	// bound leaves that side open. It fails when no value is left.
+	Restrict(lo, hi *Bound) error
+	// GenerateWithin draws a value that also lies within lo and hi, for
+	// bounds that depend on other columns of the row. It returns false
+	// when the range is empty.
+	GenerateWithin(r *rand.Rand, row int64, lo, hi *Bound) (any, bool)
+}
+
+var errEmptyRange = fmt.Errorf("no values left in range")
+
+// intRange converts bounds to an inclusive integer range in the units
+// returned by conv, intersected with [min, max].
+func intRange(lo, hi *Bound, lower, upper int64, conv func(any, bool) (int64, error)) (int64, int64, error) {
+	if lo != nil {
+		v, err := conv(lo.Value, true)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !lo.Inclusive && v < math.MaxInt64 {
+			if isExact(lo.Value, conv) {
+				v++
+			}
+		}
+		lower = max(lower, v)
+	}
+	if hi != nil {
+		v, err := conv(hi.Value, false)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !hi.Inclusive && v > math.MinInt64 {
+			if isExact(hi.Value, conv) {
+				v--
+			}
+		}
+		upper = min(upper, v)
+	}
+	if lower > upper {
+		return 0, 0, errEmptyRange
+	}
+	return lower, upper, nil
+}
+
+// isExact reports whether a bound value maps onto a whole unit, in which
+// case an exclusive bound has to step past it.
+func isExact(v any, conv func(any, bool) (int64, error)) bool {
+	up, err1 := conv(v, true)
+	down, err2 := conv(v, false)
+	return err1 == nil && err2 == nil && up == down
+}
+
+func toFloat(v any) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case Decimal:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// roundTo converts a float to an integer, rounding up for lower bounds and
+// down for upper bounds.
+func roundTo(f float64, up bool) int64 {
+	if up {
+		f = math.Ceil(f - 1e-9)
+	} else {
+		f = math.Floor(f + 1e-9)
+	}
+	switch {
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+func (g *Int) toUnits(v any, up bool) (int64, error) {
+	if i, ok := v.(int64); ok {
+		return i, nil
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	return roundTo(f, up), nil
+}
+
+func (g *Int) Restrict(lo, hi *Bound) error {
+	lower, upper, err := intRange(lo, hi, g.Min, g.Max, g.toUnits)
+	if err != nil {
+		return err
+	}
+	g.Min, g.Max = lower, upper
+	return nil
+}
+
+func (g *Int) GenerateWithin(r *rand.Rand, row int64, lo, hi *Bound) (any, bool) {
+	lower, upper, err := intRange(lo, hi, g.Min, g.Max, g.toUnits)
+	if err != nil {
+		return nil, false
+	}
+	return (&Int{Min: lower, Max: upper}).Generate(r, row), true
+}
+
+func (g *Numeric) toUnits(v any, up bool) (int64, error) {
+	if i, ok := v.(int64); ok && g.Scale >= 0 && g.Scale <= 18 {
+		scaled := i * int64(math.Pow10(g.Scale))
+		if scaled/int64(math.Pow10(g.Scale)) == i {
+			return scaled, nil
+		}
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	return roundTo(f*math.Pow10(g.Scale), up), nil
+}
+
+func (g *Numeric) Restrict(lo, hi *Bound) error {
+	lower, upper, err := intRange(lo, hi, g.Min, g.Max, g.toUnits)
+	if err != nil {
+		return err
+	}
+	g.Min, g.Max = lower, upper
+	return nil
+}
+
+func (g *Numeric) GenerateWithin(r *rand.Rand, row int64, lo, hi *Bound) (any, bool) {
+	lower, upper, err := intRange(lo, hi, g.Min, g.Max, g.toUnits)
+	if err != nil {
+		return nil, false
+	}
+	return (&Numeric{Precision: g.Precision, Scale: g.Scale, Min: lower, Max: upper}).Generate(r, row), true
+}
+
+func (g *Float) floatRange(lo, hi *Bound) (float64, float64, error) {
+	lower, upper := g.Min, g.Max
+	if lo != nil {
+		v, err := toFloat(lo.Value)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !lo.Inclusive {
+			v = math.Nextafter(v, math.Inf(1))
+		}
+		lower = max(lower, v)
+	}
+	if hi != nil {
+		v, err := toFloat(hi.Value)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !hi.Inclusive {
+			v = math.Nextafter(v, math.Inf(-1))
+		}
+		upper = min(upper, v)
+	}
+	if lower > upper {
+		return 0, 0, errEmptyRange
+	}
+	return lower, upper, nil
+}
+
+func (g *Float) Restrict(lo, hi *Bound) error {
+	lower, upper, err := g.floatRange(lo, hi)
+	if err != nil {
+		return err
+	}
+	g.Min, g.Max = lower, upper
+	return nil
+}
+
+func (g *Float) GenerateWithin(r *rand.Rand, _ int64, lo, hi *Bound) (any, bool) {
+	lower, upper, err := g.floatRange(lo, hi)
+	if err != nil {
+		return nil, false
+	}
+	// rounding must not push the value back out of the range
+	v := lower + r.Float64()*(upper-lower)
+	if rounded := math.Round(v*1e4) / 1e4; rounded >= lower && rounded <= upper {
+		v = rounded
+	}
+	if g.Bits == 32 {
+		if f := float64(float32(v)); f >= lower && f <= upper {
+			v = f
+		}
+	}
+	return v, true
+}
+
+func (g *Timestamp) toUnits(v any, up bool) (int64, error) {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := ParseTime(v)
+		if err != nil {
+			return 0, err
+		}
+		t = parsed
+	default:
+		return 0, fmt.Errorf("%v is not a time", v)
+	}
+	unit := int64(g.unit())
+	d := t.Sub(RangeStart)
+	if up {
+		return int64(math.Ceil(float64(d) / float64(unit))), nil
+	}
+	return int64(math.Floor(float64(d) / float64(unit))), nil
+}
+
+func (g *Timestamp) Restrict(lo, hi *Bound) error {
+	lower, upper, err := g.unitRange(lo, hi)
+	if err != nil {
+		return err
+	}
+	unit := g.unit()
+	g.Min = RangeStart.Add(time.Duration(lower) * unit)
+	g.Max = RangeStart.Add(time.Duration(upper) * unit)
+	return nil
+}
+
+func (g *Timestamp) unitRange(lo, hi *Bound) (int64, int64, error) {
+	unit := int64(g.unit())
+	minUnits := int64(math.Ceil(float64(g.Min.Sub(RangeStart)) / float64(unit)))
+	maxUnits := int64(math.Floor(float64(g.Max.Sub(RangeStart)) / float64(unit)))
+	return intRange(lo, hi, minUnits, maxUnits, g.toUnits)
+}
+
+func (g *Timestamp) GenerateWithin(r *rand.Rand, _ int64, lo, hi *Bound) (any, bool) {
+	lower, upper, err := g.unitRange(lo, hi)
+	if err != nil {
+		return nil, false
+	}
+	n := lower + r.Int64N(upper-lower+1)
+	return RangeStart.Add(time.Duration(n) * g.unit()), true
+}
+
+// Override replaces the default range of gen by lo and hi. Unlike
+// Restrict, the new range may reach past the default one, up to the limits
+// of type t. A nil bound keeps the default on its side unless that leaves
+// no values.
+func Override(gen Ranged, t ddl.Type, lo, hi *Bound) error {
+	widen := func(low, high bool) {
+		switch g := gen.(type) {
+		case *Int:
+			lower, upper := intLimits(t.Name)
+			if low {
+				g.Min = lower
+			}
+			if high {
+				g.Max = upper
+			}
+		case *Numeric:
+			limit := int64(math.Pow10(min(g.Precision, 18))) - 1
+			if low {
+				g.Min = -limit
+			}
+			if high {
+				g.Max = limit
+			}
+		case *Float:
+			if low {
+				g.Min = -1e15
+			}
+			if high {
+				g.Max = 1e15
+			}
+		case *Timestamp:
+			// time.Duration spans about 290 years, which Generate relies on
+			if low {
+				g.Min = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+			}
+			if high {
+				g.Max = time.Date(2100, 12, 31, 23, 59, 59, 0, time.UTC)
+			}
+		}
+	}
+
+	widen(lo != nil, hi != nil)
+	if err := gen.Restrict(lo, hi); err == nil || (lo != nil && hi != nil) {
+		return err
+	}
+	widen(true, true)
+	return gen.Restrict(lo, hi)
+}
+
+func intLimits(typeName string) (int64, int64) {
+	switch typeName {
+	case "smallint":
+		return math.MinInt16, math.MaxInt16
+	case "integer":
+		return math.MinInt32, math.MaxInt32
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999-07:00",
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02T15:04:05.999999Z07:00",
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02",
+}
+
+// ParseTime parses a date or timestamp literal.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date/time literal %q", s)
+}
+
+// Coerce converts a constant from an expression, such as an element of an
+// IN list, to the value representation used for type t.
+func Coerce(t ddl.Type, v any) (any, error) {
+	if v == nil || t.ArrayDims > 0 {
+		return v, nil
+	}
+	if i, ok := v.(int); ok {
+		v = int64(i)
+	}
+	switch t.Name {
+	case "smallint", "integer", "bigint", "serial", "bigserial", "smallserial":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case string:
+			return strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+		}
+	case "numeric", "money":
+		switch x := v.(type) {
+		case int64:
+			return Decimal(strconv.FormatInt(x, 10)), nil
+		case float64:
+			return Decimal(strconv.FormatFloat(x, 'f', -1, 64)), nil
+		case string:
+			if _, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+				return nil, err
+			}
+			return Decimal(strings.TrimSpace(x)), nil
+		}
+	case "real", "double precision":
+		return toFloat(v)
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+	case "date", "timestamp", "timestamptz":
+		switch x := v.(type) {
+		case time.Time:
+			return x, nil
+		case string:
+			return ParseTime(x)
+		}
+	default:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(v), nil
+	}
+	return nil, fmt.Errorf("cannot use %v as %s", v, t)
+}
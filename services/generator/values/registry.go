@@ -0,0 +1,132 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Generator produces values for a single column. row is the zero-based
+// index of the row being generated, which sequence-like generators use.
+type Generator interface {
+	Generate(r *rand.Rand, row int64) any
+}
+
+// GeneratorFunc adapts a plain function to the Generator interface.
+type GeneratorFunc func(r *rand.Rand, row int64) any
+
+func (f GeneratorFunc) Generate(r *rand.Rand, row int64) any {
+	return f(r, row)
+}
+
+// Factory builds a generator for a scalar type. The type's modifiers must
+// be honoured so that generated values always load.
+type Factory func(t ddl.Type) (Generator, error)
+
+// Registry maps PostgreSQL type names to generator factories.
+type Registry struct {
+	factories map[string]Factory
+	named     map[string]Factory
+	locale    *Locale
+}
+
+// NewRegistry returns a registry with generators for the built-in types and
+// for the enum types declared in schema. Named text generators follow the
+// conventions of loc, or of DefaultLocale when it is nil.
+func NewRegistry(schema *ddl.Schema, loc *Locale) *Registry {
+	if loc == nil {
+		loc, _ = LookupLocale(DefaultLocale)
+	}
+	r := &Registry{factories: make(map[string]Factory), named: make(map[string]Factory), locale: loc}
+
+	registerNumeric(r)
+	registerText(r)
+	registerTemporal(r)
+	registerNetwork(r)
+	registerMisc(r)
+	registerNamed(r)
+	registerSemantic(r)
+
+	if schema != nil {
+		for _, e := range schema.Enums {
+			gen := &Choice{Values: toAny(e.Values)}
+			f := func(ddl.Type) (Generator, error) { return gen, nil }
+			r.Register(e.Name, f)
+			r.Register(e.QualifiedName(), f)
+		}
+	}
+
+	return r
+}
+
+// Register adds or replaces the factory for a type name.
+func (r *Registry) Register(typeName string, f Factory) {
+	r.factories[typeName] = f
+}
+
+// ForType returns a generator for the given type, wrapping the element
+// generator for array types.
+func (r *Registry) ForType(t ddl.Type) (Generator, error) {
+	f, ok := r.factories[t.Name]
+	if !ok {
+		return nil, fmt.Errorf("no value generator for type %q", t.Name)
+	}
+
+	gen, err := f(t.Elem())
+	if err != nil {
+		return nil, fmt.Errorf("type %s: %w", t, err)
+	}
+
+	if t.ArrayDims > 0 {
+		gen = &Array{Elem: gen, Dims: t.ArrayDims, MaxLen: 4}
+	}
+	return gen, nil
+}
+
+// ForColumn returns a generator for the column's declared type.
+func (r *Registry) ForColumn(c *ddl.Column) (Generator, error) {
+	gen, err := r.ForType(c.Type)
+	if err != nil {
+		return nil, fmt.Errorf("column %q: %w", c.Name, err)
+	}
+	return gen, nil
+}
+
+// Choice picks from a fixed list of values, uniformly unless it was made
+// by NewWeightedChoice.
+type Choice struct {
+	Values []any
+	// cumulative weights of Values, nil for a uniform choice
+	cum []float64
+}
+
+// NewWeightedChoice returns a Choice that picks values[i] with a
+// probability proportional to weights[i].
+func NewWeightedChoice(values []any, weights []float64) *Choice {
+	g := &Choice{Values: values, cum: make([]float64, len(weights))}
+	total := 0.0
+	for i, w := range weights {
+		total += w
+		g.cum[i] = total
+	}
+	return g
+}
+
+func (g *Choice) Generate(r *rand.Rand, _ int64) any {
+	if g.cum == nil {
+		return g.Values[r.IntN(len(g.Values))]
+	}
+	x := r.Float64() * g.cum[len(g.cum)-1]
+	i := sort.Search(len(g.cum), func(i int) bool { return g.cum[i] > x })
+	return g.Values[min(i, len(g.Values)-1)]
+}
+
+func toAny[T any](vals []T) []any {
+	out := make([]any, len(vals))
+	for i, v := range vals {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package values_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+	"github.com/kacperborowieckb/gen-sql/services/generator/values"
+)
+
+func TestForColumn(t *testing.T) {
+	schema, err := ddl.Parse(`
+CREATE TYPE mood AS ENUM ('sad', 'happy');
+CREATE DOMAIN posint AS smallint CHECK (VALUE > 0);
+CREATE TABLE t (s smallint, qty posint, feeling mood);
+`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	registry := values.NewRegistry(schema, nil)
+
+	tests := []struct {
+		column string
+		ok     func(v any) bool
+	}{
+		{"s", func(v any) bool { n, ok := v.(int64); return ok && n >= math.MinInt16 && n <= math.MaxInt16 }},
+		{"qty", func(v any) bool { n, ok := v.(int64); return ok && n >= math.MinInt16 && n <= math.MaxInt16 }},
+		{"feeling", func(v any) bool { return v == "sad" || v == "happy" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			gen, err := registry.ForColumn(schema.Table("t").Column(tt.column))
+			if err != nil {
+				t.Fatalf("ForColumn: %v", err)
+			}
+			r := rand.New(rand.NewPCG(1, 2))
+			negative := false
+			for row := int64(0); row < 1000; row++ {
+				v := gen.Generate(r, row)
+				if !tt.ok(v) {
+					t.Fatalf("generated %v (%T)", v, v)
+				}
+				if n, ok := v.(int64); ok && n < 0 {
+					negative = true
+				}
+			}
+			if _, isInt := gen.Generate(r, 0).(int64); isInt && !negative {
+				t.Error("no negative values generated across the signed range")
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// TypeGenerator is the name Infer returns for columns that get the
+// generator of their type. Rules can select it to turn inference off.
+const TypeGenerator = "type"
+
+// columnKinds maps normalised column names to the named generator that
+// fits them best.
+var columnKinds = map[string]string{
+	"email": "email", "email_address": "email", "mail": "email", "e_mail": "email",
+	"first_name": "first_name", "firstname": "first_name", "given_name": "first_name", "forename": "first_name",
+	"last_name": "last_name", "lastname": "last_name", "surname": "last_name", "family_name": "last_name",
+	"full_name": "full_name", "fullname": "full_name", "display_name": "full_name", "contact_name": "full_name",
+	"username": "username", "user_name": "username", "login": "username", "handle": "username", "nickname": "username",
+	"address": "street_address", "street": "street_address", "street_address": "street_address",
+	"address1": "street_address", "address_line1": "street_address", "address_line_1": "street_address",
+	"city": "city", "town": "city",
+	"zip": "postal_code", "zip_code": "postal_code", "zipcode": "postal_code",
+	"postal_code": "postal_code", "postcode": "postal_code", "post_code": "postal_code",
+	"country": "country", "country_name": "country", "country_code": "country_code", "country_iso": "country_code",
+	"company": "company", "company_name": "company", "employer": "company", "organization": "company", "organisation": "company",
+	"phone": "phone", "phone_number": "phone", "mobile": "phone", "mobile_phone": "phone",
+	"telephone": "phone", "tel": "phone", "cell_phone": "phone", "fax": "phone",
+	"iban": "iban", "bank_account": "iban",
+	"national_id": "national_id", "pesel": "national_id", "ssn": "national_id", "social_security_number": "national_id",
+	"tax_id": "national_id", "personal_id": "national_id",
+	"currency": "currency_code", "currency_code": "currency_code",
+	"url": "url", "website": "url", "web_site": "url", "homepage": "url", "link": "url",
+	"domain": "domain", "hostname": "domain",
+	"ip": "ip_address", "ip_address": "ip_address",
+	"title": "sentence", "subject": "sentence", "headline": "sentence", "summary": "sentence",
+	"description": "paragraph", "bio": "paragraph", "about": "paragraph", "comment": "paragraph",
+	"comments": "paragraph", "note": "paragraph", "notes": "paragraph", "body": "paragraph",
+	"content": "paragraph", "message": "paragraph",
+	"slug": "slug", "color": "color", "colour": "color",
+	"uuid": "uuid", "guid": "uuid",
+	"created": "recent", "updated": "recent", "modified": "recent",
+	"birth_date": "birth_date", "birthdate": "birth_date", "birthday": "birth_date",
+	"date_of_birth": "birth_date", "dob": "birth_date", "born_at": "birth_date", "born_on": "birth_date",
+	"age": "age", "latitude": "latitude", "lat": "latitude",
+	"longitude": "longitude", "lng": "longitude", "lon": "longitude",
+}
+
+// columnSuffixes infer a kind from the end of a name, e.g. billing_email.
+var columnSuffixes = []struct{ suffix, kind string }{
+	{"_email", "email"},
+	{"_phone", "phone"},
+	{"_url", "url"},
+	{"_city", "city"},
+	{"_at", "recent"},
+	{"_on", "recent"},
+}
+
+// nameKinds says what a bare "name" column holds, by table name.
+var nameKinds = map[string]string{
+	"user": "full_name", "customer": "full_name", "employee": "full_name", "person": "full_name",
+	"people": "full_name", "author": "full_name", "member": "full_name", "contact": "full_name",
+	"student": "full_name", "patient": "full_name", "client": "full_name", "owner": "full_name",
+	"company": "company", "companies": "company", "organization": "company", "vendor": "company",
+	"supplier": "company", "manufacturer": "company", "publisher": "company",
+	"city": "city", "cities": "city", "country": "country", "countries": "country",
+}
+
+// minLengths are the shortest varchar(n) limits that leave realistic
+// values of a kind mostly intact. Shorter columns keep their type's
+// generator.
+var minLengths = map[string]int{
+	"email": 16, "username": 8, "full_name": 10, "street_address": 12, "company": 10,
+	"phone": 14, "iban": 22, "url": 20, "domain": 10, "ip_address": 15,
+	"sentence": 20, "paragraph": 40, "slug": 10, "postal_code": 5, "color": 7,
+	"country": 8, "country_code": 2, "uuid": 36, "national_id": 11, "currency_code": 3, "local_date": 10,
+}
+
+// fixedLength kinds always have their minimum length, so they also fit
+// char(n) columns of exactly that length.
+var fixedLength = map[string]bool{"country_code": true, "currency_code": true, "national_id": true}
+
+// Infer picks the generator for a column of table t that has no rules: a
+// named generator when the column's name and type tell what it holds, such
+// as email or created_at, otherwise the one for its type. Text follows the
+// conventions of the registry's locale. It also returns
+// the name of the picked generator, TypeGenerator in the latter case, so
+// the choice can be reviewed and overridden with a rule.
+func (r *Registry) Infer(t *ddl.Table, c *ddl.Column) (Generator, string, error) {
+	if kind := inferKind(t, c); kind != "" {
+		if gen, err := r.Named(kind, c.Type); err == nil {
+			return gen, kind, nil
+		}
+	}
+	gen, err := r.ForColumn(c)
+	return gen, TypeGenerator, err
+}
+
+func inferKind(t *ddl.Table, c *ddl.Column) string {
+	if c.Type.ArrayDims > 0 {
+		return ""
+	}
+	name := snakeCase(c.Name)
+	kind, ok := columnKinds[name]
+	if !ok && name == "name" {
+		kind = nameKinds[strings.TrimSuffix(snakeCase(t.Name), "s")]
+		if kind == "" {
+			kind = nameKinds[snakeCase(t.Name)]
+		}
+	}
+	if kind == "" {
+		for _, s := range columnSuffixes {
+			if strings.HasSuffix(name, s.suffix) {
+				kind = s.kind
+				break
+			}
+		}
+	}
+
+	switch {
+	case kind == "":
+		return ""
+	case kind == "country" && isText(c.Type) && textLimit(c.Type, 3) == 2:
+		return "country_code"
+	case (kind == "recent" || kind == "birth_date") && isText(c.Type):
+		// dates kept as text are written the local way
+		kind = "local_date"
+		fallthrough
+	case isText(c.Type):
+		n := minLengths[kind]
+		if textLimit(c.Type, n) < n || c.Type.Name == "char" && (!fixedLength[kind] || textLimit(c.Type, n+1) != n) {
+			return ""
+		}
+	}
+	return kind
+}
+
+func isText(t ddl.Type) bool {
+	switch t.Name {
+	case "text", "varchar", "citext", "char":
+		return true
+	}
+	return false
+}
+
+// snakeCase lower-cases a column name and splits camelCase words by
+// underscores, so firstName and first_name are treated alike.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	prev := rune(0)
+	for _, c := range name {
+		if unicode.IsUpper(c) && prev != 0 && prev != '_' && !unicode.IsUpper(prev) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToLower(c))
+		prev = c
+	}
+	return sb.String()
+}
+
+// registerSemantic adds the named generators Infer picks from. Text kinds
+// only fit text columns, the others narrow the generator of the column's
+// type.
+func registerSemantic(r *Registry) {
+	for kind := range fakers {
+		r.RegisterNamed(kind, func(t ddl.Type) (Generator, error) {
+			if !isText(t) {
+				return nil, fmt.Errorf("generator %q needs a text column, got %s", kind, t)
+			}
+			return &Fake{Kind: kind, Locale: r.locale, MaxLen: textLimit(t, math.MaxInt32)}, nil
+		})
+	}
+	r.RegisterNamed("ip_address", func(t ddl.Type) (Generator, error) {
+		if !isText(t) && t.Name != "inet" {
+			return nil, fmt.Errorf("generator %q needs a text or inet column, got %s", "ip_address", t)
+		}
+		return &IPv4{}, nil
+	})
+
+	yearsBack := func(years int) *Bound {
+		return &Bound{Value: RangeEnd.AddDate(-years, 0, 0), Inclusive: true}
+	}
+	r.registerRanged("recent", yearsBack(3), nil)
+	r.registerRanged("birth_date", &Bound{Value: time.Date(1940, 1, 1, 0, 0, 0, 0, time.UTC), Inclusive: true}, yearsBack(18))
+	r.registerRanged("age", &Bound{Value: int64(18), Inclusive: true}, &Bound{Value: int64(90), Inclusive: true})
+	r.registerRanged("latitude", &Bound{Value: int64(-90), Inclusive: true}, &Bound{Value: int64(90), Inclusive: true})
+	r.registerRanged("longitude", &Bound{Value: int64(-180), Inclusive: true}, &Bound{Value: int64(180), Inclusive: true})
+}
+
+// registerRanged adds a named generator that narrows the numeric or date
+// generator of a column's type to [lo, hi].
+func (r *Registry) registerRanged(name string, lo, hi *Bound) {
+	r.RegisterNamed(name, func(t ddl.Type) (Generator, error) {
+		gen, err := r.ForType(t)
+		if err != nil {
+			return nil, err
+		}
+		ranged, ok := gen.(Ranged)
+		if !ok || t.ArrayDims > 0 {
+			return nil, fmt.Errorf("generator %q needs a numeric or date column, got %s", name, t)
+		}
+		if err := Override(ranged, t, lo, hi); err != nil {
+			return nil, fmt.Errorf("generator %q: %w", name, err)
+		}
+		return ranged, nil
+	})
+}
@@ -0,0 +1,123 @@
+package values
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+// Interval is a PostgreSQL interval split into its three stored fields.
+type Interval struct {
+	Months int32
+	Days   int32
+	Micros int64
+}
+
+// RangeStart and RangeEnd bound generated dates and timestamps. RangeEnd
+// also stands in for now() when expressions are evaluated, which keeps
+// generation independent of the wall clock.
+var (
+	RangeStart = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	RangeEnd   = time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// Timestamp generates times in [Min, Max] truncated to Precision
+// fractional second digits (0-6). Dates use a precision of -1, which
+// truncates to whole days.
+type Timestamp struct {
+	Min, Max  time.Time
+	Precision int
+}
+
+func (g *Timestamp) Generate(r *rand.Rand, _ int64) any {
+	span := g.Max.Sub(g.Min)
+	t := g.Min
+	if span > 0 {
+		t = t.Add(time.Duration(r.Int64N(int64(span/time.Microsecond)+1)) * time.Microsecond)
+	}
+	return truncate(t, g.Precision)
+}
+
+func truncate(t time.Time, precision int) time.Time {
+	if precision < 0 {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	unit := time.Second
+	for i := 0; i < min(precision, 6); i++ {
+		unit /= 10
+	}
+	return t.Truncate(unit)
+}
+
+// TimeOfDay generates times within a day, returned as durations since midnight.
+type TimeOfDay struct {
+	Precision int
+}
+
+func (g *TimeOfDay) Generate(r *rand.Rand, _ int64) any {
+	d := time.Duration(r.Int64N(int64(24*time.Hour/time.Microsecond))) * time.Microsecond
+	return truncate(time.Time{}.Add(d), g.Precision).Sub(time.Time{})
+}
+
+// IntervalGen generates intervals of up to MaxDays days.
+type IntervalGen struct {
+	MaxDays   int
+	Precision int
+}
+
+func (g *IntervalGen) Generate(r *rand.Rand, _ int64) any {
+	micros := r.Int64N(int64(24 * time.Hour / time.Microsecond))
+	d := truncate(time.Time{}.Add(time.Duration(micros)*time.Microsecond), g.Precision).Sub(time.Time{})
+	return Interval{
+		Months: int32(r.IntN(12)),
+		Days:   int32(r.IntN(g.MaxDays + 1)),
+		Micros: int64(d / time.Microsecond),
+	}
+}
+
+func precisionOf(t ddl.Type) (int, error) {
+	if len(t.Modifiers) == 0 {
+		return 6, nil
+	}
+	p := t.Modifiers[0]
+	if p < 0 || p > 6 {
+		return 0, fmt.Errorf("%s precision %d must be between 0 and 6", t.Name, p)
+	}
+	return p, nil
+}
+
+func registerTemporal(r *Registry) {
+	r.Register("date", func(ddl.Type) (Generator, error) {
+		return &Timestamp{Min: RangeStart, Max: RangeEnd, Precision: -1}, nil
+	})
+
+	timestamp := func(t ddl.Type) (Generator, error) {
+		p, err := precisionOf(t)
+		if err != nil {
+			return nil, err
+		}
+		return &Timestamp{Min: RangeStart, Max: RangeEnd, Precision: p}, nil
+	}
+	r.Register("timestamp", timestamp)
+	r.Register("timestamptz", timestamp)
+
+	timeOfDay := func(t ddl.Type) (Generator, error) {
+		p, err := precisionOf(t)
+		if err != nil {
+			return nil, err
+		}
+		return &TimeOfDay{Precision: p}, nil
+	}
+	r.Register("time", timeOfDay)
+	r.Register("timetz", timeOfDay)
+
+	r.Register("interval", func(t ddl.Type) (Generator, error) {
+		p, err := precisionOf(t)
+		if err != nil {
+			return nil, err
+		}
+		return &IntervalGen{MaxDays: 30, Precision: p}, nil
+	})
+}
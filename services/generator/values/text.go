@@ -0,0 +1,164 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/kacperborowieckb/gen-sql/services/generator/ddl"
+)
+
+const (
+	consonants = "bcdfghjklmnprstvz"
+	vowels     = "aeiou"
+)
+
+// String generates pronounceable lower-case words with a total length in
+// [MinLen, MaxLen] characters. Lengths count characters, as varchar(n) does.
+// When Charset is set, characters are instead drawn uniformly from it.
+type String struct {
+	MinLen, MaxLen int
+	Charset        string
+	// Limit is the most characters the column's type holds, 0 when it has
+	// no limit. MinLen and MaxLen are only the lengths picked by default.
+	Limit int
+
+	// the lengths CHECK constraints allow and the default lengths, kept
+	// once RestrictLength is called
+	restricted     bool
+	lo, hi         int
+	defMin, defMax int
+}
+
+// Alphanumeric is a Charset with a much larger domain than pronounceable
+// words, used for short unique columns.
+const Alphanumeric = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+func (g *String) Generate(r *rand.Rand, _ int64) any {
+	n := g.MinLen
+	if g.MaxLen > g.MinLen {
+		n += r.IntN(g.MaxLen - g.MinLen + 1)
+	}
+	if g.Charset == "" {
+		return Word(r, n)
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = g.Charset[r.IntN(len(g.Charset))]
+	}
+	return string(b)
+}
+
+// Word returns a pronounceable string of exactly n characters. Longer
+// strings are split into words by single spaces.
+func Word(r *rand.Rand, n int) string {
+	var sb strings.Builder
+	sb.Grow(n)
+	wordLen := 0
+	for sb.Len() < n {
+		remaining := n - sb.Len()
+		if wordLen >= 4 && remaining > 2 && r.IntN(8) == 0 {
+			sb.WriteByte(' ')
+			wordLen = 0
+			continue
+		}
+		if wordLen%2 == 0 {
+			sb.WriteByte(consonants[r.IntN(len(consonants))])
+		} else {
+			sb.WriteByte(vowels[r.IntN(len(vowels))])
+		}
+		wordLen++
+	}
+	return sb.String()
+}
+
+// Bits generates bit strings of MinLen to MaxLen bits.
+type Bits struct {
+	MinLen, MaxLen int
+}
+
+func (g *Bits) Generate(r *rand.Rand, _ int64) any {
+	n := g.MinLen
+	if g.MaxLen > g.MinLen {
+		n += r.IntN(g.MaxLen - g.MinLen + 1)
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '0' + byte(r.IntN(2))
+	}
+	return string(b)
+}
+
+func registerText(r *Registry) {
+	r.Register("text", func(ddl.Type) (Generator, error) { return &String{MinLen: 8, MaxLen: 32}, nil })
+	r.Register("citext", func(ddl.Type) (Generator, error) { return &String{MinLen: 8, MaxLen: 32}, nil })
+
+	r.Register("varchar", func(t ddl.Type) (Generator, error) {
+		if len(t.Modifiers) == 0 {
+			return &String{MinLen: 8, MaxLen: 32}, nil
+		}
+		n := t.Modifiers[0]
+		if n < 1 {
+			return nil, fmt.Errorf("length for type varchar must be at least 1")
+		}
+		return &String{MinLen: min(n, 4), MaxLen: min(n, 32), Limit: n}, nil
+	})
+
+	r.Register("char", func(t ddl.Type) (Generator, error) {
+		n := 1
+		if len(t.Modifiers) > 0 {
+			n = t.Modifiers[0]
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("length for type char must be at least 1")
+		}
+		return &String{MinLen: n, MaxLen: n, Limit: n}, nil
+	})
+
+	r.Register("bit", func(t ddl.Type) (Generator, error) {
+		n := 1
+		if len(t.Modifiers) > 0 {
+			n = t.Modifiers[0]
+		}
+		return &Bits{MinLen: n, MaxLen: n}, nil
+	})
+	r.Register("varbit", func(t ddl.Type) (Generator, error) {
+		n := 16
+		if len(t.Modifiers) > 0 {
+			n = t.Modifiers[0]
+		}
+		return &Bits{MinLen: 1, MaxLen: n}, nil
+	})
+
+	r.Register("xml", func(ddl.Type) (Generator, error) {
+		return GeneratorFunc(func(r *rand.Rand, _ int64) any {
+			return "<value>" + Word(r, 4+r.IntN(12)) + "</value>"
+		}), nil
+	})
+}
+
+// RestrictLength narrows the lengths allowed to [lo, hi] characters, within
+// what the type holds. The default lengths are kept where they are allowed;
+// otherwise lengths are drawn from the allowed range, up to as many
+// characters past its start as the default range spans.
+func (g *String) RestrictLength(lo, hi int) error {
+	if !g.restricted {
+		g.restricted = true
+		g.lo, g.hi = 0, math.MaxInt32
+		if g.Limit > 0 {
+			g.hi = g.Limit
+		}
+		g.defMin, g.defMax = g.MinLen, g.MaxLen
+	}
+	g.lo, g.hi = max(g.lo, lo), min(g.hi, hi)
+	if g.lo > g.hi {
+		return errEmptyRange
+	}
+
+	g.MinLen, g.MaxLen = max(g.defMin, g.lo), min(g.defMax, g.hi)
+	if g.MinLen > g.MaxLen {
+		g.MinLen, g.MaxLen = g.lo, min(g.hi, g.lo+g.defMax-g.defMin)
+	}
+	return nil
+}
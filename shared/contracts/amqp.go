@@ -6,5 +6,18 @@ type AmqpMessage struct {
 }
 
 const (
-	ProjectCreatedRoutingKey = "project.created"
+	ProjectCreatedRoutingKey                 = "project.created"
+	ProjectInstructionsInterpretedRoutingKey = "project.instructions.interpreted"
+	ProjectGeneratorsChosenRoutingKey        = "project.generators.chosen"
+	ProjectSandboxReadyRoutingKey            = "project.sandbox.ready"
+	GenerationPlannedRoutingKey              = "generation.planned"
+	GenerationShardRoutingKey                = "generation.shard"
+	GenerationShardDoneRoutingKey            = "generation.shard.done"
+	GenerationAssembleRoutingKey             = "generation.assemble"
+	GenerationAssembledRoutingKey            = "generation.assembled"
+	GenerationStartedRoutingKey              = "generation.started"
+	GenerationProgressRoutingKey             = "generation.progress"
+	GenerationCompletedRoutingKey            = "generation.completed"
+	GenerationFailedRoutingKey               = "generation.failed"
+	GenerationCancelRoutingKey               = "generation.cancel"
 )
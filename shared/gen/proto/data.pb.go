@@ -27,8 +27,19 @@ type StartDataGenerationRequest struct {
 	DdlSchema              string                 `protobuf:"bytes,2,opt,name=ddl_schema,json=ddlSchema,proto3" json:"ddl_schema,omitempty"`
 	MaxRows                int32                  `protobuf:"varint,3,opt,name=max_rows,json=maxRows,proto3" json:"max_rows,omitempty"`
 	GenerationInstructions string                 `protobuf:"bytes,4,opt,name=generation_instructions,json=generationInstructions,proto3" json:"generation_instructions,omitempty"`
-	unknownFields          protoimpl.UnknownFields
-	sizeCache              protoimpl.SizeCache
+	Seed                   *int64                 `protobuf:"varint,5,opt,name=seed,proto3,oneof" json:"seed,omitempty"`
+	// row counts per table, max_rows applies to the others
+	TableRows map[string]int64 `protobuf:"bytes,6,rep,name=table_rows,json=tableRows,proto3" json:"table_rows,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	FanOut    []*FanOut        `protobuf:"bytes,7,rep,name=fan_out,json=fanOut,proto3" json:"fan_out,omitempty"`
+	// locale of names, addresses, phone numbers and the like, e.g. "pl_PL";
+	// en_US when empty
+	Locale string `protobuf:"bytes,8,opt,name=locale,proto3" json:"locale,omitempty"`
+	// locale overrides for single columns, keyed by "table.column"
+	ColumnLocales map[string]string `protobuf:"bytes,9,rep,name=column_locales,json=columnLocales,proto3" json:"column_locales,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// how the generated dataset is written
+	Output        *OutputOptions `protobuf:"bytes,10,opt,name=output,proto3" json:"output,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *StartDataGenerationRequest) Reset() {
@@ -89,18 +100,316 @@ func (x *StartDataGenerationRequest) GetGenerationInstructions() string {
 	return ""
 }
 
+func (x *StartDataGenerationRequest) GetSeed() int64 {
+	if x != nil && x.Seed != nil {
+		return *x.Seed
+	}
+	return 0
+}
+
+func (x *StartDataGenerationRequest) GetTableRows() map[string]int64 {
+	if x != nil {
+		return x.TableRows
+	}
+	return nil
+}
+
+func (x *StartDataGenerationRequest) GetFanOut() []*FanOut {
+	if x != nil {
+		return x.FanOut
+	}
+	return nil
+}
+
+func (x *StartDataGenerationRequest) GetLocale() string {
+	if x != nil {
+		return x.Locale
+	}
+	return ""
+}
+
+func (x *StartDataGenerationRequest) GetColumnLocales() map[string]string {
+	if x != nil {
+		return x.ColumnLocales
+	}
+	return nil
+}
+
+func (x *StartDataGenerationRequest) GetOutput() *OutputOptions {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+// OutputOptions shape the files of a dataset.
+type OutputOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// rows per INSERT statement, 1000 when 0
+	BatchSize int32 `protobuf:"varint,1,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	// load in one transaction with session_replication_role = replica, which
+	// skips triggers and foreign key checks but needs superuser rights
+	Transaction bool `protobuf:"varint,2,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	// sql (INSERT statements, the default), copy or copy_csv (COPY FROM STDIN
+	// in text or CSV format), the csv, ndjson and parquet exports, or sandbox,
+	// which loads the dataset into a schema of its own in the database
+	Format string `protobuf:"bytes,3,opt,name=format,proto3" json:"format,omitempty"`
+	// with a copy format, one file per table and a manifest instead of a
+	// single psql script
+	PerTableFiles bool `protobuf:"varint,4,opt,name=per_table_files,json=perTableFiles,proto3" json:"per_table_files,omitempty"`
+	// zip (the default) or tar.gz, the archive exports are packaged in
+	Archive       string      `protobuf:"bytes,5,opt,name=archive,proto3" json:"archive,omitempty"`
+	Csv           *CSVOptions `protobuf:"bytes,6,opt,name=csv,proto3" json:"csv,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutputOptions) Reset() {
+	*x = OutputOptions{}
+	mi := &file_proto_data_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutputOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutputOptions) ProtoMessage() {}
+
+func (x *OutputOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutputOptions.ProtoReflect.Descriptor instead.
+func (*OutputOptions) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *OutputOptions) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+func (x *OutputOptions) GetTransaction() bool {
+	if x != nil {
+		return x.Transaction
+	}
+	return false
+}
+
+func (x *OutputOptions) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *OutputOptions) GetPerTableFiles() bool {
+	if x != nil {
+		return x.PerTableFiles
+	}
+	return false
+}
+
+func (x *OutputOptions) GetArchive() string {
+	if x != nil {
+		return x.Archive
+	}
+	return ""
+}
+
+func (x *OutputOptions) GetCsv() *CSVOptions {
+	if x != nil {
+		return x.Csv
+	}
+	return nil
+}
+
+// CSVOptions shape csv exports.
+type CSVOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// a single character, a comma by default
+	Delimiter string `protobuf:"bytes,1,opt,name=delimiter,proto3" json:"delimiter,omitempty"`
+	// minimal (the default) or all
+	Quoting string `protobuf:"bytes,2,opt,name=quoting,proto3" json:"quoting,omitempty"`
+	// the header row of column names, written unless set to false
+	Header        *bool `protobuf:"varint,3,opt,name=header,proto3,oneof" json:"header,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CSVOptions) Reset() {
+	*x = CSVOptions{}
+	mi := &file_proto_data_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CSVOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CSVOptions) ProtoMessage() {}
+
+func (x *CSVOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CSVOptions.ProtoReflect.Descriptor instead.
+func (*CSVOptions) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CSVOptions) GetDelimiter() string {
+	if x != nil {
+		return x.Delimiter
+	}
+	return ""
+}
+
+func (x *CSVOptions) GetQuoting() string {
+	if x != nil {
+		return x.Quoting
+	}
+	return ""
+}
+
+func (x *CSVOptions) GetHeader() bool {
+	if x != nil && x.Header != nil {
+		return *x.Header
+	}
+	return false
+}
+
+// FanOut derives the row count of child_table from parent_table: every
+// parent row gets between min and max children.
+type FanOut struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	ChildTable  string                 `protobuf:"bytes,1,opt,name=child_table,json=childTable,proto3" json:"child_table,omitempty"`
+	ParentTable string                 `protobuf:"bytes,2,opt,name=parent_table,json=parentTable,proto3" json:"parent_table,omitempty"`
+	// foreign key columns, only needed when the child references the parent
+	// more than once
+	Columns []string `protobuf:"bytes,3,rep,name=columns,proto3" json:"columns,omitempty"`
+	Min     int64    `protobuf:"varint,4,opt,name=min,proto3" json:"min,omitempty"`
+	Max     int64    `protobuf:"varint,5,opt,name=max,proto3" json:"max,omitempty"`
+	// "uniform" (the default) or "poisson"
+	Distribution  string  `protobuf:"bytes,6,opt,name=distribution,proto3" json:"distribution,omitempty"`
+	Mean          float64 `protobuf:"fixed64,7,opt,name=mean,proto3" json:"mean,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FanOut) Reset() {
+	*x = FanOut{}
+	mi := &file_proto_data_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FanOut) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FanOut) ProtoMessage() {}
+
+func (x *FanOut) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FanOut.ProtoReflect.Descriptor instead.
+func (*FanOut) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FanOut) GetChildTable() string {
+	if x != nil {
+		return x.ChildTable
+	}
+	return ""
+}
+
+func (x *FanOut) GetParentTable() string {
+	if x != nil {
+		return x.ParentTable
+	}
+	return ""
+}
+
+func (x *FanOut) GetColumns() []string {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+func (x *FanOut) GetMin() int64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *FanOut) GetMax() int64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *FanOut) GetDistribution() string {
+	if x != nil {
+		return x.Distribution
+	}
+	return ""
+}
+
+func (x *FanOut) GetMean() float64 {
+	if x != nil {
+		return x.Mean
+	}
+	return 0
+}
+
 type StartDataGenerationResponse struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	GenerationJobId string                 `protobuf:"bytes,1,opt,name=generation_job_id,json=generationJobId,proto3" json:"generation_job_id,omitempty"`
 	Message         string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
 	Success         bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Seed            int64                  `protobuf:"varint,4,opt,name=seed,proto3" json:"seed,omitempty"`
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
 
 func (x *StartDataGenerationResponse) Reset() {
 	*x = StartDataGenerationResponse{}
-	mi := &file_proto_data_proto_msgTypes[1]
+	mi := &file_proto_data_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -112,7 +421,7 @@ func (x *StartDataGenerationResponse) String() string {
 func (*StartDataGenerationResponse) ProtoMessage() {}
 
 func (x *StartDataGenerationResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_data_proto_msgTypes[1]
+	mi := &file_proto_data_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -125,7 +434,7 @@ func (x *StartDataGenerationResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StartDataGenerationResponse.ProtoReflect.Descriptor instead.
 func (*StartDataGenerationResponse) Descriptor() ([]byte, []int) {
-	return file_proto_data_proto_rawDescGZIP(), []int{1}
+	return file_proto_data_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *StartDataGenerationResponse) GetGenerationJobId() string {
@@ -149,24 +458,559 @@ func (x *StartDataGenerationResponse) GetSuccess() bool {
 	return false
 }
 
+func (x *StartDataGenerationResponse) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+type GetGenerationJobRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ProjectId       string                 `protobuf:"bytes,1,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	GenerationJobId string                 `protobuf:"bytes,2,opt,name=generation_job_id,json=generationJobId,proto3" json:"generation_job_id,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetGenerationJobRequest) Reset() {
+	*x = GetGenerationJobRequest{}
+	mi := &file_proto_data_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGenerationJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGenerationJobRequest) ProtoMessage() {}
+
+func (x *GetGenerationJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGenerationJobRequest.ProtoReflect.Descriptor instead.
+func (*GetGenerationJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetGenerationJobRequest) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *GetGenerationJobRequest) GetGenerationJobId() string {
+	if x != nil {
+		return x.GenerationJobId
+	}
+	return ""
+}
+
+// GetGenerationJobResponse is a generation job as the data service keeps
+// it.
+type GetGenerationJobResponse struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	GenerationJobId        string                 `protobuf:"bytes,1,opt,name=generation_job_id,json=generationJobId,proto3" json:"generation_job_id,omitempty"`
+	ProjectId              string                 `protobuf:"bytes,2,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	GenerationInstructions string                 `protobuf:"bytes,3,opt,name=generation_instructions,json=generationInstructions,proto3" json:"generation_instructions,omitempty"`
+	// RFC 3339 time the job was queued at
+	CreatedAt string `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// how free-text instructions were understood, a JSON object with the
+	// provider, the rules and notes; empty for structured instructions
+	Interpretation string `protobuf:"bytes,5,opt,name=interpretation,proto3" json:"interpretation,omitempty"`
+	// the generator picked for every column, once the rows are generated
+	Generators []*ColumnGenerator `protobuf:"bytes,6,rep,name=generators,proto3" json:"generators,omitempty"`
+	// where a job of the sandbox format loaded its dataset, once it did
+	Sandbox *Sandbox `protobuf:"bytes,7,opt,name=sandbox,proto3" json:"sandbox,omitempty"`
+	// queued, running, completed, failed or cancelled
+	Status string `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	// why a failed job failed
+	Error string `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	// the path of a completed job's output
+	Artifact string `protobuf:"bytes,10,opt,name=artifact,proto3" json:"artifact,omitempty"`
+	RowCount int64  `protobuf:"varint,11,opt,name=row_count,json=rowCount,proto3" json:"row_count,omitempty"`
+	// RFC 3339 times, empty until the job got there
+	StartedAt     string `protobuf:"bytes,12,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt    string `protobuf:"bytes,13,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGenerationJobResponse) Reset() {
+	*x = GetGenerationJobResponse{}
+	mi := &file_proto_data_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGenerationJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGenerationJobResponse) ProtoMessage() {}
+
+func (x *GetGenerationJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGenerationJobResponse.ProtoReflect.Descriptor instead.
+func (*GetGenerationJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetGenerationJobResponse) GetGenerationJobId() string {
+	if x != nil {
+		return x.GenerationJobId
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetGenerationInstructions() string {
+	if x != nil {
+		return x.GenerationInstructions
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetInterpretation() string {
+	if x != nil {
+		return x.Interpretation
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetGenerators() []*ColumnGenerator {
+	if x != nil {
+		return x.Generators
+	}
+	return nil
+}
+
+func (x *GetGenerationJobResponse) GetSandbox() *Sandbox {
+	if x != nil {
+		return x.Sandbox
+	}
+	return nil
+}
+
+func (x *GetGenerationJobResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetArtifact() string {
+	if x != nil {
+		return x.Artifact
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetRowCount() int64 {
+	if x != nil {
+		return x.RowCount
+	}
+	return 0
+}
+
+func (x *GetGenerationJobResponse) GetStartedAt() string {
+	if x != nil {
+		return x.StartedAt
+	}
+	return ""
+}
+
+func (x *GetGenerationJobResponse) GetFinishedAt() string {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return ""
+}
+
+// Sandbox is where a dataset can be queried. The password is the one of
+// the generator's database user and is not kept.
+type Sandbox struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Port          string                 `protobuf:"bytes,2,opt,name=port,proto3" json:"port,omitempty"`
+	Database      string                 `protobuf:"bytes,3,opt,name=database,proto3" json:"database,omitempty"`
+	Schema        string                 `protobuf:"bytes,4,opt,name=schema,proto3" json:"schema,omitempty"`
+	User          string                 `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sandbox) Reset() {
+	*x = Sandbox{}
+	mi := &file_proto_data_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sandbox) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sandbox) ProtoMessage() {}
+
+func (x *Sandbox) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sandbox.ProtoReflect.Descriptor instead.
+func (*Sandbox) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Sandbox) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Sandbox) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *Sandbox) GetDatabase() string {
+	if x != nil {
+		return x.Database
+	}
+	return ""
+}
+
+func (x *Sandbox) GetSchema() string {
+	if x != nil {
+		return x.Schema
+	}
+	return ""
+}
+
+func (x *Sandbox) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+type ColumnGenerator struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Table         string                 `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Column        string                 `protobuf:"bytes,2,opt,name=column,proto3" json:"column,omitempty"`
+	Generator     string                 `protobuf:"bytes,3,opt,name=generator,proto3" json:"generator,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ColumnGenerator) Reset() {
+	*x = ColumnGenerator{}
+	mi := &file_proto_data_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ColumnGenerator) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ColumnGenerator) ProtoMessage() {}
+
+func (x *ColumnGenerator) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ColumnGenerator.ProtoReflect.Descriptor instead.
+func (*ColumnGenerator) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ColumnGenerator) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *ColumnGenerator) GetColumn() string {
+	if x != nil {
+		return x.Column
+	}
+	return ""
+}
+
+func (x *ColumnGenerator) GetGenerator() string {
+	if x != nil {
+		return x.Generator
+	}
+	return ""
+}
+
+type CancelGenerationJobRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ProjectId       string                 `protobuf:"bytes,1,opt,name=project_id,json=projectId,proto3" json:"project_id,omitempty"`
+	GenerationJobId string                 `protobuf:"bytes,2,opt,name=generation_job_id,json=generationJobId,proto3" json:"generation_job_id,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CancelGenerationJobRequest) Reset() {
+	*x = CancelGenerationJobRequest{}
+	mi := &file_proto_data_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelGenerationJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelGenerationJobRequest) ProtoMessage() {}
+
+func (x *CancelGenerationJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelGenerationJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelGenerationJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelGenerationJobRequest) GetProjectId() string {
+	if x != nil {
+		return x.ProjectId
+	}
+	return ""
+}
+
+func (x *CancelGenerationJobRequest) GetGenerationJobId() string {
+	if x != nil {
+		return x.GenerationJobId
+	}
+	return ""
+}
+
+type CancelGenerationJobResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelGenerationJobResponse) Reset() {
+	*x = CancelGenerationJobResponse{}
+	mi := &file_proto_data_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelGenerationJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelGenerationJobResponse) ProtoMessage() {}
+
+func (x *CancelGenerationJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_data_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelGenerationJobResponse.ProtoReflect.Descriptor instead.
+func (*CancelGenerationJobResponse) Descriptor() ([]byte, []int) {
+	return file_proto_data_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CancelGenerationJobResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *CancelGenerationJobResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
 var File_proto_data_proto protoreflect.FileDescriptor
 
 const file_proto_data_proto_rawDesc = "" +
 	"\n" +
-	"\x10proto/data.proto\x12\x03gen\"\xae\x01\n" +
+	"\x10proto/data.proto\x12\x03gen\"\xe4\x04\n" +
 	"\x1aStartDataGenerationRequest\x12\x1d\n" +
 	"\n" +
 	"project_id\x18\x01 \x01(\tR\tprojectId\x12\x1d\n" +
 	"\n" +
 	"ddl_schema\x18\x02 \x01(\tR\tddlSchema\x12\x19\n" +
 	"\bmax_rows\x18\x03 \x01(\x05R\amaxRows\x127\n" +
-	"\x17generation_instructions\x18\x04 \x01(\tR\x16generationInstructions\"}\n" +
+	"\x17generation_instructions\x18\x04 \x01(\tR\x16generationInstructions\x12\x17\n" +
+	"\x04seed\x18\x05 \x01(\x03H\x00R\x04seed\x88\x01\x01\x12M\n" +
+	"\n" +
+	"table_rows\x18\x06 \x03(\v2..gen.StartDataGenerationRequest.TableRowsEntryR\ttableRows\x12$\n" +
+	"\afan_out\x18\a \x03(\v2\v.gen.FanOutR\x06fanOut\x12\x16\n" +
+	"\x06locale\x18\b \x01(\tR\x06locale\x12Y\n" +
+	"\x0ecolumn_locales\x18\t \x03(\v22.gen.StartDataGenerationRequest.ColumnLocalesEntryR\rcolumnLocales\x12*\n" +
+	"\x06output\x18\n" +
+	" \x01(\v2\x12.gen.OutputOptionsR\x06output\x1a<\n" +
+	"\x0eTableRowsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a@\n" +
+	"\x12ColumnLocalesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\a\n" +
+	"\x05_seed\"\xcd\x01\n" +
+	"\rOutputOptions\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x01 \x01(\x05R\tbatchSize\x12 \n" +
+	"\vtransaction\x18\x02 \x01(\bR\vtransaction\x12\x16\n" +
+	"\x06format\x18\x03 \x01(\tR\x06format\x12&\n" +
+	"\x0fper_table_files\x18\x04 \x01(\bR\rperTableFiles\x12\x18\n" +
+	"\aarchive\x18\x05 \x01(\tR\aarchive\x12!\n" +
+	"\x03csv\x18\x06 \x01(\v2\x0f.gen.CSVOptionsR\x03csv\"l\n" +
+	"\n" +
+	"CSVOptions\x12\x1c\n" +
+	"\tdelimiter\x18\x01 \x01(\tR\tdelimiter\x12\x18\n" +
+	"\aquoting\x18\x02 \x01(\tR\aquoting\x12\x1b\n" +
+	"\x06header\x18\x03 \x01(\bH\x00R\x06header\x88\x01\x01B\t\n" +
+	"\a_header\"\xc2\x01\n" +
+	"\x06FanOut\x12\x1f\n" +
+	"\vchild_table\x18\x01 \x01(\tR\n" +
+	"childTable\x12!\n" +
+	"\fparent_table\x18\x02 \x01(\tR\vparentTable\x12\x18\n" +
+	"\acolumns\x18\x03 \x03(\tR\acolumns\x12\x10\n" +
+	"\x03min\x18\x04 \x01(\x03R\x03min\x12\x10\n" +
+	"\x03max\x18\x05 \x01(\x03R\x03max\x12\"\n" +
+	"\fdistribution\x18\x06 \x01(\tR\fdistribution\x12\x12\n" +
+	"\x04mean\x18\a \x01(\x01R\x04mean\"\x91\x01\n" +
 	"\x1bStartDataGenerationResponse\x12*\n" +
 	"\x11generation_job_id\x18\x01 \x01(\tR\x0fgenerationJobId\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x18\n" +
-	"\asuccess\x18\x03 \x01(\bR\asuccess2g\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x12\n" +
+	"\x04seed\x18\x04 \x01(\x03R\x04seed\"d\n" +
+	"\x17GetGenerationJobRequest\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x01 \x01(\tR\tprojectId\x12*\n" +
+	"\x11generation_job_id\x18\x02 \x01(\tR\x0fgenerationJobId\"\xea\x03\n" +
+	"\x18GetGenerationJobResponse\x12*\n" +
+	"\x11generation_job_id\x18\x01 \x01(\tR\x0fgenerationJobId\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x02 \x01(\tR\tprojectId\x127\n" +
+	"\x17generation_instructions\x18\x03 \x01(\tR\x16generationInstructions\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\tR\tcreatedAt\x12&\n" +
+	"\x0einterpretation\x18\x05 \x01(\tR\x0einterpretation\x124\n" +
+	"\n" +
+	"generators\x18\x06 \x03(\v2\x14.gen.ColumnGeneratorR\n" +
+	"generators\x12&\n" +
+	"\asandbox\x18\a \x01(\v2\f.gen.SandboxR\asandbox\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\x12\x1a\n" +
+	"\bartifact\x18\n" +
+	" \x01(\tR\bartifact\x12\x1b\n" +
+	"\trow_count\x18\v \x01(\x03R\browCount\x12\x1d\n" +
+	"\n" +
+	"started_at\x18\f \x01(\tR\tstartedAt\x12\x1f\n" +
+	"\vfinished_at\x18\r \x01(\tR\n" +
+	"finishedAt\"y\n" +
+	"\aSandbox\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\tR\x04port\x12\x1a\n" +
+	"\bdatabase\x18\x03 \x01(\tR\bdatabase\x12\x16\n" +
+	"\x06schema\x18\x04 \x01(\tR\x06schema\x12\x12\n" +
+	"\x04user\x18\x05 \x01(\tR\x04user\"]\n" +
+	"\x0fColumnGenerator\x12\x14\n" +
+	"\x05table\x18\x01 \x01(\tR\x05table\x12\x16\n" +
+	"\x06column\x18\x02 \x01(\tR\x06column\x12\x1c\n" +
+	"\tgenerator\x18\x03 \x01(\tR\tgenerator\"g\n" +
+	"\x1aCancelGenerationJobRequest\x12\x1d\n" +
+	"\n" +
+	"project_id\x18\x01 \x01(\tR\tprojectId\x12*\n" +
+	"\x11generation_job_id\x18\x02 \x01(\tR\x0fgenerationJobId\"Q\n" +
+	"\x1bCancelGenerationJobResponse\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess2\x92\x02\n" +
 	"\vDataService\x12X\n" +
-	"\x13StartDataGeneration\x12\x1f.gen.StartDataGenerationRequest\x1a .gen.StartDataGenerationResponseB0Z.github.com/kacperborowieckb/gen-sql/shared/genb\x06proto3"
+	"\x13StartDataGeneration\x12\x1f.gen.StartDataGenerationRequest\x1a .gen.StartDataGenerationResponse\x12O\n" +
+	"\x10GetGenerationJob\x12\x1c.gen.GetGenerationJobRequest\x1a\x1d.gen.GetGenerationJobResponse\x12X\n" +
+	"\x13CancelGenerationJob\x12\x1f.gen.CancelGenerationJobRequest\x1a .gen.CancelGenerationJobResponseB0Z.github.com/kacperborowieckb/gen-sql/shared/genb\x06proto3"
 
 var (
 	file_proto_data_proto_rawDescOnce sync.Once
@@ -180,19 +1024,41 @@ func file_proto_data_proto_rawDescGZIP() []byte {
 	return file_proto_data_proto_rawDescData
 }
 
-var file_proto_data_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_data_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_proto_data_proto_goTypes = []any{
 	(*StartDataGenerationRequest)(nil),  // 0: gen.StartDataGenerationRequest
-	(*StartDataGenerationResponse)(nil), // 1: gen.StartDataGenerationResponse
+	(*OutputOptions)(nil),               // 1: gen.OutputOptions
+	(*CSVOptions)(nil),                  // 2: gen.CSVOptions
+	(*FanOut)(nil),                      // 3: gen.FanOut
+	(*StartDataGenerationResponse)(nil), // 4: gen.StartDataGenerationResponse
+	(*GetGenerationJobRequest)(nil),     // 5: gen.GetGenerationJobRequest
+	(*GetGenerationJobResponse)(nil),    // 6: gen.GetGenerationJobResponse
+	(*Sandbox)(nil),                     // 7: gen.Sandbox
+	(*ColumnGenerator)(nil),             // 8: gen.ColumnGenerator
+	(*CancelGenerationJobRequest)(nil),  // 9: gen.CancelGenerationJobRequest
+	(*CancelGenerationJobResponse)(nil), // 10: gen.CancelGenerationJobResponse
+	nil,                                 // 11: gen.StartDataGenerationRequest.TableRowsEntry
+	nil,                                 // 12: gen.StartDataGenerationRequest.ColumnLocalesEntry
 }
 var file_proto_data_proto_depIdxs = []int32{
-	0, // 0: gen.DataService.StartDataGeneration:input_type -> gen.StartDataGenerationRequest
-	1, // 1: gen.DataService.StartDataGeneration:output_type -> gen.StartDataGenerationResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	11, // 0: gen.StartDataGenerationRequest.table_rows:type_name -> gen.StartDataGenerationRequest.TableRowsEntry
+	3,  // 1: gen.StartDataGenerationRequest.fan_out:type_name -> gen.FanOut
+	12, // 2: gen.StartDataGenerationRequest.column_locales:type_name -> gen.StartDataGenerationRequest.ColumnLocalesEntry
+	1,  // 3: gen.StartDataGenerationRequest.output:type_name -> gen.OutputOptions
+	2,  // 4: gen.OutputOptions.csv:type_name -> gen.CSVOptions
+	8,  // 5: gen.GetGenerationJobResponse.generators:type_name -> gen.ColumnGenerator
+	7,  // 6: gen.GetGenerationJobResponse.sandbox:type_name -> gen.Sandbox
+	0,  // 7: gen.DataService.StartDataGeneration:input_type -> gen.StartDataGenerationRequest
+	5,  // 8: gen.DataService.GetGenerationJob:input_type -> gen.GetGenerationJobRequest
+	9,  // 9: gen.DataService.CancelGenerationJob:input_type -> gen.CancelGenerationJobRequest
+	4,  // 10: gen.DataService.StartDataGeneration:output_type -> gen.StartDataGenerationResponse
+	6,  // 11: gen.DataService.GetGenerationJob:output_type -> gen.GetGenerationJobResponse
+	10, // 12: gen.DataService.CancelGenerationJob:output_type -> gen.CancelGenerationJobResponse
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_proto_data_proto_init() }
@@ -200,13 +1066,15 @@ func file_proto_data_proto_init() {
 	if File_proto_data_proto != nil {
 		return
 	}
+	file_proto_data_proto_msgTypes[0].OneofWrappers = []any{}
+	file_proto_data_proto_msgTypes[2].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_data_proto_rawDesc), len(file_proto_data_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
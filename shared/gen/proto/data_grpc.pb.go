@@ -20,6 +20,8 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	DataService_StartDataGeneration_FullMethodName = "/gen.DataService/StartDataGeneration"
+	DataService_GetGenerationJob_FullMethodName    = "/gen.DataService/GetGenerationJob"
+	DataService_CancelGenerationJob_FullMethodName = "/gen.DataService/CancelGenerationJob"
 )
 
 // DataServiceClient is the client API for DataService service.
@@ -27,6 +29,8 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type DataServiceClient interface {
 	StartDataGeneration(ctx context.Context, in *StartDataGenerationRequest, opts ...grpc.CallOption) (*StartDataGenerationResponse, error)
+	GetGenerationJob(ctx context.Context, in *GetGenerationJobRequest, opts ...grpc.CallOption) (*GetGenerationJobResponse, error)
+	CancelGenerationJob(ctx context.Context, in *CancelGenerationJobRequest, opts ...grpc.CallOption) (*CancelGenerationJobResponse, error)
 }
 
 type dataServiceClient struct {
@@ -47,11 +51,33 @@ func (c *dataServiceClient) StartDataGeneration(ctx context.Context, in *StartDa
 	return out, nil
 }
 
+func (c *dataServiceClient) GetGenerationJob(ctx context.Context, in *GetGenerationJobRequest, opts ...grpc.CallOption) (*GetGenerationJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetGenerationJobResponse)
+	err := c.cc.Invoke(ctx, DataService_GetGenerationJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataServiceClient) CancelGenerationJob(ctx context.Context, in *CancelGenerationJobRequest, opts ...grpc.CallOption) (*CancelGenerationJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelGenerationJobResponse)
+	err := c.cc.Invoke(ctx, DataService_CancelGenerationJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DataServiceServer is the server API for DataService service.
 // All implementations must embed UnimplementedDataServiceServer
 // for forward compatibility.
 type DataServiceServer interface {
 	StartDataGeneration(context.Context, *StartDataGenerationRequest) (*StartDataGenerationResponse, error)
+	GetGenerationJob(context.Context, *GetGenerationJobRequest) (*GetGenerationJobResponse, error)
+	CancelGenerationJob(context.Context, *CancelGenerationJobRequest) (*CancelGenerationJobResponse, error)
 	mustEmbedUnimplementedDataServiceServer()
 }
 
@@ -65,6 +91,12 @@ type UnimplementedDataServiceServer struct{}
 func (UnimplementedDataServiceServer) StartDataGeneration(context.Context, *StartDataGenerationRequest) (*StartDataGenerationResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StartDataGeneration not implemented")
 }
+func (UnimplementedDataServiceServer) GetGenerationJob(context.Context, *GetGenerationJobRequest) (*GetGenerationJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGenerationJob not implemented")
+}
+func (UnimplementedDataServiceServer) CancelGenerationJob(context.Context, *CancelGenerationJobRequest) (*CancelGenerationJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelGenerationJob not implemented")
+}
 func (UnimplementedDataServiceServer) mustEmbedUnimplementedDataServiceServer() {}
 func (UnimplementedDataServiceServer) testEmbeddedByValue()                     {}
 
@@ -104,6 +136,42 @@ func _DataService_StartDataGeneration_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DataService_GetGenerationJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGenerationJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).GetGenerationJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_GetGenerationJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).GetGenerationJob(ctx, req.(*GetGenerationJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataService_CancelGenerationJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelGenerationJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServiceServer).CancelGenerationJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataService_CancelGenerationJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServiceServer).CancelGenerationJob(ctx, req.(*CancelGenerationJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DataService_ServiceDesc is the grpc.ServiceDesc for DataService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +183,14 @@ var DataService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "StartDataGeneration",
 			Handler:    _DataService_StartDataGeneration_Handler,
 		},
+		{
+			MethodName: "GetGenerationJob",
+			Handler:    _DataService_GetGenerationJob_Handler,
+		},
+		{
+			MethodName: "CancelGenerationJob",
+			Handler:    _DataService_CancelGenerationJob_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/data.proto",
@@ -1,7 +1,11 @@
 package messaging
 
+import "github.com/kacperborowieckb/gen-sql/shared/rules"
+
 const (
-	DataGenerationQueue = "data_generation_queue"
+	DataGenerationQueue        = "data_generation_queue"
+	GenerationStatusQueue      = "generation_status_queue"
+	GenerationCoordinatorQueue = "generation_coordinator_queue"
 )
 
 // ProjectCreatedEvent defines the payload for a project.created event
@@ -10,4 +14,214 @@ type ProjectCreatedEvent struct {
 	DdlSchema              string `json:"ddlSchema"`
 	GenerationInstructions string `json:"generationInstructions"`
 	MaxRows                int32  `json:"maxRows"`
+	Seed                   int64  `json:"seed"`
+	// TableRows and FanOut override MaxRows for individual tables
+	TableRows map[string]int64 `json:"tableRows,omitempty"`
+	FanOut    []FanOut         `json:"fanOut,omitempty"`
+	// Locale shapes names, addresses, phone numbers and the like, e.g.
+	// pl_PL; ColumnLocales overrides it for columns named table.column
+	Locale        string            `json:"locale,omitempty"`
+	ColumnLocales map[string]string `json:"columnLocales,omitempty"`
+	Output        OutputOptions     `json:"output"`
+	// JobID identifies the generation job. Jobs of more rows than a set
+	// ShardRows are split into shards of about that many rows
+	JobID     string `json:"jobId,omitempty"`
+	ShardRows int64  `json:"shardRows,omitempty"`
+}
+
+// GenerationPlannedEvent lays out a job too large for one generator, for
+// the coordinator to split into shards. The instructions of Job are
+// replaced by the rules they resolved to, so that every shard follows the
+// same rules
+type GenerationPlannedEvent struct {
+	Job ProjectCreatedEvent `json:"job"`
+	// ShardUnit is the granularity of shards: every shard of a split table
+	// but the last has a multiple of it rows
+	ShardUnit int64          `json:"shardUnit"`
+	Tables    []PlannedTable `json:"tables"`
+}
+
+// PlannedTable is a table of a sharded job, in load order. Only Split
+// tables may be generated in more than one shard, and shards of a table
+// start once every table in After is generated
+type PlannedTable struct {
+	Name  string   `json:"name"`
+	Rows  int64    `json:"rows"`
+	Split bool     `json:"split,omitempty"`
+	After []string `json:"after,omitempty"`
+}
+
+// GenerationShardEvent asks a generator for the rows of one table from
+// First on. Attempt counts the times the shard was dispatched
+type GenerationShardEvent struct {
+	Job     ProjectCreatedEvent `json:"job"`
+	ShardID string              `json:"shardId"`
+	Attempt int                 `json:"attempt"`
+	Table   string              `json:"table"`
+	First   int64               `json:"first"`
+	Rows    int64               `json:"rows"`
+}
+
+// GenerationShardDoneEvent reports a generated shard, or why the attempt
+// failed
+type GenerationShardDoneEvent struct {
+	JobID   string `json:"jobId"`
+	ShardID string `json:"shardId"`
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GenerationAssembleEvent asks a generator to put the shards of a job
+// together into its output
+type GenerationAssembleEvent struct {
+	Job ProjectCreatedEvent `json:"job"`
+}
+
+// GenerationAssembledEvent reports the output of a sharded job, or why it
+// could not be assembled
+type GenerationAssembledEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// OutputOptions shape the files of a dataset. A BatchSize of 0 means the
+// generator's default, PerTableFiles only applies to COPY formats and
+// Archive and CSV to exports
+type OutputOptions struct {
+	BatchSize     int        `json:"batchSize,omitempty"`
+	Transaction   bool       `json:"transaction,omitempty"`
+	Format        string     `json:"format,omitempty"`
+	PerTableFiles bool       `json:"perTableFiles,omitempty"`
+	Archive       string     `json:"archive,omitempty"`
+	CSV           CSVOptions `json:"csv"`
+}
+
+// CSVOptions shape CSV exports, empty fields mean the defaults
+type CSVOptions struct {
+	Delimiter string `json:"delimiter,omitempty"`
+	Quoting   string `json:"quoting,omitempty"`
+	NoHeader  bool   `json:"noHeader,omitempty"`
+}
+
+// Output formats, an empty Format is FormatSQL
+const (
+	FormatSQL     = "sql"
+	FormatCopy    = "copy"
+	FormatCopyCSV = "copy_csv"
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+	FormatSandbox = "sandbox"
+)
+
+// Archive formats of exports, an empty Archive is ArchiveZip
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// IsExport reports whether a format is packaged as an archive
+func IsExport(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON || format == FormatParquet
+}
+
+// FanOut sets how many rows of ChildTable reference each row of ParentTable
+type FanOut struct {
+	ChildTable   string   `json:"childTable"`
+	ParentTable  string   `json:"parentTable"`
+	Columns      []string `json:"columns,omitempty"`
+	Min          int64    `json:"min"`
+	Max          int64    `json:"max"`
+	Distribution string   `json:"distribution,omitempty"`
+	Mean         float64  `json:"mean,omitempty"`
+}
+
+// InstructionsInterpretedEvent records how free-text generation
+// instructions of a job were understood
+type InstructionsInterpretedEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	Provider  string `json:"provider"`
+	// Rules is nil when nothing in the instructions was understood
+	Rules *rules.Rules `json:"rules,omitempty"`
+	Notes []string     `json:"notes,omitempty"`
+}
+
+// ColumnGeneratorsEvent lists the generator picked for every column of a
+// generated job, so that the choices can be reviewed and overridden with
+// the generator field of a column rule
+type ColumnGeneratorsEvent struct {
+	JobID     string            `json:"jobId"`
+	ProjectID string            `json:"projectId"`
+	Columns   []ColumnGenerator `json:"columns"`
+}
+
+// SandboxReadyEvent tells where the dataset of a job was loaded, so that
+// it can be queried. The password is the one of the generator's database
+// user and is not sent
+type SandboxReadyEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	Host      string `json:"host"`
+	Port      string `json:"port"`
+	Database  string `json:"database"`
+	Schema    string `json:"schema"`
+	User      string `json:"user"`
+}
+
+// GenerationStartedEvent reports a job a generator started on
+type GenerationStartedEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+}
+
+// GenerationProgressEvent reports how far the tables of a job are
+// generated. Tables lists the ones that advanced since the last event of
+// the job, or of the shard when ShardID is set
+type GenerationProgressEvent struct {
+	JobID     string          `json:"jobId"`
+	ProjectID string          `json:"projectId"`
+	ShardID   string          `json:"shardId,omitempty"`
+	Tables    []TableProgress `json:"tables"`
+}
+
+// TableProgress is the rows of a table generated out of its total, or of
+// the rows of a shard
+type TableProgress struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+	Total int64  `json:"total"`
+}
+
+// GenerationCompletedEvent reports the output of a finished job
+type GenerationCompletedEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	Path      string `json:"path"`
+	Rows      int64  `json:"rows"`
+}
+
+// GenerationFailedEvent reports why a job failed
+type GenerationFailedEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
+	Error     string `json:"error"`
+}
+
+// ColumnGenerator is the generator picked for one column. Generator is
+// "type" for columns that get the generator of their type and "rules" for
+// columns set by generation instructions
+type ColumnGenerator struct {
+	Table     string `json:"table"`
+	Column    string `json:"column"`
+	Generator string `json:"generator"`
+}
+
+// GenerationCancelEvent asks every generator to stop working on a job and
+// to skip its messages still queued
+type GenerationCancelEvent struct {
+	JobID     string `json:"jobId"`
+	ProjectID string `json:"projectId"`
 }
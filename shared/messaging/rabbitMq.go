@@ -3,8 +3,10 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/kacperborowieckb/gen-sql/shared/contracts"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -17,8 +19,19 @@ const (
 type RabbitMQ struct {
 	conn    *amqp.Connection
 	Channel *amqp.Channel
+
+	// confirmed is the channel PublishConfirmed publishes on, opened in
+	// confirm mode when first needed, and returns the messages the broker
+	// could not route
+	confirmMu sync.Mutex
+	confirmed *amqp.Channel
+	returns   chan amqp.Return
 }
 
+// ErrUnroutable is returned by PublishConfirmed for messages no queue is
+// bound to receive.
+var ErrUnroutable = errors.New("message not routed to any queue")
+
 func NewRabbitMQ(uri string) (*RabbitMQ, error) {
 	conn, err := amqp.Dial(uri)
 	if err != nil {
@@ -74,6 +87,33 @@ func (r *RabbitMQ) BindQueue(queueName, routingKey, exchangeName string) error {
 // Return an error to Nack (reject) the message, or nil to Ack (acknowledge) it.
 type MessageHandler func(d amqp.Delivery) error
 
+// requeueError is a handler error after which the message is delivered
+// again rather than dropped.
+type requeueError struct {
+	err error
+}
+
+func (e requeueError) Error() string { return e.err.Error() }
+func (e requeueError) Unwrap() error { return e.err }
+
+// Requeue wraps a handler error so that the message is put back on its
+// queue, for this or another consumer to handle again, e.g. when the
+// consumer is stopping.
+func Requeue(err error) error {
+	return requeueError{err: err}
+}
+
+// SetPrefetch limits the messages delivered to the consumers of the channel
+// and not yet acknowledged, so that consumers on other connections get
+// their share of a queue.
+func (r *RabbitMQ) SetPrefetch(count int) error {
+	return r.Channel.Qos(
+		count, // prefetch count
+		0,     // prefetch size
+		false, // global
+	)
+}
+
 func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) error {
 	msgs, err := r.Channel.Consume(
 		queueName, // queue
@@ -92,7 +132,10 @@ func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) err
 		for d := range msgs {
 			log.Printf("Received a message: %s", d.Body)
 			err := handler(d)
-			if err != nil {
+			if errors.As(err, new(requeueError)) {
+				log.Printf("Requeueing message: %v", err)
+				d.Nack(false, true)
+			} else if err != nil {
 				// Nack the message and drop it (don't requeue)
 				log.Printf("Failed to handle message: %v", err)
 				d.Nack(false, false)
@@ -106,18 +149,69 @@ func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) err
 	return nil
 }
 
-func (r *RabbitMQ) PublishMessage(ctx context.Context, exchange, routingKey string, message contracts.AmqpMessage) error {
-	log.Printf("Publishing message with routing key: %s", routingKey)
+// Subscribe hands the messages of an exchange with the given routing keys
+// to handler, on every connection that subscribes, unlike a shared queue
+// that gives each message to one consumer. Messages go through a queue of
+// the connection's own, on a channel of its own, so they arrive while the
+// other consumers are busy; they are only delivered to the connections
+// subscribed when they are published.
+func (r *RabbitMQ) Subscribe(exchange string, routingKeys []string, handler MessageHandler) error {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to create channel: %v", err)
+	}
 
-	jsonMsg, err := json.Marshal(message)
+	q, err := ch.QueueDeclare(
+		"",    // name, chosen by the server
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %v", err)
+		ch.Close()
+		return fmt.Errorf("failed to declare subscription queue: %v", err)
+	}
+	for _, key := range routingKeys {
+		if err := ch.QueueBind(q.Name, key, exchange, false, nil); err != nil {
+			ch.Close()
+			return fmt.Errorf("failed to bind subscription queue: %v", err)
+		}
 	}
 
-	msg := amqp.Publishing{
-		DeliveryMode: amqp.Persistent,
-		ContentType:  "application/json",
-		Body:         jsonMsg,
+	msgs, err := ch.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to register a consumer: %v", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			log.Printf("Received a message: %s", d.Body)
+			if err := handler(d); err != nil {
+				log.Printf("Failed to handle message: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *RabbitMQ) PublishMessage(ctx context.Context, exchange, routingKey string, message contracts.AmqpMessage) error {
+	log.Printf("Publishing message with routing key: %s", routingKey)
+
+	msg, err := publishing(message)
+	if err != nil {
+		return err
 	}
 
 	return r.Channel.PublishWithContext(ctx,
@@ -129,6 +223,89 @@ func (r *RabbitMQ) PublishMessage(ctx context.Context, exchange, routingKey stri
 	)
 }
 
+// PublishConfirmed publishes a message and waits for the broker to confirm
+// it, i.e. to have routed it to its queues and written it to disk where
+// they are durable. It fails with ErrUnroutable when no queue is bound to
+// receive the message, and when the broker rejects it or ctx ends first;
+// the message may have been published then all the same.
+func (r *RabbitMQ) PublishConfirmed(ctx context.Context, exchange, routingKey string, message contracts.AmqpMessage) error {
+	log.Printf("Publishing message with routing key: %s", routingKey)
+
+	msg, err := publishing(message)
+	if err != nil {
+		return err
+	}
+
+	r.confirmMu.Lock()
+	defer r.confirmMu.Unlock()
+	if r.confirmed == nil || r.confirmed.IsClosed() {
+		if err := r.openConfirmed(); err != nil {
+			return err
+		}
+	}
+
+	confirmation, err := r.confirmed.PublishWithDeferredConfirmWithContext(ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		true,       // mandatory
+		false,      // immediate
+		msg,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %v", err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// a channel of its own for the next message, so that the return of
+		// this one is not taken for it
+		r.confirmed.Close()
+		r.confirmed = nil
+		return fmt.Errorf("failed to wait for confirmation: %w", err)
+	}
+	// the broker returns an unroutable message before it confirms it, and
+	// one message at a time is in flight
+	select {
+	case ret, ok := <-r.returns:
+		if ok {
+			return fmt.Errorf("%w: %s", ErrUnroutable, ret.ReplyText)
+		}
+	default:
+	}
+	if !acked {
+		return errors.New("message rejected by the broker")
+	}
+	return nil
+}
+
+// openConfirmed opens the channel of PublishConfirmed. It is called with
+// confirmMu held.
+func (r *RabbitMQ) openConfirmed() error {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to create channel: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to put channel in confirm mode: %v", err)
+	}
+	r.confirmed = ch
+	r.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	return nil
+}
+
+func publishing(message contracts.AmqpMessage) (amqp.Publishing, error) {
+	jsonMsg, err := json.Marshal(message)
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	return amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "application/json",
+		Body:         jsonMsg,
+	}, nil
+}
+
 func (r *RabbitMQ) Close() {
 	if r.conn != nil {
 		r.conn.Close()
@@ -147,8 +324,38 @@ func (r *RabbitMQ) SetupAppTopology() error {
 		return err
 	}
 
-	if err := r.declareAndBind(DataGenerationQueue, ProjectsExchange, contracts.ProjectCreatedRoutingKey); err != nil {
-		return err
+	for _, key := range []string{
+		contracts.ProjectCreatedRoutingKey,
+		contracts.GenerationShardRoutingKey,
+		contracts.GenerationAssembleRoutingKey,
+	} {
+		if err := r.declareAndBind(DataGenerationQueue, ProjectsExchange, key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range []string{
+		contracts.GenerationPlannedRoutingKey,
+		contracts.GenerationShardDoneRoutingKey,
+		contracts.GenerationAssembledRoutingKey,
+	} {
+		if err := r.declareAndBind(GenerationCoordinatorQueue, ProjectsExchange, key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range []string{
+		contracts.GenerationStartedRoutingKey,
+		contracts.GenerationProgressRoutingKey,
+		contracts.GenerationCompletedRoutingKey,
+		contracts.GenerationFailedRoutingKey,
+		contracts.ProjectInstructionsInterpretedRoutingKey,
+		contracts.ProjectGeneratorsChosenRoutingKey,
+		contracts.ProjectSandboxReadyRoutingKey,
+	} {
+		if err := r.declareAndBind(GenerationStatusQueue, ProjectsExchange, key); err != nil {
+			return err
+		}
 	}
 
 	log.Println("RabbitMQ application topology setup complete.")
@@ -0,0 +1,320 @@
+// Package rules defines the structured form of generation instructions, a
+// YAML or JSON document with per-table and per-column rules:
+//
+//	version: 1
+//	nullRatio: 0.1
+//	tables:
+//	  users:
+//	    rows: 50000
+//	    columns:
+//	      country:
+//	        values: [PL, DE, US]
+//	        weights: [60, 30, 10]
+//	      phone:
+//	        nullRatio: 0.05
+//	        pattern: '\+48 [1-9]\d{8}'
+//	      age:
+//	        min: 18
+//	        max: 90
+//	        distribution: {type: normal, mean: 35, stddev: 12}
+//	    rules:
+//	      - signed_up_at > born_at
+//	  orders:
+//	    columns:
+//	      customer_id:
+//	        distribution: {type: hotspot, hot: 0.01, share: 0.5}
+//
+// Instructions that are not a mapping with a version or tables key are
+// kept as free text.
+package rules
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the only rules format version so far.
+const Version = 1
+
+type Rules struct {
+	Version int `yaml:"version" json:"version"`
+	// NullRatio is the share of NULLs in nullable columns without a
+	// nullRatio of their own.
+	NullRatio *float64 `yaml:"nullRatio,omitempty" json:"nullRatio,omitempty"`
+	// Defaults is keep to leave columns with a DEFAULT to the database, the
+	// default, or generate to draw their values like for other columns.
+	Defaults string            `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	Tables   map[string]*Table `yaml:"tables" json:"tables"`
+}
+
+// Values of Rules.Defaults.
+const (
+	KeepDefaults     = "keep"
+	GenerateDefaults = "generate"
+)
+
+type Table struct {
+	// Rows is the row count of the table, unless the request sets one.
+	Rows    int64              `yaml:"rows,omitempty" json:"rows,omitempty"`
+	Columns map[string]*Column `yaml:"columns,omitempty" json:"columns,omitempty"`
+	// Rules are SQL boolean expressions every row has to satisfy, written
+	// like CHECK constraints.
+	Rules []string `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+type Column struct {
+	// Generator names a value generator instead of the one picked from the
+	// column type.
+	Generator string `yaml:"generator,omitempty" json:"generator,omitempty"`
+	// Values is a fixed list to pick from, with optional relative Weights.
+	Values  []any     `yaml:"values,omitempty" json:"values,omitempty"`
+	Weights []float64 `yaml:"weights,omitempty" json:"weights,omitempty"`
+	// NullRatio is the share of rows in which the column is NULL.
+	NullRatio *float64 `yaml:"nullRatio,omitempty" json:"nullRatio,omitempty"`
+	// Pattern is a regular expression generated text must match.
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	// Min and Max bound numeric and date values, both inclusive.
+	Min          any           `yaml:"min,omitempty" json:"min,omitempty"`
+	Max          any           `yaml:"max,omitempty" json:"max,omitempty"`
+	Distribution *Distribution `yaml:"distribution,omitempty" json:"distribution,omitempty"`
+}
+
+// Distribution shapes numeric and date values, or for foreign key columns
+// how often each parent row is referenced. Parameters are in the units of
+// the column: its values for numbers, days for dates and parent row
+// positions for foreign keys.
+type Distribution struct {
+	// Type is one of uniform, normal, lognormal, exponential, zipf, hotspot
+	// or histogram.
+	Type   string  `yaml:"type" json:"type"`
+	Mean   float64 `yaml:"mean,omitempty" json:"mean,omitempty"`
+	StdDev float64 `yaml:"stddev,omitempty" json:"stddev,omitempty"`
+	// Rate is the rate of an exponential distribution.
+	Rate float64 `yaml:"rate,omitempty" json:"rate,omitempty"`
+	// Exponent is the s parameter of a Zipf distribution, greater than 1.
+	Exponent float64 `yaml:"exponent,omitempty" json:"exponent,omitempty"`
+	// Hot is the share of the range that receives Share of the values in a
+	// hotspot distribution, e.g. 1% of customers placing 50% of orders.
+	Hot     float64  `yaml:"hot,omitempty" json:"hot,omitempty"`
+	Share   float64  `yaml:"share,omitempty" json:"share,omitempty"`
+	Buckets []Bucket `yaml:"buckets,omitempty" json:"buckets,omitempty"`
+}
+
+// Bucket is one histogram bar covering [Min, Max].
+type Bucket struct {
+	Min    any     `yaml:"min" json:"min"`
+	Max    any     `yaml:"max" json:"max"`
+	Weight float64 `yaml:"weight" json:"weight"`
+}
+
+// Parse reads generation instructions. It returns nil rules and no error
+// when the instructions are free text.
+func Parse(instructions string) (*Rules, error) {
+	if strings.TrimSpace(instructions) == "" {
+		return nil, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(instructions), &doc); err != nil || !structured(&doc) {
+		// not YAML, or YAML that only happens to parse, like "note: ..."
+		return nil, nil
+	}
+	root := doc.Content[0]
+
+	if err := checkFields(root, ""); err != nil {
+		return nil, Errors{err}
+	}
+
+	var r Rules
+	if err := root.Decode(&r); err != nil {
+		return nil, Errors{&Error{Msg: strings.TrimPrefix(err.Error(), "yaml: ")}}
+	}
+	if errs := r.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return &r, nil
+}
+
+func structured(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false
+	}
+	m := doc.Content[0]
+	for i := 0; i < len(m.Content); i += 2 {
+		if k := m.Content[i].Value; k == "version" || k == "tables" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the rules for problems that do not need the schema.
+func (r *Rules) Validate() Errors {
+	var errs Errors
+	add := func(path, format string, args ...any) {
+		errs = append(errs, &Error{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if r.Version != Version {
+		add("version", "must be %d, got %d", Version, r.Version)
+	}
+	if len(r.Tables) == 0 {
+		add("tables", "at least one table is required")
+	}
+	if r.NullRatio != nil && (*r.NullRatio < 0 || *r.NullRatio > 1) {
+		add("nullRatio", "must be between 0 and 1, got %g", *r.NullRatio)
+	}
+	switch r.Defaults {
+	case "", KeepDefaults, GenerateDefaults:
+	default:
+		add("defaults", "must be %s or %s, got %q", KeepDefaults, GenerateDefaults, r.Defaults)
+	}
+
+	for _, name := range sortedKeys(r.Tables) {
+		t := r.Tables[name]
+		path := "tables." + name
+		if t == nil {
+			add(path, "must be a mapping")
+			continue
+		}
+		if t.Rows < 0 {
+			add(path+".rows", "must be greater than 0, got %d", t.Rows)
+		}
+		for i, rule := range t.Rules {
+			if strings.TrimSpace(rule) == "" {
+				add(fmt.Sprintf("%s.rules[%d]", path, i), "must not be empty")
+			}
+		}
+		for _, col := range sortedKeys(t.Columns) {
+			c := t.Columns[col]
+			if c == nil {
+				add(path+".columns."+col, "must be a mapping")
+				continue
+			}
+			errs = append(errs, c.validate(path+".columns."+col)...)
+		}
+	}
+	return errs
+}
+
+func (c *Column) validate(path string) Errors {
+	var errs Errors
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &Error{Path: path + field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	sources := 0
+	for _, set := range []bool{c.Generator != "", len(c.Values) > 0, c.Pattern != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		add("", "generator, values and pattern are mutually exclusive")
+	}
+
+	if len(c.Weights) > 0 {
+		if len(c.Weights) != len(c.Values) {
+			add(".weights", "has %d entries, but values has %d", len(c.Weights), len(c.Values))
+		}
+		total := 0.0
+		for i, w := range c.Weights {
+			if w < 0 {
+				add(fmt.Sprintf(".weights[%d]", i), "must not be negative, got %g", w)
+			}
+			total += w
+		}
+		if total <= 0 {
+			add(".weights", "must add up to more than 0")
+		}
+	}
+	for i, v := range c.Values {
+		switch v.(type) {
+		case nil, bool, int, int64, uint64, float64, string, time.Time:
+		default:
+			add(fmt.Sprintf(".values[%d]", i), "must be a scalar")
+		}
+	}
+
+	if c.NullRatio != nil && (*c.NullRatio < 0 || *c.NullRatio > 1) {
+		add(".nullRatio", "must be between 0 and 1, got %g", *c.NullRatio)
+	}
+	if c.Pattern != "" {
+		if _, err := syntax.Parse(c.Pattern, syntax.Perl); err != nil {
+			add(".pattern", "invalid regular expression: %v", err)
+		}
+	}
+	if c.Min != nil && !scalar(c.Min) {
+		add(".min", "must be a number or a date")
+	}
+	if c.Max != nil && !scalar(c.Max) {
+		add(".max", "must be a number or a date")
+	}
+	if c.Distribution != nil {
+		errs = append(errs, c.Distribution.validate(path+".distribution")...)
+	}
+	return errs
+}
+
+func (d *Distribution) validate(path string) Errors {
+	var errs Errors
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &Error{Path: path + field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	switch d.Type {
+	case "uniform":
+	case "normal", "lognormal":
+		if d.StdDev <= 0 {
+			add(".stddev", "must be greater than 0")
+		}
+		if d.Type == "lognormal" && d.Mean <= 0 {
+			add(".mean", "must be greater than 0")
+		}
+	case "exponential":
+		if d.Rate <= 0 {
+			add(".rate", "must be greater than 0")
+		}
+	case "zipf":
+		if d.Exponent <= 1 {
+			add(".exponent", "must be greater than 1")
+		}
+	case "hotspot":
+		if d.Hot <= 0 || d.Hot >= 1 {
+			add(".hot", "must be between 0 and 1, exclusive")
+		}
+		if d.Share <= 0 || d.Share > 1 {
+			add(".share", "must be greater than 0 and at most 1")
+		}
+	case "histogram":
+		if len(d.Buckets) == 0 {
+			add(".buckets", "at least one bucket is required")
+		}
+		for i, b := range d.Buckets {
+			p := fmt.Sprintf(".buckets[%d]", i)
+			if !scalar(b.Min) || !scalar(b.Max) {
+				add(p, "min and max must be numbers or dates")
+			}
+			if b.Weight <= 0 {
+				add(p+".weight", "must be greater than 0")
+			}
+		}
+	case "":
+		add(".type", "is required")
+	default:
+		add(".type", "unknown distribution %q, expected uniform, normal, lognormal, exponential, zipf, hotspot or histogram", d.Type)
+	}
+	return errs
+}
+
+func scalar(v any) bool {
+	switch v.(type) {
+	case int, int64, uint64, float64, string, time.Time:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationsLock is the key of the advisory lock held while migrating, so
+// that replicas starting together apply every migration once.
+const migrationsLock = 7266913
+
+// migrationFile matches the files of a migration, e.g. 0001_create_jobs.up.sql
+// and 0001_create_jobs.down.sql.
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change to the schema, with the SQL that applies
+// it and the SQL that reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies the migrations of a service to its database. Every
+// service records the versions it applied in the schema_migrations table
+// under its own name, so services sharing a database migrate independently.
+type Migrator struct {
+	db         *sql.DB
+	service    string
+	migrations []Migration
+}
+
+// NewMigrator reads the migrations of a service from the .sql files in dir
+// of fsys, usually an embed.FS.
+func NewMigrator(db *sql.DB, service string, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, service: service, migrations: migrations}, nil
+}
+
+// LoadMigrations reads the migrations in dir of fsys, ordered by version.
+// Every migration needs an up file; one without a down file cannot be
+// reverted.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.<up|down>.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, m[2], version)
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the migrations not applied yet, in order, and returns how many
+// it applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn, versions map[int64]bool) error {
+		for _, migration := range m.migrations {
+			if versions[migration.Version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps migrations applied, latest first, and returns
+// how many it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn, versions map[int64]bool) error {
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if !versions[migration.Version] {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+			if err := m.apply(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the migrations of the service and whether each is applied.
+func (m *Migrator) Status(ctx context.Context) ([]Migration, map[int64]bool, error) {
+	var applied map[int64]bool
+	err := m.locked(ctx, func(_ *sql.Conn, versions map[int64]bool) error {
+		applied = versions
+		return nil
+	})
+	return m.migrations, applied, err
+}
+
+// locked runs fn holding the migrations lock on a connection of its own,
+// with the versions of the service applied so far.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, versions map[int64]bool) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationsLock); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer func() {
+		// the lock goes with the connection if it cannot be released
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationsLock); err != nil {
+			log.Printf("Failed to unlock migrations: %v", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	service    text        NOT NULL,
+	version    bigint      NOT NULL,
+	name       text        NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (service, version)
+)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations WHERE service = $1`, m.service)
+	if err != nil {
+		return fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	versions := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		versions[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+
+	return fn(conn, versions)
+}
+
+// apply runs the SQL of a migration and records it as applied, or no longer
+// applied, in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, query string, up bool) error {
+	direction, done := "revert", "reverted"
+	if up {
+		direction, done = "apply", "applied"
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to %s migration %d_%s: %w", direction, migration.Version, migration.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (service, version, name) VALUES ($1, $2, $3)`,
+			m.service, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE service = $1 AND version = $2`,
+			m.service, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	log.Printf("Migration %d_%s of %s %s", migration.Version, migration.Name, m.service, done)
+	return nil
+}
+
+// RunMigrateCommand runs the migrate subcommand of a service:
+//
+//	migrate [up]     applies the migrations not applied yet
+//	migrate down [n] reverts the last n migrations, 1 by default
+//	migrate status   lists the migrations and whether each is applied
+func RunMigrateCommand(ctx context.Context, m *Migrator, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "up":
+		if len(args) > 0 {
+			return errors.New("usage: migrate up")
+		}
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migrations of %s", n, m.service)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			return errors.New("usage: migrate down [steps]")
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[0])
+			}
+			steps = n
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migrations of %s", n, m.service)
+	case "status":
+		if len(args) > 0 {
+			return errors.New("usage: migrate status")
+		}
+		migrations, applied, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if applied[migration.Version] {
+				state = "applied"
+			}
+			fmt.Printf("%d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+	return nil
+}
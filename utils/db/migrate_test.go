@@ -0,0 +1,92 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []Migration
+		err   string
+	}{
+		{
+			name: "ordered by version",
+			files: map[string]string{
+				"10_later.up.sql":    "SELECT 10",
+				"2_add.up.sql":       "SELECT 2",
+				"2_add.down.sql":     "SELECT -2",
+				"0001_init.up.sql":   "SELECT 1",
+				"0001_init.down.sql": "SELECT -1",
+			},
+			want: []Migration{
+				{Version: 1, Name: "init", Up: "SELECT 1", Down: "SELECT -1"},
+				{Version: 2, Name: "add", Up: "SELECT 2", Down: "SELECT -2"},
+				{Version: 10, Name: "later", Up: "SELECT 10"},
+			},
+		},
+		{
+			name: "other files skipped",
+			files: map[string]string{
+				"0001_init.up.sql":  "SELECT 1",
+				"README.md":         "notes",
+				"old/0002_x.up.sql": "SELECT 2",
+			},
+			want: []Migration{{Version: 1, Name: "init", Up: "SELECT 1"}},
+		},
+		{
+			name:  "none",
+			files: map[string]string{"README.md": "notes"},
+			want:  []Migration{},
+		},
+		{
+			name:  "down without up",
+			files: map[string]string{"0001_init.down.sql": "SELECT -1"},
+			err:   "has no up file",
+		},
+		{
+			name: "shared version",
+			files: map[string]string{
+				"0001_init.up.sql":  "SELECT 1",
+				"0001_other.up.sql": "SELECT 1",
+			},
+			err: "share version 1",
+		},
+		{
+			name:  "badly named",
+			files: map[string]string{"init.sql": "SELECT 1"},
+			err:   "is not named",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, data := range tt.files {
+				fsys["migrations/"+name] = &fstest.MapFile{Data: []byte(data)}
+			}
+			migrations, err := LoadMigrations(fsys, "migrations")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMigrations: %v", err)
+			}
+			if !reflect.DeepEqual(migrations, tt.want) {
+				t.Errorf("got %+v, want %+v", migrations, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsMissingDir(t *testing.T) {
+	if _, err := LoadMigrations(fstest.MapFS{}, "migrations"); err == nil {
+		t.Fatal("LoadMigrations succeeded without the directory")
+	}
+}
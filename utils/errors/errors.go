@@ -21,3 +21,8 @@ func NotFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("not found error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
 	json.WriteJSONError(w, http.StatusNotFound, "not found")
 }
+
+func ConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("conflict error: %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+	json.WriteJSONError(w, http.StatusConflict, err.Error())
+}